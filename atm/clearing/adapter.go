@@ -0,0 +1,106 @@
+package clearing
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	"main/domain"
+)
+
+type iso20022Adapter struct {
+	requestTopic string
+	statusTopic  string
+}
+
+// NewISO20022Adapter will create an object that represent the domain.ClearingAdapter interface.
+// Credit transfers are sent as pacs.008 to requestTopic, the pacs.002 reports come back on statusTopic.
+func NewISO20022Adapter(requestTopic, statusTopic string) domain.ClearingAdapter {
+	return &iso20022Adapter{
+		requestTopic: requestTopic,
+		statusTopic:  statusTopic,
+	}
+}
+
+// CreditTransfer writes it as a pacs.008 keyed by the debtor account, so the transfers of an
+// account reach the clearing house in order
+func (a *iso20022Adapter) CreditTransfer(it *domain.InterbankTransfer) (ev domain.OutboxEvent, err error) {
+	debtorAgent, err := BIC(it.DebtorBank)
+	if err != nil {
+		return ev, err
+	}
+
+	creditorAgent, err := BIC(it.CreditorBank)
+	if err != nil {
+		return ev, err
+	}
+
+	doc := pacs008Document{
+		Xmlns: pacs008Namespace,
+		Msg: pacs008CdtTrfMsg{
+			GrpHdr: pacs008GrpHdr{
+				MsgId:    it.MessageId,
+				CreDtTm:  it.SentAt.Format(isoDateTime),
+				NbOfTxs:  1,
+				SttlmMtd: "CLRG",
+			},
+			CdtTrfTxInf: []pacs008CdtTrf{{
+				InstrId:        it.MessageId,
+				EndToEndId:     it.EndToEndId,
+				TxId:           it.EndToEndId,
+				IntrBkSttlmAmt: isoAmount{Ccy: domain.DefaultCurrency, Value: it.Amount.String()},
+				IntrBkSttlmDt:  it.SentAt.Format(isoDate),
+				ChrgBr:         "SLEV",
+				InstgAgt:       debtorAgent,
+				InstdAgt:       creditorAgent,
+				DbtrAcct:       it.DebtorAccount,
+				DbtrAgt:        debtorAgent,
+				CdtrAgt:        creditorAgent,
+				CdtrAcct:       it.CreditorAccount,
+			}},
+		},
+	}
+
+	body, err := marshalDocument(doc)
+	if err != nil {
+		return ev, err
+	}
+
+	return domain.OutboxEvent{
+		Topic:       a.requestTopic,
+		Key:         it.DebtorAccount,
+		ContentType: ContentType,
+		Payload:     string(body),
+	}, nil
+}
+
+func (a *iso20022Adapter) StatusTopic() string {
+	return a.statusTopic
+}
+
+// PaymentStatus reads a pacs.002 reporting on a single credit transfer
+func (a *iso20022Adapter) PaymentStatus(message *domain.Message) (status domain.PaymentStatus, err error) {
+	var doc pacs002Document
+	if err = xml.Unmarshal(message.Value, &doc); err != nil {
+		return status, fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+
+	if len(doc.Msg.TxInfAndSts) != 1 {
+		return status, ErrMalformedMessage
+	}
+
+	tx := doc.Msg.TxInfAndSts[0]
+	status = domain.PaymentStatus{
+		OriginalMessageId:  doc.Msg.OrgnlGrpInfAndSts.OrgnlMsgId,
+		OriginalEndToEndId: tx.OrgnlEndToEndId,
+		Status:             tx.TxSts,
+	}
+	if tx.StsRsnInf != nil {
+		status.ReasonCode, status.ReasonText = tx.StsRsnInf.Cd, tx.StsRsnInf.AddtlInf
+	}
+
+	if status.OriginalEndToEndId == "" || status.Status == "" {
+		return status, ErrMalformedMessage
+	}
+
+	return status, nil
+}
@@ -0,0 +1,143 @@
+package clearing
+
+import (
+	"encoding/xml"
+	"errors"
+)
+
+const (
+	pacs008Namespace = "urn:iso:std:iso:20022:tech:xsd:pacs.008.001.08"
+	pacs002Namespace = "urn:iso:std:iso:20022:tech:xsd:pacs.002.001.10"
+	pacs008Name      = "pacs.008.001.08"
+	isoDateTime      = "2006-01-02T15:04:05"
+	isoDate          = "2006-01-02"
+
+	// ContentType is set on every message to and from the clearing house
+	ContentType = "application/xml"
+)
+
+var (
+	ErrMalformedMessage = errors.New("malformed ISO 20022 message")
+	ErrUnknownBank      = errors.New("bank has no BIC")
+)
+
+// bics are the BICs of the banks that Account.Bank names
+var bics = map[string]string{
+	"KBANK": "KASITHBK",
+	"KTB":   "KRTHTHBK",
+	"SCB":   "SICOTHBK",
+	"BAY":   "AYUDTHBK",
+	"TMB":   "TMBKTHBK",
+	"GSB":   "GSBATHBK",
+	"TBANK": "THBKTHBK",
+	"TISCO": "TFPCTHB1",
+	"BBL":   "BKKBTHBK",
+	"UOB":   "UOVBTHBK",
+}
+
+// BIC returns the BIC of bank
+func BIC(bank string) (string, error) {
+	bic, ok := bics[bank]
+	if !ok {
+		return "", ErrUnknownBank
+	}
+	return bic, nil
+}
+
+// Bank returns the bank that bic belongs to, empty when it is no member of the clearing house
+func Bank(bic string) string {
+	for bank, b := range bics {
+		if b == bic {
+			return bank
+		}
+	}
+	return ""
+}
+
+// pacs008Document is an ISO 20022 pacs.008.001.08 FI to FI customer credit transfer
+type pacs008Document struct {
+	XMLName xml.Name         `xml:"Document"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Msg     pacs008CdtTrfMsg `xml:"FIToFICstmrCdtTrf"`
+}
+
+type pacs008CdtTrfMsg struct {
+	GrpHdr      pacs008GrpHdr   `xml:"GrpHdr"`
+	CdtTrfTxInf []pacs008CdtTrf `xml:"CdtTrfTxInf"`
+}
+
+type pacs008GrpHdr struct {
+	MsgId    string `xml:"MsgId"`
+	CreDtTm  string `xml:"CreDtTm"`
+	NbOfTxs  int    `xml:"NbOfTxs"`
+	SttlmMtd string `xml:"SttlmInf>SttlmMtd"`
+}
+
+type pacs008CdtTrf struct {
+	InstrId        string    `xml:"PmtId>InstrId"`
+	EndToEndId     string    `xml:"PmtId>EndToEndId"`
+	TxId           string    `xml:"PmtId>TxId"`
+	IntrBkSttlmAmt isoAmount `xml:"IntrBkSttlmAmt"`
+	IntrBkSttlmDt  string    `xml:"IntrBkSttlmDt"`
+	ChrgBr         string    `xml:"ChrgBr"`
+	InstgAgt       string    `xml:"InstgAgt>FinInstnId>BICFI"`
+	InstdAgt       string    `xml:"InstdAgt>FinInstnId>BICFI"`
+	Dbtr           isoParty  `xml:"Dbtr"`
+	DbtrAcct       string    `xml:"DbtrAcct>Id>Othr>Id"`
+	DbtrAgt        string    `xml:"DbtrAgt>FinInstnId>BICFI"`
+	CdtrAgt        string    `xml:"CdtrAgt>FinInstnId>BICFI"`
+	Cdtr           isoParty  `xml:"Cdtr"`
+	CdtrAcct       string    `xml:"CdtrAcct>Id>Othr>Id"`
+}
+
+type isoAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type isoParty struct {
+	Nm string `xml:"Nm,omitempty"`
+}
+
+// pacs002Document is an ISO 20022 pacs.002.001.10 FI to FI payment status report
+type pacs002Document struct {
+	XMLName xml.Name         `xml:"Document"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Msg     pacs002StsRptMsg `xml:"FIToFIPmtStsRpt"`
+}
+
+type pacs002StsRptMsg struct {
+	GrpHdr            pacs002GrpHdr     `xml:"GrpHdr"`
+	OrgnlGrpInfAndSts pacs002OrgnlGrp   `xml:"OrgnlGrpInfAndSts"`
+	TxInfAndSts       []pacs002TxStatus `xml:"TxInfAndSts"`
+}
+
+type pacs002GrpHdr struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type pacs002OrgnlGrp struct {
+	OrgnlMsgId   string `xml:"OrgnlMsgId"`
+	OrgnlMsgNmId string `xml:"OrgnlMsgNmId"`
+}
+
+type pacs002TxStatus struct {
+	OrgnlEndToEndId string            `xml:"OrgnlEndToEndId"`
+	OrgnlTxId       string            `xml:"OrgnlTxId"`
+	TxSts           string            `xml:"TxSts"`
+	StsRsnInf       *pacs002StsReason `xml:"StsRsnInf,omitempty"`
+}
+
+type pacs002StsReason struct {
+	Cd       string `xml:"Rsn>Cd"`
+	AddtlInf string `xml:"AddtlInf,omitempty"`
+}
+
+func marshalDocument(doc interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
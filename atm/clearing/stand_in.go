@@ -0,0 +1,167 @@
+package clearing
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"main/domain"
+	"main/kafka/codec"
+)
+
+// StandInRules are what the stand-in clearing house rejects a credit transfer for, on top of
+// malformed amounts, unknown banks and account numbers failing their check digit
+type StandInRules struct {
+	// MaxAmount is the largest amount accepted, zero for no limit
+	MaxAmount domain.Money
+	// ClosedAccounts are creditor accounts the receiving bank reports as closed
+	ClosedAccounts []string
+}
+
+// StandInClearingHouse plays the clearing house and the receiving banks behind it, so interbank
+// transfers run end to end without a connection to a real one. Every pacs.008 is answered with a
+// pacs.002 that settles or rejects it at once. A receiver whose account is held here is credited
+// through receiver before the transfer is reported settled.
+type StandInClearingHouse struct {
+	publisher   domain.EventPublisher
+	receiver    domain.TransactionUsecase
+	statusTopic string
+	rules       StandInRules
+}
+
+// NewStandInClearingHouse answers on statusTopic through publisher
+func NewStandInClearingHouse(publisher domain.EventPublisher, receiver domain.TransactionUsecase, statusTopic string, rules StandInRules) *StandInClearingHouse {
+	return &StandInClearingHouse{
+		publisher:   publisher,
+		receiver:    receiver,
+		statusTopic: statusTopic,
+		rules:       rules,
+	}
+}
+
+// Handle is the consumer of the credit transfer topic. The report keeps the key of the request,
+// so the reports of an account come back in order.
+func (h *StandInClearingHouse) Handle(ctx context.Context, message *domain.Message) error {
+	var doc pacs008Document
+	if err := xml.Unmarshal(message.Value, &doc); err != nil {
+		return domain.Permanent(fmt.Errorf("%w: %v", ErrMalformedMessage, err))
+	}
+
+	now := time.Now()
+	report := pacs002Document{
+		Xmlns: pacs002Namespace,
+		Msg: pacs002StsRptMsg{
+			GrpHdr: pacs002GrpHdr{
+				MsgId:   "STS" + doc.Msg.GrpHdr.MsgId,
+				CreDtTm: now.Format(isoDateTime),
+			},
+			OrgnlGrpInfAndSts: pacs002OrgnlGrp{
+				OrgnlMsgId:   doc.Msg.GrpHdr.MsgId,
+				OrgnlMsgNmId: pacs008Name,
+			},
+		},
+	}
+
+	for _, tx := range doc.Msg.CdtTrfTxInf {
+		status := pacs002TxStatus{
+			OrgnlEndToEndId: tx.EndToEndId,
+			OrgnlTxId:       tx.TxId,
+			TxSts:           domain.PaymentAccepted,
+		}
+
+		code, info := h.check(tx)
+		if code == "" {
+			var err error
+			if code, info, err = h.credit(ctx, tx); err != nil {
+				return err
+			}
+		}
+
+		if code != "" {
+			status.TxSts = domain.PaymentRejected
+			status.StsRsnInf = &pacs002StsReason{Cd: code, AddtlInf: info}
+		}
+
+		report.Msg.TxInfAndSts = append(report.Msg.TxInfAndSts, status)
+	}
+
+	body, err := marshalDocument(report)
+	if err != nil {
+		return err
+	}
+
+	return h.publisher.Publish(h.statusTopic, message.Key, map[string]string{codec.ContentTypeHeader: ContentType}, body)
+}
+
+// check returns the ISO 20022 reason code and text a transfer is rejected for, an empty code
+// when it settles
+func (h *StandInClearingHouse) check(tx pacs008CdtTrf) (code string, info string) {
+	if tx.IntrBkSttlmAmt.Ccy != domain.DefaultCurrency {
+		return "AM03", "currency not accepted"
+	}
+
+	amount, err := domain.ParseMoney(tx.IntrBkSttlmAmt.Value)
+	if err != nil || !amount.IsPositive() {
+		return "AM12", "invalid amount"
+	}
+
+	if h.rules.MaxAmount.IsPositive() {
+		if amount.Cmp(h.rules.MaxAmount) > 0 {
+			return "AM02", "amount above the clearing limit"
+		}
+	}
+
+	if Bank(tx.CdtrAgt) == "" {
+		return "RC01", "creditor agent is no member"
+	}
+
+	if !validAccountNo(tx.CdtrAcct) {
+		return "AC01", "incorrect creditor account number"
+	}
+
+	for _, closed := range h.rules.ClosedAccounts {
+		if closed == tx.CdtrAcct {
+			return "AC04", "creditor account closed"
+		}
+	}
+
+	return "", ""
+}
+
+// credit pays the transfer out as the receiving bank, a receiver held elsewhere is left to its
+// own bank. A transfer sent again is only paid once.
+func (h *StandInClearingHouse) credit(ctx context.Context, tx pacs008CdtTrf) (code string, info string, err error) {
+	err = h.receiver.ReceiveInterbankTransfer(ctx, tx.EndToEndId)
+	switch err {
+	case nil, domain.ErrResipientNotFound:
+		return "", "", nil
+	case domain.ErrAccDeleted:
+		return "AC04", "creditor account closed", nil
+	case domain.ErrClearingRejected:
+		return domain.PaymentTimedOut, "transfer returned before it was received", nil
+	case domain.ErrInterbankTransferNotFound:
+		return "", "", domain.Permanent(err)
+	}
+	return "", "", err
+}
+
+// validAccountNo checks the ten digits of an account number, the last is the sum of the others modulo 10
+func validAccountNo(accountNo string) bool {
+	if len(accountNo) != 10 {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < 10; i++ {
+		d := accountNo[i]
+		if d < '0' || d > '9' {
+			return false
+		}
+		if i < 9 {
+			sum += int(d - '0')
+		}
+	}
+
+	return sum%10 == int(accountNo[9]-'0')
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -14,8 +15,21 @@ import (
 
 // ResponseError represent the response error struct
 type ResponseError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
+	Limit   *domain.LimitError `json:"limit,omitempty"`
+}
+
+// newResponseError adds which limit was hit and the headroom left when err is a limit error
+func newResponseError(err error) ResponseError {
+	res := ResponseError{Message: err.Error()}
+
+	var limitErr *domain.LimitError
+	if errors.As(err, &limitErr) {
+		res.Limit = limitErr
+	}
+
+	return res
 }
 
 // AccountHandler  represent the httphandler for account
@@ -159,7 +173,7 @@ func (a *AccountHandler) CloseAccount(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, domain.ErrNotFound.Error())
 	}
 
-	sender := string(idP)
+	sender := strconv.Itoa(idP)
 	ctx := c.Request().Context()
 
 	err = a.AUsecase.DeleteAccount(ctx, sender)
@@ -176,13 +190,24 @@ func getStatusCode(err error) int {
 	}
 
 	logrus.Error(err)
+	if errors.Is(err, domain.ErrLimitExceeded) {
+		return http.StatusUnprocessableEntity
+	}
+
 	switch err {
 	case domain.ErrInternalServerError:
 		return http.StatusInternalServerError
-	case domain.ErrNotFound:
+	case domain.ErrNotFound, domain.ErrTransactionNotFound, domain.ErrFeeRuleNotFound, domain.ErrLimitNotFound, domain.ErrScheduleNotFound,
+		domain.ErrDeadLetterNotFound, domain.ErrProxyNotFound, domain.ErrCardlessNotFound, domain.ErrTerminalNotFound:
 		return http.StatusNotFound
-	case domain.ErrConflict:
+	case domain.ErrConflict, domain.ErrAlreadyReversed, domain.ErrInvalidStatusTransition, domain.ErrScheduleNotActive,
+		domain.ErrDeadLetterNotPending, domain.ErrDeadLetterRedacted, domain.ErrProxyTaken, domain.ErrTerminalUnavailable:
 		return http.StatusConflict
+	case domain.ErrBadParamInput, domain.ErrInvalidReversal, domain.ErrInvalidFeeRule, domain.ErrInvalidLimit,
+		domain.ErrFeeRuleTransactionType, domain.ErrInvalidSchedule, domain.ErrInvalidTimezone, domain.ErrInvalidProxy, domain.ErrInvalidOtp,
+		domain.ErrProxyNotVerifiable, domain.ErrInvalidQR, domain.ErrQRChecksum, domain.ErrInvalidCardlessCode,
+		domain.ErrInvalidTerminal, domain.ErrWrongPin, domain.ErrCannotDispense, domain.ErrInvalidCashOperation:
+		return http.StatusBadRequest
 	default:
 		return http.StatusInternalServerError
 	}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"main/atm/delivery/http/middleware"
+	"main/domain"
+)
+
+// CardlessWithdrawalHandler  represent the httphandler for cardless ATM withdrawals
+type CardlessWithdrawalHandler struct {
+	TrUsecase domain.TransactionUsecase
+}
+
+// NewCardlessWithdrawalHandler will initialize the cardless withdrawal resources endpoint. Customers
+// start a withdrawal on the app, ATM terminals redeem its code through terminalAuth.
+func NewCardlessWithdrawalHandler(e *echo.Echo, us domain.TransactionUsecase, iu domain.IdempotencyUsecase, terminalAuth echo.MiddlewareFunc) {
+	handler := &CardlessWithdrawalHandler{
+		TrUsecase: us,
+	}
+
+	restrictedGroup := e.Group("/users/accounts", middleware.CustomJWTMiddleware)
+	restrictedGroup.POST("/:account_no/cardless-withdrawal", handler.CreateCardlessWithdrawal)
+
+	terminalGroup := e.Group("/terminals", terminalAuth, middleware.NewIdempotencyMiddleware(iu))
+	terminalGroup.POST("/cardless-withdrawal/redeem", handler.RedeemCardlessWithdrawal)
+}
+
+// CreateCardlessWithdrawal answers with the one-time code, it is not shown again
+func (h *CardlessWithdrawalHandler) CreateCardlessWithdrawal(c echo.Context) (err error) {
+	var req domain.CardlessWithdrawalRequest
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	uuid := c.Get("tel").(string)
+	ctx := c.Request().Context()
+
+	w, err := h.TrUsecase.CreateCardlessWithdrawal(ctx, uuid, c.Param("account_no"), req)
+	if err != nil {
+		return c.JSON(getStatusCode(err), newResponseError(err))
+	}
+
+	return c.JSON(http.StatusCreated, w)
+}
+
+func (h *CardlessWithdrawalHandler) RedeemCardlessWithdrawal(c echo.Context) (err error) {
+	var req domain.CardlessRedemption
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	terminalId := c.Get("terminal_id").(string)
+	ctx := c.Request().Context()
+
+	transaction, err := h.TrUsecase.RedeemCardlessWithdrawal(ctx, terminalId, req)
+	if err != nil {
+		return c.JSON(getStatusCode(err), newResponseError(err))
+	}
+
+	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Withdraw successfully", Body: transaction})
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"main/domain"
+)
+
+// DeadLetterHandler  represent the httphandler for messages that failed every retry
+type DeadLetterHandler struct {
+	DUsecase domain.DeadLetterUsecase
+}
+
+// NewDeadLetterHandler will initialize the admin dead-letters/ resources endpoint
+func NewDeadLetterHandler(e *echo.Echo, du domain.DeadLetterUsecase, adminAuth echo.MiddlewareFunc) {
+	handler := &DeadLetterHandler{
+		DUsecase: du,
+	}
+
+	adminGroup := e.Group("/admin", adminAuth)
+	adminGroup.GET("/dead-letters", handler.GetDeadLetters)
+	adminGroup.GET("/dead-letters/stats", handler.GetDeadLetterStats)
+	adminGroup.GET("/dead-letters/:id", handler.GetDeadLetterByID)
+	adminGroup.PUT("/dead-letters/:id", handler.UpdateDeadLetter)
+	adminGroup.POST("/dead-letters/:id/replay", handler.ReplayDeadLetter)
+	adminGroup.POST("/dead-letters/:id/discard", handler.DiscardDeadLetter)
+	// the expvar gauges, dead_letters_pending among them
+	adminGroup.GET("/metrics", echo.WrapHandler(expvar.Handler()))
+}
+
+// GetDeadLetters lists dead letters newest first, narrowed with ?topic=, ?status= and ?limit=
+func (d *DeadLetterHandler) GetDeadLetters(c echo.Context) error {
+	filter := domain.DeadLetterFilter{
+		Topic:  c.QueryParam("topic"),
+		Status: c.QueryParam("status"),
+	}
+	filter.Limit, _ = strconv.Atoi(c.QueryParam("limit"))
+
+	ctx := c.Request().Context()
+
+	letters, err := d.DUsecase.GetDeadLetters(ctx, filter)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, letters)
+}
+
+// GetDeadLetterStats reports how many dead letters of each topic are still pending
+func (d *DeadLetterHandler) GetDeadLetterStats(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	stats, err := d.DUsecase.GetDeadLetterStats(ctx)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+func (d *DeadLetterHandler) GetDeadLetterByID(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrDeadLetterNotFound.Error()})
+	}
+
+	ctx := c.Request().Context()
+
+	dl, err := d.DUsecase.GetDeadLetterByID(ctx, id)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, dl)
+}
+
+// UpdateDeadLetter edits the key, payload (base64) or headers of a pending dead letter
+func (d *DeadLetterHandler) UpdateDeadLetter(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrDeadLetterNotFound.Error()})
+	}
+
+	var edit domain.DeadLetterEdit
+	if err = c.Bind(&edit); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	ctx := c.Request().Context()
+
+	dl, err := d.DUsecase.UpdateDeadLetter(ctx, id, edit)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, dl)
+}
+
+// ReplayDeadLetter sends a pending dead letter back to the topic it failed on
+func (d *DeadLetterHandler) ReplayDeadLetter(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrDeadLetterNotFound.Error()})
+	}
+
+	ctx := c.Request().Context()
+
+	dl, err := d.DUsecase.ReplayDeadLetter(ctx, id)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, dl)
+}
+
+// DiscardDeadLetter gives up on a pending dead letter, it is kept for the record
+func (d *DeadLetterHandler) DiscardDeadLetter(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrDeadLetterNotFound.Error()})
+	}
+
+	ctx := c.Request().Context()
+
+	dl, err := d.DUsecase.DiscardDeadLetter(ctx, id)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, dl)
+}
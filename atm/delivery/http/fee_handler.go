@@ -0,0 +1,96 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"main/domain"
+)
+
+// FeeHandler  represent the httphandler for fee rules
+type FeeHandler struct {
+	FUsecase domain.FeeUsecase
+}
+
+// NewFeeHandler will initialize the admin fee-rules/ resources endpoint
+func NewFeeHandler(e *echo.Echo, fu domain.FeeUsecase, adminAuth echo.MiddlewareFunc) {
+	handler := &FeeHandler{
+		FUsecase: fu,
+	}
+
+	adminGroup := e.Group("/admin/fee-rules", adminAuth)
+	adminGroup.GET("", handler.GetRules)
+	adminGroup.POST("", handler.CreateRule)
+	adminGroup.GET("/:rule_key", handler.GetRuleVersions)
+	adminGroup.DELETE("/:rule_key", handler.ExpireRule)
+}
+
+// GetRules lists the rules in force now, or at ?at= (RFC3339)
+func (f *FeeHandler) GetRules(c echo.Context) error {
+	at := time.Now()
+	if value := c.QueryParam("at"); value != "" {
+		t, _, err := parseDateParam(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid at: " + value})
+		}
+		at = t
+	}
+
+	ctx := c.Request().Context()
+
+	rules, err := f.FUsecase.GetRules(ctx, at)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, rules)
+}
+
+func (f *FeeHandler) GetRuleVersions(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	rules, err := f.FUsecase.GetRuleVersions(ctx, c.Param("rule_key"))
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, rules)
+}
+
+// CreateRule publishes a new version of the rule named by rule_key
+func (f *FeeHandler) CreateRule(c echo.Context) (err error) {
+	var rule domain.FeeRule
+	if err = c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	ctx := c.Request().Context()
+
+	if err = f.FUsecase.CreateRule(ctx, &rule); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// ExpireRule ends the current version now, or at ?at=
+func (f *FeeHandler) ExpireRule(c echo.Context) error {
+	at := time.Now()
+	if value := c.QueryParam("at"); value != "" {
+		t, _, err := parseDateParam(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid at: " + value})
+		}
+		at = t
+	}
+
+	ctx := c.Request().Context()
+
+	if err := f.FUsecase.ExpireRule(ctx, c.Param("rule_key"), at); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"main/atm/delivery/http/middleware"
+	"main/domain"
+)
+
+// LedgerHandler  represent the httphandler for ledger
+type LedgerHandler struct {
+	LUsecase domain.LedgerUsecase
+}
+
+// NewLedgerHandler will initialize the ledger resources endpoint, users only see the ledger of their own accounts
+func NewLedgerHandler(e *echo.Echo, lu domain.LedgerUsecase) {
+	handler := &LedgerHandler{
+		LUsecase: lu,
+	}
+
+	restrictedGroup := e.Group("/users/accounts", middleware.CustomJWTMiddleware)
+	restrictedGroup.GET("/:account_no/ledger", handler.GetLedgerByAccountNo)
+}
+
+func (l *LedgerHandler) GetLedgerByAccountNo(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+	numS := c.QueryParam("num")
+	num, _ := strconv.Atoi(numS)
+	cursor := c.QueryParam("cursor")
+	account_no := c.Param("account_no")
+
+	ctx := c.Request().Context()
+
+	entries, nextCursor, err := l.LUsecase.GetLedgerByAccountNo(ctx, uuid, account_no, cursor, int64(num))
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	c.Response().Header().Set(`X-Cursor`, nextCursor)
+	return c.JSON(http.StatusOK, entries)
+}
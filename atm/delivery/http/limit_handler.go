@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"main/domain"
+)
+
+// LimitHandler  represent the httphandler for transaction limits
+type LimitHandler struct {
+	LUsecase domain.LimitUsecase
+}
+
+// NewLimitHandler will initialize the admin limits/ resources endpoint
+func NewLimitHandler(e *echo.Echo, lu domain.LimitUsecase, adminAuth echo.MiddlewareFunc) {
+	handler := &LimitHandler{
+		LUsecase: lu,
+	}
+
+	adminGroup := e.Group("/admin", adminAuth)
+	adminGroup.GET("/limits", handler.GetLimits)
+	adminGroup.PUT("/limits", handler.SaveLimit)
+	adminGroup.DELETE("/limits/:id", handler.DeleteLimit)
+	adminGroup.GET("/accounts/:account_no/limits", handler.GetEffectiveLimits)
+}
+
+// GetLimits lists the limits of one level with ?scope= and ?scope_ref=, or all of them
+func (l *LimitHandler) GetLimits(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	limits, err := l.LUsecase.GetLimits(ctx, c.QueryParam("scope"), c.QueryParam("scope_ref"))
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, limits)
+}
+
+// GetEffectiveLimits lists the limits that apply to the account after overrides
+func (l *LimitHandler) GetEffectiveLimits(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	limits, err := l.LUsecase.GetEffectiveLimits(ctx, c.Param("account_no"))
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, limits)
+}
+
+// SaveLimit sets the limit of a level, transaction type and kind, replacing the current one
+func (l *LimitHandler) SaveLimit(c echo.Context) (err error) {
+	var limit domain.Limit
+	if err = c.Bind(&limit); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	limit.Id = 0
+
+	ctx := c.Request().Context()
+
+	if err = l.LUsecase.SaveLimit(ctx, &limit); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, limit)
+}
+
+// DeleteLimit removes a limit so the level below applies again
+func (l *LimitHandler) DeleteLimit(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrLimitNotFound.Error()})
+	}
+
+	ctx := c.Request().Context()
+
+	if err = l.LUsecase.DeleteLimit(ctx, id); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const AdminKeyHeader = "X-Admin-Key"
+
+// AdminKey is the key of one back-office operator, as admin.keys lists them
+type AdminKey struct {
+	Operator string `mapstructure:"operator"`
+	Key      string `mapstructure:"key"`
+}
+
+// NewAdminMiddleware only lets through back-office requests carrying the key of an operator, the
+// operator is set as "operator" for the handlers. Entries without an operator or a key are left out.
+func NewAdminMiddleware(adminKeys []AdminKey) echo.MiddlewareFunc {
+	keys := make([]AdminKey, 0, len(adminKeys))
+	for _, k := range adminKeys {
+		if k.Operator != "" && k.Key != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := []byte(c.Request().Header.Get(AdminKeyHeader))
+
+			// every key is compared, so the time taken does not tell which one matched
+			operator := ""
+			for _, k := range keys {
+				if subtle.ConstantTimeCompare(key, []byte(k.Key)) == 1 {
+					operator = k.Operator
+				}
+			}
+			if operator == "" {
+				return c.String(http.StatusUnauthorized, "Unauthorized")
+			}
+
+			c.Set("operator", operator)
+			return next(c)
+		}
+	}
+}
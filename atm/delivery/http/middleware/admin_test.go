@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	auth := NewAdminMiddleware([]AdminKey{
+		{Operator: "somchai", Key: "key-1"},
+		{Operator: "malee", Key: "key-2"},
+		{Operator: "nobody", Key: ""},
+	})
+
+	tests := []struct {
+		key      string
+		operator string
+	}{
+		{"key-1", "somchai"},
+		{"key-2", "malee"},
+		{"key-3", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/admin/terminals/ATM-0001/balancings", nil)
+		req.Header.Set(AdminKeyHeader, tt.key)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		var operator interface{}
+		_ = auth(func(c echo.Context) error {
+			operator = c.Get("operator")
+			return c.NoContent(http.StatusOK)
+		})(c)
+
+		want := http.StatusOK
+		if tt.operator == "" {
+			want = http.StatusUnauthorized
+		}
+		if rec.Code != want {
+			t.Errorf("key %q: got %d, want %d", tt.key, rec.Code, want)
+		}
+		if tt.operator != "" && operator != tt.operator {
+			t.Errorf("key %q: operator is %v, want %s", tt.key, operator, tt.operator)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"main/atm/utils"
+	"main/domain"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// NewIdempotencyMiddleware replays the stored response of a request that is retried with the same
+// Idempotency-Key header, so the operation behind it runs at most once per key and user.
+func NewIdempotencyMiddleware(iu domain.IdempotencyUsecase) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(IdempotencyKeyHeader)
+			if key == "" || c.Request().Method != http.MethodPost {
+				return next(c)
+			}
+
+			body := []byte(utils.UnmarshalRequestBody(c.Request()))
+			requestHash := hashRequest(c.Request(), body)
+			scope := idempotencyScope(c)
+			ctx := domain.WithCommitTracking(c.Request().Context())
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			record, err := iu.Begin(ctx, scope, key, requestHash)
+			switch err {
+			case nil:
+			case domain.ErrIdempotencyKeyReused:
+				return c.JSON(http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+			case domain.ErrIdempotencyInProgress:
+				return c.JSON(http.StatusConflict, map[string]string{"message": err.Error()})
+			default:
+				return err
+			}
+
+			if record != nil {
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(record.StatusCode, echo.MIMEApplicationJSONCharsetUTF8, record.Body)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			// write errors out here so the response we store is the one the client sees
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError && !domain.MayHaveCommitted(ctx) {
+				// nothing was committed, let the client retry with the same key
+				if err := iu.Release(ctx, scope, key); err != nil {
+					logrus.Error(err)
+				}
+				return nil
+			}
+
+			// a failure after a commit started is kept, retrying it could move the money twice
+			if err := iu.Complete(ctx, scope, key, requestHash, status, recorder.body.Bytes()); err != nil {
+				logrus.Error(err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// idempotencyScope is the authenticated user or ATM terminal. Anonymous requests share one scope,
+// so their key alone picks the record and reusing it with another request is refused. A stored
+// response is only replayed to the very same request.
+func idempotencyScope(c echo.Context) string {
+	if tel, ok := c.Get("tel").(string); ok && tel != "" {
+		return tel
+	}
+
+	if terminalId, ok := c.Get("terminal_id").(string); ok && terminalId != "" {
+		return "terminal:" + terminalId
+	}
+
+	return "anonymous"
+}
+
+// hashRequest fingerprints the request, ignoring JSON key order and whitespace
+func hashRequest(req *http.Request, body []byte) string {
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		if canonical, err := json.Marshal(payload); err == nil {
+			body = canonical
+		}
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s %s\n%s", req.Method, req.URL.Path, body)))
+	return fmt.Sprintf("%x", sum)
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
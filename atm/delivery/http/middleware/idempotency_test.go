@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"main/domain"
+)
+
+type fakeIdempotency struct {
+	scope     string
+	completed bool
+	released  bool
+	// hashes are the requests that began, by scope and key
+	hashes map[string]string
+}
+
+func (f *fakeIdempotency) Begin(ctx context.Context, scope string, key string, requestHash string) (*domain.IdempotencyRecord, error) {
+	f.scope = scope
+	if f.hashes == nil {
+		f.hashes = make(map[string]string)
+	}
+
+	if hash, ok := f.hashes[scope+"|"+key]; ok && hash != requestHash {
+		return nil, domain.ErrIdempotencyKeyReused
+	}
+	f.hashes[scope+"|"+key] = requestHash
+	return nil, nil
+}
+
+func (f *fakeIdempotency) Complete(ctx context.Context, scope string, key string, requestHash string, statusCode int, body []byte) error {
+	f.completed = true
+	return nil
+}
+
+func (f *fakeIdempotency) Release(ctx context.Context, scope string, key string) error {
+	f.released = true
+	return nil
+}
+
+func serveIdempotent(iu domain.IdempotencyUsecase, handler echo.HandlerFunc) {
+	serveIdempotentBody(iu, handler, `{"account":{"account_no":"1000000001"}}`)
+}
+
+func serveIdempotentBody(iu domain.IdempotencyUsecase, handler echo.HandlerFunc, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/transaction/transfer", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	NewIdempotencyMiddleware(iu)(handler)(c)
+	return rec
+}
+
+func TestIdempotencyReleasesKeyWhenNothingCommitted(t *testing.T) {
+	iu := &fakeIdempotency{}
+	serveIdempotent(iu, func(c echo.Context) error {
+		return c.String(http.StatusInternalServerError, "down")
+	})
+
+	if !iu.released || iu.completed {
+		t.Fatalf("released = %v, completed = %v, want the key released", iu.released, iu.completed)
+	}
+}
+
+func TestIdempotencyKeepsKeyAfterCommit(t *testing.T) {
+	iu := &fakeIdempotency{}
+	serveIdempotent(iu, func(c echo.Context) error {
+		domain.MarkCommitting(c.Request().Context())
+		return c.String(http.StatusInternalServerError, "commit failed")
+	})
+
+	if iu.released || !iu.completed {
+		t.Fatalf("released = %v, completed = %v, want the response kept", iu.released, iu.completed)
+	}
+}
+
+func TestIdempotencyScopeIgnoresRequestBody(t *testing.T) {
+	iu := &fakeIdempotency{}
+	serveIdempotent(iu, func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	if iu.scope != "anonymous" {
+		t.Fatalf("scope = %q, want one not taken from the body", iu.scope)
+	}
+}
+
+func TestIdempotencyRefusesAnonymousKeyReusedForAnotherRequest(t *testing.T) {
+	iu := &fakeIdempotency{}
+	ran := 0
+	handler := func(c echo.Context) error {
+		ran++
+		return c.NoContent(http.StatusOK)
+	}
+
+	serveIdempotentBody(iu, handler, `{"account":{"account_no":"1000000001"},"amount":"100.00"}`)
+	rec := serveIdempotentBody(iu, handler, `{"account":{"account_no":"1000000001"},"amount":"900.00"}`)
+
+	if rec.Code != http.StatusUnprocessableEntity || ran != 1 {
+		t.Fatalf("got %d after %d runs, want 422 without running again", rec.Code, ran)
+	}
+}
@@ -1,6 +1,13 @@
 package middleware
 
-import "github.com/labstack/echo/v4"
+import (
+	"github.com/labstack/echo/v4"
+
+	"main/domain"
+)
+
+// HeaderXCorrelationID carries the id that ties together the events caused by a request
+const HeaderXCorrelationID = "X-Correlation-ID"
 
 // GoMiddleware represent the data-struct for middleware
 type GoMiddleware struct {
@@ -15,6 +22,24 @@ func (m *GoMiddleware) CORS(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// Correlation puts the X-Correlation-ID of the request, or else its request id, into the request
+// context, so the events the request causes carry it
+func (m *GoMiddleware) Correlation(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Request().Header.Get(HeaderXCorrelationID)
+		if id == "" {
+			id = c.Response().Header().Get(echo.HeaderXRequestID)
+		}
+
+		if id != "" {
+			c.Response().Header().Set(HeaderXCorrelationID, id)
+			c.SetRequest(c.Request().WithContext(domain.WithCorrelationID(c.Request().Context(), id)))
+		}
+
+		return next(c)
+	}
+}
+
 // InitMiddleware initialize the middleware
 func InitMiddleware() *GoMiddleware {
 	return &GoMiddleware{}
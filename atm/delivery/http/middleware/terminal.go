@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	TerminalIdHeader  = "X-Terminal-Id"
+	TerminalKeyHeader = "X-Terminal-Key"
+)
+
+// TerminalKey is the key an ATM terminal authenticates with, as terminals.keys lists them
+type TerminalKey struct {
+	Id  string `mapstructure:"id"`
+	Key string `mapstructure:"key"`
+}
+
+// NewTerminalMiddleware only lets through ATM terminals carrying their key, the terminal id is set
+// as "terminal_id" for the handlers. Entries without an id or a key are left out.
+func NewTerminalMiddleware(terminalKeys []TerminalKey) echo.MiddlewareFunc {
+	keys := make(map[string][]byte)
+	for _, k := range terminalKeys {
+		if k.Id != "" && k.Key != "" {
+			keys[k.Id] = []byte(k.Key)
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(TerminalIdHeader)
+			key := []byte(c.Request().Header.Get(TerminalKeyHeader))
+
+			want, ok := keys[id]
+			if !ok || subtle.ConstantTimeCompare(key, want) != 1 {
+				return c.String(http.StatusUnauthorized, "Unauthorized")
+			}
+
+			c.Set("terminal_id", id)
+			return next(c)
+		}
+	}
+}
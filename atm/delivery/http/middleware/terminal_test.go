@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestTerminalMiddleware(t *testing.T) {
+	auth := NewTerminalMiddleware([]TerminalKey{
+		{Id: "ATM-0001", Key: "key-1"},
+		{Id: "ATM-0002", Key: ""},
+	})
+
+	tests := []struct {
+		name   string
+		id     string
+		key    string
+		status int
+	}{
+		{"right key", "ATM-0001", "key-1", http.StatusOK},
+		{"wrong key", "ATM-0001", "key-2", http.StatusUnauthorized},
+		{"key of another terminal", "ATM-0003", "key-1", http.StatusUnauthorized},
+		{"terminal without a key", "ATM-0002", "", http.StatusUnauthorized},
+		{"no headers", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/terminals/withdraw", nil)
+		req.Header.Set(TerminalIdHeader, tt.id)
+		req.Header.Set(TerminalKeyHeader, tt.key)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		var terminalId interface{}
+		_ = auth(func(c echo.Context) error {
+			terminalId = c.Get("terminal_id")
+			return c.NoContent(http.StatusOK)
+		})(c)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if (terminalId == tt.id) != (tt.status == http.StatusOK) {
+			t.Errorf("%s: terminal_id is %v", tt.name, terminalId)
+		}
+	}
+}
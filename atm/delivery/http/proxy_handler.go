@@ -0,0 +1,97 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"main/atm/delivery/http/middleware"
+	"main/domain"
+)
+
+// ProxyHandler  represent the httphandler for PromptPay proxies
+type ProxyHandler struct {
+	PUsecase domain.ProxyUsecase
+}
+
+// NewProxyHandler will initialize the users/proxies resources endpoint. Changes take an otp
+// requested with /users/send-otp, see domain.ProxyRequest for the phone it goes to.
+func NewProxyHandler(e *echo.Echo, pu domain.ProxyUsecase) {
+	handler := &ProxyHandler{
+		PUsecase: pu,
+	}
+
+	proxyGroup := e.Group("/users/proxies", middleware.CustomJWTMiddleware)
+	proxyGroup.GET("", handler.GetProxies)
+	proxyGroup.POST("", handler.RegisterProxy)
+	proxyGroup.PUT("/:type/:value", handler.ChangeProxy)
+	proxyGroup.DELETE("/:type/:value", handler.DeregisterProxy)
+}
+
+func (p *ProxyHandler) GetProxies(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+	ctx := c.Request().Context()
+
+	proxies, err := p.PUsecase.GetProxies(ctx, uuid)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, proxies)
+}
+
+// RegisterProxy links the phone proxy in the body to account_no, other types are refused with
+// domain.ErrProxyNotVerifiable
+func (p *ProxyHandler) RegisterProxy(c echo.Context) (err error) {
+	var req domain.ProxyRequest
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	uuid := c.Get("tel").(string)
+	ctx := c.Request().Context()
+
+	proxy, err := p.PUsecase.RegisterProxy(ctx, uuid, req)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, proxy)
+}
+
+// ChangeProxy moves the proxy to the account_no in the body
+func (p *ProxyHandler) ChangeProxy(c echo.Context) (err error) {
+	var req domain.ProxyRequest
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	req.Type, req.Value = c.Param("type"), c.Param("value")
+
+	uuid := c.Get("tel").(string)
+	ctx := c.Request().Context()
+
+	proxy, err := p.PUsecase.ChangeProxy(ctx, uuid, req)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, proxy)
+}
+
+// DeregisterProxy removes the proxy, the otp comes in the body
+func (p *ProxyHandler) DeregisterProxy(c echo.Context) (err error) {
+	var req domain.ProxyRequest
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	req.Type, req.Value = c.Param("type"), c.Param("value")
+
+	uuid := c.Get("tel").(string)
+	ctx := c.Request().Context()
+
+	if err = p.PUsecase.DeregisterProxy(ctx, uuid, req); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
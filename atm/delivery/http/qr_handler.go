@@ -0,0 +1,90 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"main/atm/delivery/http/middleware"
+	"main/domain"
+)
+
+// QRHandler  represent the httphandler for Thai QR payment codes
+type QRHandler struct {
+	QUsecase domain.QRUsecase
+}
+
+// qrTransferRequest is a transfer request with the scanned payload in place of the receiver
+type qrTransferRequest struct {
+	domain.Transaction
+	Payload string `json:"payload"`
+}
+
+// NewQRHandler will initialize the qr resources endpoint
+func NewQRHandler(e *echo.Echo, qu domain.QRUsecase, iu domain.IdempotencyUsecase) {
+	handler := &QRHandler{
+		QUsecase: qu,
+	}
+
+	middL := middleware.InitMiddleware()
+
+	restrictedGroup := e.Group("/users/accounts", middleware.CustomJWTMiddleware)
+	restrictedGroup.GET("/:account_no/qr", handler.GetReceiveQR)
+
+	// the user is known before the idempotency middleware, so keys are scoped to the user
+	userTransactionGroup := e.Group("/transaction", middL.RateLimitMiddlewareForTransaction, middleware.CustomJWTMiddleware, middleware.NewIdempotencyMiddleware(iu))
+	userTransactionGroup.POST("/transfer/qr", handler.TransferByQR)
+}
+
+// GetReceiveQR answers with the payload and the PNG in base64, or only the PNG for format=png.
+// Without amount the code is static and the payer enters the amount.
+func (q *QRHandler) GetReceiveQR(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+
+	var amount *domain.Money
+	if value := c.QueryParam("amount"); value != "" {
+		m, err := domain.ParseMoney(value)
+		if err != nil || !m.IsPositive() {
+			return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid amount"})
+		}
+		amount = &m
+	}
+
+	ctx := c.Request().Context()
+
+	code, err := q.QUsecase.GetReceiveQR(ctx, uuid, c.Param("account_no"), amount)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	if c.QueryParam("format") == "png" {
+		return c.Blob(http.StatusOK, "image/png", code.Image)
+	}
+
+	return c.JSON(http.StatusOK, code)
+}
+
+// TransferByQR pays what the scanned payload asks for from an account of the user
+func (q *QRHandler) TransferByQR(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+
+	var req qrTransferRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	clearServerFields(&req.Transaction)
+
+	if req.Payload == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+	}
+
+	ctx := c.Request().Context()
+	req.SubmittedAt = time.Now()
+
+	if err := q.QUsecase.TransferByQR(ctx, uuid, &req.Transaction, req.Payload); err != nil {
+		return c.JSON(getStatusCode(err), newResponseError(err))
+	}
+
+	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Transfer successfully", Body: &req.Transaction})
+}
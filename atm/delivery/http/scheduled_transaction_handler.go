@@ -0,0 +1,83 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"main/domain"
+)
+
+func (a *TransactionHandler) GetScheduledTransactions(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+
+	ctx := c.Request().Context()
+
+	schedules, err := a.TrUsecase.GetScheduledTransactions(ctx, uuid)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, schedules)
+}
+
+// GetScheduledTransactionByID returns the schedule with the outcome of each run
+func (a *TransactionHandler) GetScheduledTransactionByID(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrScheduleNotFound.Error()})
+	}
+
+	ctx := c.Request().Context()
+
+	schedule, err := a.TrUsecase.GetScheduledTransactionByID(ctx, uuid, id)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateScheduledTransaction replaces the amount and timing of the schedule
+func (a *TransactionHandler) UpdateScheduledTransaction(c echo.Context) (err error) {
+	uuid := c.Get("tel").(string)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrScheduleNotFound.Error()})
+	}
+
+	var schedule domain.ScheduledTransaction
+	if err = c.Bind(&schedule); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	schedule.Id = id
+
+	ctx := c.Request().Context()
+
+	if err = a.TrUsecase.UpdateScheduledTransaction(ctx, uuid, &schedule); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
+func (a *TransactionHandler) CancelScheduledTransaction(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrScheduleNotFound.Error()})
+	}
+
+	ctx := c.Request().Context()
+
+	if err = a.TrUsecase.CancelScheduledTransaction(ctx, uuid, id); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"main/atm/delivery/http/middleware"
+	"main/atm/statement"
+	"main/domain"
+)
+
+// StatementHandler  represent the httphandler for account statements
+type StatementHandler struct {
+	SUsecase domain.StatementUsecase
+}
+
+// NewStatementHandler will initialize the statement resources endpoint
+func NewStatementHandler(e *echo.Echo, su domain.StatementUsecase) {
+	handler := &StatementHandler{
+		SUsecase: su,
+	}
+
+	restrictedGroup := e.Group("/users/accounts", middleware.CustomJWTMiddleware)
+	restrictedGroup.GET("/:account_no/statement", handler.GetStatement)
+}
+
+func (s *StatementHandler) GetStatement(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+	account_no := c.Param("account_no")
+	format := c.QueryParam("format")
+
+	from, _, err := parseDateParam(c.QueryParam("from"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid from"})
+	}
+
+	to, isDate, err := parseDateParam(c.QueryParam("to"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: "invalid to"})
+	}
+	if isDate {
+		to = to.AddDate(0, 0, 1)
+	}
+
+	ctx := c.Request().Context()
+
+	st, err := s.SUsecase.GetStatement(ctx, uuid, account_no, from, to)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	rendered, err := statement.Render(format, st)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.%s", account_no, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"), rendered.Extension)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	return c.Blob(http.StatusOK, rendered.ContentType, rendered.Body)
+}
@@ -0,0 +1,218 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"main/atm/delivery/http/middleware"
+	"main/domain"
+)
+
+// TerminalHandler  represent the httphandler for ATM terminals
+type TerminalHandler struct {
+	TUsecase  domain.TerminalUsecase
+	TrUsecase domain.TransactionUsecase
+}
+
+// terminalWithdrawRequest is a withdraw with the PIN the card holder keyed in at the terminal
+type terminalWithdrawRequest struct {
+	domain.Transaction
+	Pin string `json:"pin"`
+}
+
+// NewTerminalHandler will initialize the terminal resources endpoint. The registry and the cash of
+// the terminals are kept by the back office, terminals withdraw and deposit through terminalAuth.
+func NewTerminalHandler(e *echo.Echo, tu domain.TerminalUsecase, us domain.TransactionUsecase, iu domain.IdempotencyUsecase, adminAuth, terminalAuth echo.MiddlewareFunc) {
+	handler := &TerminalHandler{
+		TUsecase:  tu,
+		TrUsecase: us,
+	}
+
+	adminGroup := e.Group("/admin/terminals", adminAuth)
+	adminGroup.GET("", handler.GetTerminals)
+	adminGroup.GET("/:id", handler.GetTerminal)
+	adminGroup.PUT("/:id", handler.SaveTerminal)
+	adminGroup.PUT("/:id/cassettes/:position", handler.LoadCassette)
+	adminGroup.POST("/:id/replenishments", handler.Replenish)
+	adminGroup.POST("/:id/pickups", handler.PickUp)
+	adminGroup.POST("/:id/balancings", handler.Balance)
+	adminGroup.GET("/:id/balancings", handler.GetBalancingReports)
+
+	terminalGroup := e.Group("/terminals", terminalAuth, middleware.NewIdempotencyMiddleware(iu))
+	terminalGroup.POST("/withdraw", handler.Withdraw)
+	terminalGroup.POST("/deposit", handler.Deposit)
+}
+
+func (t *TerminalHandler) GetTerminals(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	terminals, err := t.TUsecase.GetTerminals(ctx)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, terminals)
+}
+
+func (t *TerminalHandler) GetTerminal(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	terminal, err := t.TUsecase.GetTerminal(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, terminal)
+}
+
+// SaveTerminal registers the terminal in the path or changes its settings
+func (t *TerminalHandler) SaveTerminal(c echo.Context) (err error) {
+	var terminal domain.Terminal
+	if err = c.Bind(&terminal); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	terminal.Id, terminal.Cassettes = c.Param("id"), nil
+
+	ctx := c.Request().Context()
+
+	if err = t.TUsecase.SaveTerminal(ctx, &terminal); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, terminal)
+}
+
+// LoadCassette sets the denomination and the note count of a cassette slot
+func (t *TerminalHandler) LoadCassette(c echo.Context) (err error) {
+	position, err := strconv.Atoi(c.Param("position"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: domain.ErrInvalidTerminal.Error()})
+	}
+
+	var cassette domain.Cassette
+	if err = c.Bind(&cassette); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	cassette.Id, cassette.Position = 0, position
+
+	ctx := c.Request().Context()
+
+	if err = t.TUsecase.LoadCassette(ctx, c.Param("id"), &cassette); err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, cassette)
+}
+
+// Withdraw pays out a card withdrawal at the terminal once the PIN matches, the response carries
+// the notes to dispense
+func (t *TerminalHandler) Withdraw(c echo.Context) (err error) {
+	var req terminalWithdrawRequest
+
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	clearServerFields(&req.Transaction)
+
+	if req.Type != "withdraw" || len(req.Pin) != 6 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+	}
+
+	req.TerminalId = c.Get("terminal_id").(string)
+	req.SubmittedAt = time.Now()
+
+	ctx := c.Request().Context()
+
+	if err = t.TrUsecase.WithdrawWithPin(ctx, &req.Transaction, req.Pin); err != nil {
+		return c.JSON(getStatusCode(err), newResponseError(err))
+	}
+
+	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Withdraw successfully", Body: &req.Transaction})
+}
+
+// Deposit credits cash taken in at the terminal, notes lists the banknotes that make up the amount
+func (t *TerminalHandler) Deposit(c echo.Context) (err error) {
+	var transaction domain.Transaction
+
+	if err = c.Bind(&transaction); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	if transaction.Type != "deposit" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+	}
+
+	notes := transaction.Notes
+	clearServerFields(&transaction)
+	transaction.TerminalId, transaction.Notes = c.Get("terminal_id").(string), notes
+	transaction.SubmittedAt = time.Now()
+
+	ctx := c.Request().Context()
+
+	if err = t.TrUsecase.Deposit(ctx, &transaction); err != nil {
+		return c.JSON(getStatusCode(err), newResponseError(err))
+	}
+
+	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Deposit successfully", Body: &transaction})
+}
+
+// Replenish records the notes operations staff loaded into the cassettes
+func (t *TerminalHandler) Replenish(c echo.Context) error {
+	return t.moveCash(c, t.TUsecase.Replenish)
+}
+
+// PickUp records the notes operations staff took out of the cassettes or the deposit bin
+func (t *TerminalHandler) PickUp(c echo.Context) error {
+	return t.moveCash(c, t.TUsecase.PickUp)
+}
+
+func (t *TerminalHandler) moveCash(c echo.Context, move func(ctx context.Context, terminalId string, op domain.CashOperation) (*domain.Terminal, error)) error {
+	var op domain.CashOperation
+	if err := c.Bind(&op); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	op.Operator = c.Get("operator").(string)
+
+	ctx := c.Request().Context()
+
+	terminal, err := move(ctx, c.Param("id"), op)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, terminal)
+}
+
+// Balance closes the shift of the terminal, the report flags every denomination that is off and
+// the cassettes are set to the counted notes
+func (t *TerminalHandler) Balance(c echo.Context) error {
+	var req domain.BalancingRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
+	req.Operator = c.Get("operator").(string)
+
+	ctx := c.Request().Context()
+
+	report, err := t.TUsecase.Balance(ctx, c.Param("id"), req)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, report)
+}
+
+func (t *TerminalHandler) GetBalancingReports(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	reports, err := t.TUsecase.GetBalancingReports(ctx, c.Param("id"))
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, reports)
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -30,6 +31,11 @@ type TransactionResponse struct {
 	Body    *domain.Transaction `json:"body,omitempty"`
 }
 
+type ScheduledTransactionResponse struct {
+	Message string                       `json:"message"`
+	Body    *domain.ScheduledTransaction `json:"body,omitempty"`
+}
+
 // func transactionapiGroup(c echo.Context) error {
 // 	user := c.Get("user").(*jwt.Token)
 // 	claims := user.Claims.(jwt.MapClaims)
@@ -38,7 +44,7 @@ type TransactionResponse struct {
 // }
 
 // NewTransactionHandler will initialize the transactions/ resources endpoint
-func NewTransactionHandler(e *echo.Echo, us domain.TransactionUsecase, redis *redis.Client) {
+func NewTransactionHandler(e *echo.Echo, us domain.TransactionUsecase, iu domain.IdempotencyUsecase, redis *redis.Client, adminAuth echo.MiddlewareFunc) {
 	handler := &TransactionHandler{
 		TrUsecase: us,
 		redis:     redis,
@@ -46,60 +52,167 @@ func NewTransactionHandler(e *echo.Echo, us domain.TransactionUsecase, redis *re
 
 	middL := middleware.InitMiddleware()
 
-	transactionapiGroup := e.Group("/transaction", middL.RateLimitMiddlewareForTransaction)
+	transactionapiGroup := e.Group("/transaction", middL.RateLimitMiddlewareForTransaction, middleware.NewIdempotencyMiddleware(iu))
+	// the user is known before the idempotency middleware, so keys are scoped to the user
+	userTransactionGroup := e.Group("/transaction", middL.RateLimitMiddlewareForTransaction, middleware.CustomJWTMiddleware, middleware.NewIdempotencyMiddleware(iu))
+
+	restrictedGroup := e.Group("/users/accounts", middleware.CustomJWTMiddleware)
+	restrictedGroup.GET("/:account_no/transactions", handler.GetAllTransaction)
+	restrictedGroup.GET("/:account_no/transactions/:id", handler.GetTransactionByTID)
 
-	// e.GET("/transactions", handler.GetAllTransaction)
-	transactionapiGroup.POST("/deposit", handler.Deposit)
-	transactionapiGroup.POST("/withdraw", handler.Withdraw)
+	scheduleGroup := e.Group("/users/scheduled-transactions", middleware.CustomJWTMiddleware)
+	scheduleGroup.GET("", handler.GetScheduledTransactions)
+	scheduleGroup.GET("/:id", handler.GetScheduledTransactionByID)
+	scheduleGroup.PUT("/:id", handler.UpdateScheduledTransaction)
+	scheduleGroup.DELETE("/:id", handler.CancelScheduledTransaction)
+
+	// cash is withdrawn and deposited at the terminals, see NewTerminalHandler
 	transactionapiGroup.POST("/transfer", handler.Transfer)
-	transactionapiGroup.POST("/schedule", handler.ScheduledTransaction)
+	userTransactionGroup.POST("/schedule", handler.ScheduledTransaction)
+
+	adminGroup := e.Group("/transactions", adminAuth)
+	adminGroup.POST("/:id/reverse", handler.Reverse)
 }
 
 var transferRequest = "POST /transaction/transfer"
 
-func (a *TransactionHandler) Deposit(c echo.Context) (err error) {
-	var transaction domain.Transaction
-	transaction.SubmittedAt = time.Now()
+func (a *TransactionHandler) GetAllTransaction(c echo.Context) error {
+	uuid := c.Get("tel").(string)
 
-	if err = c.Bind(&transaction); err != nil {
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ResponseError{Message: err.Error()})
+	}
 
-		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	ctx := c.Request().Context()
+
+	transactions, nextCursor, err := a.TrUsecase.GetAllTransaction(ctx, uuid, filter)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
 	}
 
-	if transaction.Type != "deposit" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+	c.Response().Header().Set(`X-Cursor`, nextCursor)
+	return c.JSON(http.StatusOK, transactions)
+}
+
+func (a *TransactionHandler) GetTransactionByTID(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+
+	tid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrTransactionNotFound.Error()})
 	}
 
 	ctx := c.Request().Context()
 
-	if err = a.TrUsecase.Deposit(ctx, &transaction); err != nil {
+	transaction, err := a.TrUsecase.GetTransactionByTID(ctx, uuid, c.Param("account_no"), tid)
+	if err != nil {
 		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
 	}
 
-	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Deposit successfully", Body: &transaction})
+	return c.JSON(http.StatusOK, transaction)
 }
 
-func (a *TransactionHandler) Withdraw(c echo.Context) (err error) {
-	var transaction domain.Transaction
+func (a *TransactionHandler) Reverse(c echo.Context) (err error) {
+	tid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, ResponseError{Message: domain.ErrTransactionNotFound.Error()})
+	}
+
+	var req domain.ReversalRequest
+	if err = c.Bind(&req); err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	}
 
 	ctx := c.Request().Context()
 
-	if err = c.Bind(&transaction); err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, err.Error())
+	reversal, err := a.TrUsecase.Reverse(ctx, tid, req)
+	if err != nil {
+		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
 	}
 
-	if transaction.Type != "withdraw" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Reverse successfully", Body: reversal})
+}
+
+// parseTransactionFilter reads the history query string. from is inclusive and to is exclusive;
+// a plain date for to covers that whole day.
+func parseTransactionFilter(c echo.Context) (filter domain.TransactionFilter, err error) {
+	num, _ := strconv.Atoi(c.QueryParam("num"))
+
+	filter = domain.TransactionFilter{
+		AccountNo:    c.Param("account_no"),
+		Type:         c.QueryParam("type"),
+		Status:       c.QueryParam("status"),
+		Counterparty: c.QueryParam("counterparty"),
+		Cursor:       c.QueryParam("cursor"),
+		Num:          int64(num),
 	}
-	// ctx := c.Request().Context()
 
-	transaction.SubmittedAt = time.Now()
+	if from := c.QueryParam("from"); from != "" {
+		t, _, err := parseDateParam(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from: %s", from)
+		}
+		filter.From = &t
+	}
 
-	if err = a.TrUsecase.Withdraw(ctx, &transaction); err != nil {
-		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+	if to := c.QueryParam("to"); to != "" {
+		t, isDate, err := parseDateParam(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to: %s", to)
+		}
+		if isDate {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = &t
 	}
 
-	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Withdraw successfully", Body: &transaction})
+	if minAmount := c.QueryParam("min_amount"); minAmount != "" {
+		amount, err := domain.ParseMoney(minAmount)
+		if err != nil {
+			return filter, fmt.Errorf("invalid min_amount: %s", minAmount)
+		}
+		filter.MinAmount = &amount
+	}
+
+	if maxAmount := c.QueryParam("max_amount"); maxAmount != "" {
+		amount, err := domain.ParseMoney(maxAmount)
+		if err != nil {
+			return filter, fmt.Errorf("invalid max_amount: %s", maxAmount)
+		}
+		filter.MaxAmount = &amount
+	}
+
+	return filter, nil
+}
+
+// parseDateParam accepts RFC3339 timestamps or plain dates in local time
+func parseDateParam(value string) (t time.Time, isDate bool, err error) {
+	if t, err = time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+
+	t, err = time.ParseInLocation("2006-01-02", value, time.Local)
+	return t, true, err
+}
+
+// bindTransaction reads a transaction request, leaving what the server decides out of the client's hands
+func bindTransaction(c echo.Context, tr *domain.Transaction) error {
+	if err := c.Bind(tr); err != nil {
+		return err
+	}
+
+	clearServerFields(tr)
+	return nil
+}
+
+// clearServerFields drops what a client sent for the fields the server decides
+func clearServerFields(tr *domain.Transaction) {
+	tr.Fee, tr.Total, tr.FeeRuleId = domain.Money{}, domain.Money{}, 0
+	tr.Status, tr.FailureCode, tr.FailureReason = "", 0, ""
+	tr.ReferenceId, tr.ReversedAt, tr.RefundedAmount = 0, nil, domain.Money{}
+	tr.TerminalId, tr.Dispense, tr.Notes = "", nil, nil
+	tr.Channel = domain.ChannelATM
 }
 
 func (a *TransactionHandler) Transfer(c echo.Context) error {
@@ -108,7 +221,7 @@ func (a *TransactionHandler) Transfer(c echo.Context) error {
 
 	requestBody := utils.UnmarshalRequestBody(c.Request())
 
-	if err := c.Bind(&transaction); err != nil {
+	if err := bindTransaction(c, &transaction); err != nil {
 		return c.JSON(http.StatusUnprocessableEntity, err.Error())
 	}
 
@@ -122,7 +235,7 @@ func (a *TransactionHandler) Transfer(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Can not transfer to the same account")
 	}
 
-	if transaction.Amount <= 0 {
+	if !transaction.Amount.IsPositive() {
 		logger.Error(fmt.Sprintf("%s: Transfer amount must be positive \n %s", transferRequest, requestBody), c.Request())
 		return echo.NewHTTPError(http.StatusBadRequest, "Transfer amount must be positive")
 	}
@@ -132,13 +245,15 @@ func (a *TransactionHandler) Transfer(c echo.Context) error {
 
 	if err := a.TrUsecase.Transfer(ctx, &transaction); err != nil {
 		logger.Error(fmt.Sprintf("%s %s \n %s", transferRequest, err.Error(), requestBody), c.Request())
-		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
+		return c.JSON(getStatusCode(err), newResponseError(err))
 	}
 	// logger.Info(fmt.Sprintf("%s: stop...", transferRequest), c.Request())
 	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Transfer successfully", Body: &transaction})
 }
 
 func (a *TransactionHandler) ScheduledTransaction(c echo.Context) error {
+	uuid := c.Get("tel").(string)
+
 	var transaction domain.ScheduledTransaction
 
 	if err := c.Bind(&transaction); err != nil {
@@ -153,16 +268,16 @@ func (a *TransactionHandler) ScheduledTransaction(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Can not transfer to the same account")
 	}
 
-	if transaction.Amount <= 0 {
+	if !transaction.Amount.IsPositive() {
 		return echo.NewHTTPError(http.StatusBadRequest, "Transfer amount must be positive")
 	}
 
 	ctx := c.Request().Context()
 	transaction.SubmittedAt = time.Now()
 
-	if err := a.TrUsecase.SaveScheduledTransaction(ctx, &transaction); err != nil {
+	if err := a.TrUsecase.SaveScheduledTransaction(ctx, uuid, &transaction); err != nil {
 		return c.JSON(getStatusCode(err), ResponseError{Message: err.Error()})
 	}
 
-	return c.JSON(http.StatusCreated, TransactionResponse{Message: "Set scheduled transfer successfully", Body: nil})
+	return c.JSON(http.StatusCreated, ScheduledTransactionResponse{Message: "Set scheduled transfer successfully", Body: &transaction})
 }
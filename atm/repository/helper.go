@@ -2,12 +2,16 @@ package repository
 
 import (
 	"encoding/base64"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	// timeFormat = "2006-01-02 15:04:05" // reduce precision from RFC3339Nano as date format
 	timeFormat = "2006-01-02 15:04:05.000"
+	// keysetTimeFormat keeps the full precision of a DATETIME(6) column
+	keysetTimeFormat = "2006-01-02 15:04:05.000000"
 )
 
 // DecodeCursor will decode cursor from user for mysql
@@ -29,3 +33,47 @@ func EncodeCursor(t time.Time) string {
 
 	return base64.StdEncoding.EncodeToString([]byte(timeString))
 }
+
+// DecodeIDCursor will decode an id based cursor from user for mysql
+func DecodeIDCursor(encodedID string) (int64, error) {
+	byt, err := base64.StdEncoding.DecodeString(encodedID)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(byt), 10, 64)
+}
+
+// EncodeIDCursor will encode an id based cursor from mysql to user
+func EncodeIDCursor(id int64) string {
+	return base64.StdEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// DecodeKeysetCursor will decode a (created_at, id) cursor from user for mysql. A cursor holding
+// only a time, as handed out by EncodeCursor, gets id 0 and so still continues after that instant.
+func DecodeKeysetCursor(encoded string) (time.Time, int64, error) {
+	byt, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	timeString, idString, ok := strings.Cut(string(byt), ",")
+	if !ok {
+		t, err := time.Parse(timeFormat, timeString)
+		return t, 0, err
+	}
+
+	t, err := time.Parse(keysetTimeFormat, timeString)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	id, err := strconv.ParseInt(idString, 10, 64)
+	return t, id, err
+}
+
+// EncodeKeysetCursor will encode a (created_at, id) cursor from mysql to user, so rows sharing a
+// created_at are neither skipped nor repeated across pages
+func EncodeKeysetCursor(t time.Time, id int64) string {
+	return base64.StdEncoding.EncodeToString([]byte(t.Format(keysetTimeFormat) + "," + strconv.FormatInt(id, 10)))
+}
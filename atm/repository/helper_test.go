@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeysetCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, time.March, 1, 10, 30, 0, 123456000, time.UTC)
+
+	gotTime, gotId, err := DecodeKeysetCursor(EncodeKeysetCursor(createdAt, 42))
+	if err != nil || !gotTime.Equal(createdAt) || gotId != 42 {
+		t.Fatalf("got %v, %d, %v, want %v, 42", gotTime, gotId, err, createdAt)
+	}
+}
+
+func TestKeysetCursorAcceptsTimeCursor(t *testing.T) {
+	createdAt := time.Date(2024, time.March, 1, 10, 30, 0, 123000000, time.UTC)
+
+	gotTime, gotId, err := DecodeKeysetCursor(EncodeCursor(createdAt))
+	if err != nil || !gotTime.Equal(createdAt) || gotId != 0 {
+		t.Fatalf("got %v, %d, %v, want %v, 0", gotTime, gotId, err, createdAt)
+	}
+}
+
+func TestKeysetCursorRejectsGarbage(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "MjAyNCxhYmM=", "YWJjLDE="} {
+		if _, _, err := DecodeKeysetCursor(cursor); err == nil {
+			t.Errorf("DecodeKeysetCursor(%q) succeeded", cursor)
+		}
+	}
+}
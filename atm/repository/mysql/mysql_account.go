@@ -27,9 +27,11 @@ func NewMysqlAccountRepository(conn *sql.DB, redis *redis.Client) domain.Account
 	}
 }
 
+const accountColumns = `account_no, uuid, name, email, tel, balance, bank, status, is_closed, created_at, updated_at, segment`
+
 func (m *mysqlAccountRepository) getAllAccount(ctx context.Context, query string, args ...interface{}) (accounts []domain.Account, err error) {
 
-	rows, err := m.conn.QueryContext(ctx, query, args...)
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
 	if err != nil {
 		logrus.Error(err)
 		return nil, err
@@ -46,6 +48,7 @@ func (m *mysqlAccountRepository) getAllAccount(ctx context.Context, query string
 
 	for rows.Next() {
 		account := domain.Account{}
+		var segment sql.NullString
 
 		err = rows.Scan(
 			&account.AccountNo,
@@ -59,11 +62,17 @@ func (m *mysqlAccountRepository) getAllAccount(ctx context.Context, query string
 			&account.IsClosed,
 			&account.CreatedAt,
 			&account.UpdatedAt,
+			&segment,
 		)
 		if err != nil {
 			logrus.Error(err)
 			return accounts, err
 		}
+
+		account.Segment = segment.String
+		if account.Segment == "" {
+			account.Segment = domain.SegmentRetail
+		}
 		accounts = append(accounts, account)
 	}
 
@@ -71,7 +80,7 @@ func (m *mysqlAccountRepository) getAllAccount(ctx context.Context, query string
 }
 
 func (m *mysqlAccountRepository) GetAllAccount(ctx context.Context, cursor string, num int64) (res []domain.Account, nextCursor string, err error) {
-	query := `SELECT * FROM banking.accounts WHERE created_at > ? ORDER BY created_at LIMIT ? `
+	query := `SELECT ` + accountColumns + ` FROM banking.accounts WHERE created_at > ? ORDER BY created_at LIMIT ? `
 
 	decodedCursor, err := repository.DecodeCursor(cursor)
 	if err != nil && cursor != "" {
@@ -98,6 +107,22 @@ func (m *mysqlAccountRepository) GetAccountByAccountNo(ctx context.Context, acco
 	return &account, nil
 }
 
+// GetAccountByAccountNoForUpdate locks the account row until the surrounding unit of work ends
+func (m *mysqlAccountRepository) GetAccountByAccountNoForUpdate(ctx context.Context, account_no string) (res *domain.Account, err error) {
+	query := `SELECT ` + accountColumns + ` FROM banking.accounts WHERE account_no = ? FOR UPDATE`
+
+	list, err := m.getAllAccount(ctx, query, account_no)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	return &list[0], nil
+}
+
 func (m *mysqlAccountRepository) GetAllAccountByUuid(ctx context.Context, uuid string) (res *[]domain.Account, err error) {
 	accounts, err := m.fetchAllAccountFromDatabaseByUuid(ctx, uuid)
 	if err != nil {
@@ -179,47 +204,14 @@ func (m *mysqlAccountRepository) GetAccountFromRedisByAccountNo(ctx context.Cont
 }
 
 func (m *mysqlAccountRepository) fetchAllAccountFromDatabaseByUuid(ctx context.Context, uuid string) (accounts []domain.Account, err error) {
-	query := `SELECT * FROM banking.accounts WHERE uuid = ?`
+	query := `SELECT ` + accountColumns + ` FROM banking.accounts WHERE uuid = ?`
 
-	rows, err := m.conn.QueryContext(ctx, query, uuid)
-	if err != nil {
-		logrus.Error(err)
-		return nil, err
-	}
-
-	fmt.Println(uuid)
-
-	accounts = make([]domain.Account, 0)
-
-	for rows.Next() {
-		account := domain.Account{}
-
-		err = rows.Scan(
-			&account.AccountNo,
-			&account.Uuid,
-			&account.Name,
-			&account.Email,
-			&account.Tel,
-			&account.Balance,
-			&account.Bank,
-			&account.Status,
-			&account.IsClosed,
-			&account.CreatedAt,
-			&account.UpdatedAt,
-		)
-		if err != nil {
-			logrus.Error(err)
-			return accounts, err
-		}
-		accounts = append(accounts, account)
-	}
-
-	return accounts, nil
+	return m.getAllAccount(ctx, query, uuid)
 }
 
 func (m *mysqlAccountRepository) fetchAccountFromDatabase(ctx context.Context, account_no string) (res domain.Account, err error) {
 
-	query := `SELECT * FROM banking.accounts WHERE account_no = ?`
+	query := `SELECT ` + accountColumns + ` FROM banking.accounts WHERE account_no = ?`
 
 	list, err := m.getAllAccount(ctx, query, account_no)
 	if err != nil {
@@ -304,14 +296,9 @@ func (m *mysqlAccountRepository) DeleteAccount(ctx context.Context, account_no s
 func (m *mysqlAccountRepository) UpdateAccount(ctx context.Context, ar *domain.Account) (err error) {
 	query := `UPDATE banking.accounts set balance=?, updated_at=? WHERE account_no = ?`
 
-	stmt, err := m.conn.PrepareContext(ctx, query)
-	if err != nil {
-		return
-	}
-
 	*ar.UpdatedAt = time.Now()
 
-	res, err := stmt.ExecContext(ctx, ar.Balance, ar.UpdatedAt, ar.AccountNo)
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, ar.Balance, ar.UpdatedAt, ar.AccountNo)
 	if err != nil {
 		return
 	}
@@ -338,15 +325,3 @@ func (m *mysqlAccountRepository) UpdateAccount(ctx context.Context, ar *domain.A
 
 	return
 }
-
-// tx, err := m.conn.BeginTx(ctx, nil)
-// 	if err != nil {
-// 		return domain.Account{}, err
-// 	}
-// 	defer func() {
-// 		if err != nil {
-// 			tx.Rollback()
-// 			return
-// 		}
-// 		tx.Commit()
-// 	}()
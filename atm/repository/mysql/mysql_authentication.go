@@ -59,3 +59,25 @@ func (m *mysqlAuthenticationRepository) SaveOtpSecret(ctx context.Context, uuid
 	}
 	return err
 }
+
+func (m *mysqlAuthenticationRepository) ExpireOtpSecret(ctx context.Context, uuid string, secretKey string) error {
+	query := `UPDATE banking.users_otp SET expired_at = ? WHERE uuid = ? AND secret = ? AND expired_at > ?`
+
+	now := time.Now()
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, now, uuid, secretKey, now)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// another request used it first
+	if affected == 0 {
+		return domain.ErrInvalidOtp
+	}
+
+	return nil
+}
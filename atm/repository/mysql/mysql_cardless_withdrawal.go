@@ -0,0 +1,151 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlCardlessWithdrawalRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlCardlessWithdrawalRepository will create an object that represent the domain.CardlessWithdrawalRepository interface
+func NewMysqlCardlessWithdrawalRepository(conn *sql.DB) domain.CardlessWithdrawalRepository {
+	return &mysqlCardlessWithdrawalRepository{
+		conn: conn,
+	}
+}
+
+const cardlessWithdrawalColumns = `id, reference, account_no, uuid, amount, hold, code_hash, attempts, status, expires_at,
+			transaction_id, terminal_id, redeemed_at, created_at, updated_at`
+
+func (m *mysqlCardlessWithdrawalRepository) fetch(ctx context.Context, query string, args ...interface{}) (result []domain.CardlessWithdrawal, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	result = make([]domain.CardlessWithdrawal, 0)
+
+	for rows.Next() {
+		w := domain.CardlessWithdrawal{}
+		var transactionId sql.NullInt64
+		var terminalId sql.NullString
+		var redeemedAt sql.NullTime
+
+		err = rows.Scan(
+			&w.Id,
+			&w.Reference,
+			&w.AccountNo,
+			&w.Uuid,
+			&w.Amount,
+			&w.Hold,
+			&w.CodeHash,
+			&w.Attempts,
+			&w.Status,
+			&w.ExpiresAt,
+			&transactionId,
+			&terminalId,
+			&redeemedAt,
+			&w.CreatedAt,
+			&w.UpdatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+
+		w.TransactionId = transactionId.Int64
+		w.TerminalId = terminalId.String
+		if redeemedAt.Valid {
+			w.RedeemedAt = &redeemedAt.Time
+		}
+		result = append(result, w)
+	}
+
+	return result, rows.Err()
+}
+
+// CreateCardlessWithdrawal relies on the unique key on reference, a clash comes back as ErrConflict
+func (m *mysqlCardlessWithdrawalRepository) CreateCardlessWithdrawal(ctx context.Context, w *domain.CardlessWithdrawal) (err error) {
+	query := `INSERT INTO banking.cardless_withdrawals (reference, account_no, uuid, amount, hold, code_hash, attempts, status,
+			expires_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = w.CreatedAt
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, w.Reference, w.AccountNo, w.Uuid, w.Amount, w.Hold, w.CodeHash,
+		w.Attempts, w.Status, w.ExpiresAt, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		if isDuplicateEntryError(err) {
+			return domain.ErrConflict
+		}
+		return err
+	}
+
+	w.Id, err = res.LastInsertId()
+	return err
+}
+
+func (m *mysqlCardlessWithdrawalRepository) GetCardlessWithdrawalByReferenceForUpdate(ctx context.Context, reference string) (w domain.CardlessWithdrawal, err error) {
+	list, err := m.fetch(ctx, `SELECT `+cardlessWithdrawalColumns+` FROM banking.cardless_withdrawals WHERE reference = ? FOR UPDATE`, reference)
+	if err != nil {
+		return w, err
+	}
+
+	if len(list) == 0 {
+		return w, domain.ErrCardlessNotFound
+	}
+
+	return list[0], nil
+}
+
+func (m *mysqlCardlessWithdrawalRepository) UpdateCardlessWithdrawal(ctx context.Context, w *domain.CardlessWithdrawal) (err error) {
+	query := `UPDATE banking.cardless_withdrawals SET attempts=?, status=?, transaction_id=?, terminal_id=?, redeemed_at=?, updated_at=?
+			WHERE id = ?`
+
+	w.UpdatedAt = time.Now()
+
+	var transactionId sql.NullInt64
+	if w.TransactionId != 0 {
+		transactionId = sql.NullInt64{Int64: w.TransactionId, Valid: true}
+	}
+	var terminalId sql.NullString
+	if w.TerminalId != "" {
+		terminalId = sql.NullString{String: w.TerminalId, Valid: true}
+	}
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, w.Attempts, w.Status, transactionId, terminalId, w.RedeemedAt, w.UpdatedAt, w.Id)
+	return err
+}
+
+func (m *mysqlCardlessWithdrawalRepository) GetHeldAmount(ctx context.Context, accountNo string, now time.Time) (held domain.Money, err error) {
+	query := `SELECT COALESCE(SUM(hold), 0) FROM banking.cardless_withdrawals WHERE account_no = ? AND status = ? AND expires_at > ?`
+
+	err = getExecutor(ctx, m.conn).QueryRowContext(ctx, query, accountNo, domain.CardlessPending, now).Scan(&held)
+	return held, err
+}
+
+func (m *mysqlCardlessWithdrawalRepository) ExpireCardlessWithdrawals(ctx context.Context, now time.Time) (int64, error) {
+	query := `UPDATE banking.cardless_withdrawals SET status=?, updated_at=? WHERE status = ? AND expires_at <= ?`
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, domain.CardlessExpired, now, domain.CardlessPending, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,202 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlDeadLetterRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlDeadLetterRepository will create an object that represent the domain.DeadLetterRepository interface
+func NewMysqlDeadLetterRepository(conn *sql.DB) domain.DeadLetterRepository {
+	return &mysqlDeadLetterRepository{
+		conn: conn,
+	}
+}
+
+const deadLetterColumns = `id, topic, dlq_partition, dlq_offset, original_partition, original_offset, message_key, payload,
+			redacted, headers, error, attempts, status, failed_at, replayed_at, created_at, updated_at`
+
+func (m *mysqlDeadLetterRepository) fetch(ctx context.Context, query string, args ...interface{}) (letters []domain.DeadLetter, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	letters = make([]domain.DeadLetter, 0)
+
+	for rows.Next() {
+		dl := domain.DeadLetter{}
+		var headers []byte
+		var replayedAt sql.NullTime
+
+		err = rows.Scan(
+			&dl.Id,
+			&dl.Topic,
+			&dl.Partition,
+			&dl.Offset,
+			&dl.OriginalPartition,
+			&dl.OriginalOffset,
+			&dl.Key,
+			&dl.Payload,
+			&dl.Redacted,
+			&headers,
+			&dl.Error,
+			&dl.Attempts,
+			&dl.Status,
+			&dl.FailedAt,
+			&replayedAt,
+			&dl.CreatedAt,
+			&dl.UpdatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return letters, err
+		}
+
+		if err = json.Unmarshal(headers, &dl.Headers); err != nil {
+			logrus.Error(err)
+			return letters, err
+		}
+		if replayedAt.Valid {
+			dl.ReplayedAt = &replayedAt.Time
+		}
+		letters = append(letters, dl)
+	}
+
+	return letters, rows.Err()
+}
+
+// CreateDeadLetter relies on the unique key (topic, dlq_partition, dlq_offset), a message read
+// again after a rebalance keeps its first row
+func (m *mysqlDeadLetterRepository) CreateDeadLetter(ctx context.Context, dl *domain.DeadLetter) (err error) {
+	query := `INSERT INTO banking.dead_letters (topic, dlq_partition, dlq_offset, original_partition, original_offset,
+			message_key, payload, redacted, headers, error, attempts, status, failed_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE id=LAST_INSERT_ID(id)`
+
+	headers, err := json.Marshal(dl.Headers)
+	if err != nil {
+		return err
+	}
+
+	dl.CreatedAt = time.Now()
+	dl.UpdatedAt = dl.CreatedAt
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, dl.Topic, dl.Partition, dl.Offset, dl.OriginalPartition,
+		dl.OriginalOffset, dl.Key, dl.Payload, dl.Redacted, headers, dl.Error, dl.Attempts, dl.Status, dl.FailedAt, dl.CreatedAt, dl.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	dl.Id, err = res.LastInsertId()
+	return err
+}
+
+// GetDeadLetters lists the newest dead letters first
+func (m *mysqlDeadLetterRepository) GetDeadLetters(ctx context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error) {
+	query := `SELECT ` + deadLetterColumns + ` FROM banking.dead_letters WHERE 1=1`
+	args := []interface{}{}
+
+	if filter.Topic != "" {
+		query += ` AND topic = ?`
+		args = append(args, filter.Topic)
+	}
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	return m.fetch(ctx, query, args...)
+}
+
+func (m *mysqlDeadLetterRepository) GetDeadLetterByID(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	return m.getOne(ctx, `SELECT `+deadLetterColumns+` FROM banking.dead_letters WHERE id = ?`, id)
+}
+
+func (m *mysqlDeadLetterRepository) GetDeadLetterByIDForUpdate(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	return m.getOne(ctx, `SELECT `+deadLetterColumns+` FROM banking.dead_letters WHERE id = ? FOR UPDATE`, id)
+}
+
+func (m *mysqlDeadLetterRepository) getOne(ctx context.Context, query string, id int64) (dl domain.DeadLetter, err error) {
+	list, err := m.fetch(ctx, query, id)
+	if err != nil {
+		return dl, err
+	}
+
+	if len(list) == 0 {
+		return dl, domain.ErrDeadLetterNotFound
+	}
+
+	return list[0], nil
+}
+
+func (m *mysqlDeadLetterRepository) UpdateDeadLetter(ctx context.Context, dl *domain.DeadLetter) (err error) {
+	query := `UPDATE banking.dead_letters SET message_key=?, payload=?, headers=?, status=?, replayed_at=?, updated_at=? WHERE id = ?`
+
+	headers, err := json.Marshal(dl.Headers)
+	if err != nil {
+		return err
+	}
+
+	dl.UpdatedAt = time.Now()
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, dl.Key, dl.Payload, headers, dl.Status, dl.ReplayedAt, dl.UpdatedAt, dl.Id)
+	return err
+}
+
+// GetDeadLetterStats counts the pending and replaying dead letters of every topic
+func (m *mysqlDeadLetterRepository) GetDeadLetterStats(ctx context.Context) (stats []domain.DeadLetterStats, err error) {
+	query := `SELECT topic, COUNT(*), MIN(failed_at) FROM banking.dead_letters WHERE status IN (?, ?) GROUP BY topic ORDER BY topic`
+
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, domain.DeadLetterPending, domain.DeadLetterReplaying)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	stats = make([]domain.DeadLetterStats, 0)
+
+	for rows.Next() {
+		s := domain.DeadLetterStats{}
+		var oldest sql.NullTime
+
+		if err = rows.Scan(&s.Topic, &s.Pending, &oldest); err != nil {
+			logrus.Error(err)
+			return stats, err
+		}
+
+		if oldest.Valid {
+			s.OldestFailedAt = &oldest.Time
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
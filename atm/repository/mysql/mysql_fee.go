@@ -0,0 +1,177 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlFeeRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlFeeRepository will create an object that represent the domain.FeeRepository interface
+func NewMysqlFeeRepository(conn *sql.DB) domain.FeeRepository {
+	return &mysqlFeeRepository{
+		conn: conn,
+	}
+}
+
+const feeRuleColumns = `id, rule_key, version, transaction_type, channel, source_bank, destination_bank, bank_relation, segment,
+		min_amount, max_amount, fee_type, flat_fee, rate_bps, min_fee, max_fee, free_quota, priority, effective_from, effective_to, created_at`
+
+func (m *mysqlFeeRepository) fetch(ctx context.Context, query string, args ...interface{}) (rules []domain.FeeRule, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	rules = make([]domain.FeeRule, 0)
+
+	for rows.Next() {
+		rule := domain.FeeRule{}
+		var minAmount, maxAmount sql.NullString
+		var effectiveTo sql.NullTime
+
+		err = rows.Scan(
+			&rule.Id,
+			&rule.RuleKey,
+			&rule.Version,
+			&rule.TransactionType,
+			&rule.Channel,
+			&rule.SourceBank,
+			&rule.DestinationBank,
+			&rule.BankRelation,
+			&rule.Segment,
+			&minAmount,
+			&maxAmount,
+			&rule.FeeType,
+			&rule.FlatFee,
+			&rule.RateBps,
+			&rule.MinFee,
+			&rule.MaxFee,
+			&rule.FreeQuota,
+			&rule.Priority,
+			&rule.EffectiveFrom,
+			&effectiveTo,
+			&rule.CreatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return rules, err
+		}
+
+		if rule.MinAmount, err = parseNullMoney(minAmount); err != nil {
+			return rules, err
+		}
+		if rule.MaxAmount, err = parseNullMoney(maxAmount); err != nil {
+			return rules, err
+		}
+		if effectiveTo.Valid {
+			rule.EffectiveTo = &effectiveTo.Time
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// GetRulesEffectiveAt returns the rules in force at the given time, for every type when
+// transactionType is empty
+func (m *mysqlFeeRepository) GetRulesEffectiveAt(ctx context.Context, transactionType string, at time.Time) ([]domain.FeeRule, error) {
+	query := `SELECT ` + feeRuleColumns + ` FROM banking.fee_rules
+			WHERE effective_from <= ? AND (effective_to IS NULL OR effective_to > ?)`
+	args := []interface{}{at, at}
+
+	if transactionType != "" {
+		query += ` AND transaction_type = ?`
+		args = append(args, transactionType)
+	}
+
+	return m.fetch(ctx, query+` ORDER BY priority DESC, id`, args...)
+}
+
+func (m *mysqlFeeRepository) GetRuleVersions(ctx context.Context, rule_key string) ([]domain.FeeRule, error) {
+	query := `SELECT ` + feeRuleColumns + ` FROM banking.fee_rules WHERE rule_key = ? ORDER BY version DESC`
+
+	return m.fetch(ctx, query, rule_key)
+}
+
+// GetLatestRuleForUpdate locks the newest version of rule_key so that two admins can not both
+// publish the next version. It returns ErrFeeRuleNotFound for a new rule_key.
+func (m *mysqlFeeRepository) GetLatestRuleForUpdate(ctx context.Context, rule_key string) (*domain.FeeRule, error) {
+	query := `SELECT ` + feeRuleColumns + ` FROM banking.fee_rules WHERE rule_key = ? ORDER BY version DESC LIMIT 1 FOR UPDATE`
+
+	list, err := m.fetch(ctx, query, rule_key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, domain.ErrFeeRuleNotFound
+	}
+
+	return &list[0], nil
+}
+
+func (m *mysqlFeeRepository) CreateRule(ctx context.Context, rule *domain.FeeRule) (err error) {
+	query := `INSERT INTO banking.fee_rules
+			SET rule_key=?, version=?, transaction_type=?, channel=?, source_bank=?, destination_bank=?, bank_relation=?, segment=?,
+			min_amount=?, max_amount=?, fee_type=?, flat_fee=?, rate_bps=?, min_fee=?, max_fee=?, free_quota=?, priority=?,
+			effective_from=?, effective_to=?, created_at=?`
+
+	rule.CreatedAt = time.Now()
+
+	var minAmount, maxAmount, effectiveTo interface{}
+	if rule.MinAmount != nil {
+		minAmount = *rule.MinAmount
+	}
+	if rule.MaxAmount != nil {
+		maxAmount = *rule.MaxAmount
+	}
+	if rule.EffectiveTo != nil {
+		effectiveTo = *rule.EffectiveTo
+	}
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query,
+		rule.RuleKey, rule.Version, rule.TransactionType, rule.Channel, rule.SourceBank, rule.DestinationBank, rule.BankRelation, rule.Segment,
+		minAmount, maxAmount, rule.FeeType, rule.FlatFee, rule.RateBps, rule.MinFee, rule.MaxFee, rule.FreeQuota, rule.Priority,
+		rule.EffectiveFrom, effectiveTo, rule.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	rule.Id, err = res.LastInsertId()
+	return err
+}
+
+func (m *mysqlFeeRepository) SetRuleEffectiveTo(ctx context.Context, id int64, to time.Time) (err error) {
+	query := `UPDATE banking.fee_rules SET effective_to=? WHERE id = ?`
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, to, id)
+	return err
+}
+
+func parseNullMoney(s sql.NullString) (*domain.Money, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+
+	amount, err := domain.ParseMoney(s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
@@ -0,0 +1,135 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlInterbankTransferRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlInterbankTransferRepository will create an object that represent the domain.InterbankTransferRepository interface
+func NewMysqlInterbankTransferRepository(conn *sql.DB) domain.InterbankTransferRepository {
+	return &mysqlInterbankTransferRepository{
+		conn: conn,
+	}
+}
+
+const interbankTransferColumns = `id, transaction_id, message_id, end_to_end_id, debtor_account, debtor_bank, creditor_account,
+			creditor_bank, amount, status, reason_code, reason_text, sent_at, last_sent_at, settled_at, credited_at`
+
+func (m *mysqlInterbankTransferRepository) fetch(ctx context.Context, query string, args ...interface{}) (result []domain.InterbankTransfer, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	result = make([]domain.InterbankTransfer, 0)
+
+	for rows.Next() {
+		it := domain.InterbankTransfer{}
+		var reasonCode, reasonText sql.NullString
+		var settledAt, creditedAt sql.NullTime
+
+		err = rows.Scan(
+			&it.Id,
+			&it.TransactionId,
+			&it.MessageId,
+			&it.EndToEndId,
+			&it.DebtorAccount,
+			&it.DebtorBank,
+			&it.CreditorAccount,
+			&it.CreditorBank,
+			&it.Amount,
+			&it.Status,
+			&reasonCode,
+			&reasonText,
+			&it.SentAt,
+			&it.LastSentAt,
+			&settledAt,
+			&creditedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+
+		it.ReasonCode = reasonCode.String
+		it.ReasonText = reasonText.String
+		if settledAt.Valid {
+			it.SettledAt = &settledAt.Time
+		}
+		if creditedAt.Valid {
+			it.CreditedAt = &creditedAt.Time
+		}
+		result = append(result, it)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *mysqlInterbankTransferRepository) getOne(ctx context.Context, query string, args ...interface{}) (it domain.InterbankTransfer, err error) {
+	list, err := m.fetch(ctx, query, args...)
+	if err != nil {
+		return it, err
+	}
+
+	if len(list) == 0 {
+		return it, domain.ErrInterbankTransferNotFound
+	}
+
+	return list[0], nil
+}
+
+func (m *mysqlInterbankTransferRepository) CreateInterbankTransfer(ctx context.Context, it *domain.InterbankTransfer) (err error) {
+	query := `INSERT INTO banking.interbank_transfers (transaction_id, message_id, end_to_end_id, debtor_account, debtor_bank,
+			creditor_account, creditor_bank, amount, status, sent_at, last_sent_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, it.TransactionId, it.MessageId, it.EndToEndId, it.DebtorAccount,
+		it.DebtorBank, it.CreditorAccount, it.CreditorBank, it.Amount, it.Status, it.SentAt, it.LastSentAt)
+	if err != nil {
+		return err
+	}
+
+	it.Id, err = res.LastInsertId()
+	return err
+}
+
+func (m *mysqlInterbankTransferRepository) GetInterbankTransferByTransactionID(ctx context.Context, tid int64) (domain.InterbankTransfer, error) {
+	return m.getOne(ctx, `SELECT `+interbankTransferColumns+` FROM banking.interbank_transfers WHERE transaction_id = ?`, tid)
+}
+
+func (m *mysqlInterbankTransferRepository) GetInterbankTransferByEndToEndIDForUpdate(ctx context.Context, endToEndId string) (domain.InterbankTransfer, error) {
+	return m.getOne(ctx, `SELECT `+interbankTransferColumns+` FROM banking.interbank_transfers WHERE end_to_end_id = ? FOR UPDATE`, endToEndId)
+}
+
+func (m *mysqlInterbankTransferRepository) GetUnreportedInterbankTransfers(ctx context.Context, sentBefore time.Time, limit int) ([]domain.InterbankTransfer, error) {
+	query := `SELECT ` + interbankTransferColumns + ` FROM banking.interbank_transfers
+			WHERE status = ? AND last_sent_at < ? ORDER BY last_sent_at LIMIT ?`
+
+	return m.fetch(ctx, query, domain.InterbankSent, sentBefore, limit)
+}
+
+func (m *mysqlInterbankTransferRepository) UpdateInterbankTransfer(ctx context.Context, it *domain.InterbankTransfer) (err error) {
+	query := `UPDATE banking.interbank_transfers SET status=?, reason_code=?, reason_text=?, last_sent_at=?, settled_at=?, credited_at=?
+			WHERE id = ?`
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, it.Status, it.ReasonCode, it.ReasonText, it.LastSentAt, it.SettledAt,
+		it.CreditedAt, it.Id)
+	return err
+}
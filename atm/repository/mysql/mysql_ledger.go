@@ -0,0 +1,155 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strings"
+	"time"
+
+	"main/atm/repository"
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlLedgerRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlLedgerRepository will create an object that represent the domain.LedgerRepository interface
+func NewMysqlLedgerRepository(conn *sql.DB) domain.LedgerRepository {
+	return &mysqlLedgerRepository{
+		conn: conn,
+	}
+}
+
+func (m *mysqlLedgerRepository) fetch(ctx context.Context, query string, args ...interface{}) (entries []domain.LedgerEntry, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	entries = make([]domain.LedgerEntry, 0)
+
+	for rows.Next() {
+		entry := domain.LedgerEntry{}
+		var balanceAfter sql.NullString
+
+		err = rows.Scan(
+			&entry.Id,
+			&entry.TransactionId,
+			&entry.AccountNo,
+			&entry.Direction,
+			&entry.Amount,
+			&balanceAfter,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return entries, err
+		}
+
+		if balanceAfter.Valid {
+			balance, err := domain.ParseMoney(balanceAfter.String)
+			if err != nil {
+				logrus.Error(err)
+				return entries, err
+			}
+			entry.BalanceAfter = &balance
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (m *mysqlLedgerRepository) CreateEntries(ctx context.Context, entries []domain.LedgerEntry) (err error) {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	placeholders := make([]string, 0, len(entries))
+	args := make([]interface{}, 0, len(entries)*6)
+
+	for i := range entries {
+		entries[i].CreatedAt = now
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?)")
+		args = append(args,
+			entries[i].TransactionId,
+			entries[i].AccountNo,
+			entries[i].Direction,
+			entries[i].Amount,
+			entries[i].BalanceAfter,
+			entries[i].CreatedAt,
+		)
+	}
+
+	query := `INSERT INTO banking.ledger_entries (transaction_id, account_no, direction, amount, balance_after, created_at) VALUES ` +
+		strings.Join(placeholders, ", ")
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	// ids of a multi-row insert are consecutive from the first one
+	firstID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].Id = firstID + int64(i)
+	}
+
+	return nil
+}
+
+func (m *mysqlLedgerRepository) GetEntriesByAccountNo(ctx context.Context, account_no string, cursor string, num int64) (res []domain.LedgerEntry, nextCursor string, err error) {
+	query := `SELECT id, transaction_id, account_no, direction, amount, balance_after, created_at
+				FROM banking.ledger_entries WHERE account_no = ? AND id < ? ORDER BY id DESC LIMIT ?`
+
+	decodedCursor := int64(math.MaxInt64)
+	if cursor != "" {
+		decodedCursor, err = repository.DecodeIDCursor(cursor)
+		if err != nil {
+			return nil, "", domain.ErrBadParamInput
+		}
+	}
+
+	res, err = m.fetch(ctx, query, account_no, decodedCursor, num)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(res) == int(num) {
+		nextCursor = repository.EncodeIDCursor(res[len(res)-1].Id)
+	}
+
+	return
+}
+
+func (m *mysqlLedgerRepository) GetLastEntryByAccountNo(ctx context.Context, account_no string) (*domain.LedgerEntry, error) {
+	query := `SELECT id, transaction_id, account_no, direction, amount, balance_after, created_at
+				FROM banking.ledger_entries WHERE account_no = ? AND balance_after IS NOT NULL ORDER BY id DESC LIMIT 1`
+
+	list, err := m.fetch(ctx, query, account_no)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	return &list[0], nil
+}
@@ -0,0 +1,143 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlLimitRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlLimitRepository will create an object that represent the domain.LimitRepository interface
+func NewMysqlLimitRepository(conn *sql.DB) domain.LimitRepository {
+	return &mysqlLimitRepository{
+		conn: conn,
+	}
+}
+
+const limitColumns = `id, scope, scope_ref, transaction_type, kind, amount, count, updated_at`
+
+func (m *mysqlLimitRepository) fetch(ctx context.Context, query string, args ...interface{}) (limits []domain.Limit, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	limits = make([]domain.Limit, 0)
+
+	for rows.Next() {
+		limit := domain.Limit{}
+		var amount sql.NullString
+		var count sql.NullInt64
+
+		err = rows.Scan(
+			&limit.Id,
+			&limit.Scope,
+			&limit.ScopeRef,
+			&limit.TransactionType,
+			&limit.Kind,
+			&amount,
+			&count,
+			&limit.UpdatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return limits, err
+		}
+
+		if limit.Amount, err = parseNullMoney(amount); err != nil {
+			return limits, err
+		}
+		limit.Count = count.Int64
+		limits = append(limits, limit)
+	}
+
+	return limits, rows.Err()
+}
+
+// GetApplicableLimits returns the default limits together with those of the segment and the
+// account, for every type when transactionType is empty
+func (m *mysqlLimitRepository) GetApplicableLimits(ctx context.Context, transactionType string, segment string, account_no string) ([]domain.Limit, error) {
+	query := `SELECT ` + limitColumns + ` FROM banking.limits
+			WHERE (scope = ? OR (scope = ? AND scope_ref = ?) OR (scope = ? AND scope_ref = ?))`
+	args := []interface{}{domain.LimitScopeDefault, domain.LimitScopeProduct, segment, domain.LimitScopeAccount, account_no}
+
+	if transactionType != "" {
+		query += ` AND transaction_type = ?`
+		args = append(args, transactionType)
+	}
+
+	return m.fetch(ctx, query+` ORDER BY transaction_type, kind`, args...)
+}
+
+// GetLimits lists the limits set at one level, every level when scope is empty
+func (m *mysqlLimitRepository) GetLimits(ctx context.Context, scope string, scope_ref string) ([]domain.Limit, error) {
+	query := `SELECT ` + limitColumns + ` FROM banking.limits`
+	args := []interface{}{}
+
+	if scope != "" {
+		query += ` WHERE scope = ? AND scope_ref = ?`
+		args = append(args, scope, scope_ref)
+	}
+
+	return m.fetch(ctx, query+` ORDER BY scope, scope_ref, transaction_type, kind`, args...)
+}
+
+// UpsertLimit relies on the unique key (scope, scope_ref, transaction_type, kind)
+func (m *mysqlLimitRepository) UpsertLimit(ctx context.Context, limit *domain.Limit) (err error) {
+	query := `INSERT INTO banking.limits (scope, scope_ref, transaction_type, kind, amount, count, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE id=LAST_INSERT_ID(id), amount=VALUES(amount), count=VALUES(count), updated_at=VALUES(updated_at)`
+
+	limit.UpdatedAt = time.Now()
+
+	var amount, count interface{}
+	if limit.Amount != nil {
+		amount = *limit.Amount
+	}
+	if limit.Count != 0 {
+		count = limit.Count
+	}
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, limit.Scope, limit.ScopeRef, limit.TransactionType, limit.Kind, amount, count, limit.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	limit.Id, err = res.LastInsertId()
+	return err
+}
+
+func (m *mysqlLimitRepository) DeleteLimit(ctx context.Context, id int64) (err error) {
+	query := `DELETE FROM banking.limits WHERE id = ?`
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected != 1 {
+		return domain.ErrLimitNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlOutboxRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlOutboxRepository will create an object that represent the domain.OutboxRepository interface
+func NewMysqlOutboxRepository(conn *sql.DB) domain.OutboxRepository {
+	return &mysqlOutboxRepository{
+		conn: conn,
+	}
+}
+
+// CreateEvent joins the unit of work in ctx, so the event commits with the change it announces
+func (m *mysqlOutboxRepository) CreateEvent(ctx context.Context, ev *domain.OutboxEvent) (err error) {
+	query := `INSERT INTO banking.outbox_events SET topic=?, event_key=?, content_type=?, payload=?, attempts=?, next_attempt_at=?, last_error=?, created_at=?`
+
+	ev.CreatedAt = time.Now()
+	ev.NextAttemptAt = ev.CreatedAt
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, ev.Topic, ev.Key, ev.ContentType, ev.Payload, ev.Attempts, ev.NextAttemptAt, ev.LastError, ev.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	ev.Id, err = res.LastInsertId()
+	return err
+}
+
+// ClaimEvents has to run in a unit of work, the events stay locked until it ends and are held by
+// their next_attempt_at from then on
+func (m *mysqlOutboxRepository) ClaimEvents(ctx context.Context, now time.Time, until time.Time, limit int) (events []domain.OutboxEvent, err error) {
+	query := `SELECT e.id, e.topic, e.event_key, e.content_type, e.payload, e.attempts, e.next_attempt_at, e.last_error, e.created_at
+			FROM banking.outbox_events e
+			WHERE e.published_at IS NULL AND e.parked_at IS NULL AND e.next_attempt_at <= ?
+			AND NOT EXISTS (SELECT 1 FROM banking.outbox_events p
+				WHERE p.event_key = e.event_key AND p.id < e.id AND p.published_at IS NULL AND p.parked_at IS NULL)
+			ORDER BY e.id LIMIT ? FOR UPDATE OF e SKIP LOCKED`
+
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, now, limit)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	events = make([]domain.OutboxEvent, 0)
+
+	for rows.Next() {
+		ev := domain.OutboxEvent{}
+		err = rows.Scan(
+			&ev.Id,
+			&ev.Topic,
+			&ev.Key,
+			&ev.ContentType,
+			&ev.Payload,
+			&ev.Attempts,
+			&ev.NextAttemptAt,
+			&ev.LastError,
+			&ev.CreatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return events, err
+		}
+		events = append(events, ev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return events, err
+	}
+
+	for i := range events {
+		if _, err = getExecutor(ctx, m.conn).ExecContext(ctx, `UPDATE banking.outbox_events SET next_attempt_at=? WHERE id = ?`, until, events[i].Id); err != nil {
+			return events, err
+		}
+		events[i].NextAttemptAt = until
+	}
+
+	return events, nil
+}
+
+func (m *mysqlOutboxRepository) MarkEventPublished(ctx context.Context, id int64, publishedAt time.Time) (err error) {
+	query := `UPDATE banking.outbox_events SET published_at=? WHERE id = ?`
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, publishedAt, id)
+	return err
+}
+
+func (m *mysqlOutboxRepository) UpdateEventAttempt(ctx context.Context, ev *domain.OutboxEvent) (err error) {
+	query := `UPDATE banking.outbox_events SET attempts=?, next_attempt_at=?, last_error=?, parked_at=? WHERE id = ?`
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, ev.Attempts, ev.NextAttemptAt, ev.LastError, ev.ParkedAt, ev.Id)
+	return err
+}
+
+func (m *mysqlOutboxRepository) DeletePublishedEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	query := `DELETE FROM banking.outbox_events WHERE published_at < ? ORDER BY published_at LIMIT ?`
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
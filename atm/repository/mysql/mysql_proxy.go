@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlProxyRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlProxyRepository will create an object that represent the domain.ProxyRepository interface
+func NewMysqlProxyRepository(conn *sql.DB) domain.ProxyRepository {
+	return &mysqlProxyRepository{
+		conn: conn,
+	}
+}
+
+const proxyColumns = `id, proxy_type, proxy_value, account_no, uuid, created_at, updated_at`
+
+func (m *mysqlProxyRepository) fetch(ctx context.Context, query string, args ...interface{}) (result []domain.Proxy, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	result = make([]domain.Proxy, 0)
+
+	for rows.Next() {
+		p := domain.Proxy{}
+		err = rows.Scan(
+			&p.Id,
+			&p.Type,
+			&p.Value,
+			&p.AccountNo,
+			&p.Uuid,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		result = append(result, p)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *mysqlProxyRepository) getOne(ctx context.Context, query string, args ...interface{}) (p domain.Proxy, err error) {
+	list, err := m.fetch(ctx, query, args...)
+	if err != nil {
+		return p, err
+	}
+
+	if len(list) == 0 {
+		return p, domain.ErrProxyNotFound
+	}
+
+	return list[0], nil
+}
+
+func (m *mysqlProxyRepository) GetProxiesByUuid(ctx context.Context, uuid string) ([]domain.Proxy, error) {
+	return m.fetch(ctx, `SELECT `+proxyColumns+` FROM banking.proxies WHERE uuid = ? ORDER BY id`, uuid)
+}
+
+func (m *mysqlProxyRepository) GetProxy(ctx context.Context, proxyType string, value string) (domain.Proxy, error) {
+	return m.getOne(ctx, `SELECT `+proxyColumns+` FROM banking.proxies WHERE proxy_type = ? AND proxy_value = ?`, proxyType, value)
+}
+
+func (m *mysqlProxyRepository) GetProxyForUpdate(ctx context.Context, proxyType string, value string) (domain.Proxy, error) {
+	return m.getOne(ctx, `SELECT `+proxyColumns+` FROM banking.proxies WHERE proxy_type = ? AND proxy_value = ? FOR UPDATE`, proxyType, value)
+}
+
+// CreateProxy relies on the unique key (proxy_type, proxy_value), two users registering the
+// same proxy at once can not both get it
+func (m *mysqlProxyRepository) CreateProxy(ctx context.Context, p *domain.Proxy) (err error) {
+	query := `INSERT INTO banking.proxies (proxy_type, proxy_value, account_no, uuid, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, p.Type, p.Value, p.AccountNo, p.Uuid, p.CreatedAt, p.UpdatedAt)
+	if err != nil {
+		if isDuplicateEntryError(err) {
+			return domain.ErrProxyTaken
+		}
+		return err
+	}
+
+	p.Id, err = res.LastInsertId()
+	return err
+}
+
+func (m *mysqlProxyRepository) UpdateProxy(ctx context.Context, p *domain.Proxy) (err error) {
+	query := `UPDATE banking.proxies SET account_no=?, updated_at=? WHERE id = ?`
+
+	p.UpdatedAt = time.Now()
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, p.AccountNo, p.UpdatedAt, p.Id)
+	return err
+}
+
+func (m *mysqlProxyRepository) DeleteProxy(ctx context.Context, id int64) (err error) {
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, `DELETE FROM banking.proxies WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,327 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlScheduledTransactionRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlScheduledTransactionRepository will create an object that represent the domain.ScheduledTransactionRepository interface
+func NewMysqlScheduledTransactionRepository(conn *sql.DB) domain.ScheduledTransactionRepository {
+	return &mysqlScheduledTransactionRepository{
+		conn: conn,
+	}
+}
+
+const scheduledTransactionColumns = `s.id, s.amount, s.type, s.account, s.receiver, s.status, s.frequency, s.day_of_month, s.rrule,
+		s.timezone, s.scheduled_execution_at, s.next_execution_at, s.end_at, s.max_occurrences, s.occurrences,
+		s.submitted_at, s.created_at, s.updated_at`
+
+const scheduledExecutionColumns = `id, schedule_id, scheduled_for, transaction_id, status, attempts, next_attempt_at, lease_expires_at,
+		failure_code, failure_reason, created_at, executed_at`
+
+func (m *mysqlScheduledTransactionRepository) fetch(ctx context.Context, query string, args ...interface{}) (schedules []domain.ScheduledTransaction, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	schedules = make([]domain.ScheduledTransaction, 0)
+
+	for rows.Next() {
+		st := domain.ScheduledTransaction{}
+		var nextExecutionAt, endAt sql.NullTime
+
+		err = rows.Scan(
+			&st.Id,
+			&st.Amount,
+			&st.Type,
+			&st.Account.AccountNo,
+			&st.Receiver.AccountNo,
+			&st.Status,
+			&st.Frequency,
+			&st.DayOfMonth,
+			&st.RRule,
+			&st.Timezone,
+			&st.ScheduledExecutionAt,
+			&nextExecutionAt,
+			&endAt,
+			&st.MaxOccurrences,
+			&st.Occurrences,
+			&st.SubmittedAt,
+			&st.CreatedAt,
+			&st.UpdatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return schedules, err
+		}
+
+		if nextExecutionAt.Valid {
+			st.NextExecutionAt = &nextExecutionAt.Time
+		}
+		if endAt.Valid {
+			st.EndAt = &endAt.Time
+		}
+		schedules = append(schedules, st)
+	}
+
+	return schedules, rows.Err()
+}
+
+func (m *mysqlScheduledTransactionRepository) CreateScheduledTransaction(ctx context.Context, st *domain.ScheduledTransaction) (err error) {
+	query := `INSERT INTO banking.scheduled_transactions
+			SET amount=?, type=?, account=?, receiver=?, status=?, frequency=?, day_of_month=?, rrule=?, timezone=?,
+			scheduled_execution_at=?, next_execution_at=?, end_at=?, max_occurrences=?, occurrences=?,
+			submitted_at=?, created_at=?, updated_at=?`
+
+	st.CreatedAt = time.Now()
+	st.UpdatedAt = st.CreatedAt
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, st.Amount, st.Type, st.Account.AccountNo, st.Receiver.AccountNo,
+		st.Status, st.Frequency, st.DayOfMonth, st.RRule, st.Timezone, st.ScheduledExecutionAt, st.NextExecutionAt, st.EndAt,
+		st.MaxOccurrences, st.Occurrences, st.SubmittedAt, st.CreatedAt, st.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	st.Id, err = res.LastInsertId()
+	return err
+}
+
+func (m *mysqlScheduledTransactionRepository) GetScheduledTransactionByID(ctx context.Context, id int64) (res domain.ScheduledTransaction, err error) {
+	return m.getScheduledTransactionByID(ctx, id, "")
+}
+
+// GetScheduledTransactionByIDForUpdate must run inside a unit of work for the lock to be held
+func (m *mysqlScheduledTransactionRepository) GetScheduledTransactionByIDForUpdate(ctx context.Context, id int64) (res domain.ScheduledTransaction, err error) {
+	return m.getScheduledTransactionByID(ctx, id, " FOR UPDATE")
+}
+
+func (m *mysqlScheduledTransactionRepository) getScheduledTransactionByID(ctx context.Context, id int64, lock string) (res domain.ScheduledTransaction, err error) {
+	query := `SELECT ` + scheduledTransactionColumns + ` FROM banking.scheduled_transactions s WHERE s.id = ?` + lock
+
+	list, err := m.fetch(ctx, query, id)
+	if err != nil {
+		return res, err
+	}
+
+	if len(list) == 0 {
+		return res, domain.ErrScheduleNotFound
+	}
+
+	return list[0], nil
+}
+
+func (m *mysqlScheduledTransactionRepository) GetScheduledTransactionsByUuid(ctx context.Context, uuid string) ([]domain.ScheduledTransaction, error) {
+	query := `SELECT ` + scheduledTransactionColumns + ` FROM banking.scheduled_transactions s
+			JOIN banking.accounts a ON a.account_no = s.account
+			WHERE a.uuid = ? ORDER BY s.id DESC`
+
+	return m.fetch(ctx, query, uuid)
+}
+
+func (m *mysqlScheduledTransactionRepository) GetDueScheduledTransactions(ctx context.Context, now time.Time) ([]domain.ScheduledTransaction, error) {
+	query := `SELECT ` + scheduledTransactionColumns + ` FROM banking.scheduled_transactions s
+			WHERE s.status = ? AND s.next_execution_at <= ?
+			ORDER BY s.next_execution_at FOR UPDATE SKIP LOCKED`
+
+	return m.fetch(ctx, query, domain.ScheduleActive, now)
+}
+
+func (m *mysqlScheduledTransactionRepository) UpdateScheduledTransaction(ctx context.Context, st *domain.ScheduledTransaction) (err error) {
+	query := `UPDATE banking.scheduled_transactions
+			SET amount=?, status=?, frequency=?, day_of_month=?, rrule=?, timezone=?, scheduled_execution_at=?,
+			next_execution_at=?, end_at=?, max_occurrences=?, occurrences=?, updated_at=?
+			WHERE id = ?`
+
+	st.UpdatedAt = time.Now()
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, st.Amount, st.Status, st.Frequency, st.DayOfMonth, st.RRule,
+		st.Timezone, st.ScheduledExecutionAt, st.NextExecutionAt, st.EndAt, st.MaxOccurrences, st.Occurrences, st.UpdatedAt, st.Id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected != 1 {
+		return domain.ErrScheduleNotFound
+	}
+
+	return nil
+}
+
+// CreateScheduledExecution relies on the unique key (schedule_id, scheduled_for)
+func (m *mysqlScheduledTransactionRepository) CreateScheduledExecution(ctx context.Context, ex *domain.ScheduledExecution) (err error) {
+	query := `INSERT INTO banking.scheduled_transaction_executions (schedule_id, scheduled_for, status, attempts, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE id=LAST_INSERT_ID(id)`
+
+	ex.CreatedAt = time.Now()
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, ex.ScheduleId, ex.ScheduledFor, ex.Status, ex.Attempts, ex.NextAttemptAt, ex.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	ex.Id, err = res.LastInsertId()
+	return err
+}
+
+func (m *mysqlScheduledTransactionRepository) ClaimScheduledExecution(ctx context.Context, now time.Time) (*domain.ScheduledExecution, error) {
+	query := `SELECT ` + scheduledExecutionColumns + ` FROM banking.scheduled_transaction_executions
+			WHERE (status = ? AND next_attempt_at <= ?) OR (status = ? AND lease_expires_at <= ?)
+			ORDER BY scheduled_for, id LIMIT 1 FOR UPDATE SKIP LOCKED`
+
+	list, err := m.fetchExecutions(ctx, query, domain.ExecutionPending, now, domain.ExecutionProcessing, now)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+
+	return &list[0], nil
+}
+
+func (m *mysqlScheduledTransactionRepository) ClaimScheduledExecutionByID(ctx context.Context, id int64, now time.Time) (*domain.ScheduledExecution, error) {
+	query := `SELECT ` + scheduledExecutionColumns + ` FROM banking.scheduled_transaction_executions
+			WHERE id = ? AND ((status = ? AND next_attempt_at <= ?) OR (status = ? AND lease_expires_at <= ?))
+			FOR UPDATE SKIP LOCKED`
+
+	list, err := m.fetchExecutions(ctx, query, id, domain.ExecutionPending, now, domain.ExecutionProcessing, now)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+
+	return &list[0], nil
+}
+
+// GetScheduledExecutionForUpdate locks the execution until the surrounding unit of work ends
+func (m *mysqlScheduledTransactionRepository) GetScheduledExecutionForUpdate(ctx context.Context, id int64) (res domain.ScheduledExecution, err error) {
+	query := `SELECT ` + scheduledExecutionColumns + ` FROM banking.scheduled_transaction_executions WHERE id = ? FOR UPDATE`
+
+	list, err := m.fetchExecutions(ctx, query, id)
+	if err != nil {
+		return res, err
+	}
+
+	if len(list) == 0 {
+		return res, domain.ErrNotFound
+	}
+
+	return list[0], nil
+}
+
+func (m *mysqlScheduledTransactionRepository) UpdateScheduledExecution(ctx context.Context, ex *domain.ScheduledExecution, fence int) (err error) {
+	query := `UPDATE banking.scheduled_transaction_executions
+			SET transaction_id=?, status=?, attempts=?, next_attempt_at=?, lease_expires_at=?, failure_code=?, failure_reason=?, executed_at=?
+			WHERE id = ? AND attempts = ?`
+
+	var transactionId interface{}
+	if ex.TransactionId != 0 {
+		transactionId = ex.TransactionId
+	}
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, transactionId, ex.Status, ex.Attempts, ex.NextAttemptAt, ex.LeaseExpiresAt,
+		ex.FailureCode, ex.FailureReason, ex.ExecutedAt, ex.Id, fence)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected != 1 {
+		return domain.ErrExecutionLeaseLost
+	}
+
+	return nil
+}
+
+// CancelScheduledExecutions cancels the runs no worker holds, leased runs see the schedule cancelled themselves
+func (m *mysqlScheduledTransactionRepository) CancelScheduledExecutions(ctx context.Context, scheduleId int64) (err error) {
+	query := `UPDATE banking.scheduled_transaction_executions SET status=? WHERE schedule_id = ? AND status = ?`
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, domain.ExecutionCancelled, scheduleId, domain.ExecutionPending)
+	return err
+}
+
+func (m *mysqlScheduledTransactionRepository) GetScheduledExecutions(ctx context.Context, scheduleId int64) ([]domain.ScheduledExecution, error) {
+	query := `SELECT ` + scheduledExecutionColumns + ` FROM banking.scheduled_transaction_executions
+			WHERE schedule_id = ? ORDER BY scheduled_for DESC, id DESC`
+
+	return m.fetchExecutions(ctx, query, scheduleId)
+}
+
+func (m *mysqlScheduledTransactionRepository) fetchExecutions(ctx context.Context, query string, args ...interface{}) (executions []domain.ScheduledExecution, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	executions = make([]domain.ScheduledExecution, 0)
+
+	for rows.Next() {
+		ex := domain.ScheduledExecution{}
+		var transactionId sql.NullInt64
+		var leaseExpiresAt, executedAt sql.NullTime
+
+		err = rows.Scan(
+			&ex.Id,
+			&ex.ScheduleId,
+			&ex.ScheduledFor,
+			&transactionId,
+			&ex.Status,
+			&ex.Attempts,
+			&ex.NextAttemptAt,
+			&leaseExpiresAt,
+			&ex.FailureCode,
+			&ex.FailureReason,
+			&ex.CreatedAt,
+			&executedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return executions, err
+		}
+
+		ex.TransactionId = transactionId.Int64
+		if leaseExpiresAt.Valid {
+			ex.LeaseExpiresAt = &leaseExpiresAt.Time
+		}
+		if executedAt.Valid {
+			ex.ExecutedAt = &executedAt.Time
+		}
+		executions = append(executions, ex)
+	}
+
+	return executions, rows.Err()
+}
@@ -0,0 +1,481 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type mysqlTerminalRepository struct {
+	conn *sql.DB
+}
+
+// NewMysqlTerminalRepository will create an object that represent the domain.TerminalRepository interface
+func NewMysqlTerminalRepository(conn *sql.DB) domain.TerminalRepository {
+	return &mysqlTerminalRepository{
+		conn: conn,
+	}
+}
+
+const (
+	terminalColumns  = `id, location, status, denominations, dispense_strategy, low_cash_threshold, created_at, updated_at`
+	cassetteColumns  = `id, terminal_id, position, denomination, note_count, updated_at`
+	movementColumns  = `id, terminal_id, kind, position, denomination, note_count, transaction_id, operator, created_at`
+	balancingColumns = `id, terminal_id, operator, period_start, last_movement_id, denominations, expected, counted, discrepancy,
+		balanced, created_at`
+)
+
+func (m *mysqlTerminalRepository) fetchTerminals(ctx context.Context, query string, args ...interface{}) (result []domain.Terminal, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	result = make([]domain.Terminal, 0)
+
+	for rows.Next() {
+		t := domain.Terminal{}
+		var denominations string
+		var lowCashThreshold sql.NullString
+
+		err = rows.Scan(
+			&t.Id,
+			&t.Location,
+			&t.Status,
+			&denominations,
+			&t.DispenseStrategy,
+			&lowCashThreshold,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+
+		if t.Denominations, err = parseDenominations(denominations); err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+
+		if t.LowCashThreshold, err = parseNullMoney(lowCashThreshold); err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		result = append(result, t)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *mysqlTerminalRepository) fetchCassettes(ctx context.Context, query string, args ...interface{}) (result []domain.Cassette, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	result = make([]domain.Cassette, 0)
+
+	for rows.Next() {
+		c := domain.Cassette{}
+		err = rows.Scan(
+			&c.Id,
+			&c.TerminalId,
+			&c.Position,
+			&c.Denomination,
+			&c.Count,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		result = append(result, c)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *mysqlTerminalRepository) fetchMovements(ctx context.Context, query string, args ...interface{}) (result []domain.CashMovement, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	result = make([]domain.CashMovement, 0)
+
+	for rows.Next() {
+		mv := domain.CashMovement{}
+		var transactionId sql.NullInt64
+		var operator sql.NullString
+
+		err = rows.Scan(
+			&mv.Id,
+			&mv.TerminalId,
+			&mv.Kind,
+			&mv.Position,
+			&mv.Denomination,
+			&mv.Count,
+			&transactionId,
+			&operator,
+			&mv.CreatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+
+		mv.TransactionId, mv.Operator = transactionId.Int64, operator.String
+		result = append(result, mv)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *mysqlTerminalRepository) fetchBalancingReports(ctx context.Context, query string, args ...interface{}) (result []domain.BalancingReport, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	result = make([]domain.BalancingReport, 0)
+
+	for rows.Next() {
+		r := domain.BalancingReport{}
+		var periodStart sql.NullTime
+		var denominations string
+
+		err = rows.Scan(
+			&r.Id,
+			&r.TerminalId,
+			&r.Operator,
+			&periodStart,
+			&r.LastMovementId,
+			&denominations,
+			&r.Expected,
+			&r.Counted,
+			&r.Discrepancy,
+			&r.Balanced,
+			&r.CreatedAt,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+
+		if periodStart.Valid {
+			r.PeriodStart = &periodStart.Time
+		}
+
+		if err = json.Unmarshal([]byte(denominations), &r.Denominations); err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+// denominations are stored as a comma separated list, e.g. "100,500,1000"
+func parseDenominations(value string) ([]int64, error) {
+	result := make([]int64, 0)
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+
+		d, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+func formatDenominations(denominations []int64) string {
+	parts := make([]string, len(denominations))
+	for i, d := range denominations {
+		parts[i] = strconv.FormatInt(d, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *mysqlTerminalRepository) GetTerminals(ctx context.Context) ([]domain.Terminal, error) {
+	return m.fetchTerminals(ctx, `SELECT `+terminalColumns+` FROM banking.terminals ORDER BY id`)
+}
+
+func (m *mysqlTerminalRepository) GetTerminal(ctx context.Context, id string) (t domain.Terminal, err error) {
+	list, err := m.fetchTerminals(ctx, `SELECT `+terminalColumns+` FROM banking.terminals WHERE id = ?`, id)
+	if err != nil {
+		return t, err
+	}
+
+	if len(list) == 0 {
+		return t, domain.ErrTerminalNotFound
+	}
+
+	return list[0], nil
+}
+
+// UpsertTerminal keeps the created_at of a terminal that is already registered
+func (m *mysqlTerminalRepository) UpsertTerminal(ctx context.Context, t *domain.Terminal) (err error) {
+	query := `INSERT INTO banking.terminals (id, location, status, denominations, dispense_strategy, low_cash_threshold, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE location=VALUES(location), status=VALUES(status), denominations=VALUES(denominations),
+			dispense_strategy=VALUES(dispense_strategy), low_cash_threshold=VALUES(low_cash_threshold), updated_at=VALUES(updated_at)`
+
+	t.UpdatedAt = time.Now()
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = t.UpdatedAt
+	}
+
+	var lowCashThreshold interface{}
+	if t.LowCashThreshold != nil {
+		lowCashThreshold = *t.LowCashThreshold
+	}
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, t.Id, t.Location, t.Status, formatDenominations(t.Denominations),
+		t.DispenseStrategy, lowCashThreshold, t.CreatedAt, t.UpdatedAt)
+	return err
+}
+
+func (m *mysqlTerminalRepository) GetCassettes(ctx context.Context, terminalId string) ([]domain.Cassette, error) {
+	return m.fetchCassettes(ctx, `SELECT `+cassetteColumns+` FROM banking.terminal_cassettes WHERE terminal_id = ? ORDER BY position`, terminalId)
+}
+
+func (m *mysqlTerminalRepository) GetCassettesForUpdate(ctx context.Context, terminalId string) ([]domain.Cassette, error) {
+	return m.fetchCassettes(ctx, `SELECT `+cassetteColumns+` FROM banking.terminal_cassettes WHERE terminal_id = ? ORDER BY position FOR UPDATE`, terminalId)
+}
+
+// UpsertCassette relies on the unique key (terminal_id, position)
+func (m *mysqlTerminalRepository) UpsertCassette(ctx context.Context, c *domain.Cassette) (err error) {
+	query := `INSERT INTO banking.terminal_cassettes (terminal_id, position, denomination, note_count, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE id=LAST_INSERT_ID(id), denomination=VALUES(denomination), note_count=VALUES(note_count),
+			updated_at=VALUES(updated_at)`
+
+	c.UpdatedAt = time.Now()
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, c.TerminalId, c.Position, c.Denomination, c.Count, c.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	c.Id, err = res.LastInsertId()
+	return err
+}
+
+func (m *mysqlTerminalRepository) UpdateCassetteCount(ctx context.Context, id int64, count int) (err error) {
+	query := `UPDATE banking.terminal_cassettes SET note_count=?, updated_at=? WHERE id = ?`
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, count, time.Now(), id)
+	return err
+}
+
+// CreateDispense records the notes paid out for a transaction, for reconciling the cassettes
+func (m *mysqlTerminalRepository) CreateDispense(ctx context.Context, transactionId int64, plan *domain.DispensePlan) (err error) {
+	query := `INSERT INTO banking.terminal_dispenses (terminal_id, transaction_id, amount, notes, created_at) VALUES (?, ?, ?, ?, ?)`
+
+	notes, err := json.Marshal(plan.Notes)
+	if err != nil {
+		return err
+	}
+
+	_, err = getExecutor(ctx, m.conn).ExecContext(ctx, query, plan.TerminalId, transactionId, plan.Amount, string(notes), time.Now())
+	return err
+}
+
+func (m *mysqlTerminalRepository) GetDispenseForUpdate(ctx context.Context, transactionId int64) (*domain.DispensePlan, error) {
+	query := `SELECT terminal_id, amount, notes, reversal_id FROM banking.terminal_dispenses WHERE transaction_id = ? FOR UPDATE`
+
+	var plan domain.DispensePlan
+	var notes string
+	var reversalId sql.NullInt64
+
+	err := getExecutor(ctx, m.conn).QueryRowContext(ctx, query, transactionId).Scan(&plan.TerminalId, &plan.Amount, &notes, &reversalId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal([]byte(notes), &plan.Notes); err != nil {
+		return nil, err
+	}
+	plan.ReversalId = reversalId.Int64
+
+	return &plan, nil
+}
+
+func (m *mysqlTerminalRepository) ReverseDispense(ctx context.Context, transactionId int64, reversalId int64) error {
+	query := `UPDATE banking.terminal_dispenses SET reversal_id = ? WHERE transaction_id = ? AND reversal_id IS NULL`
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, reversalId, transactionId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected != 1 {
+		return domain.ErrAlreadyReversed
+	}
+
+	return nil
+}
+
+func (m *mysqlTerminalRepository) CreateCashMovements(ctx context.Context, movements []domain.CashMovement) (err error) {
+	query := `INSERT INTO banking.terminal_cash_movements (terminal_id, kind, position, denomination, note_count, transaction_id, operator, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	now := time.Now()
+	for i := range movements {
+		mv := &movements[i]
+		mv.CreatedAt = now
+
+		var transactionId, operator interface{}
+		if mv.TransactionId != 0 {
+			transactionId = mv.TransactionId
+		}
+		if mv.Operator != "" {
+			operator = mv.Operator
+		}
+
+		res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, mv.TerminalId, mv.Kind, mv.Position, mv.Denomination, mv.Count,
+			transactionId, operator, mv.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		if mv.Id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *mysqlTerminalRepository) GetCashMovementsAfter(ctx context.Context, terminalId string, movementId int64) ([]domain.CashMovement, error) {
+	return m.fetchMovements(ctx, `SELECT `+movementColumns+` FROM banking.terminal_cash_movements WHERE terminal_id = ? AND id > ? ORDER BY id`,
+		terminalId, movementId)
+}
+
+// GetDepositBin adds up the movements into and out of the deposit bin, a pickup takes out all of it
+func (m *mysqlTerminalRepository) GetDepositBin(ctx context.Context, terminalId string) (result []domain.BanknoteCount, err error) {
+	query := `SELECT denomination, SUM(note_count) FROM banking.terminal_cash_movements
+			WHERE terminal_id = ? AND position = ? GROUP BY denomination HAVING SUM(note_count) > 0 ORDER BY denomination`
+
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, terminalId, domain.DepositBin)
+	if err != nil {
+		logrus.Error(err)
+		return nil, err
+	}
+
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
+
+	result = make([]domain.BanknoteCount, 0)
+
+	for rows.Next() {
+		n := domain.BanknoteCount{}
+		if err = rows.Scan(&n.Denomination, &n.Count); err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+		result = append(result, n)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *mysqlTerminalRepository) GetLastBalancingReport(ctx context.Context, terminalId string) (*domain.BalancingReport, error) {
+	list, err := m.fetchBalancingReports(ctx, `SELECT `+balancingColumns+` FROM banking.terminal_balancings
+			WHERE terminal_id = ? ORDER BY id DESC LIMIT 1`, terminalId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	return &list[0], nil
+}
+
+func (m *mysqlTerminalRepository) GetBalancingReports(ctx context.Context, terminalId string) ([]domain.BalancingReport, error) {
+	return m.fetchBalancingReports(ctx, `SELECT `+balancingColumns+` FROM banking.terminal_balancings
+			WHERE terminal_id = ? ORDER BY id DESC`, terminalId)
+}
+
+func (m *mysqlTerminalRepository) CreateBalancingReport(ctx context.Context, r *domain.BalancingReport) (err error) {
+	query := `INSERT INTO banking.terminal_balancings (terminal_id, operator, period_start, last_movement_id, denominations, expected,
+			counted, discrepancy, balanced, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	denominations, err := json.Marshal(r.Denominations)
+	if err != nil {
+		return err
+	}
+
+	var periodStart interface{}
+	if r.PeriodStart != nil {
+		periodStart = *r.PeriodStart
+	}
+
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, r.TerminalId, r.Operator, periodStart, r.LastMovementId,
+		string(denominations), r.Expected, r.Counted, r.Discrepancy, r.Balanced, r.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	r.Id, err = res.LastInsertId()
+	return err
+}
@@ -5,304 +5,316 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"strconv"
+	"strings"
 	"time"
 
+	"main/atm/repository"
 	"main/domain"
 
-	"github.com/go-redis/redis"
+	"github.com/sirupsen/logrus"
 )
 
 type mysqlTransactionRepository struct {
-	conn  *sql.DB
-	redis *redis.Client
+	conn *sql.DB
 }
 
 // NewMysqlTransactionRepository will create an object that represent the transaction.Repository interface
-func NewMysqlTransactionRepository(conn *sql.DB, redis *redis.Client) domain.TransactionRepository {
+func NewMysqlTransactionRepository(conn *sql.DB) domain.TransactionRepository {
 	return &mysqlTransactionRepository{
-		conn:  conn,
-		redis: redis,
+		conn: conn,
 	}
 }
 
-// func (m *mysqlTransactionRepository) fetch(ctx context.Context, query string, args ...interface{}) (result []domain.Transaction, err error) {
-// 	rows, err := m.Conn.QueryContext(ctx, query, args...)
-// 	if err != nil {
-// 		logrus.Error(err)
-// 		return nil, err
-// 	}
-
-// 	defer func() {
-// 		errRow := rows.Close()
-// 		if errRow != nil {
-// 			logrus.Error(errRow)
-// 		}
-// 	}()
-
-// 	result = make([]domain.Transaction, 0)
-
-// 	for rows.Next() {
-// 		t := domain.Transaction{}
-// 		acc := domain.Account{}
-// 		accountID := acc.ID
-// 		accountName := acc.OwnerName
-// 		accountBalance := acc.Balance
-// 		accountStatus := acc.Status
-// 		accountCreatedAt := acc.CreatedAt
-// 		accountUpdatedAt := acc.UpdatedAt
-// 		accountIsdeleted := acc.IsDeleted
-// 		err = rows.Scan(
-// 			&t.TID,
-// 			&t.Amount,
-// 			&t.TrType,
-// 			&t.CreatedBy,
-// 			&t.ResipientID,
-// 			// &t.CreatedAt,
-// 		)
-
-// 		if err != nil {
-// 			logrus.Error(err)
-// 			return nil, err
-// 		}
-// 		t.CreatedBy = domain.Account{
-// 			ID:        accountID,
-// 			OwnerName: accountName,
-// 			Balance:   accountBalance,
-// 			Status:    accountStatus,
-// 			CreatedAt: accountCreatedAt,
-// 			UpdatedAt: accountUpdatedAt,
-// 			IsDeleted: accountIsdeleted,
-// 		}
-
-// 		t.ResipientID = domain.Account{
-// 			ID:        accountID,
-// 			OwnerName: accountName,
-// 			Balance:   accountBalance,
-// 			Status:    accountStatus,
-// 			CreatedAt: accountCreatedAt,
-// 			UpdatedAt: accountUpdatedAt,
-// 			IsDeleted: accountIsdeleted,
-// 		}
-
-// 		result = append(result, t)
-
-// 	}
-
-// 	return result, nil
-// }
-
-// func (m *mysqlTransactionRepository) GetAllTransaction(ctx context.Context, cursor string, num int64) (res []domain.Transaction, nextCursor string, err error) {
-// 	// query := `SELECT tid,name,content, author_tid, updated_at, created_at
-// 	// 					FROM transaction WHERE created_at > ? ORDER BY created_at LIMIT ? `
-
-// 	query := `SELECT * FROM atm.transaction WHERE created_at > ? ORDER BY created_at LIMIT ?`
-
-// 	decodedCursor, err := repository.DecodeCursor(cursor)
-// 	if err != nil && cursor != "" {
-// 		return nil, "", domain.ErrBadParamInput
-// 	}
-
-// 	res, err = m.fetch(ctx, query, decodedCursor, num)
-// 	if err != nil {
-// 		return nil, "", err
-// 	}
-
-// 	if len(res) == int(num) {
-// 		nextCursor = repository.EncodeCursor(res[len(res)-1].CreatedAt)
-// 	}
-
-// 	return
-// }
-
-// func (m *mysqlTransactionRepository) GetTransactionByTID(ctx context.Context, tid int64) (res domain.Transaction, err error) {
-// 	query := `SELECT * FROM atm.transaction WHERE tid = ?`
-
-// 	list, err := m.fetch(ctx, query, tid)
-// 	if err != nil {
-// 		return domain.Transaction{}, err
-// 	}
-
-// 	if len(list) > 0 {
-// 		res = list[0]
-// 	} else {
-// 		return res, domain.ErrNotFound
-// 	}
-
-// 	return
-// }
+// transactionColumns is selected from both banking.transactions and banking.transactions_history
+const transactionColumns = `id, amount, type, fee, total_amount, submitted_at, created_at, account, receiver, reference_id, remark, reversed_at, refunded_amount, status, failure_code, failure_reason, channel, fee_rule_id`
 
-func (m *mysqlTransactionRepository) CreateTransaction(ctx context.Context, tr *domain.Transaction) (err error) {
-	// query := `INSERT atm.transaction SET type=? , amount=? ,created_by=?, created_at=?`
-	query := `
-			INSERT INTO banking.transactions 
-			SET amount=?, type=?, fee=?, total_amount=?, submitted_at=?, created_at=? , account=?, receiver=?
-	`
-
-	stmt, err := m.conn.PrepareContext(ctx, query)
+func (m *mysqlTransactionRepository) fetch(ctx context.Context, query string, args ...interface{}) (result []domain.Transaction, err error) {
+	rows, err := getExecutor(ctx, m.conn).QueryContext(ctx, query, args...)
 	if err != nil {
-		return
+		logrus.Error(err)
+		return nil, err
 	}
 
-	tr.CreatedAt = time.Now()
+	defer func() {
+		errRow := rows.Close()
+		if errRow != nil {
+			logrus.Error(errRow)
+		}
+	}()
 
-	res, err := stmt.ExecContext(ctx, tr.Amount, tr.Type, tr.Fee, tr.Total, tr.SubmittedAt, tr.CreatedAt, tr.Account.AccountNo, tr.Receiver.AccountNo)
-	if err != nil {
-		return
-	}
-	lastID, err := res.LastInsertId()
-	if err != nil {
-		return
+	result = make([]domain.Transaction, 0)
+
+	for rows.Next() {
+		t := domain.Transaction{}
+		var receiver, remark, failureReason, channel sql.NullString
+		var referenceId, failureCode, feeRuleId sql.NullInt64
+		var reversedAt sql.NullTime
+
+		err = rows.Scan(
+			&t.Id,
+			&t.Amount,
+			&t.Type,
+			&t.Fee,
+			&t.Total,
+			&t.SubmittedAt,
+			&t.CreatedAt,
+			&t.Account.AccountNo,
+			&receiver,
+			&referenceId,
+			&remark,
+			&reversedAt,
+			&t.RefundedAmount,
+			&t.Status,
+			&failureCode,
+			&failureReason,
+			&channel,
+			&feeRuleId,
+		)
+		if err != nil {
+			logrus.Error(err)
+			return nil, err
+		}
+
+		t.Receiver.AccountNo = receiver.String
+		t.ReferenceId = referenceId.Int64
+		t.Remark = remark.String
+		if reversedAt.Valid {
+			t.ReversedAt = &reversedAt.Time
+		}
+		t.FailureCode = int(failureCode.Int64)
+		t.FailureReason = failureReason.String
+		t.Channel = channel.String
+		t.FeeRuleId = feeRuleId.Int64
+		result = append(result, t)
 	}
-	tr.Id = lastID
 
-	return nil
+	return result, rows.Err()
 }
 
-func (m *mysqlTransactionRepository) CreateScheduledTransaction(ctx context.Context, tr *domain.ScheduledTransaction) (err error) {
-	query := `
-			INSERT INTO banking.scheduled_transactions 
-			SET amount=?, type=?, account=?, receiver=?, submitted_at=?, created_at=? , scheduled_execution_at =?, updated_at=?
-	`
+// GetAllTransaction pages through the live and archived tables as one history, newest first.
+// Both branches are read in a single statement so a row moved by MigrateTransactionHistory
+// in the meantime is seen exactly once.
+func (m *mysqlTransactionRepository) GetAllTransaction(ctx context.Context, filter domain.TransactionFilter) (res []domain.Transaction, nextCursor string, err error) {
+	where := []string{"(account = ? OR receiver = ?)"}
+	whereArgs := []interface{}{filter.AccountNo, filter.AccountNo}
 
-	stmt, err := m.conn.PrepareContext(ctx, query)
-	if err != nil {
-		return
+	if filter.Cursor != "" {
+		createdAt, id, err := repository.DecodeKeysetCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", domain.ErrBadParamInput
+		}
+
+		where = append(where, "(created_at < ? OR (created_at = ? AND id < ?))")
+		whereArgs = append(whereArgs, createdAt, createdAt, id)
 	}
 
-	tr.CreatedAt = time.Now()
-	tr.UpdatedAt = time.Now()
+	if filter.From != nil {
+		where = append(where, "created_at >= ?")
+		whereArgs = append(whereArgs, *filter.From)
+	}
+	if filter.To != nil {
+		where = append(where, "created_at < ?")
+		whereArgs = append(whereArgs, *filter.To)
+	}
+	if filter.Type != "" {
+		where = append(where, "type = ?")
+		whereArgs = append(whereArgs, filter.Type)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		whereArgs = append(whereArgs, filter.Status)
+	}
+	if filter.MinAmount != nil {
+		where = append(where, "amount >= ?")
+		whereArgs = append(whereArgs, *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		where = append(where, "amount <= ?")
+		whereArgs = append(whereArgs, *filter.MaxAmount)
+	}
+	if filter.Counterparty != "" {
+		where = append(where, "(account = ? OR receiver = ?)")
+		whereArgs = append(whereArgs, filter.Counterparty, filter.Counterparty)
+	}
+
+	condition := strings.Join(where, " AND ")
+	query := `SELECT ` + transactionColumns + ` FROM banking.transactions WHERE ` + condition + `
+			UNION ALL
+			SELECT ` + transactionColumns + ` FROM banking.transactions_history WHERE ` + condition + `
+			ORDER BY created_at DESC, id DESC LIMIT ?`
 
-	res, err := stmt.ExecContext(ctx, tr.Amount, tr.Type, tr.Account.AccountNo, tr.Receiver.AccountNo, tr.SubmittedAt, tr.CreatedAt, tr.ScheduledExecutionAt, tr.UpdatedAt)
+	args := append(append(append([]interface{}{}, whereArgs...), whereArgs...), filter.Num)
+
+	res, err = m.fetch(ctx, query, args...)
 	if err != nil {
-		return
+		return nil, "", err
 	}
-	lastID, err := res.LastInsertId()
-	if err != nil {
-		return
+
+	if len(res) == int(filter.Num) {
+		last := res[len(res)-1]
+		nextCursor = repository.EncodeKeysetCursor(last.CreatedAt, last.Id)
 	}
-	tr.Id = lastID
 
-	return nil
+	return
 }
 
-func (m *mysqlTransactionRepository) GetScheduledTransaction(ctx context.Context, fetchTime time.Time) (transactions []domain.ScheduledTransaction, err error) {
-
-	query := `
-			SELECT * FROM scheduled_transactions WHERE (scheduled_execution_at = ? AND status = 'unprocessed')
-	`
+func (m *mysqlTransactionRepository) GetTransactionByTID(ctx context.Context, tid int64) (res domain.Transaction, err error) {
+	query := `SELECT ` + transactionColumns + ` FROM banking.transactions WHERE id = ?
+			UNION ALL
+			SELECT ` + transactionColumns + ` FROM banking.transactions_history WHERE id = ?`
 
-	rows, err := m.conn.Query(query, fetchTime)
+	list, err := m.fetch(ctx, query, tid, tid)
 	if err != nil {
-		log.Fatal(err)
+		return domain.Transaction{}, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		transaction := domain.ScheduledTransaction{}
-		err := rows.Scan(
-			&transaction.Id,
-			&transaction.Amount,
-			&transaction.Type,
-			&transaction.Account.AccountNo,
-			&transaction.Receiver.AccountNo,
-			&transaction.Status,
-			&transaction.SubmittedAt,
-			&transaction.CreatedAt,
-			&transaction.ScheduledExecutionAt,
-			&transaction.UpdatedAt,
-		)
+	if len(list) > 0 {
+		res = list[0]
+	} else {
+		return res, domain.ErrTransactionNotFound
+	}
 
+	return
+}
+
+// GetTransactionByTIDForUpdate locks the transaction row, in whichever table it currently lives,
+// until the surrounding unit of work ends
+func (m *mysqlTransactionRepository) GetTransactionByTIDForUpdate(ctx context.Context, tid int64) (res domain.Transaction, err error) {
+	for _, table := range []string{"banking.transactions", "banking.transactions_history"} {
+		query := `SELECT ` + transactionColumns + ` FROM ` + table + ` WHERE id = ? FOR UPDATE`
+
+		list, err := m.fetch(ctx, query, tid)
 		if err != nil {
-			fmt.Println(err)
-			return nil, err
+			return domain.Transaction{}, err
 		}
 
-		transactions = append(transactions, transaction)
+		if len(list) > 0 {
+			return list[0], nil
+		}
+	}
 
-		transaction.Status = "processing"
-		m.UpdateScheduledTransaction(ctx, transaction)
+	return res, domain.ErrTransactionNotFound
+}
 
+func (m *mysqlTransactionRepository) RecordRefund(ctx context.Context, tr *domain.Transaction, refundedBefore domain.Money) (err error) {
+	var affected int64
+
+	for _, table := range []string{"banking.transactions", "banking.transactions_history"} {
+		query := `UPDATE ` + table + ` SET refunded_amount=?, status=?, reversed_at=? WHERE id = ? AND status = ? AND refunded_amount = ?`
+
+		res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, tr.RefundedAmount, tr.Status, tr.ReversedAt, tr.Id, domain.TransactionCompleted, refundedBefore)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		affected += rows
 	}
 
-	return
+	if affected != 1 {
+		return domain.ErrAlreadyReversed
+	}
+
+	return nil
 }
 
-func (m *mysqlTransactionRepository) UpdateScheduledTransaction(ctx context.Context, tr domain.ScheduledTransaction) (err error) {
-	query := `UPDATE banking.scheduled_transactions set status=?, updated_at=? WHERE id = ?`
+func (m *mysqlTransactionRepository) CreateTransaction(ctx context.Context, tr *domain.Transaction) (err error) {
+	// query := `INSERT atm.transaction SET type=? , amount=? ,created_by=?, created_at=?`
+	query := `
+			INSERT INTO banking.transactions 
+			SET amount=?, type=?, fee=?, total_amount=?, submitted_at=?, created_at=? , account=?, receiver=?, reference_id=?, remark=?, status=?, failure_code=?, failure_reason=?, channel=?, fee_rule_id=?
+	`
+
+	tr.CreatedAt = time.Now()
+
+	var referenceId, failureCode, feeRuleId interface{}
+	if tr.ReferenceId != 0 {
+		referenceId = tr.ReferenceId
+	}
+	if tr.FailureCode != 0 {
+		failureCode = tr.FailureCode
+	}
+	if tr.FeeRuleId != 0 {
+		feeRuleId = tr.FeeRuleId
+	}
 
-	stmt, err := m.conn.PrepareContext(ctx, query)
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, tr.Amount, tr.Type, tr.Fee, tr.Total, tr.SubmittedAt, tr.CreatedAt, tr.Account.AccountNo, tr.Receiver.AccountNo, referenceId, tr.Remark, tr.Status, failureCode, tr.FailureReason, tr.Channel, feeRuleId)
 	if err != nil {
 		return
 	}
-
-	tr.UpdatedAt = time.Now()
-
-	_, err = stmt.ExecContext(ctx, tr.Status, tr.UpdatedAt, tr.Id)
+	lastID, err := res.LastInsertId()
 	if err != nil {
 		return
 	}
-	return
+	tr.Id = lastID
+
+	return nil
 }
 
-// func (m *mysqlAccountRepository) SetMaximumTransferAmountPerDayInRedis(ctx context.Context, id uint64) error {
-// 	// Check if the user exists in Redis cache
-// 	cacheKey := fmt.Sprintf("accountdailylimit:%d", id)
+// UpdateTransactionStatus settles a transaction created as pending. Fee and total are written too,
+// since a transfer only knows them once both accounts are locked. from guards against two
+// writers settling the same transaction.
+func (m *mysqlTransactionRepository) UpdateTransactionStatus(ctx context.Context, tr *domain.Transaction, from string) (err error) {
+	query := `UPDATE banking.transactions SET status=?, fee=?, total_amount=?, fee_rule_id=?, failure_code=?, failure_reason=? WHERE id = ? AND status = ?`
 
-// 	MaxTransferAmountPerDay := 100000
+	var failureCode, feeRuleId interface{}
+	if tr.FailureCode != 0 {
+		failureCode = tr.FailureCode
+	}
+	if tr.FeeRuleId != 0 {
+		feeRuleId = tr.FeeRuleId
+	}
 
-// 	err := m.redis.Set(cacheKey, MaxTransferAmountPerDay, 0).Err()
-// 	if err != nil {
-// 		return err
-// 	}
-// 	return err
+	res, err := getExecutor(ctx, m.conn).ExecContext(ctx, query, tr.Status, tr.Fee, tr.Total, feeRuleId, failureCode, tr.FailureReason, tr.Id, from)
+	if err != nil {
+		return err
+	}
 
-// }
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
 
-// func (m *mysqlAccountRepository) UpdateMaximumTransferAmountPerDayInRedis(ctx context.Context, id uint64) error {
-// 	// Check if the user exists in Redis cache
-// 	cacheKey := fmt.Sprintf("accountdailylimit:%d", id)
+	if affected != 1 {
+		return domain.ErrInvalidStatusTransition
+	}
 
-// 	RemainTransferAmountPerDay
+	return nil
+}
 
-// 	err := m.redis.Set(cacheKey, RemainTransferAmountPerDay, 0).Err()
-// 	if err != nil {
-// 		return err
-// 	}
-// 	return err
+// GetTransactionUsage counts the posted transactions account_no sent since then, live and archived,
+// leaving out transfers the clearing house returned. An empty channel counts every channel.
+func (m *mysqlTransactionRepository) GetTransactionUsage(ctx context.Context, account_no string, transactionType string, channel string, since time.Time) (res domain.TransactionUsage, err error) {
+	where := "account = ? AND type = ? AND status IN (?, ?, ?) AND created_at >= ?"
+	args := []interface{}{account_no, transactionType, domain.TransactionCompleted, domain.TransactionReversed, domain.TransactionClearing, since}
 
-// }
+	if channel != "" {
+		where += " AND channel = ?"
+		args = append(args, channel)
+	}
 
-func (m *mysqlTransactionRepository) SetTransferAmountPerDayInRedis(ctx context.Context, tr *domain.Transaction) error {
-	// Check if the user exists in Redis cache
-	cacheKey := fmt.Sprintf("daily_transaction_%s", tr.Account.AccountNo)
-	cachedAmount, err := m.redis.Get(cacheKey).Result()
-	now := time.Now()
-	nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
-	expirationTime := nextMidnight
-	durationUntilExpiration := expirationTime.Sub(now)
+	query := `SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM (
+				SELECT amount FROM banking.transactions WHERE ` + where + `
+				UNION ALL
+				SELECT amount FROM banking.transactions_history WHERE ` + where + `
+			) AS usage_rows`
 
-	if err == redis.Nil {
-		err = m.redis.Set(cacheKey, tr.Amount, durationUntilExpiration).Err()
-		if err != nil {
-			return nil
-		}
-		return nil
-	} else if err != nil {
-		return fmt.Errorf("error parsing user from cache: %v", err)
-	} else {
-		amount := cachedAmount
-		floatamount, _ := strconv.ParseFloat(amount, 64)
-		floatamount += tr.Amount
-		err = m.redis.Set(cacheKey, floatamount, 0).Err()
-		if err != nil {
-			return fmt.Errorf("error parsing user from cache: %v", err)
-		}
-		return nil
+	var amount string
+	err = getExecutor(ctx, m.conn).QueryRowContext(ctx, query, append(append([]interface{}{}, args...), args...)...).Scan(&res.Count, &amount)
+	if err != nil {
+		return res, err
 	}
 
+	res.Amount, err = domain.ParseMoney(amount)
+	return res, err
 }
 
+// MigrateTransactionHistory moves everything before today into banking.transactions_history.
+// Pending and clearing rows stay until they are settled, see Transaction.IsSettled.
+// Copy and delete run in one transaction so a row is never in both tables or in neither.
 func (m *mysqlTransactionRepository) MigrateTransactionHistory(ctx context.Context) (err error) {
 	currentTime := time.Now()
 	currentDate := currentTime.Format("2006-01-02")
@@ -314,37 +326,32 @@ func (m *mysqlTransactionRepository) MigrateTransactionHistory(ctx context.Conte
 		log.Printf("Error starting transaction: %v", err)
 		return err
 	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
 
 	log.Printf("Counting rows to be migrated...")
 
 	select_query := `
 					SELECT COUNT(*) FROM banking.transactions 
-					WHERE created_at < ?;
+					WHERE created_at < ? AND status NOT IN (?, ?) FOR UPDATE;
 	`
 
-	stmt, err := m.conn.PrepareContext(ctx, select_query)
-	if err != nil {
-		return err
-	}
-
 	var countRows int64
-	err = stmt.QueryRowContext(ctx, currentDate).Scan(&countRows)
+	err = tx.QueryRowContext(ctx, select_query, currentDate, domain.TransactionPending, domain.TransactionClearing).Scan(&countRows)
 	if err != nil {
 		return err
 	}
 
 	migrate_query := `
-					INSERT INTO banking.transactions_history
-					SELECT * FROM banking.transactions
-					WHERE created_at < ?;
+					INSERT INTO banking.transactions_history (` + transactionColumns + `)
+					SELECT ` + transactionColumns + ` FROM banking.transactions
+					WHERE created_at < ? AND status NOT IN (?, ?);
 	`
 
-	stmt, err = m.conn.PrepareContext(ctx, migrate_query)
-	if err != nil {
-		return
-	}
-
-	res, err := stmt.ExecContext(ctx, currentDate)
+	res, err := tx.ExecContext(ctx, migrate_query, currentDate, domain.TransactionPending, domain.TransactionClearing)
 	if err != nil {
 		return err
 	}
@@ -355,25 +362,15 @@ func (m *mysqlTransactionRepository) MigrateTransactionHistory(ctx context.Conte
 	}
 
 	if countRows != insertRowAffect {
-		tx.Rollback()
 		return fmt.Errorf("number of rows affected does not match")
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
-	}
-
 	delete_query := `
 					DELETE FROM banking.transactions
-					WHERE created_at < ?;
+					WHERE created_at < ? AND status NOT IN (?, ?);
 	`
 
-	stmt, err = m.conn.PrepareContext(ctx, delete_query)
-	if err != nil {
-		return
-	}
-
-	res, err = stmt.ExecContext(ctx, currentDate)
+	res, err = tx.ExecContext(ctx, delete_query, currentDate, domain.TransactionPending, domain.TransactionClearing)
 	if err != nil {
 		return err
 	}
@@ -384,11 +381,10 @@ func (m *mysqlTransactionRepository) MigrateTransactionHistory(ctx context.Conte
 	}
 
 	if deleteRowAffect != insertRowAffect {
-		tx.Rollback()
 		return fmt.Errorf("number of rows affected in delete and migrate operations do not match")
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err = tx.Commit(); err != nil {
 		return err
 	}
 
@@ -0,0 +1,68 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+type txKey struct{}
+
+// executor is the subset of *sql.DB and *sql.Tx used by the repositories
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// getExecutor returns the transaction bound to ctx by the unit of work, or conn when there is none
+func getExecutor(ctx context.Context, conn *sql.DB) executor {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return conn
+}
+
+type mysqlUnitOfWork struct {
+	conn *sql.DB
+}
+
+// NewMysqlUnitOfWork will create an object that represent the domain.UnitOfWork interface
+func NewMysqlUnitOfWork(conn *sql.DB) domain.UnitOfWork {
+	return &mysqlUnitOfWork{
+		conn: conn,
+	}
+}
+
+func (u *mysqlUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	// nested units join the outer transaction
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := u.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if errRollback := tx.Rollback(); errRollback != nil {
+			logrus.Error(errRollback)
+		}
+		return err
+	}
+
+	domain.MarkCommitting(ctx)
+	return tx.Commit()
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"main/domain"
+
+	goredis "github.com/go-redis/redis"
+)
+
+type redisIdempotencyRepository struct {
+	redis *goredis.Client
+}
+
+// NewRedisIdempotencyRepository will create an object that represent the domain.IdempotencyRepository interface
+func NewRedisIdempotencyRepository(redis *goredis.Client) domain.IdempotencyRepository {
+	return &redisIdempotencyRepository{
+		redis: redis,
+	}
+}
+
+func idempotencyCacheKey(scope string, key string) string {
+	return fmt.Sprintf("idempotency:%s:%s", scope, key)
+}
+
+func (r *redisIdempotencyRepository) Reserve(ctx context.Context, record *domain.IdempotencyRecord, ttl time.Duration) (bool, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+
+	// SETNX lets exactly one of several concurrent requests claim the key
+	return r.redis.SetNX(idempotencyCacheKey(record.Scope, record.Key), value, ttl).Result()
+}
+
+func (r *redisIdempotencyRepository) Get(ctx context.Context, scope string, key string) (*domain.IdempotencyRecord, error) {
+	value, err := r.redis.Get(idempotencyCacheKey(scope, key)).Result()
+	if err == goredis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var record domain.IdempotencyRecord
+	if err = json.Unmarshal([]byte(value), &record); err != nil {
+		return nil, fmt.Errorf("error parsing idempotency record from cache: %v", err)
+	}
+
+	return &record, nil
+}
+
+func (r *redisIdempotencyRepository) Save(ctx context.Context, record *domain.IdempotencyRecord, ttl time.Duration) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return r.redis.Set(idempotencyCacheKey(record.Scope, record.Key), value, ttl).Err()
+}
+
+func (r *redisIdempotencyRepository) Delete(ctx context.Context, scope string, key string) error {
+	return r.redis.Del(idempotencyCacheKey(scope, key)).Err()
+}
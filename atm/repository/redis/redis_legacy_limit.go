@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"strings"
+
+	"main/domain"
+
+	goredis "github.com/go-redis/redis"
+)
+
+// The keys limits were kept under before banking.limits
+const (
+	legacyMinDepositKey        = "min_deposit_amount"
+	legacyDefaultDailyLimitKey = "default_daily_limit"
+	legacyDailyLimitPrefix     = "daily_limit_"
+	legacyPerTransactionPrefix = "limit_per_transaction: "
+	legacyLimitScanBatch       = 500
+)
+
+// LegacyLimits reads the limits still kept under the old Redis keys as rows for banking.limits.
+// Keys whose value can not be a limit, such as the 0 that meant no per transaction limit, are
+// returned in skipped.
+func LegacyLimits(redis *goredis.Client) (limits []domain.Limit, skipped []string, err error) {
+	for _, pattern := range []string{legacyMinDepositKey, legacyDefaultDailyLimitKey, legacyDailyLimitPrefix + "*", legacyPerTransactionPrefix + "*"} {
+		var cursor uint64
+		for {
+			var keys []string
+			keys, cursor, err = redis.Scan(cursor, pattern, legacyLimitScanBatch).Result()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for _, key := range keys {
+				value, err := redis.Get(key).Result()
+				if err == goredis.Nil {
+					continue
+				}
+				if err != nil {
+					return nil, nil, err
+				}
+
+				limit, ok := legacyLimit(key, value)
+				if !ok {
+					skipped = append(skipped, key)
+					continue
+				}
+				limits = append(limits, limit)
+			}
+
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+
+	return limits, skipped, nil
+}
+
+// legacyLimit maps one old key to the limit that enforces the same rule: the minimum deposit for
+// everyone, and the daily and per transaction transfer limits by default or per account
+func legacyLimit(key string, value string) (domain.Limit, bool) {
+	amount, err := domain.ParseMoney(value)
+	if err != nil {
+		return domain.Limit{}, false
+	}
+
+	limit := domain.Limit{Scope: domain.LimitScopeDefault, TransactionType: "transfer", Amount: &amount}
+
+	switch {
+	case key == legacyMinDepositKey:
+		limit.TransactionType, limit.Kind = "deposit", domain.LimitMinAmount
+	case key == legacyDefaultDailyLimitKey:
+		limit.Kind = domain.LimitDaily
+	case strings.HasPrefix(key, legacyDailyLimitPrefix):
+		limit.Scope, limit.ScopeRef, limit.Kind = domain.LimitScopeAccount, strings.TrimPrefix(key, legacyDailyLimitPrefix), domain.LimitDaily
+	case strings.HasPrefix(key, legacyPerTransactionPrefix):
+		limit.Scope, limit.ScopeRef, limit.Kind = domain.LimitScopeAccount, strings.TrimPrefix(key, legacyPerTransactionPrefix), domain.LimitPerTransaction
+	default:
+		return domain.Limit{}, false
+	}
+
+	return limit, limit.Validate() == nil
+}
@@ -0,0 +1,46 @@
+package redis
+
+import (
+	"testing"
+
+	"main/domain"
+)
+
+func TestLegacyLimit(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       domain.Limit
+	}{
+		{"min_deposit_amount", "100", domain.Limit{Scope: domain.LimitScopeDefault, TransactionType: "deposit", Kind: domain.LimitMinAmount}},
+		{"default_daily_limit", "50000", domain.Limit{Scope: domain.LimitScopeDefault, TransactionType: "transfer", Kind: domain.LimitDaily}},
+		{"daily_limit_1000000001", "20000.50", domain.Limit{Scope: domain.LimitScopeAccount, ScopeRef: "1000000001", TransactionType: "transfer", Kind: domain.LimitDaily}},
+		{"limit_per_transaction: 1000000001", "5000", domain.Limit{Scope: domain.LimitScopeAccount, ScopeRef: "1000000001", TransactionType: "transfer", Kind: domain.LimitPerTransaction}},
+	}
+
+	for _, tt := range tests {
+		got, ok := legacyLimit(tt.key, tt.value)
+		if !ok {
+			t.Errorf("%s was skipped", tt.key)
+			continue
+		}
+
+		amount, _ := domain.ParseMoney(tt.value)
+		if got.Scope != tt.want.Scope || got.ScopeRef != tt.want.ScopeRef || got.TransactionType != tt.want.TransactionType ||
+			got.Kind != tt.want.Kind || got.Amount == nil || got.Amount.Satang != amount.Satang {
+			t.Errorf("%s = %+v, want %+v of %s", tt.key, got, tt.want, tt.value)
+		}
+	}
+}
+
+func TestLegacyLimitSkipsWhatIsNoLimit(t *testing.T) {
+	// 0 per transaction meant no limit, the rest can not be parsed
+	for key, value := range map[string]string{
+		"limit_per_transaction: 1000000001": "0",
+		"daily_limit_1000000002":            "lots",
+		"daily_transaction_1000000001":      "300",
+	} {
+		if limit, ok := legacyLimit(key, value); ok {
+			t.Errorf("%s = %q became %+v", key, value, limit)
+		}
+	}
+}
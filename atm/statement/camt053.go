@@ -0,0 +1,153 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+
+	"main/domain"
+)
+
+const (
+	camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+	isoDateTime      = "2006-01-02T15:04:05"
+	isoDate          = "2006-01-02"
+)
+
+type camtDocument struct {
+	XMLName xml.Name     `xml:"Document"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Stmt    camtBkToCstm `xml:"BkToCstmrStmt"`
+}
+
+type camtBkToCstm struct {
+	GrpHdr camtGrpHdr    `xml:"GrpHdr"`
+	Stmt   camtStatement `xml:"Stmt"`
+}
+
+type camtGrpHdr struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type camtStatement struct {
+	Id        string        `xml:"Id"`
+	CreDtTm   string        `xml:"CreDtTm"`
+	FrToDt    camtFrToDt    `xml:"FrToDt"`
+	Acct      camtAccount   `xml:"Acct"`
+	Bal       []camtBalance `xml:"Bal"`
+	TxsSummry camtSummary   `xml:"TxsSummry"`
+	Ntry      []camtEntry   `xml:"Ntry"`
+}
+
+type camtFrToDt struct {
+	FrDtTm string `xml:"FrDtTm"`
+	ToDtTm string `xml:"ToDtTm"`
+}
+
+type camtAccount struct {
+	Id   string `xml:"Id>Othr>Id"`
+	Ccy  string `xml:"Ccy"`
+	Nm   string `xml:"Nm,omitempty"`
+	Svcr string `xml:"Svcr>FinInstnId>Nm,omitempty"`
+}
+
+type camtAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Dt        string     `xml:"Dt>Dt"`
+}
+
+type camtSummary struct {
+	TtlCdtNtries camtEntryCount `xml:"TtlCdtNtries"`
+	TtlDbtNtries camtEntryCount `xml:"TtlDbtNtries"`
+}
+
+type camtEntryCount struct {
+	NbOfNtries int    `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+}
+
+type camtEntry struct {
+	NtryRef   string     `xml:"NtryRef"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Sts       string     `xml:"Sts"`
+	BookgDt   string     `xml:"BookgDt>DtTm"`
+	ValDt     string     `xml:"ValDt>DtTm"`
+	BkTxCd    string     `xml:"BkTxCd>Prtry>Cd"`
+	TxId      string     `xml:"NtryDtls>TxDtls>Refs>TxId"`
+	AddtlInf  string     `xml:"NtryDtls>TxDtls>AddtlTxInf,omitempty"`
+}
+
+func camtIndicator(m domain.Money) string {
+	if m.IsNegative() {
+		return "DBIT"
+	}
+	return "CRDT"
+}
+
+// RenderCamt053 writes an ISO 20022 camt.053.001.02 bank to customer statement
+func RenderCamt053(st *domain.Statement) ([]byte, error) {
+	id := statementID(st)
+
+	doc := camtDocument{
+		Xmlns: camt053Namespace,
+		Stmt: camtBkToCstm{
+			GrpHdr: camtGrpHdr{MsgId: id, CreDtTm: st.GeneratedAt.Format(isoDateTime)},
+			Stmt: camtStatement{
+				Id:      id,
+				CreDtTm: st.GeneratedAt.Format(isoDateTime),
+				FrToDt:  camtFrToDt{FrDtTm: st.From.Format(isoDateTime), ToDtTm: lastDay(st).Format(isoDateTime)},
+				Acct:    camtAccount{Id: st.AccountNo, Ccy: st.Currency, Nm: st.AccountName, Svcr: st.Bank},
+				Bal: []camtBalance{
+					{Code: "OPBD", Amt: camtAmount{Ccy: st.Currency, Value: st.OpeningBalance.Abs().String()}, CdtDbtInd: camtIndicator(st.OpeningBalance), Dt: st.From.Format(isoDate)},
+					{Code: "CLBD", Amt: camtAmount{Ccy: st.Currency, Value: st.ClosingBalance.Abs().String()}, CdtDbtInd: camtIndicator(st.ClosingBalance), Dt: lastDay(st).Format(isoDate)},
+				},
+				TxsSummry: camtSummary{
+					TtlCdtNtries: camtEntryCount{Sum: st.TotalCredits.String()},
+					TtlDbtNtries: camtEntryCount{Sum: st.TotalDebits.String()},
+				},
+			},
+		},
+	}
+
+	for _, line := range st.Lines {
+		if line.Amount.IsNegative() {
+			doc.Stmt.Stmt.TxsSummry.TtlDbtNtries.NbOfNtries++
+		} else {
+			doc.Stmt.Stmt.TxsSummry.TtlCdtNtries.NbOfNtries++
+		}
+
+		reference := strconv.FormatInt(line.TransactionId, 10)
+		doc.Stmt.Stmt.Ntry = append(doc.Stmt.Stmt.Ntry, camtEntry{
+			NtryRef:   reference,
+			Amt:       camtAmount{Ccy: st.Currency, Value: line.Amount.Abs().String()},
+			CdtDbtInd: camtIndicator(line.Amount),
+			Sts:       "BOOK",
+			BookgDt:   line.BookedAt.Format(isoDateTime),
+			ValDt:     line.BookedAt.Format(isoDateTime),
+			BkTxCd:    line.Type,
+			TxId:      reference,
+			AddtlInf:  line.Description,
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
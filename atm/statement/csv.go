@@ -0,0 +1,51 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+
+	"main/domain"
+)
+
+const csvTimeFormat = "2006-01-02 15:04:05"
+
+// RenderCSV writes one row per line, framed by opening and closing balance rows
+func RenderCSV(st *domain.Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	rows := [][]string{
+		{"booked_at", "transaction_id", "type", "description", "counterparty", "debit", "credit", "balance", "currency"},
+		{st.From.Format(csvTimeFormat), "", "OPENING_BALANCE", "Opening balance", "", "", "", st.OpeningBalance.String(), st.Currency},
+	}
+
+	for _, line := range st.Lines {
+		debit, credit := "", ""
+		if line.Amount.IsNegative() {
+			debit = line.Amount.Abs().String()
+		} else {
+			credit = line.Amount.String()
+		}
+
+		rows = append(rows, []string{
+			line.BookedAt.Format(csvTimeFormat),
+			strconv.FormatInt(line.TransactionId, 10),
+			line.Type,
+			line.Description,
+			line.Counterparty,
+			debit,
+			credit,
+			line.Balance.String(),
+			st.Currency,
+		})
+	}
+
+	rows = append(rows, []string{lastDay(st).Format(csvTimeFormat), "", "CLOSING_BALANCE", "Closing balance", "", st.TotalDebits.String(), st.TotalCredits.String(), st.ClosingBalance.String(), st.Currency})
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"main/domain"
+)
+
+// mt940Amount formats an amount the SWIFT way: no sign and a decimal comma
+func mt940Amount(m domain.Money) string {
+	return strings.Replace(m.Abs().String(), ".", ",", 1)
+}
+
+func mt940Mark(m domain.Money) string {
+	if m.IsNegative() {
+		return "D"
+	}
+	return "C"
+}
+
+// RenderMT940 writes the text block of a SWIFT MT940 customer statement
+func RenderMT940(st *domain.Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	line := func(format string, args ...interface{}) {
+		buf.WriteString(fmt.Sprintf(format, args...))
+		buf.WriteString("\r\n")
+	}
+
+	line(":20:%s", truncate(statementID(st), 16))
+	line(":25:%s", st.AccountNo)
+	line(":28C:%s/1", st.From.Format("0601"))
+	line(":60F:%s%s%s%s", mt940Mark(st.OpeningBalance), st.From.Format("060102"), st.Currency, mt940Amount(st.OpeningBalance))
+
+	for _, l := range st.Lines {
+		reference := strconv.FormatInt(l.TransactionId, 10)
+		line(":61:%s%s%s%s%s%s//%s",
+			l.BookedAt.Format("060102"),
+			l.BookedAt.Format("0102"),
+			mt940Mark(l.Amount),
+			mt940Amount(l.Amount),
+			mt940TransactionType(l),
+			truncate(reference, 16),
+			truncate(reference, 16),
+		)
+		line(":86:%s", truncate(mt940Text(l.Description), 65))
+	}
+
+	line(":62F:%s%s%s%s", mt940Mark(st.ClosingBalance), lastDay(st).Format("060102"), st.Currency, mt940Amount(st.ClosingBalance))
+	line("-")
+
+	return buf.Bytes(), nil
+}
+
+func mt940TransactionType(line domain.StatementLine) string {
+	if line.Type == "transfer" {
+		return "NTRF"
+	}
+	return "NMSC"
+}
+
+// mt940Text keeps to the SWIFT x character set
+func mt940Text(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("/-?:().,'+ ", r):
+			return r
+		}
+		return ' '
+	}, s)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+
+	"main/domain"
+)
+
+const (
+	ofxHeader     = `<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>`
+	ofxTimeFormat = "20060102150405.000[-07:MST]"
+)
+
+type ofxDocument struct {
+	XMLName xml.Name   `xml:"OFX"`
+	SignOn  ofxSignOn  `xml:"SIGNONMSGSRSV1>SONRS"`
+	Bank    ofxStmtTrn `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxSignOn struct {
+	Status   ofxStatus `xml:"STATUS"`
+	DtServer string    `xml:"DTSERVER"`
+	Language string    `xml:"LANGUAGE"`
+}
+
+type ofxStmtTrn struct {
+	TrnUID string    `xml:"TRNUID"`
+	Status ofxStatus `xml:"STATUS"`
+	StmtRs ofxStmtRs `xml:"STMTRS"`
+}
+
+type ofxStmtRs struct {
+	CurDef    string      `xml:"CURDEF"`
+	BankAcct  ofxBankAcct `xml:"BANKACCTFROM"`
+	TranList  ofxTranList `xml:"BANKTRANLIST"`
+	LedgerBal ofxBalance  `xml:"LEDGERBAL"`
+	AvailBal  ofxBalance  `xml:"AVAILBAL"`
+}
+
+type ofxBankAcct struct {
+	BankID   string `xml:"BANKID"`
+	AcctID   string `xml:"ACCTID"`
+	AcctType string `xml:"ACCTTYPE"`
+}
+
+type ofxTranList struct {
+	DtStart      string       `xml:"DTSTART"`
+	DtEnd        string       `xml:"DTEND"`
+	Transactions []ofxStmtTrx `xml:"STMTTRN"`
+}
+
+type ofxStmtTrx struct {
+	TrnType  string `xml:"TRNTYPE"`
+	DtPosted string `xml:"DTPOSTED"`
+	TrnAmt   string `xml:"TRNAMT"`
+	FitID    string `xml:"FITID"`
+	Name     string `xml:"NAME,omitempty"`
+	Memo     string `xml:"MEMO,omitempty"`
+}
+
+type ofxBalance struct {
+	BalAmt string `xml:"BALAMT"`
+	DtAsOf string `xml:"DTASOF"`
+}
+
+// RenderOFX writes an OFX 2.2 bank statement response
+func RenderOFX(st *domain.Statement) ([]byte, error) {
+	doc := ofxDocument{
+		SignOn: ofxSignOn{
+			Status:   ofxStatus{Code: 0, Severity: "INFO"},
+			DtServer: st.GeneratedAt.Format(ofxTimeFormat),
+			Language: "ENG",
+		},
+		Bank: ofxStmtTrn{
+			TrnUID: statementID(st),
+			Status: ofxStatus{Code: 0, Severity: "INFO"},
+			StmtRs: ofxStmtRs{
+				CurDef: st.Currency,
+				BankAcct: ofxBankAcct{
+					BankID:   st.Bank,
+					AcctID:   st.AccountNo,
+					AcctType: "SAVINGS",
+				},
+				TranList: ofxTranList{
+					DtStart:      st.From.Format(ofxTimeFormat),
+					DtEnd:        st.To.Format(ofxTimeFormat),
+					Transactions: make([]ofxStmtTrx, 0, len(st.Lines)),
+				},
+				LedgerBal: ofxBalance{BalAmt: st.ClosingBalance.String(), DtAsOf: lastDay(st).Format(ofxTimeFormat)},
+				AvailBal:  ofxBalance{BalAmt: st.ClosingBalance.String(), DtAsOf: lastDay(st).Format(ofxTimeFormat)},
+			},
+		},
+	}
+
+	for _, line := range st.Lines {
+		doc.Bank.StmtRs.TranList.Transactions = append(doc.Bank.StmtRs.TranList.Transactions, ofxStmtTrx{
+			TrnType:  ofxTransactionType(line),
+			DtPosted: line.BookedAt.Format(ofxTimeFormat),
+			TrnAmt:   line.Amount.String(),
+			FitID:    strconv.FormatInt(line.TransactionId, 10),
+			Name:     line.Counterparty,
+			Memo:     line.Description,
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	buf.WriteString(ofxHeader + "\n")
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
+
+func ofxTransactionType(line domain.StatementLine) string {
+	switch line.Type {
+	case "deposit":
+		return "DEP"
+	case "withdraw":
+		return "ATM"
+	case "transfer":
+		return "XFER"
+	}
+
+	if line.Amount.IsNegative() {
+		return "DEBIT"
+	}
+	return "CREDIT"
+}
@@ -0,0 +1,52 @@
+package statement
+
+import (
+	"fmt"
+	"time"
+
+	"main/domain"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatOFX     = "ofx"
+	FormatMT940   = "mt940"
+	FormatCamt053 = "camt053"
+)
+
+// Rendered is a statement encoded in one of the export formats
+type Rendered struct {
+	ContentType string
+	Extension   string
+	Body        []byte
+}
+
+// Render encodes st in the requested format
+func Render(format string, st *domain.Statement) (*Rendered, error) {
+	switch format {
+	case FormatCSV, "":
+		body, err := RenderCSV(st)
+		return &Rendered{ContentType: "text/csv; charset=utf-8", Extension: "csv", Body: body}, err
+	case FormatOFX:
+		body, err := RenderOFX(st)
+		return &Rendered{ContentType: "application/x-ofx", Extension: "ofx", Body: body}, err
+	case FormatMT940:
+		body, err := RenderMT940(st)
+		return &Rendered{ContentType: "text/plain; charset=utf-8", Extension: "sta", Body: body}, err
+	case FormatCamt053:
+		body, err := RenderCamt053(st)
+		return &Rendered{ContentType: "application/xml", Extension: "xml", Body: body}, err
+	}
+
+	return nil, fmt.Errorf("unsupported statement format: %s", format)
+}
+
+// lastDay is the last calendar day covered by the half-open period
+func lastDay(st *domain.Statement) time.Time {
+	return st.To.Add(-time.Nanosecond)
+}
+
+// statementID identifies a statement by account and period
+func statementID(st *domain.Statement) string {
+	return fmt.Sprintf("%s%s", st.AccountNo, st.From.Format("060102"))
+}
@@ -0,0 +1,86 @@
+package statement
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var bangkok = time.FixedZone("ICT", 7*60*60)
+
+func goldenStatement() *domain.Statement {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, time.March, day, hour, min, 0, 0, bangkok)
+	}
+
+	return &domain.Statement{
+		AccountNo:      "1000000001",
+		AccountName:    "Somchai Jaidee",
+		Bank:           "KBANK",
+		Currency:       domain.DefaultCurrency,
+		From:           at(1, 0, 0),
+		To:             at(8, 0, 0),
+		OpeningBalance: domain.NewMoney(100000),
+		ClosingBalance: domain.NewMoney(142450),
+		TotalCredits:   domain.NewMoney(75000),
+		TotalDebits:    domain.NewMoney(32550),
+		GeneratedAt:    at(8, 9, 15),
+		Lines: []domain.StatementLine{
+			{TransactionId: 11, Type: "deposit", Description: "Deposit", Amount: domain.NewMoney(50000), Balance: domain.NewMoney(150000), BookedAt: at(2, 10, 0)},
+			{TransactionId: 12, Type: "withdraw", Description: "Withdrawal, fee 20.00", Amount: domain.NewMoney(-12000), Balance: domain.NewMoney(138000), BookedAt: at(3, 18, 45)},
+			{TransactionId: 13, Type: "transfer", Description: "Transfer to 2000000002, fee 10.00", Counterparty: "2000000002", Amount: domain.NewMoney(-20550), Balance: domain.NewMoney(117450), BookedAt: at(5, 8, 5)},
+			{TransactionId: 14, Type: "transfer", Description: "Transfer from 3000000003 & \"friends\"", Counterparty: "3000000003", Amount: domain.NewMoney(25000), Balance: domain.NewMoney(142450), BookedAt: at(7, 23, 59)},
+		},
+	}
+}
+
+func TestRenderGolden(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatOFX, FormatMT940, FormatCamt053} {
+		t.Run(format, func(t *testing.T) {
+			rendered, err := Render(format, goldenStatement())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "statement."+rendered.Extension)
+			if *update {
+				if err := os.WriteFile(golden, rendered.Body, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rendered.Body, want) {
+				t.Errorf("%s differs from %s, rerun with -update after checking the change\n%s", format, golden, rendered.Body)
+			}
+		})
+	}
+}
+
+func TestRenderEmptyStatement(t *testing.T) {
+	st := goldenStatement()
+	st.Lines = []domain.StatementLine{}
+	st.ClosingBalance, st.TotalCredits, st.TotalDebits = st.OpeningBalance, domain.NewMoney(0), domain.NewMoney(0)
+
+	for _, format := range []string{FormatCSV, FormatOFX, FormatMT940, FormatCamt053} {
+		if _, err := Render(format, st); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	if _, err := Render("pdf", goldenStatement()); err == nil {
+		t.Fatal("rendering pdf succeeded")
+	}
+}
@@ -0,0 +1,88 @@
+package thaiqr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"main/domain"
+)
+
+// EMVCo merchant presented QR data objects used by Thai QR payment codes
+const (
+	tagPayloadFormat     = "00"
+	tagPointOfInitiation = "01"
+	tagPromptPay         = "29"
+	tagCurrency          = "53"
+	tagAmount            = "54"
+	tagCountry           = "58"
+	tagCRC               = "63"
+
+	payloadFormat = "01"
+	staticCode    = "11"
+	dynamicCode   = "12"
+	currencyTHB   = "764"
+	countryTH     = "TH"
+)
+
+// field writes one data object as its id, two digit length and value
+func field(id, value string) string {
+	return fmt.Sprintf("%s%02d%s", id, len(value), value)
+}
+
+// parseFields reads the data objects of payload, the last one wins when an id repeats
+func parseFields(payload string) (map[string]string, error) {
+	fields := make(map[string]string)
+
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			return nil, domain.ErrInvalidQR
+		}
+
+		n, err := strconv.Atoi(payload[2:4])
+		if err != nil || len(payload) < 4+n {
+			return nil, domain.ErrInvalidQR
+		}
+
+		fields[payload[:2]] = payload[4 : 4+n]
+		payload = payload[4+n:]
+	}
+
+	return fields, nil
+}
+
+// appendCRC closes payload with the CRC data object, the CRC covers its own id and length
+func appendCRC(payload string) string {
+	payload += tagCRC + "04"
+	return payload + fmt.Sprintf("%04X", crc16(payload))
+}
+
+// checkCRC makes sure payload ends with a CRC data object that matches the rest of it
+func checkCRC(payload string) error {
+	if len(payload) < 8 || payload[len(payload)-8:len(payload)-4] != tagCRC+"04" {
+		return domain.ErrInvalidQR
+	}
+
+	body, sum := payload[:len(payload)-4], payload[len(payload)-4:]
+	if !strings.EqualFold(sum, fmt.Sprintf("%04X", crc16(body))) {
+		return domain.ErrQRChecksum
+	}
+
+	return nil
+}
+
+// crc16 is CRC-16/CCITT-FALSE, the checksum EMVCo QR codes carry
+func crc16(data string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,58 @@
+package thaiqr
+
+import (
+	"strings"
+	"testing"
+
+	"main/domain"
+)
+
+func TestCRC16(t *testing.T) {
+	// the check value of CRC-16/CCITT-FALSE
+	if got := crc16("123456789"); got != 0x29B1 {
+		t.Errorf("got %04X, want 29B1", got)
+	}
+}
+
+func TestCheckCRC(t *testing.T) {
+	payload := appendCRC(field(tagPayloadFormat, payloadFormat) + field(tagCountry, countryTH))
+	sum := payload[len(payload)-4:]
+
+	wrong := "0000"
+	if sum == wrong {
+		wrong = "FFFF"
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		err     error
+	}{
+		{"matching", payload, nil},
+		{"lower case", payload[:len(payload)-4] + strings.ToLower(sum), nil},
+		{"wrong sum", payload[:len(payload)-4] + wrong, domain.ErrQRChecksum},
+		{"changed body", strings.Replace(payload, countryTH, "US", 1), domain.ErrQRChecksum},
+		{"no CRC object", payload[:len(payload)-8], domain.ErrInvalidQR},
+		{"CRC of another length", payload[:len(payload)-6] + "05" + sum, domain.ErrInvalidQR},
+		{"too short", "6304", domain.ErrInvalidQR},
+	}
+
+	for _, tt := range tests {
+		if err := checkCRC(tt.payload); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := parseFields("000201" + "5303764" + "5802TH")
+	if err != nil || len(fields) != 3 || fields[tagCurrency] != currencyTHB || fields[tagCountry] != countryTH {
+		t.Errorf("got %v and %v", fields, err)
+	}
+
+	for _, payload := range []string{"000", "0002", "0004010", "00xx01"} {
+		if _, err := parseFields(payload); err != domain.ErrInvalidQR {
+			t.Errorf("%q: got %v, want ErrInvalidQR", payload, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package thaiqr
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+
+	"main/domain"
+)
+
+// PromptPay credit transfer merchant account information, data object 29
+const (
+	promptPayAID = "A000000677010111"
+
+	subTagAID         = "00"
+	subTagPhone       = "01"
+	subTagNationalID  = "02"
+	subTagEWallet     = "03"
+	subTagBankAccount = "04"
+)
+
+var ErrUnknownBank = errors.New("bank has no Thai QR bank code")
+
+// bankCodes are the Bank of Thailand codes of the banks that Account.Bank names
+var bankCodes = map[string]string{
+	"BBL":   "002",
+	"KBANK": "004",
+	"KTB":   "006",
+	"TMB":   "011",
+	"SCB":   "014",
+	"UOB":   "024",
+	"BAY":   "025",
+	"GSB":   "030",
+	"TBANK": "065",
+	"TISCO": "067",
+}
+
+// bankOfCode returns the bank with the Bank of Thailand code, empty when it is unknown
+func bankOfCode(code string) string {
+	for bank, c := range bankCodes {
+		if c == code {
+			return bank
+		}
+	}
+	return ""
+}
+
+type promptPayCodec struct {
+	size int
+}
+
+// NewPromptPayCodec will create an object that represent the domain.QRCodec interface.
+// Codes are rendered size pixels wide.
+func NewPromptPayCodec(size int) domain.QRCodec {
+	return &promptPayCodec{
+		size: size,
+	}
+}
+
+// Encode writes p as a PromptPay payload. An account is written as its bank code followed by
+// the account number, a phone proxy in the international form the standard asks for.
+func (q *promptPayCodec) Encode(p domain.QRPayment) (string, error) {
+	account := field(subTagAID, promptPayAID)
+
+	switch {
+	case p.Proxy != nil && p.Proxy.Type == domain.ProxyPhone:
+		account += field(subTagPhone, "0066"+strings.TrimPrefix(p.Proxy.Value, "0"))
+	case p.Proxy != nil && p.Proxy.Type == domain.ProxyNationalID:
+		account += field(subTagNationalID, p.Proxy.Value)
+	case p.Proxy != nil && p.Proxy.Type == domain.ProxyEWallet:
+		account += field(subTagEWallet, p.Proxy.Value)
+	case p.Proxy == nil && p.AccountNo != "":
+		code, ok := bankCodes[p.Bank]
+		if !ok {
+			return "", ErrUnknownBank
+		}
+		account += field(subTagBankAccount, code+p.AccountNo)
+	default:
+		return "", domain.ErrInvalidQR
+	}
+
+	initiation := staticCode
+	if p.Amount != nil {
+		if !p.Amount.IsPositive() {
+			return "", domain.ErrBadParamInput
+		}
+		initiation = dynamicCode
+	}
+
+	payload := field(tagPayloadFormat, payloadFormat) +
+		field(tagPointOfInitiation, initiation) +
+		field(tagPromptPay, account) +
+		field(tagCurrency, currencyTHB)
+	if p.Amount != nil {
+		payload += field(tagAmount, p.Amount.String())
+	}
+	payload += field(tagCountry, countryTH)
+
+	return appendCRC(payload), nil
+}
+
+// Decode reads a scanned PromptPay payload. Codes for other schemes, e.g. bill payments, and
+// codes in another currency are refused with domain.ErrInvalidQR.
+func (q *promptPayCodec) Decode(payload string) (p domain.QRPayment, err error) {
+	payload = strings.TrimSpace(payload)
+	if err = checkCRC(payload); err != nil {
+		return p, err
+	}
+
+	fields, err := parseFields(payload)
+	if err != nil {
+		return p, err
+	}
+
+	if fields[tagPayloadFormat] != payloadFormat || fields[tagCurrency] != currencyTHB {
+		return p, domain.ErrInvalidQR
+	}
+
+	if initiation, ok := fields[tagPointOfInitiation]; ok && initiation != staticCode && initiation != dynamicCode {
+		return p, domain.ErrInvalidQR
+	}
+
+	account, err := parseFields(fields[tagPromptPay])
+	if err != nil || account[subTagAID] != promptPayAID {
+		return p, domain.ErrInvalidQR
+	}
+
+	switch {
+	case account[subTagPhone] != "":
+		phone := account[subTagPhone]
+		if !strings.HasPrefix(phone, "0066") {
+			return p, domain.ErrInvalidQR
+		}
+		p.Proxy = &domain.ProxyRef{Type: domain.ProxyPhone, Value: "0" + phone[4:]}
+	case account[subTagNationalID] != "":
+		p.Proxy = &domain.ProxyRef{Type: domain.ProxyNationalID, Value: account[subTagNationalID]}
+	case account[subTagEWallet] != "":
+		p.Proxy = &domain.ProxyRef{Type: domain.ProxyEWallet, Value: account[subTagEWallet]}
+	case len(account[subTagBankAccount]) > 3:
+		value := account[subTagBankAccount]
+		if p.Bank = bankOfCode(value[:3]); p.Bank == "" {
+			return p, domain.ErrInvalidQR
+		}
+		p.AccountNo = value[3:]
+	default:
+		return p, domain.ErrInvalidQR
+	}
+
+	if p.Proxy != nil {
+		if err = p.Proxy.Normalize(); err != nil {
+			return p, domain.ErrInvalidQR
+		}
+	}
+
+	if value, ok := fields[tagAmount]; ok {
+		amount, err := domain.ParseMoney(value)
+		if err != nil || !amount.IsPositive() {
+			return p, domain.ErrInvalidQR
+		}
+		p.Amount = &amount
+	}
+
+	return p, nil
+}
+
+// PNG renders payload as a QR code with medium error correction
+func (q *promptPayCodec) PNG(payload string) ([]byte, error) {
+	code, err := qr.Encode(payload, qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err = barcode.Scale(code, q.size, q.size)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, code); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package thaiqr
+
+import (
+	"reflect"
+	"testing"
+
+	"main/domain"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	amount := domain.NewMoney(12550)
+
+	tests := []struct {
+		name string
+		p    domain.QRPayment
+	}{
+		{"phone", domain.QRPayment{Proxy: &domain.ProxyRef{Type: domain.ProxyPhone, Value: "0812345678"}}},
+		{"national id", domain.QRPayment{Proxy: &domain.ProxyRef{Type: domain.ProxyNationalID, Value: "1101700230716"}}},
+		{"e-wallet", domain.QRPayment{Proxy: &domain.ProxyRef{Type: domain.ProxyEWallet, Value: "140000000000001"}}},
+		{"account", domain.QRPayment{AccountNo: "1000000001", Bank: "KBANK"}},
+		{"phone with amount", domain.QRPayment{Proxy: &domain.ProxyRef{Type: domain.ProxyPhone, Value: "0812345678"}, Amount: &amount}},
+		{"account with amount", domain.QRPayment{AccountNo: "1000000009", Bank: "BBL", Amount: &amount}},
+	}
+
+	codec := NewPromptPayCodec(256)
+	for _, tt := range tests {
+		payload, err := codec.Encode(tt.p)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		got, err := codec.Decode(payload)
+		if err != nil {
+			t.Errorf("%s: %q: %v", tt.name, payload, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.p) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.p)
+		}
+
+		fields, _ := parseFields(payload)
+		if initiation := fields[tagPointOfInitiation]; (initiation == dynamicCode) != (tt.p.Amount != nil) {
+			t.Errorf("%s: point of initiation %s", tt.name, initiation)
+		}
+	}
+}
+
+func TestEncodePhoneInInternationalForm(t *testing.T) {
+	payload, err := NewPromptPayCodec(256).Encode(domain.QRPayment{Proxy: &domain.ProxyRef{Type: domain.ProxyPhone, Value: "0812345678"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "000201" + "010211" + "2937" + "0016" + promptPayAID + "01130066812345678" + "5303764" + "5802TH" + "6304"
+	if payload[:len(payload)-4] != want {
+		t.Errorf("got %s, want %s and the CRC", payload, want)
+	}
+}
+
+func TestEncodeRefuses(t *testing.T) {
+	zero := domain.NewMoney(0)
+
+	tests := []struct {
+		name string
+		p    domain.QRPayment
+		err  error
+	}{
+		{"nothing to pay", domain.QRPayment{}, domain.ErrInvalidQR},
+		{"unknown bank", domain.QRPayment{AccountNo: "1000000001", Bank: "XYZ"}, ErrUnknownBank},
+		{"zero amount", domain.QRPayment{AccountNo: "1000000001", Bank: "KBANK", Amount: &zero}, domain.ErrBadParamInput},
+	}
+
+	codec := NewPromptPayCodec(256)
+	for _, tt := range tests {
+		if _, err := codec.Encode(tt.p); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeRefuses(t *testing.T) {
+	account := field(subTagAID, promptPayAID) + field(subTagBankAccount, "0041000000001")
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{"other currency", field(tagPayloadFormat, payloadFormat) + field(tagPromptPay, account) + field(tagCurrency, "840")},
+		{"other scheme", field(tagPayloadFormat, payloadFormat) + field(tagPromptPay, field(subTagAID, "A000000677010112")+field(subTagBankAccount, "0041000000001")) + field(tagCurrency, currencyTHB)},
+		{"unknown bank code", field(tagPayloadFormat, payloadFormat) + field(tagPromptPay, field(subTagAID, promptPayAID)+field(subTagBankAccount, "9991000000001")) + field(tagCurrency, currencyTHB)},
+		{"phone not international", field(tagPayloadFormat, payloadFormat) + field(tagPromptPay, field(subTagAID, promptPayAID)+field(subTagPhone, "0812345678")) + field(tagCurrency, currencyTHB)},
+		{"invalid national id", field(tagPayloadFormat, payloadFormat) + field(tagPromptPay, field(subTagAID, promptPayAID)+field(subTagNationalID, "1101700230717")) + field(tagCurrency, currencyTHB)},
+		{"zero amount", field(tagPayloadFormat, payloadFormat) + field(tagPromptPay, account) + field(tagCurrency, currencyTHB) + field(tagAmount, "0.00")},
+		{"other point of initiation", field(tagPayloadFormat, payloadFormat) + field(tagPointOfInitiation, "13") + field(tagPromptPay, account) + field(tagCurrency, currencyTHB)},
+	}
+
+	codec := NewPromptPayCodec(256)
+	for _, tt := range tests {
+		if _, err := codec.Decode(appendCRC(tt.payload)); err != domain.ErrInvalidQR {
+			t.Errorf("%s: got %v, want ErrInvalidQR", tt.name, err)
+		}
+	}
+}
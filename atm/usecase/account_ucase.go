@@ -2,29 +2,24 @@ package usecase
 
 import (
 	"context"
-	"fmt"
 	"math/rand"
 	"strconv"
 	"time"
 
 	"main/domain"
-
-	"github.com/go-redis/redis"
 )
 
 type accountUsecase struct {
 	accountRepo     domain.AccountRepository
 	transactionRepo domain.TransactionRepository
 	contextTimeout  time.Duration
-	redis           *redis.Client
 }
 
 // NewAccountUsecase will create new an accountUsecase object representation of domain.AccountUsecase interface
-func NewAccountUsecase(ar domain.AccountRepository, tr domain.TransactionRepository, redis *redis.Client, timeout time.Duration) domain.AccountUsecase {
+func NewAccountUsecase(ar domain.AccountRepository, tr domain.TransactionRepository, timeout time.Duration) domain.AccountUsecase {
 	return &accountUsecase{
 		accountRepo:     ar,
 		transactionRepo: tr,
-		redis:           redis,
 		contextTimeout:  timeout,
 	}
 }
@@ -178,42 +173,3 @@ func (a *accountUsecase) ValidateAccount(c context.Context, ar *domain.Account)
 	}
 	return
 }
-
-func (a *accountUsecase) GetDailyLimit(c context.Context, account_no string) (float64, error) {
-	cacheKey := fmt.Sprintf("daily_limit_%s", account_no)
-	dailyLimit, err := a.redis.Get(cacheKey).Result()
-	if err != nil {
-		// log.Printf("key: %s not found in redis", cacheKey)
-	}
-
-	if err == redis.Nil {
-		cacheKey := "default_daily_limit"
-		dailyLimit, err := a.redis.Get(cacheKey).Result()
-		if err != nil {
-			// log.Printf("key: %s not found in redis", cacheKey)
-		}
-		floatDailyLimit, _ := strconv.ParseFloat(dailyLimit, 64)
-		return floatDailyLimit, nil
-	}
-
-	floatDailyLimit, _ := strconv.ParseFloat(dailyLimit, 64)
-
-	return floatDailyLimit, nil
-}
-
-func (a *accountUsecase) GetSumDailyTransaction(c context.Context, account_no string) (float64, error) {
-	cacheKey := fmt.Sprintf("daily_transaction_%s", account_no)
-	sumDailyTransaction, err := a.redis.Get(cacheKey).Result()
-	// if err != nil {
-	// 	return 0, err
-	// }
-
-	if err == redis.Nil {
-		// log.Printf("key: %s not found in redis", cacheKey)
-		return 0, nil
-	}
-
-	floatSumDailyTransaction, _ := strconv.ParseFloat(sumDailyTransaction, 64)
-
-	return floatSumDailyTransaction, nil
-}
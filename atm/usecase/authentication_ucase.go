@@ -9,22 +9,22 @@ import (
 
 	"main/atm/utils"
 	"main/domain"
-	producer "main/kafka/producer"
 
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
-	"github.com/spf13/viper"
 )
 
 type authenticationUsecase struct {
 	authenticationRepo domain.AuthenticationRepository
+	publisher          domain.EventPublisher
 	contextTimeout     time.Duration
 }
 
 // NewAccountUsecase will create new an accountUsecase object representation of domain.AccountUsecase interface
-func NewAuthenticationUsecase(auth domain.AuthenticationRepository, timeout time.Duration) domain.AuthenticationUsecase {
+func NewAuthenticationUsecase(auth domain.AuthenticationRepository, publisher domain.EventPublisher, timeout time.Duration) domain.AuthenticationUsecase {
 	return &authenticationUsecase{
 		authenticationRepo: auth,
+		publisher:          publisher,
 		contextTimeout:     timeout,
 	}
 }
@@ -56,7 +56,6 @@ func (auth *authenticationUsecase) GenerateOtp(c context.Context, tel string) (s
 
 func (auth *authenticationUsecase) SendOtp(c context.Context, tel string) error {
 	topic := "sms"
-	brokerAddress := viper.GetString("kafka.broker_address")
 	ctx, cancel := context.WithTimeout(c, auth.contextTimeout)
 	defer cancel()
 	otp, err := auth.GenerateOtp(ctx, tel)
@@ -64,29 +63,50 @@ func (auth *authenticationUsecase) SendOtp(c context.Context, tel string) error
 		return err
 	}
 
-	producer.RunKafkaProducer(brokerAddress, topic, otp)
-	return nil
+	return auth.publisher.Publish(topic, tel, nil, []byte(otp))
 }
 
 func (auth *authenticationUsecase) ValidateOtp(c context.Context, tel string, otpUser string) bool {
 	ctx, cancel := context.WithTimeout(c, auth.contextTimeout)
 	defer cancel()
 
+	_, valid := auth.validateOtp(ctx, tel, otpUser)
+	return valid
+}
+
+func (auth *authenticationUsecase) ConsumeOtp(c context.Context, tel string, otpUser string) error {
+	ctx, cancel := context.WithTimeout(c, auth.contextTimeout)
+	defer cancel()
+
+	secretKey, valid := auth.validateOtp(ctx, tel, otpUser)
+	if !valid {
+		return domain.ErrInvalidOtp
+	}
+
+	if err := utils.EncodeBase64(&tel); err != nil {
+		return err
+	}
+
+	return auth.authenticationRepo.ExpireOtpSecret(ctx, tel, secretKey)
+}
+
+// validateOtp returns the secret otpUser was generated from when it is valid
+func (auth *authenticationUsecase) validateOtp(ctx context.Context, tel string, otpUser string) (string, bool) {
 	secretKey, expiredAt, err := auth.getSecretKeyByUUID(ctx, tel)
 
 	if secretKey == "" {
 		fmt.Println("key error")
-		return false
+		return "", false
 	}
 
 	if err != nil {
 		fmt.Println("OTP error")
-		return false
+		return "", false
 	}
 
 	if expiredAt.Before(time.Now()) {
 		fmt.Println("OTP expired")
-		return false
+		return "", false
 	}
 
 	validateOpts := totp.ValidateOpts{
@@ -99,10 +119,10 @@ func (auth *authenticationUsecase) ValidateOtp(c context.Context, tel string, ot
 	valid, err := totp.ValidateCustom(otpUser, secretKey, time.Now(), validateOpts)
 	if err != nil {
 		fmt.Println("OTP error")
-		return false
+		return "", false
 	}
 
-	return valid
+	return secretKey, valid
 }
 
 func (auth *authenticationUsecase) getSecretKeyByUUID(c context.Context, tel string) (string, time.Time, error) {
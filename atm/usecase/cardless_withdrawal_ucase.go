@@ -0,0 +1,201 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	"main/atm/utils"
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	cardlessCodeDigits      = 6
+	cardlessReferenceDigits = 10
+)
+
+// CreateCardlessWithdrawal quotes the fee of the withdrawal and holds the amount plus the fee on
+// the account. The code is only in the returned withdrawal, a hash of it is what is kept.
+func (a *transactionUsecase) CreateCardlessWithdrawal(c context.Context, uuid string, accountNo string, req domain.CardlessWithdrawalRequest) (*domain.CardlessWithdrawal, error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	if !req.Amount.IsPositive() {
+		return nil, domain.ErrBadParamInput
+	}
+
+	code, err := randomDigits(cardlessCodeDigits)
+	if err != nil {
+		return nil, err
+	}
+
+	reference, err := randomDigits(cardlessReferenceDigits)
+	if err != nil {
+		return nil, err
+	}
+
+	codeHash := code
+	if err = utils.HashPinBcrypt(&codeHash); err != nil {
+		return nil, err
+	}
+
+	w := &domain.CardlessWithdrawal{
+		Reference: reference,
+		AccountNo: accountNo,
+		Uuid:      uuid,
+		Amount:    req.Amount,
+		CodeHash:  codeHash,
+		Status:    domain.CardlessPending,
+	}
+
+	err = a.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		acc, err := a.accountRepo.GetAccountByAccountNoForUpdate(ctx, accountNo)
+		if err != nil {
+			return err
+		}
+
+		if acc.Uuid != uuid {
+			return domain.ErrNotFound
+		}
+
+		if acc.Status == "inactive" {
+			return domain.ErrAccDeleted
+		}
+
+		quote := domain.Transaction{Type: "withdraw", Amount: req.Amount, Account: *acc, Channel: domain.ChannelCardless}
+
+		if err = a.limitUsecase.CheckLimits(ctx, &quote, acc); err != nil {
+			return err
+		}
+
+		if err = a.feeUsecase.ApplyFee(ctx, &quote, acc, nil); err != nil {
+			return err
+		}
+
+		if err = a.checkFunds(ctx, acc, quote.Total); err != nil {
+			return err
+		}
+
+		w.Hold = quote.Total
+		w.ExpiresAt = time.Now().Add(a.cardlessPolicy.TTL)
+		return a.cardlessRepo.CreateCardlessWithdrawal(ctx, w)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w.Code = code
+	return w, nil
+}
+
+// RedeemCardlessWithdrawal books the withdraw, the notes the terminal pays out included, in the
+// unit of work that marks the withdrawal redeemed, so the hold goes exactly when the money leaves
+// the account
+func (a *transactionUsecase) RedeemCardlessWithdrawal(c context.Context, terminalId string, req domain.CardlessRedemption) (*domain.Transaction, error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	w, err := a.checkCardlessCode(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &domain.Transaction{
+		Type:        "withdraw",
+		Amount:      w.Amount,
+		Account:     domain.Account{AccountNo: w.AccountNo},
+		Channel:     domain.ChannelCardless,
+		TerminalId:  terminalId,
+		Remark:      "cardless withdrawal " + w.Reference,
+		SubmittedAt: time.Now(),
+	}
+
+	err = a.withdraw(ctx, tr, nil, func(ctx context.Context) error {
+		// locked again so that two terminals can not both pay it out
+		w, err := a.cardlessRepo.GetCardlessWithdrawalByReferenceForUpdate(ctx, req.Reference)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if !w.IsHolding(now) {
+			return domain.ErrCardlessNotFound
+		}
+
+		w.Status, w.TransactionId, w.TerminalId, w.RedeemedAt = domain.CardlessRedeemed, tr.Id, terminalId, &now
+		return a.cardlessRepo.UpdateCardlessWithdrawal(ctx, &w)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tr, nil
+}
+
+// checkCardlessCode counts a wrong code in a unit of work of its own, so the attempt sticks
+// although the redemption fails. Used up attempts block the withdrawal and release the hold.
+func (a *transactionUsecase) checkCardlessCode(ctx context.Context, req domain.CardlessRedemption) (w domain.CardlessWithdrawal, err error) {
+	wrongCode := false
+
+	err = a.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		w, err = a.cardlessRepo.GetCardlessWithdrawalByReferenceForUpdate(ctx, req.Reference)
+		if err != nil {
+			return err
+		}
+
+		if !w.IsHolding(time.Now()) {
+			return domain.ErrCardlessNotFound
+		}
+
+		if utils.ComparePins(w.CodeHash, req.Code) == nil {
+			return nil
+		}
+
+		wrongCode = true
+		w.Attempts++
+		if w.Attempts >= a.cardlessPolicy.MaxAttempts {
+			w.Status = domain.CardlessBlocked
+		}
+		return a.cardlessRepo.UpdateCardlessWithdrawal(ctx, &w)
+	})
+	if err == nil && wrongCode {
+		err = domain.ErrInvalidCardlessCode
+	}
+
+	return w, err
+}
+
+// ExpireCardlessWithdrawals is run by the poller. Holds stop counting at their expiry anyway,
+// this records the withdrawals as expired.
+func (a *transactionUsecase) ExpireCardlessWithdrawals(c context.Context, now time.Time) error {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	n, err := a.cardlessRepo.ExpireCardlessWithdrawals(ctx, now)
+	if err != nil {
+		logrus.Error(err)
+		return err
+	}
+
+	if n > 0 {
+		logrus.Infof("expired %d cardless withdrawals", n)
+	}
+
+	return nil
+}
+
+// randomDigits returns n digits from a cryptographically secure source
+func randomDigits(n int) (string, error) {
+	digits := make([]byte, n)
+	for i := range digits {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		digits[i] = byte('0' + d.Int64())
+	}
+	return string(digits), nil
+}
@@ -0,0 +1,177 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+var testCardlessPolicy = domain.CardlessPolicy{TTL: 15 * time.Minute, MaxAttempts: 3}
+
+func newCardlessTest() (*memDB, *transactionUsecase, *testTerminals) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	tu := newTestUsecases(db).transaction
+	tu.cardlessPolicy = testCardlessPolicy
+	terminals := tu.terminalUsecase.(*testTerminals)
+	return db, tu, terminals
+}
+
+func createCardless(t *testing.T, tu *transactionUsecase, satang int64) *domain.CardlessWithdrawal {
+	t.Helper()
+
+	w, err := tu.CreateCardlessWithdrawal(context.Background(), "0811111111", "1000000001", domain.CardlessWithdrawalRequest{Amount: domain.NewMoney(satang)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func held(t *testing.T, db *memDB) int64 {
+	t.Helper()
+
+	amount, err := memCardlessRepo{db: db}.GetHeldAmount(context.Background(), "1000000001", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amount.Satang
+}
+
+// wrongCode is a code of the right length that is not code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestCreateCardlessWithdrawalHoldsTheAmount(t *testing.T) {
+	db, tu, _ := newCardlessTest()
+	ctx := context.Background()
+
+	if _, err := tu.CreateCardlessWithdrawal(ctx, "0899999999", "1000000001", domain.CardlessWithdrawalRequest{Amount: domain.NewMoney(10000)}); err != domain.ErrNotFound {
+		t.Fatalf("another user's account: got %v, want ErrNotFound", err)
+	}
+	if _, err := tu.CreateCardlessWithdrawal(ctx, "0811111111", "1000000001", domain.CardlessWithdrawalRequest{}); err != domain.ErrBadParamInput {
+		t.Fatalf("no amount: got %v, want ErrBadParamInput", err)
+	}
+
+	w := createCardless(t, tu, 30000)
+	if len(w.Code) != cardlessCodeDigits || len(w.Reference) != cardlessReferenceDigits || w.Status != domain.CardlessPending {
+		t.Fatalf("got %+v", w)
+	}
+	if kept := db.cardless[w.Reference]; kept.Code != "" || kept.CodeHash == w.Code {
+		t.Errorf("the code is kept as it is")
+	}
+	if got := held(t, db); got != 30000 {
+		t.Fatalf("holds %d satang, want 30000", got)
+	}
+
+	// the balance is untouched, but what it holds can not be spent
+	if balance := db.account("1000000001").Balance.Satang; balance != 50000 {
+		t.Errorf("balance is %d satang, want 50000", balance)
+	}
+	tr := &domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(30000), Account: domain.Account{AccountNo: "1000000001"}, TerminalId: "ATM-0001"}
+	if err := tu.withdraw(ctx, tr, nil, nil); err != domain.ErrInsufficientBalance {
+		t.Fatalf("withdrawing the held money: got %v, want ErrInsufficientBalance", err)
+	}
+	if _, err := tu.CreateCardlessWithdrawal(ctx, "0811111111", "1000000001", domain.CardlessWithdrawalRequest{Amount: domain.NewMoney(30000)}); err != domain.ErrInsufficientBalance {
+		t.Fatalf("holding the held money again: got %v, want ErrInsufficientBalance", err)
+	}
+}
+
+func TestRedeemCardlessWithdrawal(t *testing.T) {
+	db, tu, terminals := newCardlessTest()
+	ctx := context.Background()
+	w := createCardless(t, tu, 30000)
+
+	tr, err := tu.RedeemCardlessWithdrawal(ctx, "ATM-0001", domain.CardlessRedemption{Reference: w.Reference, Code: w.Code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Channel != domain.ChannelCardless || tr.TerminalId != "ATM-0001" || len(terminals.dispensed) != 1 {
+		t.Errorf("got %+v, dispensed %v", tr, terminals.dispensed)
+	}
+
+	redeemed := db.cardless[w.Reference]
+	if redeemed.Status != domain.CardlessRedeemed || redeemed.TransactionId != tr.Id || redeemed.TerminalId != "ATM-0001" || redeemed.RedeemedAt == nil {
+		t.Errorf("withdrawal is %+v after redemption", redeemed)
+	}
+	if got := held(t, db); got != 0 {
+		t.Errorf("still holds %d satang", got)
+	}
+	if balance := db.account("1000000001").Balance.Satang; balance != 20000 {
+		t.Errorf("balance is %d satang, want 20000", balance)
+	}
+
+	if _, err = tu.RedeemCardlessWithdrawal(ctx, "ATM-0002", domain.CardlessRedemption{Reference: w.Reference, Code: w.Code}); err != domain.ErrCardlessNotFound {
+		t.Fatalf("redeeming twice: got %v, want ErrCardlessNotFound", err)
+	}
+	if len(terminals.dispensed) != 1 {
+		t.Errorf("dispensed %v, want only the first redemption", terminals.dispensed)
+	}
+}
+
+func TestCardlessWrongCodesBlock(t *testing.T) {
+	db, tu, terminals := newCardlessTest()
+	ctx := context.Background()
+	w := createCardless(t, tu, 30000)
+	wrong := domain.CardlessRedemption{Reference: w.Reference, Code: wrongCode(w.Code)}
+
+	for attempt := 1; attempt < testCardlessPolicy.MaxAttempts; attempt++ {
+		if _, err := tu.RedeemCardlessWithdrawal(ctx, "ATM-0001", wrong); err != domain.ErrInvalidCardlessCode {
+			t.Fatalf("attempt %d: got %v, want ErrInvalidCardlessCode", attempt, err)
+		}
+		// the failed redemption rolls back, the attempt stays counted
+		if got := db.cardless[w.Reference]; got.Attempts != attempt || got.Status != domain.CardlessPending {
+			t.Fatalf("attempt %d: got %d attempts, %s", attempt, got.Attempts, got.Status)
+		}
+	}
+
+	if _, err := tu.RedeemCardlessWithdrawal(ctx, "ATM-0001", wrong); err != domain.ErrInvalidCardlessCode {
+		t.Fatalf("last attempt: got %v, want ErrInvalidCardlessCode", err)
+	}
+	if got := db.cardless[w.Reference].Status; got != domain.CardlessBlocked {
+		t.Fatalf("withdrawal is %s, want blocked", got)
+	}
+	if got := held(t, db); got != 0 {
+		t.Errorf("a blocked withdrawal holds %d satang", got)
+	}
+
+	if _, err := tu.RedeemCardlessWithdrawal(ctx, "ATM-0001", domain.CardlessRedemption{Reference: w.Reference, Code: w.Code}); err != domain.ErrCardlessNotFound {
+		t.Fatalf("right code after the block: got %v, want ErrCardlessNotFound", err)
+	}
+	if len(terminals.dispensed) != 0 || db.account("1000000001").Balance.Satang != 50000 {
+		t.Errorf("a blocked withdrawal was paid out")
+	}
+}
+
+func TestCardlessWithdrawalExpires(t *testing.T) {
+	db, tu, _ := newCardlessTest()
+	ctx := context.Background()
+	w := createCardless(t, tu, 30000)
+
+	expired := db.cardless[w.Reference]
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	db.cardless[w.Reference] = expired
+
+	// the hold stops counting at the expiry, before the poller gets to it
+	if got := held(t, db); got != 0 {
+		t.Errorf("an expired withdrawal holds %d satang", got)
+	}
+	if _, err := tu.RedeemCardlessWithdrawal(ctx, "ATM-0001", domain.CardlessRedemption{Reference: w.Reference, Code: w.Code}); err != domain.ErrCardlessNotFound {
+		t.Fatalf("got %v, want ErrCardlessNotFound", err)
+	}
+
+	if err := tu.ExpireCardlessWithdrawals(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.cardless[w.Reference].Status; got != domain.CardlessExpired {
+		t.Errorf("withdrawal is %s, want expired", got)
+	}
+	if balance := db.account("1000000001").Balance.Satang; balance != 50000 {
+		t.Errorf("balance is %d satang, want 50000", balance)
+	}
+}
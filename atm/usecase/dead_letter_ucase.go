@@ -0,0 +1,282 @@
+package usecase
+
+import (
+	"context"
+	"expvar"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+	// a dead letter replaying for longer than deadLetterReplayTimeout was cut short, e.g. by a
+	// restart, and can be replayed again
+	deadLetterReplayTimeout = time.Minute
+)
+
+// deadLetterDepth is the number of dead letters waiting per topic, refreshed by WatchDeadLetters
+var deadLetterDepth = expvar.NewMap("dead_letters_pending")
+
+type deadLetterUsecase struct {
+	deadLetterRepo domain.DeadLetterRepository
+	publisher      domain.EventPublisher
+	unitOfWork     domain.UnitOfWork
+	contextTimeout time.Duration
+	redacted       map[string]bool
+}
+
+// NewDeadLetterUsecase will create new an deadLetterUsecase object representation of domain.DeadLetterUsecase interface.
+// The payloads of the redactedTopics are not kept, as they hold secrets such as OTPs.
+func NewDeadLetterUsecase(dr domain.DeadLetterRepository, publisher domain.EventPublisher, uow domain.UnitOfWork, timeout time.Duration, redactedTopics []string) domain.DeadLetterUsecase {
+	redacted := make(map[string]bool, len(redactedTopics))
+	for _, topic := range redactedTopics {
+		redacted[topic] = true
+	}
+
+	return &deadLetterUsecase{
+		deadLetterRepo: dr,
+		publisher:      publisher,
+		unitOfWork:     uow,
+		contextTimeout: timeout,
+		redacted:       redacted,
+	}
+}
+
+// StoreDeadLetter keeps a message of a dead letter topic with the details the retries left in its headers
+func (d *deadLetterUsecase) StoreDeadLetter(c context.Context, message *domain.Message) error {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	dl := domain.DeadLetter{
+		Topic:     strings.TrimSuffix(message.Topic, ".dlq"),
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       message.Key,
+		Payload:   message.Value,
+		Headers:   make(map[string]string, len(message.Headers)),
+		Status:    domain.DeadLetterPending,
+		FailedAt:  message.Timestamp,
+	}
+
+	for k, v := range message.Headers {
+		dl.Headers[k] = v
+	}
+
+	if topic := dl.Headers[domain.HeaderOriginalTopic]; topic != "" {
+		dl.Topic = topic
+	}
+	if partition, err := strconv.ParseInt(dl.Headers[domain.HeaderOriginalPartition], 10, 32); err == nil {
+		dl.OriginalPartition = int32(partition)
+	}
+	if offset, err := strconv.ParseInt(dl.Headers[domain.HeaderOriginalOffset], 10, 64); err == nil {
+		dl.OriginalOffset = offset
+	}
+	if failedAt, err := time.Parse(time.RFC3339Nano, dl.Headers[domain.HeaderFailedAt]); err == nil {
+		dl.FailedAt = failedAt
+	}
+	dl.Attempts, _ = strconv.Atoi(dl.Headers[domain.HeaderAttempts])
+	dl.Error = dl.Headers[domain.HeaderError]
+
+	if d.redacted[dl.Topic] {
+		dl.Payload, dl.Redacted = nil, true
+	}
+
+	return d.deadLetterRepo.CreateDeadLetter(ctx, &dl)
+}
+
+func (d *deadLetterUsecase) GetDeadLetters(c context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultDeadLetterLimit
+	}
+	if filter.Limit > maxDeadLetterLimit {
+		filter.Limit = maxDeadLetterLimit
+	}
+
+	return d.deadLetterRepo.GetDeadLetters(ctx, filter)
+}
+
+func (d *deadLetterUsecase) GetDeadLetterByID(c context.Context, id int64) (*domain.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	dl, err := d.deadLetterRepo.GetDeadLetterByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dl, nil
+}
+
+// UpdateDeadLetter fixes up a pending dead letter, e.g. a payload no consumer could read
+func (d *deadLetterUsecase) UpdateDeadLetter(c context.Context, id int64, edit domain.DeadLetterEdit) (*domain.DeadLetter, error) {
+	return d.change(c, id, isPending, func(dl *domain.DeadLetter) error {
+		if edit.Key != nil {
+			dl.Key = *edit.Key
+		}
+		if edit.Payload != nil {
+			dl.Payload = edit.Payload
+		}
+		if edit.Headers != nil {
+			dl.Headers = edit.Headers
+		}
+		return nil
+	})
+}
+
+// ReplayDeadLetter sends the dead letter back to its topic with the headers it came with. It is
+// marked replaying before the publish and replayed after it, so no row stays locked while Kafka
+// is waited for; a failed publish puts it back to pending. A replay cut short in between can be
+// replayed again after deadLetterReplayTimeout, the message may then go out twice.
+func (d *deadLetterUsecase) ReplayDeadLetter(c context.Context, id int64) (*domain.DeadLetter, error) {
+	dl, err := d.change(c, id, replayable, func(dl *domain.DeadLetter) error {
+		if dl.Redacted {
+			return domain.ErrDeadLetterRedacted
+		}
+		dl.Status = domain.DeadLetterReplaying
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string, len(dl.Headers)+1)
+	for k, v := range dl.Headers {
+		switch k {
+		case domain.HeaderOriginalTopic, domain.HeaderOriginalPartition, domain.HeaderOriginalOffset,
+			domain.HeaderAttempts, domain.HeaderError, domain.HeaderFailedAt, domain.HeaderRetryAt:
+		default:
+			headers[k] = v
+		}
+	}
+	headers[domain.HeaderReplayedFrom] = strconv.FormatInt(dl.Id, 10)
+
+	errPublish := d.publisher.Publish(dl.Topic, dl.Key, headers, dl.Payload)
+
+	dl, err = d.change(c, id, isReplaying, func(dl *domain.DeadLetter) error {
+		if errPublish != nil {
+			dl.Status = domain.DeadLetterPending
+			return nil
+		}
+
+		now := time.Now()
+		dl.Status, dl.ReplayedAt = domain.DeadLetterReplayed, &now
+		return nil
+	})
+	if errPublish != nil {
+		return nil, errPublish
+	}
+
+	return dl, err
+}
+
+func (d *deadLetterUsecase) DiscardDeadLetter(c context.Context, id int64) (*domain.DeadLetter, error) {
+	return d.change(c, id, isPending, func(dl *domain.DeadLetter) error {
+		dl.Status = domain.DeadLetterDiscarded
+		return nil
+	})
+}
+
+// GetDeadLetterStats is the depth of the dead letter queues
+func (d *deadLetterUsecase) GetDeadLetterStats(c context.Context) ([]domain.DeadLetterStats, error) {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	return d.deadLetterRepo.GetDeadLetterStats(ctx)
+}
+
+// WatchDeadLetters refreshes deadLetterDepth every interval, a topic without dead letters left goes back to 0
+func (d *deadLetterUsecase) WatchDeadLetters(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.updateDepth(ctx); err != nil {
+			logrus.Error(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *deadLetterUsecase) updateDepth(ctx context.Context) error {
+	stats, err := d.GetDeadLetterStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	depth := make(map[string]int64, len(stats))
+	deadLetterDepth.Do(func(kv expvar.KeyValue) {
+		depth[kv.Key] = 0
+	})
+	for _, s := range stats {
+		depth[s.Topic] = s.Pending
+	}
+
+	for topic, pending := range depth {
+		v := new(expvar.Int)
+		v.Set(pending)
+		deadLetterDepth.Set(topic, v)
+	}
+
+	return nil
+}
+
+func isPending(dl *domain.DeadLetter) bool {
+	return dl.Status == domain.DeadLetterPending
+}
+
+func isReplaying(dl *domain.DeadLetter) bool {
+	return dl.Status == domain.DeadLetterReplaying
+}
+
+// replayable is a pending dead letter or one whose replay was cut short
+func replayable(dl *domain.DeadLetter) bool {
+	return isPending(dl) || (isReplaying(dl) && time.Since(dl.UpdatedAt) > deadLetterReplayTimeout)
+}
+
+// change applies fn to a dead letter in the status from accepts under lock and saves it, fn runs
+// before the save so that its error rolls the change back
+func (d *deadLetterUsecase) change(c context.Context, id int64, from func(dl *domain.DeadLetter) bool, fn func(dl *domain.DeadLetter) error) (res *domain.DeadLetter, err error) {
+	ctx, cancel := context.WithTimeout(c, d.contextTimeout)
+	defer cancel()
+
+	err = d.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		dl, err := d.deadLetterRepo.GetDeadLetterByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if !from(&dl) {
+			return domain.ErrDeadLetterNotPending
+		}
+
+		if err = fn(&dl); err != nil {
+			return err
+		}
+
+		if err = d.deadLetterRepo.UpdateDeadLetter(ctx, &dl); err != nil {
+			return err
+		}
+
+		res = &dl
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,180 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+func newTestDeadLetters(db *memDB, publisher domain.EventPublisher) *deadLetterUsecase {
+	return NewDeadLetterUsecase(memDeadLetterRepo{db: db}, publisher, memUnitOfWork{db: db}, time.Second, []string{"sms"}).(*deadLetterUsecase)
+}
+
+// storeDeadLetter stores a message of the dead letter topic of topic as the router leaves it there
+func storeDeadLetter(t *testing.T, d *deadLetterUsecase, topic string, offset int64, payload string) int64 {
+	t.Helper()
+
+	message := &domain.Message{
+		Topic:  domain.DeadLetterTopic(topic),
+		Offset: offset,
+		Key:    "1000000001",
+		Value:  []byte(payload),
+		Headers: map[string]string{
+			domain.HeaderOriginalTopic: topic,
+			domain.HeaderAttempts:      "4",
+			domain.HeaderError:         "gateway unavailable",
+			"content-type":             "application/json",
+		},
+		Timestamp: time.Now(),
+	}
+	if err := d.StoreDeadLetter(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+
+	letters, _ := d.GetDeadLetters(context.Background(), domain.DeadLetterFilter{Topic: topic})
+	for _, dl := range letters {
+		if dl.Offset == offset {
+			return dl.Id
+		}
+	}
+	t.Fatalf("dead letter %s/%d not stored", topic, offset)
+	return 0
+}
+
+func TestStoreDeadLetterRedactsOTPs(t *testing.T) {
+	db := newMemDB()
+	p := &testPublisher{}
+	d := newTestDeadLetters(db, p)
+
+	id := storeDeadLetter(t, d, "sms", 1, "123456|0811111111")
+	dl, _ := d.GetDeadLetterByID(context.Background(), id)
+	if !dl.Redacted || len(dl.Payload) != 0 {
+		t.Errorf("got %q redacted %v, want the OTP dropped", dl.Payload, dl.Redacted)
+	}
+
+	if _, err := d.ReplayDeadLetter(context.Background(), id); err != domain.ErrDeadLetterRedacted {
+		t.Errorf("got %v, want %v", err, domain.ErrDeadLetterRedacted)
+	}
+	if dl, _ = d.GetDeadLetterByID(context.Background(), id); dl.Status != domain.DeadLetterPending || len(p.sent) != 0 {
+		t.Errorf("got %s, sent %v, want it pending and nothing sent", dl.Status, p.sent)
+	}
+
+	id = storeDeadLetter(t, d, "sms_transaction", 2, `{"type":"transaction.transfer"}`)
+	if dl, _ = d.GetDeadLetterByID(context.Background(), id); dl.Redacted || string(dl.Payload) != `{"type":"transaction.transfer"}` {
+		t.Errorf("got %q redacted %v, want the payload kept", dl.Payload, dl.Redacted)
+	}
+}
+
+func TestReplayPublishesOutsideTheUnitOfWork(t *testing.T) {
+	db := newMemDB()
+	p := &testPublisher{}
+	d := newTestDeadLetters(db, p)
+	id := storeDeadLetter(t, d, "sms_transaction", 1, `{"type":"transaction.transfer"}`)
+
+	p.publish = func(key string, message string) error {
+		// the row is not locked, it is marked replaying and cannot be replayed a second time
+		err := memUnitOfWork{db: db}.Do(context.Background(), func(ctx context.Context) error {
+			if !db.tryLock(ctx, deadLetterKey(id)) {
+				return errors.New("dead letter locked while it is published")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if dl, _ := d.GetDeadLetterByID(context.Background(), id); dl.Status != domain.DeadLetterReplaying {
+			return errors.New("dead letter is " + dl.Status + " while it is published")
+		}
+		if _, err = d.ReplayDeadLetter(context.Background(), id); err != domain.ErrDeadLetterNotPending {
+			return errors.New("replayed twice")
+		}
+		return nil
+	}
+
+	dl, err := d.ReplayDeadLetter(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dl.Status != domain.DeadLetterReplayed || dl.ReplayedAt == nil {
+		t.Errorf("got %s, want %s", dl.Status, domain.DeadLetterReplayed)
+	}
+	if len(p.sent["1000000001"]) != 1 {
+		t.Fatalf("sent %v, want the dead letter once", p.sent)
+	}
+	if p.headers[domain.HeaderReplayedFrom] == "" || p.headers[domain.HeaderAttempts] != "" || p.headers["content-type"] != "application/json" {
+		t.Errorf("got headers %v, want the original headers and where it was replayed from", p.headers)
+	}
+}
+
+func TestFailedReplayStaysPending(t *testing.T) {
+	db := newMemDB()
+	p := &testPublisher{publish: func(key string, message string) error {
+		return errors.New("broker unavailable")
+	}}
+	d := newTestDeadLetters(db, p)
+	id := storeDeadLetter(t, d, "sms_transaction", 1, `{"type":"transaction.transfer"}`)
+
+	if _, err := d.ReplayDeadLetter(context.Background(), id); err == nil {
+		t.Fatal("want the publish error")
+	}
+	if dl, _ := d.GetDeadLetterByID(context.Background(), id); dl.Status != domain.DeadLetterPending {
+		t.Errorf("got %s, want %s", dl.Status, domain.DeadLetterPending)
+	}
+}
+
+func TestReplayCutShortCanBeReplayed(t *testing.T) {
+	db := newMemDB()
+	p := &testPublisher{}
+	d := newTestDeadLetters(db, p)
+	id := storeDeadLetter(t, d, "sms_transaction", 1, `{"type":"transaction.transfer"}`)
+
+	setReplaying := func(since time.Time) {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		dl := db.deadLetters[id]
+		dl.Status, dl.UpdatedAt = domain.DeadLetterReplaying, since
+		db.deadLetters[id] = dl
+	}
+
+	setReplaying(time.Now())
+	if _, err := d.ReplayDeadLetter(context.Background(), id); err != domain.ErrDeadLetterNotPending {
+		t.Errorf("got %v, want %v while the replay may still run", err, domain.ErrDeadLetterNotPending)
+	}
+
+	setReplaying(time.Now().Add(-2 * deadLetterReplayTimeout))
+	if dl, err := d.ReplayDeadLetter(context.Background(), id); err != nil || dl.Status != domain.DeadLetterReplayed {
+		t.Errorf("got %v, want the replay taken over", err)
+	}
+}
+
+func TestDeadLetterDepthGauge(t *testing.T) {
+	db := newMemDB()
+	d := newTestDeadLetters(db, &testPublisher{})
+	sms := storeDeadLetter(t, d, "sms", 1, "123456|0811111111")
+	tx := storeDeadLetter(t, d, "sms_transaction", 2, `{"type":"transaction.transfer"}`)
+	storeDeadLetter(t, d, "sms_transaction", 3, `{"type":"transaction.transfer"}`)
+
+	if err := d.updateDepth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sms, tx := deadLetterDepth.Get("sms").String(), deadLetterDepth.Get("sms_transaction").String(); sms != "1" || tx != "2" {
+		t.Errorf("got sms %s, sms_transaction %s, want 1 and 2", sms, tx)
+	}
+
+	for _, id := range []int64{sms, tx} {
+		if _, err := d.DiscardDeadLetter(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.updateDepth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sms, tx := deadLetterDepth.Get("sms").String(), deadLetterDepth.Get("sms_transaction").String(); sms != "0" || tx != "1" {
+		t.Errorf("got sms %s, sms_transaction %s, want 0 and 1", sms, tx)
+	}
+}
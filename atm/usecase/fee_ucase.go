@@ -0,0 +1,189 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"main/domain"
+)
+
+type feeUsecase struct {
+	feeRepo         domain.FeeRepository
+	transactionRepo domain.TransactionRepository
+	unitOfWork      domain.UnitOfWork
+	contextTimeout  time.Duration
+}
+
+// NewFeeUsecase will create new an feeUsecase object representation of domain.FeeUsecase interface
+func NewFeeUsecase(fr domain.FeeRepository, tr domain.TransactionRepository, uow domain.UnitOfWork, timeout time.Duration) domain.FeeUsecase {
+	return &feeUsecase{
+		feeRepo:         fr,
+		transactionRepo: tr,
+		unitOfWork:      uow,
+		contextTimeout:  timeout,
+	}
+}
+
+// ApplyFee prices tr with the rule in force and sets Fee, Total and FeeRuleId. receiver is nil
+// for withdrawals. It runs inside the booking unit of work, so with acc locked the free quota
+// usage can not change underneath it.
+func (f *feeUsecase) ApplyFee(c context.Context, tr *domain.Transaction, acc *domain.Account, receiver *domain.Account) (err error) {
+	ctx, cancel := context.WithTimeout(c, f.contextTimeout)
+	defer cancel()
+
+	fc := domain.FeeContext{
+		TransactionType: tr.Type,
+		Channel:         tr.Channel,
+		Amount:          tr.Amount,
+		SourceBank:      acc.Bank,
+		Segment:         acc.Segment,
+	}
+	if receiver != nil {
+		fc.DestinationBank = receiver.Bank
+	}
+
+	now := time.Now()
+	rules, err := f.feeRepo.GetRulesEffectiveAt(ctx, tr.Type, now)
+	if err != nil {
+		return err
+	}
+
+	tr.Fee, tr.FeeRuleId = legacyFee(tr.Type, acc, receiver), 0
+
+	if rule := selectFeeRule(rules, fc); rule != nil {
+		var used int64
+		if rule.FeeType == domain.FeeFreeQuota {
+			monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+			usage, err := f.transactionRepo.GetTransactionUsage(ctx, acc.AccountNo, tr.Type, rule.Channel, monthStart)
+			if err != nil {
+				return err
+			}
+			used = usage.Count
+		}
+
+		if tr.Fee, err = rule.Calculate(tr.Amount, used); err != nil {
+			return err
+		}
+		tr.FeeRuleId = rule.Id
+	}
+
+	tr.Total, err = tr.Amount.Add(tr.Fee)
+	return err
+}
+
+func (f *feeUsecase) GetRules(c context.Context, at time.Time) ([]domain.FeeRule, error) {
+	ctx, cancel := context.WithTimeout(c, f.contextTimeout)
+	defer cancel()
+
+	return f.feeRepo.GetRulesEffectiveAt(ctx, "", at)
+}
+
+func (f *feeUsecase) GetRuleVersions(c context.Context, rule_key string) ([]domain.FeeRule, error) {
+	ctx, cancel := context.WithTimeout(c, f.contextTimeout)
+	defer cancel()
+
+	rules, err := f.feeRepo.GetRuleVersions(ctx, rule_key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rules) == 0 {
+		return nil, domain.ErrFeeRuleNotFound
+	}
+
+	return rules, nil
+}
+
+// CreateRule publishes rule as the next version of its RuleKey. The previous version stays
+// in force until the new one takes effect.
+func (f *feeUsecase) CreateRule(c context.Context, rule *domain.FeeRule) (err error) {
+	if err = rule.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c, f.contextTimeout)
+	defer cancel()
+
+	if rule.EffectiveFrom.IsZero() {
+		rule.EffectiveFrom = time.Now()
+	}
+
+	if rule.EffectiveTo != nil && !rule.EffectiveTo.After(rule.EffectiveFrom) {
+		return domain.ErrInvalidFeeRule
+	}
+
+	return f.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		latest, err := f.feeRepo.GetLatestRuleForUpdate(ctx, rule.RuleKey)
+		if err == domain.ErrFeeRuleNotFound {
+			rule.Version = 1
+			return f.feeRepo.CreateRule(ctx, rule)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !rule.EffectiveFrom.After(latest.EffectiveFrom) {
+			return domain.ErrInvalidFeeRule
+		}
+
+		if latest.EffectiveTo == nil || latest.EffectiveTo.After(rule.EffectiveFrom) {
+			if err = f.feeRepo.SetRuleEffectiveTo(ctx, latest.Id, rule.EffectiveFrom); err != nil {
+				return err
+			}
+		}
+
+		rule.Version = latest.Version + 1
+		return f.feeRepo.CreateRule(ctx, rule)
+	})
+}
+
+// ExpireRule ends the current version of rule_key at the given time without a successor
+func (f *feeUsecase) ExpireRule(c context.Context, rule_key string, at time.Time) (err error) {
+	ctx, cancel := context.WithTimeout(c, f.contextTimeout)
+	defer cancel()
+
+	return f.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		latest, err := f.feeRepo.GetLatestRuleForUpdate(ctx, rule_key)
+		if err != nil {
+			return err
+		}
+
+		if latest.EffectiveTo != nil && !latest.EffectiveTo.After(at) {
+			return nil
+		}
+
+		if at.Before(latest.EffectiveFrom) {
+			return domain.ErrInvalidFeeRule
+		}
+
+		return f.feeRepo.SetRuleEffectiveTo(ctx, latest.Id, at)
+	})
+}
+
+// selectFeeRule picks the matching rule with the highest priority, the most specific one on a tie
+func selectFeeRule(rules []domain.FeeRule, fc domain.FeeContext) (selected *domain.FeeRule) {
+	bestSpecificity := -1
+
+	for i := range rules {
+		ok, specificity := rules[i].Matches(fc)
+		if !ok {
+			continue
+		}
+
+		if selected == nil || rules[i].Priority > selected.Priority ||
+			(rules[i].Priority == selected.Priority && specificity > bestSpecificity) {
+			selected, bestSpecificity = &rules[i], specificity
+		}
+	}
+
+	return selected
+}
+
+// legacyFee is what was charged before fee rules existed, used when no rule matches:
+// 10 baht for a transfer to another bank
+func legacyFee(transactionType string, acc, receiver *domain.Account) domain.Money {
+	if transactionType == "transfer" && receiver != nil && acc.Bank != receiver.Bank {
+		return domain.NewMoney(1000)
+	}
+	return domain.NewMoney(0)
+}
@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"main/domain"
+)
+
+type idempotencyUsecase struct {
+	idempotencyRepo domain.IdempotencyRepository
+	ttl             time.Duration
+	lockTimeout     time.Duration
+}
+
+// NewIdempotencyUsecase will create new an idempotencyUsecase object representation of domain.IdempotencyUsecase interface.
+// ttl is how long a completed response is kept, lockTimeout how long an unfinished request holds its key.
+func NewIdempotencyUsecase(ir domain.IdempotencyRepository, ttl time.Duration, lockTimeout time.Duration) domain.IdempotencyUsecase {
+	return &idempotencyUsecase{
+		idempotencyRepo: ir,
+		ttl:             ttl,
+		lockTimeout:     lockTimeout,
+	}
+}
+
+func (i *idempotencyUsecase) Begin(ctx context.Context, scope string, key string, requestHash string) (*domain.IdempotencyRecord, error) {
+	record := &domain.IdempotencyRecord{
+		Key:         key,
+		Scope:       scope,
+		RequestHash: requestHash,
+		CreatedAt:   time.Now(),
+	}
+
+	// a second attempt covers the key expiring between Reserve and Get
+	for attempt := 0; attempt < 2; attempt++ {
+		reserved, err := i.idempotencyRepo.Reserve(ctx, record, i.lockTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+
+		existing, err := i.idempotencyRepo.Get(ctx, scope, key)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			continue
+		}
+
+		if existing.RequestHash != requestHash {
+			return nil, domain.ErrIdempotencyKeyReused
+		}
+		if !existing.Completed {
+			return nil, domain.ErrIdempotencyInProgress
+		}
+
+		return existing, nil
+	}
+
+	return nil, domain.ErrIdempotencyInProgress
+}
+
+func (i *idempotencyUsecase) Complete(ctx context.Context, scope string, key string, requestHash string, statusCode int, body []byte) error {
+	record := &domain.IdempotencyRecord{
+		Key:         key,
+		Scope:       scope,
+		RequestHash: requestHash,
+		Completed:   true,
+		StatusCode:  statusCode,
+		Body:        body,
+		CreatedAt:   time.Now(),
+	}
+
+	return i.idempotencyRepo.Save(ctx, record, i.ttl)
+}
+
+func (i *idempotencyUsecase) Release(ctx context.Context, scope string, key string) error {
+	return i.idempotencyRepo.Delete(ctx, scope, key)
+}
@@ -0,0 +1,353 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"main/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+// interbankReconcileBatch is how many unreported transfers one reconciliation looks at
+const interbankReconcileBatch = 100
+
+// bankOf gives the bank of an account number, its last digit names it as in GenerateAccountNo
+func (a *transactionUsecase) bankOf(accountNo string) string {
+	if accountNo == "" {
+		return ""
+	}
+	return a.accountUsecase.SelectBank(accountNo[len(accountNo)-1:])
+}
+
+// debitInterbankTransfer takes a transfer to another bank from the sender. The receiver is not
+// looked up or credited here, its own bank does that once the clearing house passed the money on.
+func (a *transactionUsecase) debitInterbankTransfer(ctx context.Context, tr *domain.Transaction, receiverBank string) (err error) {
+	if receiverBank == "" {
+		return domain.ErrResipientNotFound
+	}
+
+	acc, err := a.accountRepo.GetAccountByAccountNoForUpdate(ctx, tr.Account.AccountNo)
+	if err != nil {
+		return err
+	}
+
+	receiver := &domain.Account{AccountNo: tr.Receiver.AccountNo, Bank: receiverBank}
+
+	if err = a.limitUsecase.CheckLimits(ctx, tr, acc); err != nil {
+		return err
+	}
+
+	if err = a.feeUsecase.ApplyFee(ctx, tr, acc, receiver); err != nil {
+		return err
+	}
+
+	newBalance, err := acc.Balance.Sub(tr.Total)
+	if err != nil {
+		return err
+	}
+
+	if err = a.checkFunds(ctx, acc, tr.Total); err != nil {
+		return err
+	}
+
+	acc.Balance = newBalance
+
+	if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+		return err
+	}
+
+	tr.Account = *acc
+	tr.Receiver = *receiver
+	return nil
+}
+
+// submitInterbankTransfer records the clearing of a booked interbank transfer and queues its
+// credit transfer, which the relay only sends once the debit committed
+func (a *transactionUsecase) submitInterbankTransfer(ctx context.Context, tr *domain.Transaction) error {
+	now := time.Now()
+	it := domain.InterbankTransfer{
+		TransactionId:   tr.Id,
+		MessageId:       fmt.Sprintf("ATM%s%010d", now.Format("20060102150405"), tr.Id),
+		EndToEndId:      fmt.Sprintf("TR%010d", tr.Id),
+		DebtorAccount:   tr.Account.AccountNo,
+		DebtorBank:      tr.Account.Bank,
+		CreditorAccount: tr.Receiver.AccountNo,
+		CreditorBank:    tr.Receiver.Bank,
+		Amount:          tr.Amount,
+		Status:          domain.InterbankSent,
+		SentAt:          now,
+		LastSentAt:      now,
+	}
+
+	ev, err := a.clearing.CreditTransfer(&it)
+	if err != nil {
+		return err
+	}
+
+	if err = a.interbankRepo.CreateInterbankTransfer(ctx, &it); err != nil {
+		return err
+	}
+
+	return a.outboxRepo.CreateEvent(ctx, &ev)
+}
+
+// HandlePaymentStatus settles or returns the interbank transfer a status report is about. A
+// report seen again after it was handled changes nothing, and a transfer still in progress
+// at the clearing house waits for its final report.
+func (a *transactionUsecase) HandlePaymentStatus(c context.Context, message *domain.Message) error {
+	status, err := a.clearing.PaymentStatus(message)
+	if err != nil {
+		return domain.Permanent(err)
+	}
+
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	return a.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		it, err := a.interbankRepo.GetInterbankTransferByEndToEndIDForUpdate(ctx, status.OriginalEndToEndId)
+		if err == domain.ErrInterbankTransferNotFound {
+			return domain.Permanent(err)
+		}
+		if err != nil {
+			return err
+		}
+
+		if it.Status != domain.InterbankSent {
+			// the money went back to the sender already, the clearing house has to claw it back
+			if it.ReasonCode == domain.PaymentTimedOut && status.Status == domain.PaymentAccepted {
+				logrus.Errorf("interbank transfer %s settled after it was returned for want of a report", it.EndToEndId)
+			}
+			return nil
+		}
+
+		tr, err := a.transactionRepo.GetTransactionByTIDForUpdate(ctx, it.TransactionId)
+		if err != nil {
+			return err
+		}
+
+		switch status.Status {
+		case domain.PaymentAccepted:
+			err = a.settleInterbankTransfer(ctx, &tr, &it)
+		case domain.PaymentRejected:
+			err = a.returnInterbankTransfer(ctx, &tr, &it, status)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return a.interbankRepo.UpdateInterbankTransfer(ctx, &it)
+	})
+}
+
+// settleInterbankTransfer completes a transfer the receiving bank was paid for
+func (a *transactionUsecase) settleInterbankTransfer(ctx context.Context, tr *domain.Transaction, it *domain.InterbankTransfer) error {
+	now := time.Now()
+	it.Status, it.SettledAt = domain.InterbankSettled, &now
+
+	if err := a.settleTransaction(ctx, tr, domain.TransactionCompleted); err != nil {
+		return err
+	}
+
+	return a.ledgerUsecase.PostSettlement(ctx, tr)
+}
+
+// returnInterbankTransfer gives a rejected transfer back to the sender, fee included, in a
+// reversal booked against the clearing account
+func (a *transactionUsecase) returnInterbankTransfer(ctx context.Context, tr *domain.Transaction, it *domain.InterbankTransfer, status domain.PaymentStatus) (err error) {
+	now := time.Now()
+	it.Status, it.ReasonCode, it.ReasonText, it.SettledAt = domain.InterbankRejected, status.ReasonCode, status.ReasonText, &now
+
+	tr.FailureCode, tr.FailureReason = domain.ErrorCode(domain.ErrClearingRejected)
+	if status.ReasonCode != "" {
+		tr.FailureReason = fmt.Sprintf("%s: %s %s", tr.FailureReason, status.ReasonCode, status.ReasonText)
+	}
+
+	if err = a.settleTransaction(ctx, tr, domain.TransactionReturned); err != nil {
+		return err
+	}
+
+	acc, err := a.accountRepo.GetAccountByAccountNoForUpdate(ctx, tr.Account.AccountNo)
+	if err != nil {
+		return err
+	}
+
+	if acc.Balance, err = acc.Balance.Add(tr.Total); err != nil {
+		return err
+	}
+
+	if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+		return err
+	}
+
+	refund := domain.Transaction{
+		Type:        "reversal",
+		Channel:     domain.ChannelClearing,
+		Amount:      tr.Amount,
+		Fee:         tr.Fee,
+		Total:       tr.Total,
+		SubmittedAt: now,
+		Receiver:    *acc,
+		ReferenceId: tr.Id,
+		Remark:      tr.FailureReason,
+		Status:      domain.TransactionCompleted,
+	}
+
+	if err = a.createTransaction(ctx, &refund); err != nil {
+		return err
+	}
+
+	if err = a.ledgerUsecase.PostTransaction(ctx, &refund); err != nil {
+		return err
+	}
+
+	// the customer told about the return is the sender, as for any reversal
+	notification := refund
+	notification.Account.AccountNo = acc.AccountNo
+
+	return a.enqueueTransactionEvent(ctx, notification, acc.Balance)
+}
+
+// ReconcileInterbankTransfers sends the credit transfers without a report again once they waited
+// ResendAfter, and returns those that waited ReturnAfter since they were first sent
+func (a *transactionUsecase) ReconcileInterbankTransfers(c context.Context, now time.Time) error {
+	if a.clearingPolicy.ResendAfter <= 0 && a.clearingPolicy.ReturnAfter <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	wait := a.clearingPolicy.ResendAfter
+	if wait <= 0 || (a.clearingPolicy.ReturnAfter > 0 && a.clearingPolicy.ReturnAfter < wait) {
+		wait = a.clearingPolicy.ReturnAfter
+	}
+
+	unreported, err := a.interbankRepo.GetUnreportedInterbankTransfers(ctx, now.Add(-wait), interbankReconcileBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, it := range unreported {
+		if err = a.reconcileInterbankTransfer(ctx, it.EndToEndId, now); err != nil {
+			logrus.Errorf("reconcile interbank transfer %s: %v", it.EndToEndId, err)
+		}
+	}
+
+	return nil
+}
+
+// reconcileInterbankTransfer returns or resends one transfer, unless its report came in meanwhile
+func (a *transactionUsecase) reconcileInterbankTransfer(c context.Context, endToEndId string, now time.Time) error {
+	return a.unitOfWork.Do(c, func(ctx context.Context) error {
+		it, err := a.interbankRepo.GetInterbankTransferByEndToEndIDForUpdate(ctx, endToEndId)
+		if err != nil {
+			return err
+		}
+
+		if it.Status != domain.InterbankSent {
+			return nil
+		}
+
+		policy := a.clearingPolicy
+		if policy.ReturnAfter > 0 && !now.Before(it.SentAt.Add(policy.ReturnAfter)) {
+			tr, err := a.transactionRepo.GetTransactionByTIDForUpdate(ctx, it.TransactionId)
+			if err != nil {
+				return err
+			}
+
+			// the receiver is held here and was paid, only the report got lost
+			if it.CreditedAt != nil {
+				if err = a.settleInterbankTransfer(ctx, &tr, &it); err != nil {
+					return err
+				}
+				return a.interbankRepo.UpdateInterbankTransfer(ctx, &it)
+			}
+
+			status := domain.PaymentStatus{
+				OriginalMessageId:  it.MessageId,
+				OriginalEndToEndId: it.EndToEndId,
+				Status:             domain.PaymentRejected,
+				ReasonCode:         domain.PaymentTimedOut,
+				ReasonText:         "no status report from the clearing house",
+			}
+			if err = a.returnInterbankTransfer(ctx, &tr, &it, status); err != nil {
+				return err
+			}
+
+			return a.interbankRepo.UpdateInterbankTransfer(ctx, &it)
+		}
+
+		if policy.ResendAfter <= 0 || now.Before(it.LastSentAt.Add(policy.ResendAfter)) {
+			return nil
+		}
+
+		// the same message id, so the clearing house knows it for a duplicate
+		ev, err := a.clearing.CreditTransfer(&it)
+		if err != nil {
+			return err
+		}
+
+		if err = a.outboxRepo.CreateEvent(ctx, &ev); err != nil {
+			return err
+		}
+
+		it.LastSentAt = now
+		return a.interbankRepo.UpdateInterbankTransfer(ctx, &it)
+	})
+}
+
+// ReceiveInterbankTransfer pays the transfer out to its receiver once. The receiving bank of a
+// transfer only looks at the clearing message, which is why it is looked up by its end to end id.
+func (a *transactionUsecase) ReceiveInterbankTransfer(c context.Context, endToEndId string) error {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	return a.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		it, err := a.interbankRepo.GetInterbankTransferByEndToEndIDForUpdate(ctx, endToEndId)
+		if err != nil {
+			return err
+		}
+
+		// the clearing house sent it again
+		if it.CreditedAt != nil {
+			return nil
+		}
+
+		// a copy sent again arrived after the sender got the money back
+		if it.Status == domain.InterbankRejected {
+			return domain.ErrClearingRejected
+		}
+
+		acc, err := a.accountRepo.GetAccountByAccountNoForUpdate(ctx, it.CreditorAccount)
+		if err == domain.ErrNotFound {
+			return domain.ErrResipientNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if acc.Status == "inactive" {
+			return domain.ErrAccDeleted
+		}
+
+		if acc.Balance, err = acc.Balance.Add(it.Amount); err != nil {
+			return err
+		}
+
+		if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+			return err
+		}
+
+		if err = a.ledgerUsecase.PostInterbankCredit(ctx, &it, acc); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		it.CreditedAt = &now
+		return a.interbankRepo.UpdateInterbankTransfer(ctx, &it)
+	})
+}
@@ -0,0 +1,383 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"main/atm/clearing"
+	"main/domain"
+)
+
+// testClearing runs the stand-in clearing house on the credit transfers tu queues and hands its
+// reports back to tu, as the relay and the consumers do
+type testClearing struct {
+	t       *testing.T
+	db      *memDB
+	tu      *transactionUsecase
+	house   *clearing.StandInClearingHouse
+	reports *testPublisher
+	// seen counts the outbox events already handed to the clearing house
+	seen int
+}
+
+func newTestClearing(t *testing.T, db *memDB, tu *transactionUsecase) *testClearing {
+	reports := &testPublisher{}
+	return &testClearing{
+		t:       t,
+		db:      db,
+		tu:      tu,
+		house:   clearing.NewStandInClearingHouse(reports, tu, "clearing_pacs002", clearing.StandInRules{}),
+		reports: reports,
+	}
+}
+
+// send hands the credit transfers queued since the last call to the clearing house and returns
+// its reports
+func (c *testClearing) send() []*domain.Message {
+	c.t.Helper()
+
+	c.db.mu.Lock()
+	queued := append([]domain.OutboxEvent(nil), c.db.outbox[c.seen:]...)
+	c.seen = len(c.db.outbox)
+	c.db.mu.Unlock()
+
+	var reports []*domain.Message
+	for _, ev := range queued {
+		if ev.Topic != "clearing_pacs008" {
+			continue
+		}
+		if ev.ContentType != clearing.ContentType {
+			c.t.Errorf("credit transfer queued as %q, want %q", ev.ContentType, clearing.ContentType)
+		}
+
+		before := len(c.reports.sent[ev.Key])
+		if err := c.house.Handle(context.Background(), &domain.Message{Topic: ev.Topic, Key: ev.Key, Value: []byte(ev.Payload)}); err != nil {
+			c.t.Fatal(err)
+		}
+		for _, report := range c.reports.sent[ev.Key][before:] {
+			reports = append(reports, &domain.Message{Topic: "clearing_pacs002", Key: ev.Key, Value: []byte(report)})
+		}
+	}
+	return reports
+}
+
+// report hands the reports to tu
+func (c *testClearing) report(reports []*domain.Message) {
+	c.t.Helper()
+
+	for _, report := range reports {
+		if err := c.tu.HandlePaymentStatus(context.Background(), report); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// sendInterbank transfers amount from 1000000001, held at KBANK, to receiver at another bank
+func sendInterbank(t *testing.T, tu *transactionUsecase, receiver string, satang int64) *domain.Transaction {
+	t.Helper()
+
+	tr := &domain.Transaction{Type: "transfer", Amount: domain.NewMoney(satang), Account: domain.Account{AccountNo: "1000000001"},
+		Receiver: domain.Account{AccountNo: receiver}}
+	if err := tu.Transfer(context.Background(), tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Status != domain.TransactionClearing {
+		t.Fatalf("transfer is %s, want %s", tr.Status, domain.TransactionClearing)
+	}
+	return tr
+}
+
+// interbankOf returns the clearing record of tid
+func interbankOf(t *testing.T, db *memDB, tid int64) domain.InterbankTransfer {
+	t.Helper()
+
+	it, err := memInterbankRepo{db: db}.GetInterbankTransferByTransactionID(context.Background(), tid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return it
+}
+
+// checkLedger makes sure the ledger of every customer account matches its balance and that
+// nothing is left in the clearing account
+func checkLedger(t *testing.T, db *memDB) {
+	t.Helper()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	balances := ledgerBalances(db.ledger)
+	for accountNo, acc := range db.accounts {
+		if balances[accountNo] != acc.Balance.Satang {
+			t.Errorf("ledger of %s sums to %d, balance is %s", accountNo, balances[accountNo], acc.Balance)
+		}
+	}
+	if balances[domain.LedgerClearingAccount] != 0 {
+		t.Errorf("%d left in the clearing account", balances[domain.LedgerClearingAccount])
+	}
+}
+
+func TestInterbankTransferSettles(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	db.addAccount("1100000002", "0822222222", domain.NewMoney(5000))
+	tu := newTestUsecases(db).transaction
+	ch := newTestClearing(t, db, tu)
+
+	tr := sendInterbank(t, tu, "1100000002", 10000)
+	if balance := db.account("1100000002").Balance; balance.Satang != 5000 {
+		t.Errorf("receiver has %s before the clearing house settled, want 50.00", balance)
+	}
+
+	ch.report(ch.send())
+
+	if got := db.transactions[tr.Id].Status; got != domain.TransactionCompleted {
+		t.Errorf("transfer is %s, want %s", got, domain.TransactionCompleted)
+	}
+	if it := interbankOf(t, db, tr.Id); it.Status != domain.InterbankSettled || it.SettledAt == nil || it.CreditedAt == nil {
+		t.Errorf("clearing record is %s settled %v credited %v, want settled and credited", it.Status, it.SettledAt, it.CreditedAt)
+	}
+	if balance := db.account("1000000001").Balance; balance.Satang != 100000-tr.Total.Satang {
+		t.Errorf("sender has %s, want %d satang less", balance, tr.Total.Satang)
+	}
+	if balance := db.account("1100000002").Balance; balance.Satang != 15000 {
+		t.Errorf("receiver has %s, want 150.00", balance)
+	}
+	checkLedger(t, db)
+}
+
+func TestInterbankTransferSettlesAfterTheHistoryMigration(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	db.addAccount("1100000002", "0822222222", domain.NewMoney(5000))
+	tu := newTestUsecases(db).transaction
+	ch := newTestClearing(t, db, tu)
+
+	settled := sendInterbank(t, tu, "1100000002", 10000)
+	ch.report(ch.send())
+	clearing := sendInterbank(t, tu, "1100000002", 20000)
+	reports := ch.send()
+
+	// both were sent yesterday, the report of the second comes in after the nightly migration
+	db.mu.Lock()
+	for _, id := range []int64{settled.Id, clearing.Id} {
+		tr := db.transactions[id]
+		tr.CreatedAt = tr.CreatedAt.AddDate(0, 0, -1)
+		db.transactions[id] = tr
+	}
+	db.mu.Unlock()
+
+	if err := tu.migrateTransactionHistory(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.history[settled.Id]; !ok {
+		t.Errorf("settled transfer %d was not migrated", settled.Id)
+	}
+	if _, ok := db.transactions[clearing.Id]; !ok {
+		t.Fatalf("transfer %d still clearing was migrated", clearing.Id)
+	}
+
+	ch.report(reports)
+
+	if got := db.transactions[clearing.Id].Status; got != domain.TransactionCompleted {
+		t.Errorf("transfer is %s, want %s", got, domain.TransactionCompleted)
+	}
+	if balance := db.account("1100000002").Balance; balance.Satang != 35000 {
+		t.Errorf("receiver has %s, want 350.00", balance)
+	}
+	checkLedger(t, db)
+}
+
+func TestInterbankTransferToAnotherBankIsNotCredited(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	tu := newTestUsecases(db).transaction
+	ch := newTestClearing(t, db, tu)
+
+	// the account is held by its own bank, not here
+	tr := sendInterbank(t, tu, "2100000003", 10000)
+	ch.report(ch.send())
+
+	if it := interbankOf(t, db, tr.Id); it.Status != domain.InterbankSettled || it.CreditedAt != nil {
+		t.Errorf("clearing record is %s credited %v, want settled without a credit", it.Status, it.CreditedAt)
+	}
+	if _, ok := db.accounts["2100000003"]; ok {
+		t.Error("an account was opened for the receiver")
+	}
+	checkLedger(t, db)
+}
+
+func TestInterbankTransferReturned(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	tu := newTestUsecases(db).transaction
+	ch := newTestClearing(t, db, tu)
+
+	// the check digit is wrong
+	tr := sendInterbank(t, tu, "1100000009", 10000)
+	ch.report(ch.send())
+
+	orig := db.transactions[tr.Id]
+	if orig.Status != domain.TransactionReturned || !strings.Contains(orig.FailureReason, "AC01") {
+		t.Errorf("transfer is %s for %q, want returned for AC01", orig.Status, orig.FailureReason)
+	}
+	if it := interbankOf(t, db, tr.Id); it.Status != domain.InterbankRejected || it.ReasonCode != "AC01" {
+		t.Errorf("clearing record is %s for %s, want rejected for AC01", it.Status, it.ReasonCode)
+	}
+	if balance := db.account("1000000001").Balance; balance.Satang != 100000 {
+		t.Errorf("sender has %s, want 1000.00 with the fee refunded", balance)
+	}
+
+	refunds := 0
+	for _, r := range db.transactions {
+		if r.Type == "reversal" && r.ReferenceId == tr.Id {
+			refunds++
+			if r.Channel != domain.ChannelClearing || r.Total.Satang != tr.Total.Satang {
+				t.Errorf("refund of %s on %s, want %s on %s", r.Total, r.Channel, tr.Total, domain.ChannelClearing)
+			}
+		}
+	}
+	if refunds != 1 {
+		t.Errorf("%d refunds, want 1", refunds)
+	}
+	checkLedger(t, db)
+}
+
+func TestDuplicateReportsChangeNothing(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	db.addAccount("1100000002", "0822222222", domain.NewMoney(0))
+	tu := newTestUsecases(db).transaction
+	ch := newTestClearing(t, db, tu)
+
+	settled := sendInterbank(t, tu, "1100000002", 10000)
+	returned := sendInterbank(t, tu, "1100000009", 20000)
+	queued := db.outbox
+	reports := ch.send()
+	ch.report(reports)
+
+	balance := db.account("1000000001").Balance
+	entries := len(db.ledger)
+	transactions := len(db.transactions)
+
+	// the relay sent the credit transfers twice and the reports came twice
+	ch.seen = 0
+	db.outbox = queued
+	ch.report(ch.send())
+	ch.report(reports)
+
+	if got := db.account("1100000002").Balance; got.Satang != 10000 {
+		t.Errorf("receiver has %s, want 100.00 credited once", got)
+	}
+	if got := db.account("1000000001").Balance; got != balance {
+		t.Errorf("sender has %s, want %s", got, balance)
+	}
+	if len(db.ledger) != entries || len(db.transactions) != transactions {
+		t.Errorf("duplicates wrote %d ledger entries and %d transactions", len(db.ledger)-entries, len(db.transactions)-transactions)
+	}
+	if db.transactions[settled.Id].Status != domain.TransactionCompleted || db.transactions[returned.Id].Status != domain.TransactionReturned {
+		t.Errorf("transfers are %s and %s, want them as they were", db.transactions[settled.Id].Status, db.transactions[returned.Id].Status)
+	}
+	checkLedger(t, db)
+}
+
+func TestReportStillInProgressWaits(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	tu := newTestUsecases(db).transaction
+
+	tr := sendInterbank(t, tu, "2100000003", 10000)
+	it := interbankOf(t, db, tr.Id)
+
+	report := `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pacs.002.001.10"><FIToFIPmtStsRpt>
+		<OrgnlGrpInfAndSts><OrgnlMsgId>` + it.MessageId + `</OrgnlMsgId></OrgnlGrpInfAndSts>
+		<TxInfAndSts><OrgnlEndToEndId>` + it.EndToEndId + `</OrgnlEndToEndId><TxSts>ACSP</TxSts></TxInfAndSts>
+		</FIToFIPmtStsRpt></Document>`
+	if err := tu.HandlePaymentStatus(context.Background(), &domain.Message{Value: []byte(report)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := db.transactions[tr.Id].Status; got != domain.TransactionClearing {
+		t.Errorf("transfer is %s, want it still %s", got, domain.TransactionClearing)
+	}
+}
+
+func TestReconcileResendsAndReturnsUnreportedTransfers(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	tu := newTestUsecases(db).transaction
+	tu.clearingPolicy = domain.ClearingPolicy{ResendAfter: time.Minute, ReturnAfter: time.Hour}
+	ch := newTestClearing(t, db, tu)
+	ctx := context.Background()
+
+	tr := sendInterbank(t, tu, "2100000003", 10000)
+	sent := interbankOf(t, db, tr.Id).SentAt
+	first := ch.send()
+
+	// the report got lost, nothing happens before ResendAfter
+	if err := tu.ReconcileInterbankTransfers(ctx, sent.Add(30*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if again := ch.send(); len(again) != 0 {
+		t.Fatalf("sent again after 30s, want it sent after %v", tu.clearingPolicy.ResendAfter)
+	}
+
+	if err := tu.ReconcileInterbankTransfers(ctx, sent.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	again := ch.send()
+	if len(again) != 1 || string(again[0].Value) == "" {
+		t.Fatalf("got %d reports, want the credit transfer sent again", len(again))
+	}
+	if it := interbankOf(t, db, tr.Id); !it.LastSentAt.Equal(sent.Add(2 * time.Minute)) {
+		t.Errorf("last sent at %v, want it moved to the resend", it.LastSentAt)
+	}
+
+	// neither report arrives, the transfer is given up
+	if err := tu.ReconcileInterbankTransfers(ctx, sent.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if it := interbankOf(t, db, tr.Id); it.Status != domain.InterbankRejected || it.ReasonCode != domain.PaymentTimedOut {
+		t.Errorf("clearing record is %s for %s, want rejected for %s", it.Status, it.ReasonCode, domain.PaymentTimedOut)
+	}
+	if got := db.transactions[tr.Id].Status; got != domain.TransactionReturned {
+		t.Errorf("transfer is %s, want %s", got, domain.TransactionReturned)
+	}
+	if balance := db.account("1000000001").Balance; balance.Satang != 100000 {
+		t.Errorf("sender has %s, want 1000.00", balance)
+	}
+
+	// a late report does not undo the return
+	ch.report(first)
+	if got := db.transactions[tr.Id].Status; got != domain.TransactionReturned {
+		t.Errorf("a late report made the transfer %s", got)
+	}
+	checkLedger(t, db)
+}
+
+func TestReconcileSettlesACreditedTransfer(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	db.addAccount("1100000002", "0822222222", domain.NewMoney(0))
+	tu := newTestUsecases(db).transaction
+	tu.clearingPolicy = domain.ClearingPolicy{ReturnAfter: time.Hour}
+	ch := newTestClearing(t, db, tu)
+
+	tr := sendInterbank(t, tu, "1100000002", 10000)
+	// the receiver was paid, the report never came
+	ch.send()
+
+	if err := tu.ReconcileInterbankTransfers(context.Background(), time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := db.transactions[tr.Id].Status; got != domain.TransactionCompleted {
+		t.Errorf("transfer is %s, want %s", got, domain.TransactionCompleted)
+	}
+	if balance := db.account("1000000001").Balance; balance.Satang != 100000-tr.Total.Satang {
+		t.Errorf("sender has %s, want the transfer kept", balance)
+	}
+	checkLedger(t, db)
+}
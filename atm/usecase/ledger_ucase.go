@@ -0,0 +1,219 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"main/domain"
+)
+
+type ledgerUsecase struct {
+	ledgerRepo     domain.LedgerRepository
+	accountRepo    domain.AccountRepository
+	contextTimeout time.Duration
+}
+
+// NewLedgerUsecase will create new an ledgerUsecase object representation of domain.LedgerUsecase interface
+func NewLedgerUsecase(lr domain.LedgerRepository, ar domain.AccountRepository, timeout time.Duration) domain.LedgerUsecase {
+	return &ledgerUsecase{
+		ledgerRepo:     lr,
+		accountRepo:    ar,
+		contextTimeout: timeout,
+	}
+}
+
+// PostTransaction writes the balanced journal of a persisted transaction. It must run in the
+// same unit of work as the balance update, with tr.Account and tr.Receiver holding the new balances.
+func (l *ledgerUsecase) PostTransaction(c context.Context, tr *domain.Transaction) (err error) {
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	entries := buildJournal(tr)
+
+	if err = checkJournalBalanced(entries); err != nil {
+		return err
+	}
+
+	for i := range entries {
+		if entries[i].BalanceAfter == nil {
+			continue
+		}
+		if err = l.checkAgainstLastEntry(ctx, entries[i]); err != nil {
+			return err
+		}
+	}
+
+	return l.ledgerRepo.CreateEntries(ctx, entries)
+}
+
+// PostSettlement writes the journal of an interbank transfer the clearing house settled
+func (l *ledgerUsecase) PostSettlement(c context.Context, tr *domain.Transaction) (err error) {
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	entries := []domain.LedgerEntry{
+		{TransactionId: tr.Id, AccountNo: domain.LedgerClearingAccount, Direction: domain.LedgerDebit, Amount: tr.Amount},
+		{TransactionId: tr.Id, AccountNo: domain.LedgerSettlementAccount, Direction: domain.LedgerCredit, Amount: tr.Amount},
+	}
+
+	return l.ledgerRepo.CreateEntries(ctx, entries)
+}
+
+// PostInterbankCredit writes the journal of an interbank transfer paid out to a receiver held here
+func (l *ledgerUsecase) PostInterbankCredit(c context.Context, it *domain.InterbankTransfer, receiver *domain.Account) (err error) {
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	balance := receiver.Balance
+	entries := []domain.LedgerEntry{
+		{TransactionId: it.TransactionId, AccountNo: domain.LedgerSettlementAccount, Direction: domain.LedgerDebit, Amount: it.Amount},
+		{TransactionId: it.TransactionId, AccountNo: receiver.AccountNo, Direction: domain.LedgerCredit, Amount: it.Amount, BalanceAfter: &balance},
+	}
+
+	if err = l.checkAgainstLastEntry(ctx, entries[1]); err != nil {
+		return err
+	}
+
+	return l.ledgerRepo.CreateEntries(ctx, entries)
+}
+
+func (l *ledgerUsecase) GetLedgerByAccountNo(c context.Context, uuid string, account_no string, cursor string, num int64) (res []domain.LedgerEntry, nextCursor string, err error) {
+	if num == 0 {
+		num = 10
+	}
+
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	// accounts of other users are hidden behind ErrNotFound, as checkAccountOwner does
+	acc, err := l.accountRepo.GetAccountByAccountNo(ctx, account_no)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if acc.Uuid != uuid {
+		return nil, "", domain.ErrNotFound
+	}
+
+	return l.ledgerRepo.GetEntriesByAccountNo(ctx, account_no, cursor, num)
+}
+
+// checkAgainstLastEntry makes sure the balance reached by this entry follows from the previous one.
+// An account without entries starts from zero, accounts opened before the ledger existed got an
+// opening entry at their balance from the migration.
+func (l *ledgerUsecase) checkAgainstLastEntry(ctx context.Context, entry domain.LedgerEntry) error {
+	last, err := l.ledgerRepo.GetLastEntryByAccountNo(ctx, entry.AccountNo)
+	if err != nil {
+		return err
+	}
+
+	previous := domain.NewMoney(0)
+	if last != nil {
+		previous = *last.BalanceAfter
+	}
+
+	expected, err := previous.Add(entry.Amount)
+	if entry.Direction == domain.LedgerDebit {
+		expected, err = previous.Sub(entry.Amount)
+	}
+	if err != nil {
+		return err
+	}
+
+	if expected.Cmp(*entry.BalanceAfter) != 0 {
+		return domain.ErrLedgerMismatch
+	}
+
+	return nil
+}
+
+func buildJournal(tr *domain.Transaction) []domain.LedgerEntry {
+	debit := func(accountNo string, amount domain.Money, balanceAfter *domain.Money) domain.LedgerEntry {
+		return domain.LedgerEntry{TransactionId: tr.Id, AccountNo: accountNo, Direction: domain.LedgerDebit, Amount: amount, BalanceAfter: balanceAfter}
+	}
+	credit := func(accountNo string, amount domain.Money, balanceAfter *domain.Money) domain.LedgerEntry {
+		return domain.LedgerEntry{TransactionId: tr.Id, AccountNo: accountNo, Direction: domain.LedgerCredit, Amount: amount, BalanceAfter: balanceAfter}
+	}
+
+	accountBalance := tr.Account.Balance
+	receiverBalance := tr.Receiver.Balance
+
+	var entries []domain.LedgerEntry
+
+	switch tr.Type {
+	case "deposit":
+		entries = append(entries,
+			debit(domain.LedgerCashAccount, tr.Amount, nil),
+			credit(tr.Account.AccountNo, tr.Amount, &accountBalance),
+		)
+	case "withdraw":
+		if tr.Fee.IsPositive() {
+			entries = append(entries,
+				debit(tr.Account.AccountNo, tr.Total, &accountBalance),
+				credit(domain.LedgerCashAccount, tr.Amount, nil),
+				credit(domain.LedgerFeeIncomeAccount, tr.Fee, nil),
+			)
+			break
+		}
+		entries = append(entries,
+			debit(tr.Account.AccountNo, tr.Amount, &accountBalance),
+			credit(domain.LedgerCashAccount, tr.Amount, nil),
+		)
+	case "transfer":
+		entries = append(entries, debit(tr.Account.AccountNo, tr.Total, &accountBalance))
+		// the receiving bank credits its customer, here the money waits for the clearing house
+		if tr.IsInterbank() {
+			entries = append(entries, credit(domain.LedgerClearingAccount, tr.Amount, nil))
+		} else {
+			entries = append(entries, credit(tr.Receiver.AccountNo, tr.Amount, &receiverBalance))
+		}
+		if tr.Fee.IsPositive() {
+			entries = append(entries, credit(domain.LedgerFeeIncomeAccount, tr.Fee, nil))
+		}
+	case "reversal":
+		// Account gives back Amount, fee income gives back Fee and Receiver gets Total;
+		// a missing side is cash at the ATM, or the clearing account for a returned transfer
+		switch {
+		case tr.Account.AccountNo != "":
+			entries = append(entries, debit(tr.Account.AccountNo, tr.Amount, &accountBalance))
+		case tr.Channel == domain.ChannelClearing:
+			entries = append(entries, debit(domain.LedgerClearingAccount, tr.Amount, nil))
+		default:
+			entries = append(entries, debit(domain.LedgerCashAccount, tr.Amount, nil))
+		}
+		if tr.Fee.IsPositive() {
+			entries = append(entries, debit(domain.LedgerFeeIncomeAccount, tr.Fee, nil))
+		}
+		if tr.Receiver.AccountNo != "" {
+			entries = append(entries, credit(tr.Receiver.AccountNo, tr.Total, &receiverBalance))
+		} else {
+			entries = append(entries, credit(domain.LedgerCashAccount, tr.Total, nil))
+		}
+	}
+
+	return entries
+}
+
+func checkJournalBalanced(entries []domain.LedgerEntry) (err error) {
+	if len(entries) == 0 {
+		return domain.ErrUnbalancedJournal
+	}
+
+	var debits, credits domain.Money
+	for _, entry := range entries {
+		if entry.Direction == domain.LedgerDebit {
+			debits, err = debits.Add(entry.Amount)
+		} else {
+			credits, err = credits.Add(entry.Amount)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if debits.Cmp(credits) != 0 {
+		return domain.ErrUnbalancedJournal
+	}
+
+	return nil
+}
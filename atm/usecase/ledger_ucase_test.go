@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"main/domain"
+)
+
+// ledgerBalances sums the entries of every ledger account, credits up
+func ledgerBalances(entries []domain.LedgerEntry) map[string]int64 {
+	balances := make(map[string]int64)
+	for _, e := range entries {
+		if e.Direction == domain.LedgerCredit {
+			balances[e.AccountNo] += e.Amount.Satang
+		} else {
+			balances[e.AccountNo] -= e.Amount.Satang
+		}
+	}
+	return balances
+}
+
+func TestLedgerReconcilesWithBalances(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+	tu := newTestUsecases(db).transaction
+	ctx := context.Background()
+
+	steps := []*domain.Transaction{
+		{Type: "deposit", Amount: domain.NewMoney(20000), Account: domain.Account{AccountNo: "1000000001"}, TerminalId: "ATM-0001"},
+		{Type: "withdraw", Amount: domain.NewMoney(5000), Account: domain.Account{AccountNo: "1000000001"}, TerminalId: "ATM-0001"},
+		{Type: "transfer", Amount: domain.NewMoney(30000), Account: domain.Account{AccountNo: "1000000001"}, Receiver: domain.Account{AccountNo: "2000000001"}},
+	}
+	for _, tr := range steps {
+		var err error
+		switch tr.Type {
+		case "deposit":
+			err = tu.Deposit(ctx, tr)
+		case "withdraw":
+			err = tu.withdraw(ctx, tr, nil, nil)
+		case "transfer":
+			err = tu.Transfer(ctx, tr)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tr.Type, err)
+		}
+	}
+
+	balances := ledgerBalances(db.ledger)
+
+	var total int64
+	for _, b := range balances {
+		total += b
+	}
+	if total != 0 {
+		t.Errorf("debits and credits differ by %d satang", total)
+	}
+
+	for _, accountNo := range []string{"1000000001", "2000000001"} {
+		if got, want := balances[accountNo], db.account(accountNo).Balance.Satang; got != want {
+			t.Errorf("ledger of %s sums to %d satang, balance is %d", accountNo, got, want)
+		}
+	}
+}
+
+func TestLedgerRejectsBalanceChangedOutsideIt(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	tu := newTestUsecases(db).transaction
+
+	acc := db.accounts["1000000001"]
+	acc.Balance = domain.NewMoney(90000)
+	db.accounts["1000000001"] = acc
+
+	tr := &domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(1000), Account: domain.Account{AccountNo: "1000000001"}, TerminalId: "ATM-0001"}
+	if err := tu.withdraw(context.Background(), tr, nil, nil); err != domain.ErrLedgerMismatch {
+		t.Fatalf("got %v, want ErrLedgerMismatch", err)
+	}
+}
+
+func TestLedgerOfAnotherUserIsHidden(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	lu := NewLedgerUsecase(memLedgerRepo{db: db}, memAccountRepo{db: db}, 0)
+
+	if _, _, err := lu.GetLedgerByAccountNo(context.Background(), "0899999999", "1000000001", "", 10); err != domain.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	entries, _, err := lu.GetLedgerByAccountNo(context.Background(), "0811111111", "1000000001", "", 10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("got %d entries and %v, want the opening entry", len(entries), err)
+	}
+}
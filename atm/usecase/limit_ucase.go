@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"main/domain"
+)
+
+type limitUsecase struct {
+	limitRepo       domain.LimitRepository
+	transactionRepo domain.TransactionRepository
+	accountRepo     domain.AccountRepository
+	contextTimeout  time.Duration
+}
+
+// NewLimitUsecase will create new an limitUsecase object representation of domain.LimitUsecase interface
+func NewLimitUsecase(lr domain.LimitRepository, tr domain.TransactionRepository, ar domain.AccountRepository, timeout time.Duration) domain.LimitUsecase {
+	return &limitUsecase{
+		limitRepo:       lr,
+		transactionRepo: tr,
+		accountRepo:     ar,
+		contextTimeout:  timeout,
+	}
+}
+
+// CheckLimits returns a *domain.LimitError for the first limit tr does not fit in. Usage is
+// counted from the posted transactions of acc, so it must run with acc locked in the booking
+// unit of work for two transactions not to both fit in the same headroom.
+func (l *limitUsecase) CheckLimits(c context.Context, tr *domain.Transaction, acc *domain.Account) (err error) {
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	limits, err := l.limitRepo.GetApplicableLimits(ctx, tr.Type, acc.Segment, acc.AccountNo)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	usageSince := make(map[time.Time]domain.TransactionUsage)
+
+	for _, limit := range resolveLimits(limits) {
+		var used domain.TransactionUsage
+
+		if since, ok := limit.Window(now); ok {
+			var cached bool
+			if used, cached = usageSince[since]; !cached {
+				used, err = l.transactionRepo.GetTransactionUsage(ctx, acc.AccountNo, tr.Type, "", since)
+				if err != nil {
+					return err
+				}
+				usageSince[since] = used
+			}
+		}
+
+		if err = limit.Check(tr.Amount, used); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetEffectiveLimits shows which limit of each level wins for the account
+func (l *limitUsecase) GetEffectiveLimits(c context.Context, account_no string) ([]domain.Limit, error) {
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	acc, err := l.accountRepo.GetAccountByAccountNo(ctx, account_no)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := l.limitRepo.GetApplicableLimits(ctx, "", acc.Segment, acc.AccountNo)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveLimits(limits), nil
+}
+
+func (l *limitUsecase) GetLimits(c context.Context, scope string, scope_ref string) ([]domain.Limit, error) {
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	return l.limitRepo.GetLimits(ctx, scope, scope_ref)
+}
+
+// SaveLimit creates the limit or replaces the one of the same level, type and kind
+func (l *limitUsecase) SaveLimit(c context.Context, limit *domain.Limit) (err error) {
+	if err = limit.Validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	if limit.Scope == domain.LimitScopeAccount {
+		if _, err = l.accountRepo.GetAccountByAccountNo(ctx, limit.ScopeRef); err != nil {
+			return err
+		}
+	}
+
+	return l.limitRepo.UpsertLimit(ctx, limit)
+}
+
+func (l *limitUsecase) DeleteLimit(c context.Context, id int64) error {
+	ctx, cancel := context.WithTimeout(c, l.contextTimeout)
+	defer cancel()
+
+	return l.limitRepo.DeleteLimit(ctx, id)
+}
+
+// resolveLimits keeps the most specific limit for each transaction type and kind
+func resolveLimits(limits []domain.Limit) []domain.Limit {
+	index := make(map[[2]string]int)
+	res := make([]domain.Limit, 0, len(limits))
+
+	for _, limit := range limits {
+		key := [2]string{limit.TransactionType, limit.Kind}
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(res)
+			res = append(res, limit)
+			continue
+		}
+
+		if limit.Overrides(res[i]) {
+			res[i] = limit
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,1362 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"main/atm/clearing"
+	"main/atm/repository"
+	"main/domain"
+)
+
+// memDB stands in for MySQL in the usecase tests. A unit of work holds the row locks it takes
+// until it ends, like SELECT ... FOR UPDATE does, and undoes its writes when it fails.
+type memDB struct {
+	mu     sync.Mutex
+	rows   map[string]*sync.Mutex
+	nextId int64
+
+	accounts     map[string]domain.Account
+	transactions map[int64]domain.Transaction
+	history      map[int64]domain.Transaction
+	ledger       []domain.LedgerEntry
+	outbox       []domain.OutboxEvent
+	schedules    map[int64]domain.ScheduledTransaction
+	executions   map[int64]domain.ScheduledExecution
+	deadLetters  map[int64]domain.DeadLetter
+	interbank    map[int64]domain.InterbankTransfer
+	proxies      map[string]domain.Proxy
+	cardless     map[string]domain.CardlessWithdrawal
+	terminals    map[string]domain.Terminal
+	cassettes    map[int64]domain.Cassette
+	movements    []domain.CashMovement
+	dispenses    map[int64]domain.DispensePlan
+	balancings   []domain.BalancingReport
+}
+
+func newMemDB() *memDB {
+	return &memDB{
+		rows:         make(map[string]*sync.Mutex),
+		accounts:     make(map[string]domain.Account),
+		transactions: make(map[int64]domain.Transaction),
+		history:      make(map[int64]domain.Transaction),
+		schedules:    make(map[int64]domain.ScheduledTransaction),
+		executions:   make(map[int64]domain.ScheduledExecution),
+		deadLetters:  make(map[int64]domain.DeadLetter),
+		interbank:    make(map[int64]domain.InterbankTransfer),
+		proxies:      make(map[string]domain.Proxy),
+		cardless:     make(map[string]domain.CardlessWithdrawal),
+		terminals:    make(map[string]domain.Terminal),
+		cassettes:    make(map[int64]domain.Cassette),
+		dispenses:    make(map[int64]domain.DispensePlan),
+	}
+}
+
+type memTxKey struct{}
+
+type memTx struct {
+	held map[string]*sync.Mutex
+	undo []func()
+}
+
+// lock takes the row lock key for the unit of work of ctx, statements outside one lock nothing
+func (db *memDB) lock(ctx context.Context, key string) {
+	tx, ok := ctx.Value(memTxKey{}).(*memTx)
+	if !ok || tx.held[key] != nil {
+		return
+	}
+
+	db.mu.Lock()
+	row, ok := db.rows[key]
+	if !ok {
+		row = &sync.Mutex{}
+		db.rows[key] = row
+	}
+	db.mu.Unlock()
+
+	row.Lock()
+	tx.held[key] = row
+}
+
+// tryLock is lock for SELECT ... SKIP LOCKED, it reports false instead of waiting for a row
+// another unit of work holds
+func (db *memDB) tryLock(ctx context.Context, key string) bool {
+	tx, ok := ctx.Value(memTxKey{}).(*memTx)
+	if !ok || tx.held[key] != nil {
+		return true
+	}
+
+	db.mu.Lock()
+	row, ok := db.rows[key]
+	if !ok {
+		row = &sync.Mutex{}
+		db.rows[key] = row
+	}
+	db.mu.Unlock()
+
+	if !row.TryLock() {
+		return false
+	}
+	tx.held[key] = row
+	return true
+}
+
+// write runs change, with db.mu held, and keeps undo to roll it back with the unit of work of ctx
+func (db *memDB) write(ctx context.Context, change func(), undo func()) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	change()
+	if tx, ok := ctx.Value(memTxKey{}).(*memTx); ok {
+		tx.undo = append(tx.undo, undo)
+	}
+}
+
+func (db *memDB) id() int64 {
+	db.nextId++
+	return db.nextId
+}
+
+func (db *memDB) account(accountNo string) domain.Account {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.accounts[accountNo]
+}
+
+// addAccount opens an account with its opening ledger entries, as migrations/002 does for the
+// accounts that had a balance before the ledger. Its last digit names its bank.
+func (db *memDB) addAccount(accountNo string, uuid string, balance domain.Money) {
+	now := time.Now()
+	bank := (&accountUsecase{}).SelectBank(accountNo[len(accountNo)-1:])
+	db.accounts[accountNo] = domain.Account{AccountNo: accountNo, Uuid: uuid, Bank: bank, Balance: balance, Status: "active", CreatedAt: &now, UpdatedAt: &now}
+
+	if !balance.IsZero() {
+		db.ledger = append(db.ledger,
+			domain.LedgerEntry{Id: db.id(), AccountNo: accountNo, Direction: domain.LedgerCredit, Amount: balance, BalanceAfter: &balance},
+			domain.LedgerEntry{Id: db.id(), AccountNo: domain.LedgerOpeningAccount, Direction: domain.LedgerDebit, Amount: balance},
+		)
+	}
+}
+
+// addBooked records a completed transaction created at at, as the history has it
+func (db *memDB) addBooked(tr domain.Transaction, at time.Time) int64 {
+	tr.Id, tr.CreatedAt, tr.Status = db.id(), at, domain.TransactionCompleted
+	if tr.Total.IsZero() {
+		tr.Total = tr.Amount
+	}
+	db.transactions[tr.Id] = tr
+	return tr.Id
+}
+
+type memUnitOfWork struct {
+	db *memDB
+}
+
+func (u memUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(memTxKey{}).(*memTx); ok {
+		return fn(ctx)
+	}
+
+	tx := &memTx{held: make(map[string]*sync.Mutex)}
+	err := fn(context.WithValue(ctx, memTxKey{}, tx))
+	if err != nil {
+		u.db.mu.Lock()
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		u.db.mu.Unlock()
+	} else {
+		domain.MarkCommitting(ctx)
+	}
+
+	for _, row := range tx.held {
+		row.Unlock()
+	}
+	return err
+}
+
+type memAccountRepo struct {
+	domain.AccountRepository
+	db *memDB
+}
+
+func (r memAccountRepo) GetAccountByAccountNo(ctx context.Context, accountNo string) (*domain.Account, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	acc, ok := r.db.accounts[accountNo]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &acc, nil
+}
+
+func (r memAccountRepo) GetAccountByAccountNoForUpdate(ctx context.Context, accountNo string) (*domain.Account, error) {
+	r.db.lock(ctx, "account:"+accountNo)
+	return r.GetAccountByAccountNo(ctx, accountNo)
+}
+
+func (r memAccountRepo) UpdateAccount(ctx context.Context, acc *domain.Account) error {
+	var old domain.Account
+	r.db.write(ctx, func() {
+		old = r.db.accounts[acc.AccountNo]
+		r.db.accounts[acc.AccountNo] = *acc
+	}, func() {
+		r.db.accounts[acc.AccountNo] = old
+	})
+	return nil
+}
+
+type memTransactionRepo struct {
+	domain.TransactionRepository
+	db *memDB
+}
+
+func (r memTransactionRepo) CreateTransaction(ctx context.Context, tr *domain.Transaction) error {
+	r.db.write(ctx, func() {
+		tr.Id, tr.CreatedAt = r.db.id(), time.Now()
+		r.db.transactions[tr.Id] = *tr
+	}, func() {
+		delete(r.db.transactions, tr.Id)
+	})
+	return nil
+}
+
+func (r memTransactionRepo) GetTransactionByTID(ctx context.Context, tid int64) (domain.Transaction, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	tr, ok := r.db.transactions[tid]
+	if !ok {
+		if tr, ok = r.db.history[tid]; !ok {
+			return tr, domain.ErrTransactionNotFound
+		}
+	}
+	return tr, nil
+}
+
+func (r memTransactionRepo) GetTransactionByTIDForUpdate(ctx context.Context, tid int64) (domain.Transaction, error) {
+	r.db.lock(ctx, "transaction:"+strconv.FormatInt(tid, 10))
+	return r.GetTransactionByTID(ctx, tid)
+}
+
+func (r memTransactionRepo) UpdateTransactionStatus(ctx context.Context, tr *domain.Transaction, from string) (err error) {
+	// like the driver, a statement is not run on a finished context
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	var old domain.Transaction
+	r.db.write(ctx, func() {
+		old = r.db.transactions[tr.Id]
+		if old.Status != from {
+			err = domain.ErrInvalidStatusTransition
+			return
+		}
+		r.db.transactions[tr.Id] = *tr
+	}, func() {
+		r.db.transactions[tr.Id] = old
+	})
+	return err
+}
+
+// MigrateTransactionHistory moves the settled transactions from before today, as the MySQL
+// repository does. UpdateTransactionStatus only settles the live ones.
+func (r memTransactionRepo) MigrateTransactionHistory(ctx context.Context) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for id, tr := range r.db.transactions {
+		if tr.CreatedAt.Before(today) && tr.IsSettled() {
+			r.db.history[id] = tr
+			delete(r.db.transactions, id)
+		}
+	}
+	return nil
+}
+
+func (r memTransactionRepo) GetTransactionUsage(ctx context.Context, accountNo string, transactionType string, channel string, since time.Time) (domain.TransactionUsage, error) {
+	return domain.TransactionUsage{}, nil
+}
+
+func (r memTransactionRepo) RecordRefund(ctx context.Context, tr *domain.Transaction, refundedBefore domain.Money) (err error) {
+	var old domain.Transaction
+	r.db.write(ctx, func() {
+		old = r.db.transactions[tr.Id]
+		if old.Status != domain.TransactionCompleted || old.RefundedAmount.Satang != refundedBefore.Satang {
+			err = domain.ErrAlreadyReversed
+			return
+		}
+		r.db.transactions[tr.Id] = *tr
+	}, func() {
+		r.db.transactions[tr.Id] = old
+	})
+	return err
+}
+
+// GetAllTransaction pages the way the MySQL repository does, newest first by (created_at, id)
+func (r memTransactionRepo) GetAllTransaction(ctx context.Context, filter domain.TransactionFilter) ([]domain.Transaction, string, error) {
+	var createdAt time.Time
+	var id int64
+	if filter.Cursor != "" {
+		var err error
+		if createdAt, id, err = repository.DecodeKeysetCursor(filter.Cursor); err != nil {
+			return nil, "", domain.ErrBadParamInput
+		}
+	}
+
+	r.db.mu.Lock()
+	var res []domain.Transaction
+	for _, tr := range r.db.transactions {
+		if tr.Account.AccountNo != filter.AccountNo && tr.Receiver.AccountNo != filter.AccountNo {
+			continue
+		}
+		if filter.From != nil && tr.CreatedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.Cursor != "" && !(tr.CreatedAt.Before(createdAt) || (tr.CreatedAt.Equal(createdAt) && tr.Id < id)) {
+			continue
+		}
+		res = append(res, tr)
+	}
+	r.db.mu.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.After(res[j].CreatedAt)
+		}
+		return res[i].Id > res[j].Id
+	})
+
+	if int64(len(res)) < filter.Num {
+		return res, "", nil
+	}
+
+	res = res[:filter.Num]
+	last := res[len(res)-1]
+	return res, repository.EncodeKeysetCursor(last.CreatedAt, last.Id), nil
+}
+
+// transactionsByStatus counts the transactions recorded with each status
+func (db *memDB) transactionsByStatus() map[string]int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, tr := range db.transactions {
+		counts[tr.Status]++
+	}
+	return counts
+}
+
+type memLedgerRepo struct {
+	db *memDB
+}
+
+func (r memLedgerRepo) CreateEntries(ctx context.Context, entries []domain.LedgerEntry) error {
+	var n int
+	r.db.write(ctx, func() {
+		n = len(r.db.ledger)
+		for i := range entries {
+			entries[i].Id = r.db.id()
+		}
+		r.db.ledger = append(r.db.ledger, entries...)
+	}, func() {
+		r.db.ledger = r.db.ledger[:n]
+	})
+	return nil
+}
+
+func (r memLedgerRepo) GetEntriesByAccountNo(ctx context.Context, accountNo string, cursor string, num int64) ([]domain.LedgerEntry, string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var res []domain.LedgerEntry
+	for _, e := range r.db.ledger {
+		if e.AccountNo == accountNo {
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id > res[j].Id })
+	return res, "", nil
+}
+
+func (r memLedgerRepo) GetLastEntryByAccountNo(ctx context.Context, accountNo string) (*domain.LedgerEntry, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for i := len(r.db.ledger) - 1; i >= 0; i-- {
+		if e := r.db.ledger[i]; e.AccountNo == accountNo && e.BalanceAfter != nil {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+type memOutboxRepo struct {
+	domain.OutboxRepository
+	db *memDB
+}
+
+func (r memOutboxRepo) CreateEvent(ctx context.Context, ev *domain.OutboxEvent) error {
+	var n int
+	r.db.write(ctx, func() {
+		n = len(r.db.outbox)
+		ev.Id, ev.CreatedAt = r.db.id(), time.Now()
+		ev.NextAttemptAt = ev.CreatedAt
+		r.db.outbox = append(r.db.outbox, *ev)
+	}, func() {
+		r.db.outbox = r.db.outbox[:n]
+	})
+	return nil
+}
+
+func outboxKey(id int64) string {
+	return "outbox:" + strconv.FormatInt(id, 10)
+}
+
+// event returns the stored event id, db.mu must be held
+func (db *memDB) event(id int64) *domain.OutboxEvent {
+	for i := range db.outbox {
+		if db.outbox[i].Id == id {
+			return &db.outbox[i]
+		}
+	}
+	return nil
+}
+
+func (r memOutboxRepo) ClaimEvents(ctx context.Context, now time.Time, until time.Time, limit int) ([]domain.OutboxEvent, error) {
+	r.db.mu.Lock()
+	var heads []int64
+	held := make(map[string]bool)
+	for _, ev := range r.db.outbox {
+		if ev.PublishedAt != nil || ev.ParkedAt != nil || held[ev.Key] {
+			continue
+		}
+		held[ev.Key] = true
+		if !ev.NextAttemptAt.After(now) {
+			heads = append(heads, ev.Id)
+		}
+	}
+	r.db.mu.Unlock()
+
+	events := make([]domain.OutboxEvent, 0)
+	for _, id := range heads {
+		if len(events) == limit {
+			break
+		}
+		if !r.db.tryLock(ctx, outboxKey(id)) {
+			continue
+		}
+
+		// a locking read sees what the relay that held the row committed
+		var was time.Time
+		r.db.write(ctx, func() {
+			ev := r.db.event(id)
+			if ev == nil || ev.PublishedAt != nil || ev.ParkedAt != nil || ev.NextAttemptAt.After(now) {
+				return
+			}
+			was, ev.NextAttemptAt = ev.NextAttemptAt, until
+			events = append(events, *ev)
+		}, func() {
+			if ev := r.db.event(id); ev != nil && !was.IsZero() {
+				ev.NextAttemptAt = was
+			}
+		})
+	}
+	return events, nil
+}
+
+func (r memOutboxRepo) MarkEventPublished(ctx context.Context, id int64, publishedAt time.Time) error {
+	r.db.lock(ctx, outboxKey(id))
+
+	var was *time.Time
+	r.db.write(ctx, func() {
+		if ev := r.db.event(id); ev != nil {
+			was, ev.PublishedAt = ev.PublishedAt, &publishedAt
+		}
+	}, func() {
+		if ev := r.db.event(id); ev != nil {
+			ev.PublishedAt = was
+		}
+	})
+	return nil
+}
+
+func (r memOutboxRepo) UpdateEventAttempt(ctx context.Context, ev *domain.OutboxEvent) error {
+	r.db.lock(ctx, outboxKey(ev.Id))
+
+	var was domain.OutboxEvent
+	r.db.write(ctx, func() {
+		if cur := r.db.event(ev.Id); cur != nil {
+			was = *cur
+			cur.Attempts, cur.NextAttemptAt, cur.LastError, cur.ParkedAt = ev.Attempts, ev.NextAttemptAt, ev.LastError, ev.ParkedAt
+		}
+	}, func() {
+		if cur := r.db.event(ev.Id); cur != nil {
+			*cur = was
+		}
+	})
+	return nil
+}
+
+func (r memOutboxRepo) DeletePublishedEvents(ctx context.Context, before time.Time, limit int) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var deleted int64
+	kept := r.db.outbox[:0]
+	for _, ev := range r.db.outbox {
+		if ev.PublishedAt != nil && ev.PublishedAt.Before(before) && deleted < int64(limit) {
+			deleted++
+			continue
+		}
+		kept = append(kept, ev)
+	}
+	r.db.outbox = kept
+	return deleted, nil
+}
+
+// eventsByState counts the events of db that are published, parked and waiting
+func (db *memDB) eventsByState() map[string]int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, ev := range db.outbox {
+		switch {
+		case ev.PublishedAt != nil:
+			counts["published"]++
+		case ev.ParkedAt != nil:
+			counts["parked"]++
+		default:
+			counts["waiting"]++
+		}
+	}
+	return counts
+}
+
+// testPublisher records what it sent by key and the headers it last sent, publish can fail or
+// inspect a message before it is sent
+type testPublisher struct {
+	mu      sync.Mutex
+	sent    map[string][]string
+	headers map[string]string
+	publish func(key string, message string) error
+}
+
+func (p *testPublisher) Publish(topic string, key string, headers map[string]string, message []byte) error {
+	if p.publish != nil {
+		if err := p.publish(key, string(message)); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sent == nil {
+		p.sent = make(map[string][]string)
+	}
+	p.sent[key] = append(p.sent[key], string(message))
+	p.headers = headers
+	return nil
+}
+
+type memDeadLetterRepo struct {
+	domain.DeadLetterRepository
+	db *memDB
+}
+
+func deadLetterKey(id int64) string {
+	return "dead_letter:" + strconv.FormatInt(id, 10)
+}
+
+func (r memDeadLetterRepo) CreateDeadLetter(ctx context.Context, dl *domain.DeadLetter) error {
+	r.db.mu.Lock()
+	for _, stored := range r.db.deadLetters {
+		if stored.Topic == dl.Topic && stored.Partition == dl.Partition && stored.Offset == dl.Offset {
+			dl.Id = stored.Id
+			r.db.mu.Unlock()
+			return nil
+		}
+	}
+	r.db.mu.Unlock()
+
+	r.db.write(ctx, func() {
+		dl.Id, dl.CreatedAt = r.db.id(), time.Now()
+		dl.UpdatedAt = dl.CreatedAt
+		r.db.deadLetters[dl.Id] = *dl
+	}, func() {
+		delete(r.db.deadLetters, dl.Id)
+	})
+	return nil
+}
+
+func (r memDeadLetterRepo) GetDeadLetters(ctx context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	letters := make([]domain.DeadLetter, 0)
+	for _, dl := range r.db.deadLetters {
+		if filter.Topic == "" || dl.Topic == filter.Topic {
+			letters = append(letters, dl)
+		}
+	}
+	return letters, nil
+}
+
+func (r memDeadLetterRepo) GetDeadLetterByID(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	dl, ok := r.db.deadLetters[id]
+	if !ok {
+		return dl, domain.ErrDeadLetterNotFound
+	}
+	return dl, nil
+}
+
+func (r memDeadLetterRepo) GetDeadLetterByIDForUpdate(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	r.db.lock(ctx, deadLetterKey(id))
+	return r.GetDeadLetterByID(ctx, id)
+}
+
+func (r memDeadLetterRepo) UpdateDeadLetter(ctx context.Context, dl *domain.DeadLetter) error {
+	var was domain.DeadLetter
+	r.db.write(ctx, func() {
+		was = r.db.deadLetters[dl.Id]
+		dl.UpdatedAt = time.Now()
+		r.db.deadLetters[dl.Id] = *dl
+	}, func() {
+		r.db.deadLetters[dl.Id] = was
+	})
+	return nil
+}
+
+func (r memDeadLetterRepo) GetDeadLetterStats(ctx context.Context) ([]domain.DeadLetterStats, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	pending := make(map[string]int64)
+	for _, dl := range r.db.deadLetters {
+		if dl.Status == domain.DeadLetterPending || dl.Status == domain.DeadLetterReplaying {
+			pending[dl.Topic]++
+		}
+	}
+
+	stats := make([]domain.DeadLetterStats, 0, len(pending))
+	for topic, n := range pending {
+		stats = append(stats, domain.DeadLetterStats{Topic: topic, Pending: n})
+	}
+	return stats, nil
+}
+
+type memInterbankRepo struct {
+	domain.InterbankTransferRepository
+	db *memDB
+}
+
+func (r memInterbankRepo) CreateInterbankTransfer(ctx context.Context, it *domain.InterbankTransfer) error {
+	var id int64
+	r.db.write(ctx, func() {
+		id = r.db.id()
+		it.Id = id
+		r.db.interbank[id] = *it
+	}, func() {
+		delete(r.db.interbank, id)
+	})
+	return nil
+}
+
+func (r memInterbankRepo) GetInterbankTransferByTransactionID(ctx context.Context, tid int64) (domain.InterbankTransfer, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, it := range r.db.interbank {
+		if it.TransactionId == tid {
+			return it, nil
+		}
+	}
+	return domain.InterbankTransfer{}, domain.ErrInterbankTransferNotFound
+}
+
+func (r memInterbankRepo) GetInterbankTransferByEndToEndIDForUpdate(ctx context.Context, endToEndId string) (domain.InterbankTransfer, error) {
+	r.db.lock(ctx, "interbank:"+endToEndId)
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, it := range r.db.interbank {
+		if it.EndToEndId == endToEndId {
+			return it, nil
+		}
+	}
+	return domain.InterbankTransfer{}, domain.ErrInterbankTransferNotFound
+}
+
+func (r memInterbankRepo) GetUnreportedInterbankTransfers(ctx context.Context, sentBefore time.Time, limit int) ([]domain.InterbankTransfer, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var res []domain.InterbankTransfer
+	for _, it := range r.db.interbank {
+		if it.Status == domain.InterbankSent && it.LastSentAt.Before(sentBefore) {
+			res = append(res, it)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LastSentAt.Before(res[j].LastSentAt) })
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (r memInterbankRepo) UpdateInterbankTransfer(ctx context.Context, it *domain.InterbankTransfer) error {
+	var old domain.InterbankTransfer
+	r.db.write(ctx, func() {
+		old = r.db.interbank[it.Id]
+		r.db.interbank[it.Id] = *it
+	}, func() {
+		r.db.interbank[it.Id] = old
+	})
+	return nil
+}
+
+type memProxyRepo struct {
+	domain.ProxyRepository
+	db *memDB
+}
+
+func (r memProxyRepo) GetProxiesByUuid(ctx context.Context, uuid string) ([]domain.Proxy, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var res []domain.Proxy
+	for _, p := range r.db.proxies {
+		if p.Uuid == uuid {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// CreateProxy turns a proxy down that is registered already, as the unique key does
+func (r memProxyRepo) CreateProxy(ctx context.Context, p *domain.Proxy) error {
+	key := p.Type + ":" + p.Value
+
+	var err error
+	r.db.write(ctx, func() {
+		if _, ok := r.db.proxies[key]; ok {
+			err = domain.ErrProxyTaken
+			return
+		}
+		p.Id, p.CreatedAt = r.db.id(), time.Now()
+		r.db.proxies[key] = *p
+	}, func() {
+		if err == nil {
+			delete(r.db.proxies, key)
+		}
+	})
+	return err
+}
+
+func (r memProxyRepo) GetProxyForUpdate(ctx context.Context, proxyType string, value string) (domain.Proxy, error) {
+	key := proxyType + ":" + value
+	r.db.lock(ctx, "proxy:"+key)
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	p, ok := r.db.proxies[key]
+	if !ok {
+		return p, domain.ErrProxyNotFound
+	}
+	return p, nil
+}
+
+func (r memProxyRepo) UpdateProxy(ctx context.Context, p *domain.Proxy) error {
+	key := p.Type + ":" + p.Value
+
+	var old domain.Proxy
+	r.db.write(ctx, func() {
+		old = r.db.proxies[key]
+		p.UpdatedAt = time.Now()
+		r.db.proxies[key] = *p
+	}, func() {
+		r.db.proxies[key] = old
+	})
+	return nil
+}
+
+func (r memProxyRepo) DeleteProxy(ctx context.Context, id int64) error {
+	var key string
+	var old domain.Proxy
+	r.db.write(ctx, func() {
+		for k, p := range r.db.proxies {
+			if p.Id == id {
+				key, old = k, p
+				delete(r.db.proxies, k)
+			}
+		}
+	}, func() {
+		if key != "" {
+			r.db.proxies[key] = old
+		}
+	})
+	return nil
+}
+
+type memCardlessRepo struct {
+	domain.CardlessWithdrawalRepository
+	db *memDB
+}
+
+func (r memCardlessRepo) CreateCardlessWithdrawal(ctx context.Context, w *domain.CardlessWithdrawal) (err error) {
+	r.db.write(ctx, func() {
+		if _, ok := r.db.cardless[w.Reference]; ok {
+			err = domain.ErrConflict
+			return
+		}
+		w.Id, w.CreatedAt = r.db.id(), time.Now()
+		w.UpdatedAt = w.CreatedAt
+		r.db.cardless[w.Reference] = *w
+	}, func() {
+		if err == nil {
+			delete(r.db.cardless, w.Reference)
+		}
+	})
+	return err
+}
+
+func (r memCardlessRepo) GetCardlessWithdrawalByReferenceForUpdate(ctx context.Context, reference string) (domain.CardlessWithdrawal, error) {
+	r.db.lock(ctx, "cardless:"+reference)
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	w, ok := r.db.cardless[reference]
+	if !ok {
+		return w, domain.ErrCardlessNotFound
+	}
+	return w, nil
+}
+
+func (r memCardlessRepo) UpdateCardlessWithdrawal(ctx context.Context, w *domain.CardlessWithdrawal) error {
+	var old domain.CardlessWithdrawal
+	r.db.write(ctx, func() {
+		old = r.db.cardless[w.Reference]
+		w.UpdatedAt = time.Now()
+		r.db.cardless[w.Reference] = *w
+	}, func() {
+		r.db.cardless[w.Reference] = old
+	})
+	return nil
+}
+
+func (r memCardlessRepo) GetHeldAmount(ctx context.Context, accountNo string, now time.Time) (held domain.Money, err error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, w := range r.db.cardless {
+		if w.AccountNo == accountNo && w.IsHolding(now) {
+			if held, err = held.Add(w.Hold); err != nil {
+				return held, err
+			}
+		}
+	}
+	return held, nil
+}
+
+func (r memCardlessRepo) ExpireCardlessWithdrawals(ctx context.Context, now time.Time) (n int64, err error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for reference, w := range r.db.cardless {
+		if w.Status == domain.CardlessPending && !now.Before(w.ExpiresAt) {
+			w.Status, w.UpdatedAt = domain.CardlessExpired, now
+			r.db.cardless[reference] = w
+			n++
+		}
+	}
+	return n, nil
+}
+
+type memTerminalRepo struct {
+	domain.TerminalRepository
+	db *memDB
+}
+
+// addTerminal puts an online terminal paying out every Thai banknote, without cassettes
+func (db *memDB) addTerminal(id string, threshold *domain.Money) {
+	db.terminals[id] = domain.Terminal{Id: id, Status: domain.TerminalOnline, Denominations: []int64{20, 50, 100, 500, 1000},
+		DispenseStrategy: domain.DispenseMinimalNotes, LowCashThreshold: threshold}
+}
+
+func (r memTerminalRepo) GetTerminal(ctx context.Context, id string) (domain.Terminal, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	terminal, ok := r.db.terminals[id]
+	if !ok {
+		return terminal, domain.ErrNotFound
+	}
+	return terminal, nil
+}
+
+func (r memTerminalRepo) GetCassettes(ctx context.Context, terminalId string) ([]domain.Cassette, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var res []domain.Cassette
+	for _, c := range r.db.cassettes {
+		if c.TerminalId == terminalId {
+			res = append(res, c)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Position < res[j].Position })
+	return res, nil
+}
+
+func (r memTerminalRepo) GetCassettesForUpdate(ctx context.Context, terminalId string) ([]domain.Cassette, error) {
+	r.db.lock(ctx, "terminal:"+terminalId)
+	return r.GetCassettes(ctx, terminalId)
+}
+
+func (r memTerminalRepo) UpsertCassette(ctx context.Context, c *domain.Cassette) error {
+	var old domain.Cassette
+	r.db.write(ctx, func() {
+		for id, existing := range r.db.cassettes {
+			if existing.TerminalId == c.TerminalId && existing.Position == c.Position {
+				c.Id, old = id, existing
+			}
+		}
+		if c.Id == 0 {
+			c.Id = r.db.id()
+		}
+		c.UpdatedAt = time.Now()
+		r.db.cassettes[c.Id] = *c
+	}, func() {
+		if old.Id == 0 {
+			delete(r.db.cassettes, c.Id)
+		} else {
+			r.db.cassettes[c.Id] = old
+		}
+	})
+	return nil
+}
+
+func (r memTerminalRepo) UpdateCassetteCount(ctx context.Context, id int64, count int) error {
+	var old domain.Cassette
+	r.db.write(ctx, func() {
+		old = r.db.cassettes[id]
+		c := old
+		c.Count = count
+		r.db.cassettes[id] = c
+	}, func() {
+		r.db.cassettes[id] = old
+	})
+	return nil
+}
+
+func (r memTerminalRepo) CreateDispense(ctx context.Context, transactionId int64, plan *domain.DispensePlan) (err error) {
+	r.db.write(ctx, func() {
+		if _, ok := r.db.dispenses[transactionId]; ok {
+			err = domain.ErrConflict
+			return
+		}
+		r.db.dispenses[transactionId] = *plan
+	}, func() {
+		if err == nil {
+			delete(r.db.dispenses, transactionId)
+		}
+	})
+	return err
+}
+
+func (r memTerminalRepo) GetDispenseForUpdate(ctx context.Context, transactionId int64) (*domain.DispensePlan, error) {
+	r.db.lock(ctx, "dispense:"+strconv.FormatInt(transactionId, 10))
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	plan, ok := r.db.dispenses[transactionId]
+	if !ok {
+		return nil, nil
+	}
+	return &plan, nil
+}
+
+func (r memTerminalRepo) ReverseDispense(ctx context.Context, transactionId int64, reversalId int64) (err error) {
+	var old domain.DispensePlan
+	r.db.write(ctx, func() {
+		old = r.db.dispenses[transactionId]
+		if old.ReversalId != 0 {
+			err = domain.ErrAlreadyReversed
+			return
+		}
+		plan := old
+		plan.ReversalId = reversalId
+		r.db.dispenses[transactionId] = plan
+	}, func() {
+		r.db.dispenses[transactionId] = old
+	})
+	return err
+}
+
+func (r memTerminalRepo) CreateCashMovements(ctx context.Context, movements []domain.CashMovement) error {
+	var n int
+	r.db.write(ctx, func() {
+		n = len(r.db.movements)
+		for i := range movements {
+			movements[i].Id, movements[i].CreatedAt = r.db.id(), time.Now()
+			r.db.movements = append(r.db.movements, movements[i])
+		}
+	}, func() {
+		r.db.movements = r.db.movements[:n]
+	})
+	return nil
+}
+
+func (r memTerminalRepo) GetCashMovementsAfter(ctx context.Context, terminalId string, movementId int64) ([]domain.CashMovement, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var res []domain.CashMovement
+	for _, mv := range r.db.movements {
+		if mv.TerminalId == terminalId && mv.Id > movementId {
+			res = append(res, mv)
+		}
+	}
+	return res, nil
+}
+
+func (r memTerminalRepo) GetDepositBin(ctx context.Context, terminalId string) ([]domain.BanknoteCount, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	counts := make(map[int64]int)
+	for _, mv := range r.db.movements {
+		if mv.TerminalId == terminalId && mv.Position == domain.DepositBin {
+			counts[mv.Denomination] += mv.Count
+		}
+	}
+
+	res := make([]domain.BanknoteCount, 0)
+	for d, count := range counts {
+		if count > 0 {
+			res = append(res, domain.BanknoteCount{Denomination: d, Count: count})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Denomination < res[j].Denomination })
+	return res, nil
+}
+
+func (r memTerminalRepo) GetLastBalancingReport(ctx context.Context, terminalId string) (*domain.BalancingReport, error) {
+	reports, _ := r.GetBalancingReports(ctx, terminalId)
+	if len(reports) == 0 {
+		return nil, nil
+	}
+	return &reports[0], nil
+}
+
+// GetBalancingReports returns the reports of the terminal, the latest first
+func (r memTerminalRepo) GetBalancingReports(ctx context.Context, terminalId string) ([]domain.BalancingReport, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var res []domain.BalancingReport
+	for i := len(r.db.balancings) - 1; i >= 0; i-- {
+		if r.db.balancings[i].TerminalId == terminalId {
+			res = append(res, r.db.balancings[i])
+		}
+	}
+	return res, nil
+}
+
+func (r memTerminalRepo) CreateBalancingReport(ctx context.Context, report *domain.BalancingReport) error {
+	var n int
+	r.db.write(ctx, func() {
+		n = len(r.db.balancings)
+		report.Id = r.db.id()
+		r.db.balancings = append(r.db.balancings, *report)
+	}, func() {
+		r.db.balancings = r.db.balancings[:n]
+	})
+	return nil
+}
+
+type memFeeRepo struct {
+	domain.FeeRepository
+	rules []domain.FeeRule
+}
+
+func (r memFeeRepo) GetRulesEffectiveAt(ctx context.Context, transactionType string, at time.Time) ([]domain.FeeRule, error) {
+	var res []domain.FeeRule
+	for _, rule := range r.rules {
+		if rule.TransactionType == transactionType {
+			res = append(res, rule)
+		}
+	}
+	return res, nil
+}
+
+type memLimitRepo struct {
+	domain.LimitRepository
+	limits []domain.Limit
+}
+
+func (r memLimitRepo) GetApplicableLimits(ctx context.Context, transactionType string, segment string, accountNo string) ([]domain.Limit, error) {
+	return r.limits, nil
+}
+
+type memScheduledRepo struct {
+	domain.ScheduledTransactionRepository
+	db *memDB
+}
+
+func scheduleKey(id int64) string {
+	return "schedule:" + strconv.FormatInt(id, 10)
+}
+
+func executionKey(id int64) string {
+	return "execution:" + strconv.FormatInt(id, 10)
+}
+
+func (r memScheduledRepo) CreateScheduledTransaction(ctx context.Context, st *domain.ScheduledTransaction) error {
+	r.db.write(ctx, func() {
+		st.Id, st.CreatedAt = r.db.id(), time.Now()
+		r.db.schedules[st.Id] = *st
+	}, func() {
+		delete(r.db.schedules, st.Id)
+	})
+	return nil
+}
+
+func (r memScheduledRepo) GetScheduledTransactionByID(ctx context.Context, id int64) (domain.ScheduledTransaction, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	st, ok := r.db.schedules[id]
+	if !ok {
+		return st, domain.ErrScheduleNotFound
+	}
+	return st, nil
+}
+
+func (r memScheduledRepo) GetScheduledTransactionByIDForUpdate(ctx context.Context, id int64) (domain.ScheduledTransaction, error) {
+	r.db.lock(ctx, scheduleKey(id))
+	return r.GetScheduledTransactionByID(ctx, id)
+}
+
+func (r memScheduledRepo) GetDueScheduledTransactions(ctx context.Context, now time.Time) ([]domain.ScheduledTransaction, error) {
+	r.db.mu.Lock()
+	var due []domain.ScheduledTransaction
+	for _, st := range r.db.schedules {
+		if st.Status == domain.ScheduleActive && st.NextExecutionAt != nil && !st.NextExecutionAt.After(now) {
+			due = append(due, st)
+		}
+	}
+	r.db.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].NextExecutionAt.Before(*due[j].NextExecutionAt) })
+
+	var locked []domain.ScheduledTransaction
+	for _, st := range due {
+		if !r.db.tryLock(ctx, scheduleKey(st.Id)) {
+			continue
+		}
+		// read again, the schedule may have moved on while another poller held it
+		if st, _ = r.GetScheduledTransactionByID(ctx, st.Id); st.Status == domain.ScheduleActive && !st.NextExecutionAt.After(now) {
+			locked = append(locked, st)
+		}
+	}
+	return locked, nil
+}
+
+func (r memScheduledRepo) UpdateScheduledTransaction(ctx context.Context, st *domain.ScheduledTransaction) error {
+	var old domain.ScheduledTransaction
+	r.db.write(ctx, func() {
+		old = r.db.schedules[st.Id]
+		r.db.schedules[st.Id] = *st
+	}, func() {
+		r.db.schedules[st.Id] = old
+	})
+	return nil
+}
+
+// CreateScheduledExecution keeps the unique key (schedule_id, scheduled_for) as MySQL does
+func (r memScheduledRepo) CreateScheduledExecution(ctx context.Context, ex *domain.ScheduledExecution) error {
+	r.db.write(ctx, func() {
+		for id, existing := range r.db.executions {
+			if existing.ScheduleId == ex.ScheduleId && existing.ScheduledFor.Equal(ex.ScheduledFor) {
+				ex.Id = id
+				return
+			}
+		}
+		ex.Id, ex.CreatedAt = r.db.id(), time.Now()
+		r.db.executions[ex.Id] = *ex
+	}, func() {
+		delete(r.db.executions, ex.Id)
+	})
+	return nil
+}
+
+func claimable(ex domain.ScheduledExecution, now time.Time) bool {
+	return (ex.Status == domain.ExecutionPending && !ex.NextAttemptAt.After(now)) ||
+		(ex.Status == domain.ExecutionProcessing && !ex.LeaseExpiresAt.After(now))
+}
+
+func (r memScheduledRepo) ClaimScheduledExecution(ctx context.Context, now time.Time) (*domain.ScheduledExecution, error) {
+	r.db.mu.Lock()
+	var due []domain.ScheduledExecution
+	for _, ex := range r.db.executions {
+		if claimable(ex, now) {
+			due = append(due, ex)
+		}
+	}
+	r.db.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].ScheduledFor.Equal(due[j].ScheduledFor) {
+			return due[i].ScheduledFor.Before(due[j].ScheduledFor)
+		}
+		return due[i].Id < due[j].Id
+	})
+
+	for _, ex := range due {
+		if claimed, err := r.ClaimScheduledExecutionByID(ctx, ex.Id, now); claimed != nil || err != nil {
+			return claimed, err
+		}
+	}
+	return nil, nil
+}
+
+func (r memScheduledRepo) ClaimScheduledExecutionByID(ctx context.Context, id int64, now time.Time) (*domain.ScheduledExecution, error) {
+	if !r.db.tryLock(ctx, executionKey(id)) {
+		return nil, nil
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	ex, ok := r.db.executions[id]
+	if !ok || !claimable(ex, now) {
+		return nil, nil
+	}
+	return &ex, nil
+}
+
+func (r memScheduledRepo) GetScheduledExecutionForUpdate(ctx context.Context, id int64) (domain.ScheduledExecution, error) {
+	r.db.lock(ctx, executionKey(id))
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	ex, ok := r.db.executions[id]
+	if !ok {
+		return ex, domain.ErrNotFound
+	}
+	return ex, nil
+}
+
+func (r memScheduledRepo) UpdateScheduledExecution(ctx context.Context, ex *domain.ScheduledExecution, fence int) (err error) {
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	var old domain.ScheduledExecution
+	r.db.write(ctx, func() {
+		old = r.db.executions[ex.Id]
+		if old.Attempts != fence {
+			err = domain.ErrExecutionLeaseLost
+			return
+		}
+		r.db.executions[ex.Id] = *ex
+	}, func() {
+		r.db.executions[ex.Id] = old
+	})
+	return err
+}
+
+func (r memScheduledRepo) CancelScheduledExecutions(ctx context.Context, scheduleId int64) error {
+	var cancelled []int64
+	r.db.write(ctx, func() {
+		for id, ex := range r.db.executions {
+			if ex.ScheduleId == scheduleId && ex.Status == domain.ExecutionPending {
+				ex.Status = domain.ExecutionCancelled
+				r.db.executions[id] = ex
+				cancelled = append(cancelled, id)
+			}
+		}
+	}, func() {
+		for _, id := range cancelled {
+			ex := r.db.executions[id]
+			ex.Status = domain.ExecutionPending
+			r.db.executions[id] = ex
+		}
+	})
+	return nil
+}
+
+// executionsByStatus counts the executions of schedule id with each status
+func (db *memDB) executionsByStatus(id int64) map[string]int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, ex := range db.executions {
+		if ex.ScheduleId == id {
+			counts[ex.Status]++
+		}
+	}
+	return counts
+}
+
+// testUsecases wires a transactionUsecase to db the way main.go wires it to MySQL
+type testUsecases struct {
+	db          *memDB
+	transaction *transactionUsecase
+}
+
+// testTerminals pays out every withdrawal and takes in every deposit it is asked to
+type testTerminals struct {
+	domain.TerminalUsecase
+	dispensed []int64
+}
+
+func (t *testTerminals) Dispense(ctx context.Context, tr *domain.Transaction) error {
+	t.dispensed = append(t.dispensed, tr.Amount.Satang)
+	return nil
+}
+
+func (t *testTerminals) AcceptDeposit(ctx context.Context, tr *domain.Transaction) error {
+	return nil
+}
+
+// ReturnDispense has no notes to put back, testTerminals records no dispense
+func (t *testTerminals) ReturnDispense(ctx context.Context, orig *domain.Transaction, reversal *domain.Transaction) error {
+	return nil
+}
+
+func newTestUsecases(db *memDB) *testUsecases {
+	ar := memAccountRepo{db: db}
+	tr := memTransactionRepo{db: db}
+	uow := memUnitOfWork{db: db}
+	timeout := 5 * time.Second
+
+	au := NewAccountUsecase(ar, tr, timeout)
+	lu := NewLedgerUsecase(memLedgerRepo{db: db}, ar, timeout)
+	fu := NewFeeUsecase(memFeeRepo{}, tr, uow, timeout)
+	limu := NewLimitUsecase(memLimitRepo{}, tr, ar, timeout)
+
+	tu := NewTransactionUsecase(tr, memScheduledRepo{db: db}, memOutboxRepo{db: db}, memInterbankRepo{db: db}, nil, memCardlessRepo{db: db}, ar, au, nil, lu, fu, limu, &testTerminals{},
+		clearing.NewISO20022Adapter("clearing_pacs008", "clearing_pacs002"), uow,
+		domain.SchedulePolicy{}, domain.CardlessPolicy{}, domain.ClearingPolicy{}, timeout)
+
+	return &testUsecases{db: db, transaction: tu.(*transactionUsecase)}
+}
@@ -7,70 +7,71 @@ import (
 	"time"
 
 	"main/domain"
-
-	consumer "main/kafka/consumer"
-
-	"github.com/Shopify/sarama"
+	"main/kafka/codec"
 )
 
 type notificationUsecase struct {
 	transactionUsecase domain.TransactionUsecase
 	contextTimeout     time.Duration
-	kafkaClient        sarama.Client
 }
 
 // NewAccountUsecase will create new an accountUsecase object representation of domain.AccountUsecase interface
-func NewNotificationUsecase(tu domain.TransactionUsecase, timeout time.Duration, kafka sarama.Client) domain.NotificationUsecase {
+func NewNotificationUsecase(tu domain.TransactionUsecase, timeout time.Duration) domain.NotificationUsecase {
 	return &notificationUsecase{
 		transactionUsecase: tu,
 		contextTimeout:     timeout,
-		kafkaClient:        kafka,
 	}
 }
 
-func (n *notificationUsecase) SendTransactionNotification(ctx context.Context) {
-	topic := "sms_transaction"
-	var partition int32 = 0
-	var offset int64 = sarama.OffsetNewest
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Println("Send Notification stopped")
-			return
-		default:
-
-			// Consume a Kafka message
-			message := consumer.RunKafkaConsumer(n.kafkaClient, topic, partition, offset)
-			message_split := strings.Split(message, "|")
-			if message_split[0] == "withdraw" {
-				fmt.Printf("%s Baht has been withdrawn from account no: %s at %s\nRemaining balance: %s\n%s\n",
-					message_split[1],
-					message_split[2],
-					message_split[3],
-					message_split[4],
-					strings.Repeat("-", 120))
+// SendTransactionNotification handles one message of the "sms_transaction" topic. Messages that
+// can not be read go to the dead letter topic without retries, trying them again would not help.
+func (n *notificationUsecase) SendTransactionNotification(ctx context.Context, message *domain.Message) error {
+	ev, err := codec.DecodeMessage(message)
+	if err != nil {
+		return domain.Permanent(err)
+	}
 
-			} else if message_split[0] == "deposit" {
-				fmt.Printf("%s Baht has been deposited into account no: %s at %s\nRemaining balance: %s\n%s\n",
-					message_split[1],
-					message_split[2],
-					message_split[3],
-					message_split[4],
-					strings.Repeat("-", 120))
-			} else if message_split[0] == "transfer" {
-				fmt.Printf("%s Baht has been transferred from account no: %s to account no: %s at %s\n%s\n",
-					message_split[1],
-					message_split[2],
-					message_split[5],
-					message_split[3],
-					strings.Repeat("-", 120))
-			}
+	tr, ok := ev.Payload.(*codec.TransactionEvent)
+	if !ok {
+		return nil
+	}
 
-			// offset += 1
+	money := func(satang int64) string {
+		return domain.NewMoney(satang).String()
+	}
+	createdAt := tr.CreatedAt.Format("2006-01-02 15:04:05")
 
-			// time.Sleep(time.Second)
-		}
+	if tr.Type == "withdraw" {
+		fmt.Printf("%s Baht has been withdrawn from account no: %s at %s\nRemaining balance: %s\n%s\n",
+			money(tr.Amount),
+			tr.AccountNo,
+			createdAt,
+			money(tr.Balance),
+			strings.Repeat("-", 120))
 
+	} else if tr.Type == "deposit" {
+		fmt.Printf("%s Baht has been deposited into account no: %s at %s\nRemaining balance: %s\n%s\n",
+			money(tr.Amount),
+			tr.AccountNo,
+			createdAt,
+			money(tr.Balance),
+			strings.Repeat("-", 120))
+	} else if tr.Type == "reversal" {
+		fmt.Printf("Transaction %d on account no: %s has been reversed (%s Baht) at %s\nRemaining balance: %s\n%s\n",
+			tr.ReferenceId,
+			tr.AccountNo,
+			money(tr.Total),
+			createdAt,
+			money(tr.Balance),
+			strings.Repeat("-", 120))
+	} else if tr.Type == "transfer" {
+		fmt.Printf("%s Baht has been transferred from account no: %s to account no: %s at %s\n%s\n",
+			money(tr.Amount),
+			tr.AccountNo,
+			tr.ReceiverNo,
+			createdAt,
+			strings.Repeat("-", 120))
 	}
 
+	return nil
 }
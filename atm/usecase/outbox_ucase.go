@@ -0,0 +1,194 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"main/domain"
+	"main/kafka/codec"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	outboxBatchSize  = 100
+	outboxBackoff    = time.Second
+	outboxMaxBackoff = time.Minute
+	// published events are deleted every outboxCleanupEvery, outboxDeleteBatch at a time
+	outboxCleanupEvery = time.Hour
+	outboxDeleteBatch  = 1000
+)
+
+type outboxUsecase struct {
+	outboxRepo  domain.OutboxRepository
+	publisher   domain.EventPublisher
+	codec       codec.Codec
+	unitOfWork  domain.UnitOfWork
+	policy      domain.OutboxPolicy
+	lastCleanup time.Time
+}
+
+// NewOutboxUsecase will create new an outboxUsecase object representation of domain.OutboxUsecase interface
+func NewOutboxUsecase(or domain.OutboxRepository, publisher domain.EventPublisher, c codec.Codec, uow domain.UnitOfWork, policy domain.OutboxPolicy) domain.OutboxUsecase {
+	return &outboxUsecase{
+		outboxRepo: or,
+		publisher:  publisher,
+		codec:      c,
+		unitOfWork: uow,
+		policy:     policy,
+	}
+}
+
+// Relay publishes the outbox every interval until ctx is done, and deletes what was published
+// longer than the retention ago. Delivery is at least once: an event sent just before its row
+// could be marked, or by a relay whose claim ran out, goes out again, so consumers must tolerate repeats.
+func (o *outboxUsecase) Relay(ctx context.Context) {
+	ticker := time.NewTicker(o.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// a claim takes one event of a key, so the batches run until nothing is due
+			for ctx.Err() == nil {
+				n, err := o.relayBatch(ctx)
+				if err != nil {
+					logrus.Error(err)
+				}
+				if err != nil || n == 0 {
+					break
+				}
+			}
+
+			if err := o.cleanup(ctx, time.Now()); err != nil {
+				logrus.Error(err)
+			}
+		}
+	}
+}
+
+// relayBatch claims a batch of events in a short unit of work and publishes it outside of it, so
+// no row stays locked while Kafka is waited for. The batch stops at the first failed publish, as
+// Kafka being down would fail the rest the same way, and the events not tried are given back.
+func (o *outboxUsecase) relayBatch(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	var events []domain.OutboxEvent
+	err := o.unitOfWork.Do(ctx, func(ctx context.Context) (err error) {
+		events, err = o.outboxRepo.ClaimEvents(ctx, now, now.Add(o.policy.Lease), outboxBatchSize)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range events {
+		ev := &events[i]
+
+		headers, message, err := o.encode(ev)
+		if err != nil {
+			// no later attempt encodes it any better
+			if err = o.failed(ctx, ev, err, true); err != nil {
+				return len(events), err
+			}
+			continue
+		}
+
+		if err = o.publisher.Publish(ev.Topic, ev.Key, headers, message); err != nil {
+			if errFailed := o.failed(ctx, ev, err, false); errFailed != nil {
+				logrus.Error(errFailed)
+			}
+			o.release(ctx, events[i+1:])
+			return len(events), err
+		}
+
+		if err = o.outboxRepo.MarkEventPublished(ctx, ev.Id, time.Now()); err != nil {
+			return len(events), err
+		}
+	}
+
+	return len(events), nil
+}
+
+// failed records a failed attempt at ev. The event is parked when it can never be published or
+// used up MaxAttempts, and tried again after a backoff otherwise. A MaxAttempts of 0 never parks
+// an event that could still go out.
+func (o *outboxUsecase) failed(ctx context.Context, ev *domain.OutboxEvent, cause error, permanent bool) error {
+	now := time.Now()
+	ev.Attempts++
+	ev.NextAttemptAt = now.Add(outboxRetryAfter(ev.Attempts))
+	ev.LastError = cause.Error()
+
+	if permanent || (o.policy.MaxAttempts > 0 && ev.Attempts >= o.policy.MaxAttempts) {
+		ev.ParkedAt = &now
+		logrus.Errorf("outbox event %d for %s parked after %d attempts: %v", ev.Id, ev.Topic, ev.Attempts, cause)
+	}
+
+	return o.outboxRepo.UpdateEventAttempt(ctx, ev)
+}
+
+// release gives claimed events back without counting an attempt
+func (o *outboxUsecase) release(ctx context.Context, events []domain.OutboxEvent) {
+	now := time.Now()
+	for i := range events {
+		events[i].NextAttemptAt = now
+		if err := o.outboxRepo.UpdateEventAttempt(ctx, &events[i]); err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+// cleanup deletes the events published longer than the retention ago, once every outboxCleanupEvery
+func (o *outboxUsecase) cleanup(ctx context.Context, now time.Time) error {
+	if o.policy.Retention <= 0 || now.Sub(o.lastCleanup) < outboxCleanupEvery {
+		return nil
+	}
+	o.lastCleanup = now
+
+	for {
+		n, err := o.outboxRepo.DeletePublishedEvents(ctx, now.Add(-o.policy.Retention), outboxDeleteBatch)
+		if err != nil || n < outboxDeleteBatch {
+			return err
+		}
+	}
+}
+
+// encode encodes the event with the configured codec. An event with a content type of its own,
+// such as an ISO 20022 document for the clearing house, is sent as it is. Events queued before
+// the envelope are sent as they are too, their consumers read them without a content type.
+func (o *outboxUsecase) encode(ev *domain.OutboxEvent) (map[string]string, []byte, error) {
+	if ev.ContentType != "" {
+		return map[string]string{codec.ContentTypeHeader: ev.ContentType}, []byte(ev.Payload), nil
+	}
+
+	if !strings.HasPrefix(ev.Payload, "{") {
+		return nil, []byte(ev.Payload), nil
+	}
+
+	env, err := codec.JSON.Decode([]byte(ev.Payload))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, err := o.codec.Encode(env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return map[string]string{codec.ContentTypeHeader: o.codec.ContentType()}, message, nil
+}
+
+// outboxRetryAfter doubles the wait after every failed attempt
+func outboxRetryAfter(attempts int) time.Duration {
+	backoff := outboxBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,279 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"main/domain"
+	"main/kafka/codec"
+)
+
+var testOutboxPolicy = domain.OutboxPolicy{
+	Interval:    time.Second,
+	Lease:       time.Minute,
+	MaxAttempts: 3,
+	Retention:   time.Hour,
+}
+
+func newTestRelay(db *memDB, publisher domain.EventPublisher, policy domain.OutboxPolicy) *outboxUsecase {
+	return NewOutboxUsecase(memOutboxRepo{db: db}, publisher, codec.JSON, memUnitOfWork{db: db}, policy).(*outboxUsecase)
+}
+
+// addEvents queues n pipe-delimited events for key, numbered from 0
+func addEvents(db *memDB, key string, n int) {
+	for i := 0; i < n; i++ {
+		ev := domain.OutboxEvent{Topic: "sms", Key: key, Payload: fmt.Sprintf("%s|%d", key, i)}
+		_ = memOutboxRepo{db: db}.CreateEvent(context.Background(), &ev)
+	}
+}
+
+// drain runs batches of o until one claims nothing or fails
+func drain(t *testing.T, o *outboxUsecase) {
+	t.Helper()
+
+	for {
+		n, err := o.relayBatch(context.Background())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if n == 0 {
+			return
+		}
+	}
+}
+
+func checkInOrder(t *testing.T, sent map[string][]string, key string, n int) {
+	t.Helper()
+
+	if len(sent[key]) != n {
+		t.Fatalf("%s: sent %d events, want %d", key, len(sent[key]), n)
+	}
+	for i, message := range sent[key] {
+		if want := fmt.Sprintf("%s|%d", key, i); message != want {
+			t.Fatalf("%s: event %d is %q, want %q", key, i, message, want)
+		}
+	}
+}
+
+func TestRelayPublishesEachKeyInOrder(t *testing.T) {
+	db := newMemDB()
+	for _, key := range []string{"1000000001", "2000000001", "3000000001"} {
+		addEvents(db, key, 40)
+	}
+	p := &testPublisher{}
+
+	drain(t, newTestRelay(db, p, testOutboxPolicy))
+
+	for _, key := range []string{"1000000001", "2000000001", "3000000001"} {
+		checkInOrder(t, p.sent, key, 40)
+	}
+	if got := db.eventsByState(); got["published"] != 120 {
+		t.Errorf("got %v, want all published", got)
+	}
+}
+
+func TestRelayPublishesOutsideTheClaim(t *testing.T) {
+	db := newMemDB()
+	addEvents(db, "1000000001", 2)
+
+	// another unit of work can lock every event while one is being sent
+	p := &testPublisher{publish: func(key string, message string) error {
+		return memUnitOfWork{db: db}.Do(context.Background(), func(ctx context.Context) error {
+			for _, ev := range db.outbox {
+				if !db.tryLock(ctx, outboxKey(ev.Id)) {
+					return fmt.Errorf("event %d is locked while %q is sent", ev.Id, message)
+				}
+			}
+			return nil
+		})
+	}}
+
+	drain(t, newTestRelay(db, p, testOutboxPolicy))
+
+	checkInOrder(t, p.sent, "1000000001", 2)
+}
+
+func TestConcurrentRelaysPublishEachEventOnceInOrder(t *testing.T) {
+	db := newMemDB()
+	keys := []string{"1000000001", "2000000001", "3000000001", "4000000001"}
+	for _, key := range keys {
+		addEvents(db, key, 25)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	p := &testPublisher{publish: func(key string, message string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, message)
+		return nil
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			drain(t, newTestRelay(db, p, testOutboxPolicy))
+		}()
+	}
+	wg.Wait()
+
+	// a relay can claim nothing while another still holds the head of every key
+	drain(t, newTestRelay(db, p, testOutboxPolicy))
+
+	for _, key := range keys {
+		checkInOrder(t, p.sent, key, 25)
+	}
+	if len(order) != 100 {
+		t.Errorf("published %d times, want 100", len(order))
+	}
+}
+
+func TestRelayParksAfterMaxAttempts(t *testing.T) {
+	db := newMemDB()
+	addEvents(db, "1000000001", 2)
+	addEvents(db, "2000000001", 1)
+
+	p := &testPublisher{publish: func(key string, message string) error {
+		if message == "1000000001|0" {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}}
+	o := newTestRelay(db, p, testOutboxPolicy)
+
+	for attempt := 1; attempt <= testOutboxPolicy.MaxAttempts; attempt++ {
+		if _, err := o.relayBatch(context.Background()); err == nil {
+			t.Fatalf("attempt %d: want the publish error", attempt)
+		}
+
+		db.mu.Lock()
+		ev := db.outbox[0]
+		// the backoff has passed
+		db.outbox[0].NextAttemptAt = time.Now()
+		db.mu.Unlock()
+
+		if ev.Attempts != attempt || ev.LastError != "broker unavailable" {
+			t.Fatalf("attempt %d: got %d attempts, %q", attempt, ev.Attempts, ev.LastError)
+		}
+		if parked := ev.ParkedAt != nil; parked != (attempt == testOutboxPolicy.MaxAttempts) {
+			t.Fatalf("attempt %d: parked is %v", attempt, parked)
+		}
+	}
+
+	// the parked event no longer holds its key back
+	drain(t, o)
+
+	if got := p.sent["1000000001"]; len(got) != 1 || got[0] != "1000000001|1" {
+		t.Errorf("got %v, want only the event after the parked one", got)
+	}
+	checkInOrder(t, p.sent, "2000000001", 1)
+}
+
+func TestRelayGivesBackTheRestOfAFailedBatch(t *testing.T) {
+	db := newMemDB()
+	addEvents(db, "1000000001", 1)
+	addEvents(db, "2000000001", 1)
+
+	p := &testPublisher{publish: func(key string, message string) error {
+		return errors.New("broker unavailable")
+	}}
+
+	if _, err := newTestRelay(db, p, testOutboxPolicy).relayBatch(context.Background()); err == nil {
+		t.Fatal("want the publish error")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if ev := db.outbox[1]; ev.Attempts != 0 || ev.NextAttemptAt.After(time.Now()) {
+		t.Errorf("got %d attempts, next at %v, want the untried event due again", ev.Attempts, ev.NextAttemptAt)
+	}
+}
+
+func TestRelayParksAnUndecodableEvent(t *testing.T) {
+	db := newMemDB()
+	ev := domain.OutboxEvent{Topic: "sms", Key: "1000000001", Payload: "{not json"}
+	_ = memOutboxRepo{db: db}.CreateEvent(context.Background(), &ev)
+	addEvents(db, "1000000001", 1)
+	p := &testPublisher{}
+
+	drain(t, newTestRelay(db, p, testOutboxPolicy))
+
+	if got := db.eventsByState(); got["parked"] != 1 || got["published"] != 1 {
+		t.Errorf("got %v, want the bad event parked and the next one published", got)
+	}
+	checkInOrder(t, p.sent, "1000000001", 1)
+}
+
+func TestRelaySendsADocumentAsItIs(t *testing.T) {
+	db := newMemDB()
+	// a JSON document of its own, not an envelope
+	ev := domain.OutboxEvent{Topic: "clearing_pacs008", Key: "1000000001", ContentType: "application/json", Payload: `{"amount":"100.00"}`}
+	_ = memOutboxRepo{db: db}.CreateEvent(context.Background(), &ev)
+	p := &testPublisher{}
+
+	drain(t, newTestRelay(db, p, testOutboxPolicy))
+
+	if got := p.sent["1000000001"]; len(got) != 1 || got[0] != ev.Payload {
+		t.Errorf("sent %q, want the payload as it is", got)
+	}
+	if got := p.headers[codec.ContentTypeHeader]; got != "application/json" {
+		t.Errorf("sent as %q, want the content type of the event", got)
+	}
+}
+
+func TestRelayReclaimsAnExpiredClaim(t *testing.T) {
+	db := newMemDB()
+	addEvents(db, "1000000001", 1)
+	repo := memOutboxRepo{db: db}
+
+	// a relay claims the event and dies before publishing it
+	now := time.Now()
+	claimed, _ := repo.ClaimEvents(context.Background(), now, now.Add(testOutboxPolicy.Lease), outboxBatchSize)
+	if len(claimed) != 1 {
+		t.Fatalf("claimed %d events, want 1", len(claimed))
+	}
+
+	if again, _ := repo.ClaimEvents(context.Background(), now.Add(time.Second), now.Add(time.Minute), outboxBatchSize); len(again) != 0 {
+		t.Fatalf("claimed %d events during the lease, want 0", len(again))
+	}
+
+	later := now.Add(testOutboxPolicy.Lease)
+	if again, _ := repo.ClaimEvents(context.Background(), later, later.Add(time.Minute), outboxBatchSize); len(again) != 1 {
+		t.Fatalf("claimed %d events after the lease, want 1", len(again))
+	}
+}
+
+func TestRelayCleanup(t *testing.T) {
+	db := newMemDB()
+	addEvents(db, "1000000001", 3)
+
+	now := time.Now()
+	old, recent := now.Add(-2*testOutboxPolicy.Retention), now.Add(-time.Minute)
+	db.outbox[0].PublishedAt = &old
+	db.outbox[1].PublishedAt = &recent
+
+	o := newTestRelay(db, &testPublisher{}, testOutboxPolicy)
+	if err := o.cleanup(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.outbox) != 2 || db.outbox[0].PublishedAt != &recent || db.outbox[1].PublishedAt != nil {
+		t.Errorf("got %+v, want the old published event deleted", db.outbox)
+	}
+
+	// not again within outboxCleanupEvery
+	db.outbox[0].PublishedAt = &old
+	if err := o.cleanup(context.Background(), now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.outbox) != 2 {
+		t.Errorf("got %d events, want the cleanup to wait", len(db.outbox))
+	}
+}
@@ -31,7 +31,9 @@ func (p *pollingUsecase) Polling(ctx context.Context, wg *sync.WaitGroup, interv
 		select {
 		case <-ticker.C:
 			// fmt.Println("Polling the database...")
-			p.transactionUsecase.PollScheduledTransaction(ctx, time.Now().Truncate(5*time.Minute))
+			p.transactionUsecase.PollScheduledTransaction(ctx, time.Now())
+			p.transactionUsecase.ExpireCardlessWithdrawals(ctx, time.Now())
+			p.transactionUsecase.ReconcileInterbankTransfers(ctx, time.Now())
 
 		case <-stopChan:
 			return
@@ -0,0 +1,174 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"main/domain"
+)
+
+type proxyUsecase struct {
+	proxyRepo      domain.ProxyRepository
+	accountRepo    domain.AccountRepository
+	authUsecase    domain.AuthenticationUsecase
+	unitOfWork     domain.UnitOfWork
+	contextTimeout time.Duration
+}
+
+// NewProxyUsecase will create new an proxyUsecase object representation of domain.ProxyUsecase interface
+func NewProxyUsecase(pr domain.ProxyRepository, ar domain.AccountRepository, auth domain.AuthenticationUsecase, uow domain.UnitOfWork, timeout time.Duration) domain.ProxyUsecase {
+	return &proxyUsecase{
+		proxyRepo:      pr,
+		accountRepo:    ar,
+		authUsecase:    auth,
+		unitOfWork:     uow,
+		contextTimeout: timeout,
+	}
+}
+
+func (p *proxyUsecase) GetProxies(c context.Context, uuid string) ([]domain.Proxy, error) {
+	ctx, cancel := context.WithTimeout(c, p.contextTimeout)
+	defer cancel()
+
+	return p.proxyRepo.GetProxiesByUuid(ctx, uuid)
+}
+
+// RegisterProxy only takes phones, an otp sent to the phone shows it belongs to the user. Nothing
+// shows that a national ID or e-wallet ID does until there is KYC data to check it against.
+func (p *proxyUsecase) RegisterProxy(c context.Context, uuid string, req domain.ProxyRequest) (*domain.Proxy, error) {
+	ctx, cancel := context.WithTimeout(c, p.contextTimeout)
+	defer cancel()
+
+	if req.Type == domain.ProxyNationalID || req.Type == domain.ProxyEWallet {
+		return nil, domain.ErrProxyNotVerifiable
+	}
+
+	var proxy domain.Proxy
+	err := p.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		ref, err := p.verify(ctx, uuid, req)
+		if err != nil {
+			return err
+		}
+
+		if err = p.checkAccount(ctx, uuid, req.AccountNo); err != nil {
+			return err
+		}
+
+		proxy = domain.Proxy{
+			Type:      ref.Type,
+			Value:     ref.Value,
+			AccountNo: req.AccountNo,
+			Uuid:      uuid,
+		}
+
+		return p.proxyRepo.CreateProxy(ctx, &proxy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxy, nil
+}
+
+func (p *proxyUsecase) ChangeProxy(c context.Context, uuid string, req domain.ProxyRequest) (res *domain.Proxy, err error) {
+	ctx, cancel := context.WithTimeout(c, p.contextTimeout)
+	defer cancel()
+
+	err = p.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		ref, err := p.verify(ctx, uuid, req)
+		if err != nil {
+			return err
+		}
+
+		proxy, err := p.getOwnedProxy(ctx, uuid, ref)
+		if err != nil {
+			return err
+		}
+
+		if err = p.checkAccount(ctx, uuid, req.AccountNo); err != nil {
+			return err
+		}
+
+		res = &proxy
+		if proxy.AccountNo == req.AccountNo {
+			return nil
+		}
+
+		proxy.AccountNo = req.AccountNo
+		return p.proxyRepo.UpdateProxy(ctx, &proxy)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (p *proxyUsecase) DeregisterProxy(c context.Context, uuid string, req domain.ProxyRequest) (err error) {
+	ctx, cancel := context.WithTimeout(c, p.contextTimeout)
+	defer cancel()
+
+	return p.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		ref, err := p.verify(ctx, uuid, req)
+		if err != nil {
+			return err
+		}
+
+		proxy, err := p.getOwnedProxy(ctx, uuid, ref)
+		if err != nil {
+			return err
+		}
+
+		return p.proxyRepo.DeleteProxy(ctx, proxy.Id)
+	})
+}
+
+// verify normalizes the proxy of req and burns its otp. A phone proxy is verified with an otp
+// sent to that phone, the other types, which the user already holds, with one sent to the phone
+// of the user. It runs in the unit of work of the change, so the otp stays usable when the
+// change fails.
+func (p *proxyUsecase) verify(ctx context.Context, uuid string, req domain.ProxyRequest) (ref domain.ProxyRef, err error) {
+	ref = domain.ProxyRef{Type: req.Type, Value: req.Value}
+	if err = ref.Normalize(); err != nil {
+		return ref, err
+	}
+
+	tel := uuid
+	if ref.Type == domain.ProxyPhone {
+		tel = ref.Value
+	}
+
+	return ref, p.authUsecase.ConsumeOtp(ctx, tel, req.Otp)
+}
+
+// checkAccount makes sure money sent to the proxy can land on the account
+func (p *proxyUsecase) checkAccount(ctx context.Context, uuid string, accountNo string) error {
+	acc, err := p.accountRepo.GetAccountByAccountNo(ctx, accountNo)
+	if err != nil {
+		return err
+	}
+
+	if acc.Uuid != uuid {
+		return domain.ErrNotFound
+	}
+
+	if acc.Status == "inactive" {
+		return domain.ErrAccDeleted
+	}
+
+	return nil
+}
+
+// getOwnedProxy locks the proxy and hides proxies of other users behind ErrProxyNotFound
+func (p *proxyUsecase) getOwnedProxy(ctx context.Context, uuid string, ref domain.ProxyRef) (domain.Proxy, error) {
+	proxy, err := p.proxyRepo.GetProxyForUpdate(ctx, ref.Type, ref.Value)
+	if err != nil {
+		return proxy, err
+	}
+
+	if proxy.Uuid != uuid {
+		return proxy, domain.ErrProxyNotFound
+	}
+
+	return proxy, nil
+}
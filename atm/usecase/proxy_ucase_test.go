@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+// testAuth takes the otp sent to each phone, once
+type testAuth struct {
+	domain.AuthenticationUsecase
+	db   *memDB
+	otps map[string]string
+}
+
+func (a testAuth) ConsumeOtp(ctx context.Context, tel string, otp string) (err error) {
+	a.db.write(ctx, func() {
+		if otp == "" || a.otps[tel] != otp {
+			err = domain.ErrInvalidOtp
+			return
+		}
+		delete(a.otps, tel)
+	}, func() {
+		if err == nil {
+			a.otps[tel] = otp
+		}
+	})
+	return err
+}
+
+func TestRegisterProxy(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(0))
+	auth := testAuth{db: db, otps: make(map[string]string)}
+	pu := NewProxyUsecase(memProxyRepo{db: db}, memAccountRepo{db: db}, auth, memUnitOfWork{db: db}, time.Second)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		req  domain.ProxyRequest
+		err  error
+	}{
+		// the otp of the user's own phone says nothing about whose phone this is
+		{"otp of another phone", domain.ProxyRequest{Type: domain.ProxyPhone, Value: "0899999999", Otp: "111111"}, domain.ErrInvalidOtp},
+		{"phone", domain.ProxyRequest{Type: domain.ProxyPhone, Value: "+66899999999", Otp: "999999"}, nil},
+		{"phone taken", domain.ProxyRequest{Type: domain.ProxyPhone, Value: "0899999999", Otp: "999999"}, domain.ErrProxyTaken},
+		// nothing to check these against, an otp to the user's own phone proves nothing
+		{"national ID", domain.ProxyRequest{Type: domain.ProxyNationalID, Value: "1101700230716", Otp: "111111"}, domain.ErrProxyNotVerifiable},
+		{"e-wallet", domain.ProxyRequest{Type: domain.ProxyEWallet, Value: "140000000000001", Otp: "111111"}, domain.ErrProxyNotVerifiable},
+		{"unknown type", domain.ProxyRequest{Type: "email", Value: "someone@example.com", Otp: "111111"}, domain.ErrInvalidProxy},
+	}
+
+	for _, tt := range tests {
+		auth.otps["0811111111"], auth.otps["0899999999"] = "111111", "999999"
+		tt.req.AccountNo = "1000000001"
+		if _, err := pu.RegisterProxy(ctx, "0811111111", tt.req); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	proxies, _ := pu.GetProxies(ctx, "0811111111")
+	if len(proxies) != 1 || proxies[0].Type != domain.ProxyPhone || proxies[0].Value != "0899999999" {
+		t.Errorf("got %+v, want only the phone registered", proxies)
+	}
+}
+
+func TestProxyOtpIsUsedOnce(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(0))
+	db.addAccount("1000000002", "0811111111", domain.NewMoney(0))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+	auth := testAuth{db: db, otps: map[string]string{"0899999999": "999999"}}
+	pu := NewProxyUsecase(memProxyRepo{db: db}, memAccountRepo{db: db}, auth, memUnitOfWork{db: db}, time.Second)
+	ctx := context.Background()
+
+	req := domain.ProxyRequest{Type: domain.ProxyPhone, Value: "0899999999", AccountNo: "1000000001", Otp: "999999"}
+	if _, err := pu.RegisterProxy(ctx, "0811111111", req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.AccountNo = "1000000002"
+	if _, err := pu.ChangeProxy(ctx, "0811111111", req); err != domain.ErrInvalidOtp {
+		t.Fatalf("change with a used otp: got %v, want %v", err, domain.ErrInvalidOtp)
+	}
+
+	// a change that fails does not use up the otp
+	auth.otps["0899999999"] = "888888"
+	req.Otp, req.AccountNo = "888888", "2000000001"
+	if _, err := pu.ChangeProxy(ctx, "0811111111", req); err != domain.ErrNotFound {
+		t.Fatalf("change to the account of another user: got %v, want %v", err, domain.ErrNotFound)
+	}
+	if err := pu.DeregisterProxy(ctx, "0811111111", req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pu.RegisterProxy(ctx, "0811111111", req); err != domain.ErrInvalidOtp {
+		t.Errorf("register with a used otp: got %v, want %v", err, domain.ErrInvalidOtp)
+	}
+}
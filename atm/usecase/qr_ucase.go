@@ -0,0 +1,115 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"main/domain"
+)
+
+type qrUsecase struct {
+	accountRepo        domain.AccountRepository
+	accountUsecase     domain.AccountUsecase
+	transactionUsecase domain.TransactionUsecase
+	codec              domain.QRCodec
+	contextTimeout     time.Duration
+}
+
+// NewQRUsecase will create new an qrUsecase object representation of domain.QRUsecase interface
+func NewQRUsecase(ar domain.AccountRepository, au domain.AccountUsecase, tu domain.TransactionUsecase, codec domain.QRCodec, timeout time.Duration) domain.QRUsecase {
+	return &qrUsecase{
+		accountRepo:        ar,
+		accountUsecase:     au,
+		transactionUsecase: tu,
+		codec:              codec,
+		contextTimeout:     timeout,
+	}
+}
+
+func (q *qrUsecase) GetReceiveQR(c context.Context, uuid string, accountNo string, amount *domain.Money) (*domain.QRCode, error) {
+	ctx, cancel := context.WithTimeout(c, q.contextTimeout)
+	defer cancel()
+
+	acc, err := q.accountRepo.GetAccountByAccountNo(ctx, accountNo)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc.Uuid != uuid {
+		return nil, domain.ErrNotFound
+	}
+
+	if acc.Status == "inactive" {
+		return nil, domain.ErrAccDeleted
+	}
+
+	payload, err := q.codec.Encode(domain.QRPayment{
+		AccountNo: acc.AccountNo,
+		Bank:      q.accountUsecase.SelectBank(acc.AccountNo[len(acc.AccountNo)-1:]),
+		Amount:    amount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := q.codec.PNG(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.QRCode{Payload: payload, Image: image}, nil
+}
+
+// TransferByQR takes the receiver from the payload. The amount of a code with a fixed amount
+// is used as is, tr may only repeat it. Accounts of other users are hidden behind ErrNotFound.
+func (q *qrUsecase) TransferByQR(c context.Context, uuid string, tr *domain.Transaction, payload string) error {
+	p, err := q.codec.Decode(payload)
+	if err != nil {
+		return err
+	}
+
+	if err = q.checkOwner(c, uuid, tr.Account.AccountNo); err != nil {
+		return err
+	}
+
+	if p.Amount != nil {
+		if !tr.Amount.IsZero() && tr.Amount.Satang != p.Amount.Satang {
+			return domain.ErrInvalidQR
+		}
+		tr.Amount = *p.Amount
+	}
+
+	tr.Type = "transfer"
+	tr.Receiver, tr.ReceiverProxy = domain.Account{}, p.Proxy
+
+	if p.Proxy == nil {
+		// the bank code must agree with the bank the account number names
+		if p.AccountNo == "" || q.accountUsecase.SelectBank(p.AccountNo[len(p.AccountNo)-1:]) != p.Bank {
+			return domain.ErrInvalidQR
+		}
+
+		if p.AccountNo == tr.Account.AccountNo {
+			return domain.ErrBadParamInput
+		}
+
+		tr.Receiver = domain.Account{AccountNo: p.AccountNo}
+	}
+
+	return q.transactionUsecase.Transfer(c, tr)
+}
+
+func (q *qrUsecase) checkOwner(c context.Context, uuid string, accountNo string) error {
+	ctx, cancel := context.WithTimeout(c, q.contextTimeout)
+	defer cancel()
+
+	acc, err := q.accountRepo.GetAccountByAccountNo(ctx, accountNo)
+	if err != nil {
+		return err
+	}
+
+	if acc.Uuid != uuid {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"main/atm/thaiqr"
+	"main/domain"
+)
+
+func TestTransferByQRFromAnotherUsersAccount(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+	ar := memAccountRepo{db: db}
+	u := newTestUsecases(db)
+	codec := thaiqr.NewPromptPayCodec(256)
+	qu := NewQRUsecase(ar, NewAccountUsecase(ar, memTransactionRepo{db: db}, time.Second), u.transaction, codec, time.Second)
+
+	amount := domain.NewMoney(10000)
+	payload, err := codec.Encode(domain.QRPayment{AccountNo: "2000000001", Bank: "KBANK", Amount: &amount})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := &domain.Transaction{Account: domain.Account{AccountNo: "1000000001"}}
+	if err := qu.TransferByQR(context.Background(), "0899999999", tr, payload); err != domain.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if got := db.account("1000000001").Balance; got.Satang != 50000 {
+		t.Fatalf("balance is %v after a refused transfer", got)
+	}
+
+	tr = &domain.Transaction{Account: domain.Account{AccountNo: "1000000001"}}
+	if err := qu.TransferByQR(context.Background(), "0811111111", tr, payload); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.account("2000000001").Balance; got.Satang != 10000 {
+		t.Errorf("receiver has %v, want the amount of the code", got)
+	}
+}
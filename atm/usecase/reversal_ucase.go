@@ -0,0 +1,187 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"main/domain"
+)
+
+// Reverse books a compensating "reversal" transaction for tid and restores the balances in one
+// unit of work. In the reversal, Account is the side that gives money back and Receiver the side
+// that gets it back; either is empty when that side is cash at the ATM. Partial reversals add up
+// on the original until its whole amount went back, which marks it reversed.
+func (a *transactionUsecase) Reverse(c context.Context, tid int64, req domain.ReversalRequest) (res *domain.Transaction, err error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	var reversal domain.Transaction
+
+	err = a.unitOfWork.Do(ctx, func(ctx context.Context) (err error) {
+		orig, err := a.transactionRepo.GetTransactionByTIDForUpdate(ctx, tid)
+		if err != nil {
+			return err
+		}
+
+		if orig.ReversedAt != nil {
+			return domain.ErrAlreadyReversed
+		}
+
+		if orig.Status != domain.TransactionCompleted {
+			return domain.ErrInvalidReversal
+		}
+
+		// the money of an interbank transfer is at the other bank, only the clearing house can bring it back
+		if orig.Type == "transfer" {
+			_, err = a.interbankRepo.GetInterbankTransferByTransactionID(ctx, orig.Id)
+			if err == nil {
+				return domain.ErrInvalidReversal
+			}
+			if err != domain.ErrInterbankTransferNotFound {
+				return err
+			}
+		}
+
+		reversal, err = buildReversal(orig, req)
+		if err != nil {
+			return err
+		}
+
+		var payer, payee *domain.Account
+		switch {
+		case reversal.Account.AccountNo != "" && reversal.Receiver.AccountNo != "":
+			payer, payee, err = a.lockTransferAccounts(ctx, reversal.Account.AccountNo, reversal.Receiver.AccountNo)
+		case reversal.Account.AccountNo != "":
+			payer, err = a.accountRepo.GetAccountByAccountNoForUpdate(ctx, reversal.Account.AccountNo)
+		default:
+			payee, err = a.accountRepo.GetAccountByAccountNoForUpdate(ctx, reversal.Receiver.AccountNo)
+		}
+		if err != nil {
+			return err
+		}
+
+		if payer != nil {
+			// money held for a cardless withdrawal can not be given back
+			if err = a.checkFunds(ctx, payer, reversal.Amount); err != nil {
+				return err
+			}
+			if payer.Balance, err = payer.Balance.Sub(reversal.Amount); err != nil {
+				return err
+			}
+
+			if err = a.accountUsecase.UpdateAccount(ctx, payer); err != nil {
+				return err
+			}
+			reversal.Account = *payer
+		}
+
+		if payee != nil {
+			if payee.Balance, err = payee.Balance.Add(reversal.Total); err != nil {
+				return err
+			}
+
+			if err = a.accountUsecase.UpdateAccount(ctx, payee); err != nil {
+				return err
+			}
+			reversal.Receiver = *payee
+		}
+
+		// the reversal is booked with the accounts already locked, so it can not fail on its own
+		reversal.Status = domain.TransactionCompleted
+		if err = a.createTransaction(ctx, &reversal); err != nil {
+			return err
+		}
+
+		refundedBefore := orig.RefundedAmount
+		if orig.RefundedAmount, err = orig.RefundedAmount.Add(reversal.Amount); err != nil {
+			return err
+		}
+		if orig.RefundedAmount.Cmp(orig.Amount) == 0 {
+			if err = orig.Transition(domain.TransactionReversed); err != nil {
+				return err
+			}
+			orig.ReversedAt = &reversal.CreatedAt
+		}
+
+		if err = a.transactionRepo.RecordRefund(ctx, &orig, refundedBefore); err != nil {
+			return err
+		}
+
+		// the notes of a withdrawal at a terminal go back into its cassettes
+		if orig.Type == "withdraw" {
+			if err = a.terminalUsecase.ReturnDispense(ctx, &orig, &reversal); err != nil {
+				return err
+			}
+		}
+
+		if err = a.ledgerUsecase.PostTransaction(ctx, &reversal); err != nil {
+			return err
+		}
+
+		// the customer told about the reversal is whoever made the original transaction
+		notification, customerBalance := reversal, reversal.Receiver.Balance
+		notification.Account.AccountNo = orig.Account.AccountNo
+		if orig.Type == "deposit" {
+			customerBalance = reversal.Account.Balance
+		}
+		if reversal.Receiver.AccountNo != orig.Account.AccountNo {
+			notification.Total = reversal.Amount.Neg()
+		}
+
+		return a.enqueueTransactionEvent(ctx, notification, customerBalance)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &reversal, nil
+}
+
+// buildReversal mirrors orig for amount, refunding the fee with the part that gives back the rest
+// of the amount
+func buildReversal(orig domain.Transaction, req domain.ReversalRequest) (reversal domain.Transaction, err error) {
+	remaining, err := orig.Amount.Sub(orig.RefundedAmount)
+	if err != nil {
+		return reversal, err
+	}
+
+	amount := remaining
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+
+	if !amount.IsPositive() || amount.Cmp(remaining) > 0 {
+		return reversal, domain.ErrInvalidReversal
+	}
+
+	reversal = domain.Transaction{
+		Type:        "reversal",
+		Amount:      amount,
+		Fee:         domain.NewMoney(0),
+		SubmittedAt: time.Now(),
+		ReferenceId: orig.Id,
+		Remark:      req.Reason,
+	}
+
+	if amount.Cmp(remaining) == 0 {
+		reversal.Fee = orig.Fee
+	}
+
+	if reversal.Total, err = reversal.Amount.Add(reversal.Fee); err != nil {
+		return reversal, err
+	}
+
+	switch orig.Type {
+	case "transfer":
+		reversal.Account.AccountNo = orig.Receiver.AccountNo
+		reversal.Receiver.AccountNo = orig.Account.AccountNo
+	case "withdraw":
+		reversal.Receiver.AccountNo = orig.Account.AccountNo
+	case "deposit":
+		reversal.Account.AccountNo = orig.Account.AccountNo
+	default:
+		return reversal, domain.ErrInvalidReversal
+	}
+
+	return reversal, nil
+}
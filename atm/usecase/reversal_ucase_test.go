@@ -0,0 +1,154 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+func refund(satang int64) domain.ReversalRequest {
+	amount := domain.NewMoney(satang)
+	return domain.ReversalRequest{Amount: &amount, Reason: "test"}
+}
+
+func TestPartialReversalsAddUpToTheOriginal(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	tu := newTestUsecases(db).transaction
+	ctx := context.Background()
+
+	tid := db.addBooked(domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(10000), Fee: domain.NewMoney(2000), Total: domain.NewMoney(12000),
+		Account: domain.Account{AccountNo: "1000000001"}}, time.Now())
+
+	first, err := tu.Reverse(ctx, tid, refund(3000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Fee.IsZero() || first.Total.Satang != 3000 {
+		t.Errorf("first part refunds %s with fee %s, want 30.00 without the fee", first.Total, first.Fee)
+	}
+	if orig := db.transactions[tid]; orig.Status != domain.TransactionCompleted || orig.RefundedAmount.Satang != 3000 || orig.ReversedAt != nil {
+		t.Fatalf("after a partial reversal the original is %s with %s refunded", orig.Status, orig.RefundedAmount)
+	}
+
+	if _, err = tu.Reverse(ctx, tid, refund(8000)); err != domain.ErrInvalidReversal {
+		t.Fatalf("refunding more than is left: got %v, want ErrInvalidReversal", err)
+	}
+
+	// without an amount the rest goes back, with the fee
+	rest, err := tu.Reverse(ctx, tid, domain.ReversalRequest{Reason: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rest.Amount.Satang != 7000 || rest.Fee.Satang != 2000 || rest.Total.Satang != 9000 {
+		t.Errorf("last part refunds %s + fee %s, want 70.00 + 20.00", rest.Amount, rest.Fee)
+	}
+
+	orig := db.transactions[tid]
+	if orig.Status != domain.TransactionReversed || orig.RefundedAmount.Satang != 10000 || orig.ReversedAt == nil {
+		t.Errorf("after the last part the original is %s with %s refunded", orig.Status, orig.RefundedAmount)
+	}
+	if balance := db.account("1000000001").Balance.Satang; balance != 62000 {
+		t.Errorf("balance is %d satang, want 62000", balance)
+	}
+
+	if _, err = tu.Reverse(ctx, tid, refund(1)); err != domain.ErrAlreadyReversed {
+		t.Fatalf("reversing a reversed transaction: got %v, want ErrAlreadyReversed", err)
+	}
+}
+
+func TestReversingATerminalWithdrawalReturnsTheNotes(t *testing.T) {
+	db, terminals := newTerminalTest(t, nil, domain.BanknoteCount{Denomination: 100, Count: 50}, domain.BanknoteCount{Denomination: 500, Count: 10})
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	tu := newTestUsecases(db).transaction
+	tu.terminalUsecase = terminals
+	ctx := context.Background()
+
+	tr := &domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(60000), Account: domain.Account{AccountNo: "1000000001"}, TerminalId: "ATM-0001"}
+	if err := tu.withdraw(ctx, tr, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// which notes came back of part of a dispense can not be told
+	if _, err := tu.Reverse(ctx, tr.Id, refund(10000)); err != domain.ErrInvalidReversal {
+		t.Fatalf("partial reversal: got %v, want ErrInvalidReversal", err)
+	}
+
+	reversal, err := tu.Reverse(ctx, tr.Id, domain.ReversalRequest{Reason: "not paid out"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	terminal, _ := terminals.GetTerminal(ctx, "ATM-0001")
+	if counts := []int{terminal.Cassettes[0].Count, terminal.Cassettes[1].Count}; counts[0] != 50 || counts[1] != 10 {
+		t.Errorf("cassettes hold %v notes, want the 50 and 10 loaded", counts)
+	}
+	if plan := db.dispenses[tr.Id]; plan.ReversalId != reversal.Id {
+		t.Errorf("dispense reversed by %d, want %d", plan.ReversalId, reversal.Id)
+	}
+
+	var returned int64
+	for _, mv := range db.movements {
+		if mv.Kind == domain.CashReversal && mv.TransactionId == reversal.Id {
+			returned += int64(mv.Count) * mv.Denomination
+		}
+	}
+	if returned != 600 {
+		t.Errorf("reversal movements put back %d baht, want 600", returned)
+	}
+
+	// the shift balances with the notes that went back
+	req := domain.BalancingRequest{Operator: "ops", Cassettes: []domain.CassetteCount{{Position: 1, Count: 50}, {Position: 2, Count: 10}}}
+	report, err := terminals.Balance(ctx, "ATM-0001", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Balanced {
+		t.Errorf("got %+v, want the shift balanced", report)
+	}
+}
+
+func TestReversalRefusesInvalidAmounts(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	tu := newTestUsecases(db).transaction
+
+	tid := db.addBooked(domain.Transaction{Type: "deposit", Amount: domain.NewMoney(10000), Account: domain.Account{AccountNo: "1000000001"}}, time.Now())
+
+	for _, satang := range []int64{0, -100, 10001} {
+		if _, err := tu.Reverse(context.Background(), tid, refund(satang)); err != domain.ErrInvalidReversal {
+			t.Errorf("reversing %d satang: got %v, want ErrInvalidReversal", satang, err)
+		}
+	}
+
+	if orig := db.transactions[tid]; !orig.RefundedAmount.IsZero() {
+		t.Errorf("refused reversals recorded %s as refunded", orig.RefundedAmount)
+	}
+}
+
+func TestReversalLeavesCardlessHoldsAlone(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	tu := newTestUsecases(db).transaction
+	tu.cardlessPolicy = testCardlessPolicy
+	ctx := context.Background()
+
+	tid := db.addBooked(domain.Transaction{Type: "deposit", Amount: domain.NewMoney(10000), Account: domain.Account{AccountNo: "1000000001"}}, time.Now())
+
+	// 50.00 of the balance is not held
+	if _, err := tu.CreateCardlessWithdrawal(ctx, "0811111111", "1000000001", domain.CardlessWithdrawalRequest{Amount: domain.NewMoney(45000)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tu.Reverse(ctx, tid, domain.ReversalRequest{Reason: "test"}); err != domain.ErrInsufficientBalance {
+		t.Fatalf("got %v, want ErrInsufficientBalance", err)
+	}
+	if _, err := tu.Reverse(ctx, tid, refund(5000)); err != nil {
+		t.Fatal(err)
+	}
+	if balance := db.account("1000000001").Balance.Satang; balance != 45000 {
+		t.Errorf("balance is %d satang, want the held 45000 left", balance)
+	}
+}
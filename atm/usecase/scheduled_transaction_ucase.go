@@ -4,115 +4,404 @@ import (
 	"context"
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
 
 	"main/domain"
-	consumer "main/kafka/consumer"
-	producer "main/kafka/producer"
+	"main/kafka/codec"
 
-	"github.com/Shopify/sarama"
-	"github.com/spf13/viper"
+	"github.com/sirupsen/logrus"
 )
 
-func (a *transactionUsecase) SaveScheduledTransaction(ctx context.Context, transaction *domain.ScheduledTransaction) (err error) {
+func (a *transactionUsecase) SaveScheduledTransaction(c context.Context, uuid string, st *domain.ScheduledTransaction) (err error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
 
-	if err = a.transactionRepo.CreateScheduledTransaction(ctx, transaction); err != nil {
+	if err = st.Validate(); err != nil {
 		return err
 	}
-	return nil
-}
 
-func (a *transactionUsecase) PollScheduledTransaction(ctx context.Context, fetchTime time.Time) (err error) {
+	now := time.Now()
+	if !st.ScheduledExecutionAt.After(now) {
+		return domain.ErrInvalidSchedule
+	}
 
-	transactions, err := a.transactionRepo.GetScheduledTransaction(ctx, fetchTime)
-	if err != nil {
+	if err = a.checkAccountOwner(ctx, uuid, st.Account.AccountNo); err != nil {
 		return err
 	}
 
-	if err = a.AddTransactionToQueue(ctx, transactions); err != nil {
+	st.Status, st.Occurrences = domain.ScheduleActive, 0
+	if err = st.Plan(now); err != nil {
 		return err
 	}
-	return nil
+
+	// e.g. an end before the first occurrence
+	if st.NextExecutionAt == nil {
+		return domain.ErrInvalidSchedule
+	}
+
+	return a.scheduledRepo.CreateScheduledTransaction(ctx, st)
 }
 
-func (a *transactionUsecase) AddTransactionToQueue(ctx context.Context, transaction []domain.ScheduledTransaction) (err error) {
-	topic := "scheduled_transactions"
-	brokerAddress := viper.GetString("kafka.broker_address")
+func (a *transactionUsecase) GetScheduledTransactions(c context.Context, uuid string) ([]domain.ScheduledTransaction, error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	return a.scheduledRepo.GetScheduledTransactionsByUuid(ctx, uuid)
+}
 
-	for i := range transaction {
-		message := fmt.Sprintf("%d|%s|%.2f|%s|%s|%s",
-			transaction[i].Id,
-			transaction[i].Type,
-			transaction[i].Amount,
-			transaction[i].Account.AccountNo,
-			transaction[i].Receiver.AccountNo,
-			transaction[i].CreatedAt)
+// GetScheduledTransactionByID returns the schedule with the history of its runs
+func (a *transactionUsecase) GetScheduledTransactionByID(c context.Context, uuid string, id int64) (*domain.ScheduledTransaction, error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
 
-		producer.RunKafkaProducer(brokerAddress, topic, message)
-		fmt.Println("producer", message)
+	st, err := a.getOwnedScheduledTransaction(ctx, uuid, id)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if st.Executions, err = a.scheduledRepo.GetScheduledExecutions(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return &st, nil
 }
 
-func (a *transactionUsecase) ConsumeScheduledTransaction(ctx context.Context) (err error) {
-	topic := "scheduled_transactions"
-	var partition int32 = 0
-	var offset int64 = sarama.OffsetNewest
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Println("Processing transaction stop.")
-			return
-		default:
-			message := consumer.RunKafkaConsumer(a.kafkaClient, topic, partition, offset)
-			go a.processScheduleTransaction(ctx, message)
-			offset += 1
-
-			fmt.Println(offset)
+// UpdateScheduledTransaction changes the amount and timing of an active schedule. The accounts
+// can not be changed, that takes a new schedule. Runs already made still count towards MaxOccurrences.
+func (a *transactionUsecase) UpdateScheduledTransaction(c context.Context, uuid string, st *domain.ScheduledTransaction) (err error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
+
+	return a.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		current, err := a.getOwnedScheduledTransaction(ctx, uuid, st.Id)
+		if err != nil {
+			return err
 		}
-	}
+
+		if current.Status != domain.ScheduleActive {
+			return domain.ErrScheduleNotActive
+		}
+
+		now := time.Now()
+		if !st.ScheduledExecutionAt.Equal(current.ScheduledExecutionAt) && !st.ScheduledExecutionAt.After(now) {
+			return domain.ErrInvalidSchedule
+		}
+
+		st.Type, st.Account, st.Receiver = current.Type, current.Account, current.Receiver
+		st.Status, st.Occurrences = current.Status, current.Occurrences
+		st.SubmittedAt, st.CreatedAt = current.SubmittedAt, current.CreatedAt
+
+		if err = st.Validate(); err != nil {
+			return err
+		}
+
+		if err = st.Plan(now); err != nil {
+			return err
+		}
+
+		return a.scheduledRepo.UpdateScheduledTransaction(ctx, st)
+	})
 }
 
-func (a *transactionUsecase) processScheduleTransaction(ctx context.Context, message string) (transaction domain.Transaction, err error) {
-	timeLayout := "2006-01-02 15:04:05.999999 -0700 MST"
-	message_split := strings.Split(message, "|")
+// CancelScheduledTransaction stops the schedule and its pending runs. A run already leased
+// is cancelled when it sees the schedule, unless it got as far as booking the transfer.
+func (a *transactionUsecase) CancelScheduledTransaction(c context.Context, uuid string, id int64) (err error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
 
-	if len(message_split) < 6 {
-		fmt.Println("Unexpected message format:", message)
+	return a.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		st, err := a.getOwnedScheduledTransaction(ctx, uuid, id)
+		if err != nil {
+			return err
+		}
+
+		if st.Status != domain.ScheduleActive {
+			return domain.ErrScheduleNotActive
+		}
+
+		st.Status, st.NextExecutionAt = domain.ScheduleCancelled, nil
+		if err = a.scheduledRepo.UpdateScheduledTransaction(ctx, &st); err != nil {
+			return err
+		}
+
+		return a.scheduledRepo.CancelScheduledExecutions(ctx, id)
+	})
+}
+
+// getOwnedScheduledTransaction hides schedules of other users behind ErrScheduleNotFound. Inside
+// a unit of work the schedule stays locked until it ends, so the poller can not move it on meanwhile.
+func (a *transactionUsecase) getOwnedScheduledTransaction(ctx context.Context, uuid string, id int64) (st domain.ScheduledTransaction, err error) {
+	if st, err = a.scheduledRepo.GetScheduledTransactionByIDForUpdate(ctx, id); err != nil {
+		return st, err
 	}
-	transaction.Type = message_split[1]
-	transaction.Amount, _ = strconv.ParseFloat(message_split[2], 64)
-	transaction.Account.AccountNo = message_split[3]
-	transaction.Receiver.AccountNo = message_split[4]
-	transaction.SubmittedAt, err = time.Parse(timeLayout, message_split[5])
-	if err != nil {
-		fmt.Println("Error parsing timestamp:", err)
+
+	if err = a.checkAccountOwner(ctx, uuid, st.Account.AccountNo); err != nil {
+		if err == domain.ErrNotFound {
+			return st, domain.ErrScheduleNotFound
+		}
+		return st, err
 	}
 
-	if err = a.Transfer(ctx, &transaction); err != nil {
-		fmt.Println("Error processing transaction:", err)
-		return transaction, err
+	return st, nil
+}
+
+// PollScheduledTransaction queues the occurrences due by now, then runs every execution it can
+// lease. Queued runs are also sent to ScheduledTransactionTopic, so the workers of every replica
+// take them up; polling still runs what no message got to, such as retries and runs whose worker
+// went away. Replicas can poll side by side: schedules and executions are claimed with SKIP
+// LOCKED, and a run only books its transfer while it still holds the lease.
+func (a *transactionUsecase) PollScheduledTransaction(ctx context.Context, now time.Time) (err error) {
+	if err = a.queueScheduledExecutions(ctx, now); err != nil {
+		return err
 	}
 
-	id, _ := strconv.ParseInt(message_split[0], 10, 64)
+	for ctx.Err() == nil {
+		ex, err := a.claimScheduledExecution(ctx, time.Now(), func(ctx context.Context, now time.Time) (*domain.ScheduledExecution, error) {
+			return a.scheduledRepo.ClaimScheduledExecution(ctx, now)
+		})
+		if err != nil {
+			return err
+		}
+
+		if ex == nil {
+			return nil
+		}
 
-	if err = a.UpdateScheduledTransaction(ctx, int64(id)); err != nil {
-		fmt.Println("Error processing transaction:", err)
+		a.runScheduledExecution(ctx, ex)
 	}
-	return
+
+	return ctx.Err()
+}
+
+// queueScheduledExecutions creates an execution for every occurrence due by now and moves the
+// schedules past them in the same unit of work. Overdue occurrences the catch-up policy leaves
+// out are recorded as skipped.
+func (a *transactionUsecase) queueScheduledExecutions(ctx context.Context, now time.Time) error {
+	return a.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		due, err := a.scheduledRepo.GetDueScheduledTransactions(ctx, now)
+		if err != nil {
+			return err
+		}
+
+		for i := range due {
+			st := &due[i]
+
+			var occurrences []time.Time
+			for st.Status == domain.ScheduleActive && !st.NextExecutionAt.After(now) {
+				occurrences = append(occurrences, *st.NextExecutionAt)
+				if err = st.Advance(); err != nil {
+					return err
+				}
+			}
+
+			for j, at := range occurrences {
+				ex := domain.ScheduledExecution{
+					ScheduleId:    st.Id,
+					ScheduledFor:  at,
+					Status:        domain.ExecutionPending,
+					NextAttemptAt: at,
+				}
+				if a.schedulePolicy.Skips(now.Sub(at), len(occurrences)-1-j) {
+					ex.Status = domain.ExecutionSkipped
+				}
+
+				if err = a.scheduledRepo.CreateScheduledExecution(ctx, &ex); err != nil {
+					return err
+				}
+
+				if ex.Status == domain.ExecutionPending {
+					if err = a.enqueueScheduledExecution(ctx, *st, ex); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err = a.scheduledRepo.UpdateScheduledTransaction(ctx, st); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
-func (a *transactionUsecase) UpdateScheduledTransaction(ctx context.Context, id int64) (err error) {
+// enqueueScheduledExecution writes the event of a queued run to the outbox, keyed by schedule
+func (a *transactionUsecase) enqueueScheduledExecution(ctx context.Context, st domain.ScheduledTransaction, ex domain.ScheduledExecution) error {
+	ev := codec.NewEnvelope(codec.ScheduledEventType("execution"), codec.ScheduledVersion, domain.CorrelationID(ctx), &codec.ScheduledExecutionEvent{
+		ExecutionId:  ex.Id,
+		ScheduleId:   st.Id,
+		Type:         st.Type,
+		AccountNo:    st.Account.AccountNo,
+		ReceiverNo:   st.Receiver.AccountNo,
+		Currency:     domain.DefaultCurrency,
+		Amount:       st.Amount.Satang,
+		ScheduledFor: ex.ScheduledFor,
+	})
 
-	var transaction domain.ScheduledTransaction
-	transaction.Id = id
-	transaction.Status = "processed"
+	payload, err := codec.JSON.Encode(ev)
+	if err != nil {
+		return err
+	}
 
-	if err := a.transactionRepo.UpdateScheduledTransaction(ctx, transaction); err != nil {
+	return a.outboxRepo.CreateEvent(ctx, &domain.OutboxEvent{
+		Topic:   domain.ScheduledTransactionTopic,
+		Key:     strconv.FormatInt(st.Id, 10),
+		Payload: string(payload),
+	})
+}
+
+// ConsumeScheduledTransaction runs the execution of a message of ScheduledTransactionTopic when
+// it is still due. A message that can not be read goes to the dead letter topic, and a run that
+// is done or leased by another worker is left to that outcome.
+func (a *transactionUsecase) ConsumeScheduledTransaction(ctx context.Context, message *domain.Message) error {
+	ex, err := processScheduleTransaction(message)
+	if err != nil {
+		return domain.Permanent(err)
+	}
+
+	claimed, err := a.claimScheduledExecution(ctx, time.Now(), func(ctx context.Context, now time.Time) (*domain.ScheduledExecution, error) {
+		return a.scheduledRepo.ClaimScheduledExecutionByID(ctx, ex.Id, now)
+	})
+	if err != nil {
 		return err
 	}
 
+	if claimed == nil {
+		return nil
+	}
+
+	if claimed.ScheduleId != ex.ScheduleId || !claimed.ScheduledFor.Equal(ex.ScheduledFor) {
+		return domain.Permanent(fmt.Errorf("scheduled execution %d is not the run of schedule %d at %s", ex.Id, ex.ScheduleId, ex.ScheduledFor))
+	}
+
+	a.runScheduledExecution(ctx, claimed)
 	return nil
 }
+
+// processScheduleTransaction reads the run a message names, messages queued before the envelope
+// included. The transfer itself is taken from the schedule, not from the message.
+func processScheduleTransaction(message *domain.Message) (ex domain.ScheduledExecution, err error) {
+	ev, err := codec.DecodeMessage(message)
+	if err != nil {
+		return ex, err
+	}
+
+	run, ok := ev.Payload.(*codec.ScheduledExecutionEvent)
+	if !ok {
+		return ex, fmt.Errorf("unexpected event %q on %s", ev.Type, domain.ScheduledTransactionTopic)
+	}
+
+	return domain.ScheduledExecution{Id: run.ExecutionId, ScheduleId: run.ScheduleId, ScheduledFor: run.ScheduledFor}, nil
+}
+
+// claimScheduledExecution leases the run claim returns, nil when nothing is due. A run whose lease
+// ran out on its last attempt failed for good: its worker is gone and did not book the transfer.
+func (a *transactionUsecase) claimScheduledExecution(ctx context.Context, now time.Time,
+	claim func(ctx context.Context, now time.Time) (*domain.ScheduledExecution, error)) (ex *domain.ScheduledExecution, err error) {
+	err = a.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		for {
+			if ex, err = claim(ctx, now); err != nil || ex == nil {
+				return err
+			}
+
+			fence := ex.Attempts
+			if ex.Status == domain.ExecutionProcessing && ex.Attempts >= a.schedulePolicy.MaxAttempts {
+				ex.Retry(now, domain.ErrExecutionLeaseLost, false, a.schedulePolicy)
+				if err = a.scheduledRepo.UpdateScheduledExecution(ctx, ex, fence); err != nil {
+					return err
+				}
+				continue
+			}
+
+			ex.Lease(now, a.schedulePolicy.Lease)
+			return a.scheduledRepo.UpdateScheduledExecution(ctx, ex, fence)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ex, nil
+}
+
+// runScheduledExecution makes the transfer of a leased run. The guard checks the lease and the
+// schedule in the unit of work that books the transfer, so a run taken over by another worker
+// can never pay twice, and a run it turns down leaves no transaction behind.
+func (a *transactionUsecase) runScheduledExecution(ctx context.Context, ex *domain.ScheduledExecution) {
+	fence := ex.Attempts
+
+	var tr domain.Transaction
+	st, err := a.scheduledRepo.GetScheduledTransactionByID(ctx, ex.ScheduleId)
+
+	if err == nil {
+		tr.Type = st.Type
+		tr.Channel = domain.ChannelScheduled
+		tr.Amount = st.Amount
+		tr.Account.AccountNo = st.Account.AccountNo
+		tr.Receiver.AccountNo = st.Receiver.AccountNo
+		tr.SubmittedAt = ex.ScheduledFor
+
+		ctx := domain.WithCorrelationID(ctx, fmt.Sprintf("scheduled-execution-%d", ex.Id))
+		err = a.transfer(ctx, &tr, func(ctx context.Context) error {
+			// the schedule before the run, in the order CancelScheduledTransaction locks them
+			current, err := a.scheduledRepo.GetScheduledTransactionByIDForUpdate(ctx, ex.ScheduleId)
+			if err != nil {
+				return err
+			}
+
+			if current.Status == domain.ScheduleCancelled {
+				return domain.ErrScheduleNotActive
+			}
+
+			run, err := a.scheduledRepo.GetScheduledExecutionForUpdate(ctx, ex.Id)
+			if err != nil {
+				return err
+			}
+
+			if run.Attempts != fence || run.Status != domain.ExecutionProcessing {
+				return domain.ErrExecutionLeaseLost
+			}
+			return nil
+		}, func(ctx context.Context) error {
+			ex.Complete(time.Now(), tr.Id)
+			return a.scheduledRepo.UpdateScheduledExecution(ctx, ex, fence)
+		})
+	}
+
+	if err == nil {
+		return
+	}
+
+	// the worker holding the lease now owns the outcome
+	if err == domain.ErrExecutionLeaseLost {
+		logrus.Error(err)
+		return
+	}
+
+	now := time.Now()
+	ex.TransactionId = tr.Id
+	if err == domain.ErrScheduleNotActive {
+		ex.Cancel(now)
+	} else {
+		ex.Retry(now, err, isRetryable(err), a.schedulePolicy)
+	}
+
+	// the run may have used up the context
+	failCtx, cancel := context.WithTimeout(context.Background(), a.contextTimeout)
+	defer cancel()
+
+	if err := a.scheduledRepo.UpdateScheduledExecution(failCtx, ex, fence); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// isRetryable tells whether a later attempt could succeed, e.g. once the balance is topped up
+func isRetryable(err error) bool {
+	switch err {
+	case domain.ErrNotFound, domain.ErrResipientNotFound, domain.ErrAccDeleted, domain.ErrBadParamInput,
+		domain.ErrInvalidMoney:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,316 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"main/domain"
+	"main/kafka/codec"
+)
+
+func TestScheduleFromAnotherUsersAccount(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+	tu := newTestUsecases(db).transaction
+
+	loc, _ := time.LoadLocation(domain.DefaultScheduleTimezone)
+	st := domain.ScheduledTransaction{
+		Type:                 "transfer",
+		Amount:               domain.NewMoney(10000),
+		Account:              domain.Account{AccountNo: "1000000001"},
+		Receiver:             domain.Account{AccountNo: "2000000001"},
+		ScheduledExecutionAt: time.Now().Add(time.Hour).In(loc),
+	}
+
+	if err := tu.SaveScheduledTransaction(context.Background(), "0822222222", &st); err != domain.ErrNotFound {
+		t.Errorf("got %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+var testSchedulePolicy = domain.SchedulePolicy{
+	Lease:       time.Hour,
+	MaxAttempts: 3,
+	Backoff:     time.Minute,
+	MaxBackoff:  time.Hour,
+	CatchUp:     domain.CatchUpAll,
+}
+
+// newScheduleReplica is one replica of the service polling db
+func newScheduleReplica(db *memDB, policy domain.SchedulePolicy) *transactionUsecase {
+	tu := newTestUsecases(db).transaction
+	tu.schedulePolicy = policy
+	return tu
+}
+
+// addDueSchedule stores an active transfer schedule of amount whose first run is at start
+func addDueSchedule(t *testing.T, db *memDB, frequency string, start time.Time, amount domain.Money) int64 {
+	t.Helper()
+
+	loc, _ := time.LoadLocation(domain.DefaultScheduleTimezone)
+	start = start.In(loc).Truncate(time.Second)
+	st := domain.ScheduledTransaction{
+		Id:                   db.id(),
+		Type:                 "transfer",
+		Amount:               amount,
+		Account:              domain.Account{AccountNo: "1000000001"},
+		Receiver:             domain.Account{AccountNo: "2000000001"},
+		Status:               domain.ScheduleActive,
+		Frequency:            frequency,
+		Timezone:             domain.DefaultScheduleTimezone,
+		ScheduledExecutionAt: start,
+		NextExecutionAt:      &start,
+	}
+	if err := st.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	db.schedules[st.Id] = st
+	return st.Id
+}
+
+// scheduledMessage delivers ev as the outbox sends it with the JSON codec
+func scheduledMessage(ev domain.OutboxEvent) *domain.Message {
+	return &domain.Message{Topic: ev.Topic, Key: ev.Key, Value: []byte(ev.Payload),
+		Headers: map[string]string{codec.ContentTypeHeader: codec.JSON.ContentType()}}
+}
+
+func TestTwoReplicasNeverDoublePay(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(1000000))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		addDueSchedule(t, db, domain.FrequencyOnce, time.Now().Add(-time.Minute), domain.NewMoney(1000))
+	}
+
+	replicas := []*transactionUsecase{newScheduleReplica(db, testSchedulePolicy), newScheduleReplica(db, testSchedulePolicy)}
+	ctx := context.Background()
+
+	if err := replicas[0].queueScheduledExecutions(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	messages := append([]domain.OutboxEvent(nil), db.outbox...)
+	if len(messages) != n {
+		t.Fatalf("%d runs sent to the workers, want %d", len(messages), n)
+	}
+
+	// both poll, and both get every message as after a rebalance that redelivers them
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(2)
+		go func(r *transactionUsecase) {
+			defer wg.Done()
+			if err := r.PollScheduledTransaction(ctx, time.Now()); err != nil {
+				t.Error(err)
+			}
+		}(r)
+		go func(r *transactionUsecase) {
+			defer wg.Done()
+			for _, ev := range messages {
+				if err := r.ConsumeScheduledTransaction(ctx, scheduledMessage(ev)); err != nil {
+					t.Error(err)
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	counts := db.transactionsByStatus()
+	if counts[domain.TransactionCompleted] != n || len(db.transactions) != n {
+		t.Errorf("transactions by status %v, want %d completed and nothing else", counts, n)
+	}
+
+	if balance := db.account("2000000001").Balance; balance.Satang != n*1000 {
+		t.Errorf("receiver got %s, want every run paid once", balance)
+	}
+
+	for id, ex := range db.executions {
+		if ex.Status != domain.ExecutionCompleted || ex.Attempts != 1 {
+			t.Errorf("execution %d is %s after %d attempts, want completed once", id, ex.Status, ex.Attempts)
+		}
+	}
+}
+
+func TestTakenOverRunDoesNotPay(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+	addDueSchedule(t, db, domain.FrequencyOnce, time.Now().Add(-time.Minute), domain.NewMoney(1000))
+
+	a, b := newScheduleReplica(db, testSchedulePolicy), newScheduleReplica(db, testSchedulePolicy)
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := a.queueScheduledExecutions(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	claim := func(r *transactionUsecase, now time.Time) *domain.ScheduledExecution {
+		ex, err := r.claimScheduledExecution(ctx, now, func(ctx context.Context, now time.Time) (*domain.ScheduledExecution, error) {
+			return r.scheduledRepo.ClaimScheduledExecution(ctx, now)
+		})
+		if err != nil || ex == nil {
+			t.Fatalf("claim: %v %v", ex, err)
+		}
+		return ex
+	}
+
+	// a stalls past its lease and b takes the run over
+	exA := claim(a, now)
+	exB := claim(b, now.Add(2*testSchedulePolicy.Lease))
+
+	a.runScheduledExecution(ctx, exA)
+	if len(db.transactions) != 0 {
+		t.Fatalf("the run that lost its lease left %d transactions", len(db.transactions))
+	}
+
+	b.runScheduledExecution(ctx, exB)
+	if counts := db.transactionsByStatus(); counts[domain.TransactionCompleted] != 1 || len(db.transactions) != 1 {
+		t.Errorf("transactions by status %v, want one completed", counts)
+	}
+	if ex := db.executions[exB.Id]; ex.Status != domain.ExecutionCompleted || ex.TransactionId == 0 {
+		t.Errorf("execution is %s with transaction %d", ex.Status, ex.TransactionId)
+	}
+}
+
+func TestCancelledRunLeavesNoTransaction(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+	id := addDueSchedule(t, db, domain.FrequencyDaily, time.Now().Add(-time.Minute), domain.NewMoney(1000))
+
+	tu := newScheduleReplica(db, testSchedulePolicy)
+	ctx := context.Background()
+
+	if err := tu.queueScheduledExecutions(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	ex, err := tu.claimScheduledExecution(ctx, time.Now(), func(ctx context.Context, now time.Time) (*domain.ScheduledExecution, error) {
+		return tu.scheduledRepo.ClaimScheduledExecution(ctx, now)
+	})
+	if err != nil || ex == nil {
+		t.Fatalf("claim: %v %v", ex, err)
+	}
+
+	// cancelled while the run is leased
+	if err = tu.CancelScheduledTransaction(ctx, "0811111111", id); err != nil {
+		t.Fatal(err)
+	}
+
+	tu.runScheduledExecution(ctx, ex)
+	if len(db.transactions) != 0 {
+		t.Errorf("the cancelled run left %d transactions", len(db.transactions))
+	}
+	if got := db.executions[ex.Id].Status; got != domain.ExecutionCancelled {
+		t.Errorf("execution is %s, want cancelled", got)
+	}
+}
+
+func TestDeclinedRunIsRecordedAndRetried(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(500))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+	addDueSchedule(t, db, domain.FrequencyOnce, time.Now().Add(-time.Minute), domain.NewMoney(1000))
+
+	tu := newScheduleReplica(db, testSchedulePolicy)
+	if err := tu.PollScheduledTransaction(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ex := range db.executions {
+		if ex.Status != domain.ExecutionPending || ex.TransactionId == 0 || !ex.NextAttemptAt.After(time.Now()) {
+			t.Fatalf("execution is %s with transaction %d, want a later retry", ex.Status, ex.TransactionId)
+		}
+		if tr := db.transactions[ex.TransactionId]; tr.Status != domain.TransactionFailed {
+			t.Errorf("the declined attempt was recorded as %q, want failed", tr.Status)
+		}
+	}
+}
+
+func TestCatchUpPolicy(t *testing.T) {
+	// ten daily runs were missed, the last one an hour ago
+	now := time.Now()
+	start := now.Add(-9*24*time.Hour - time.Hour)
+
+	tests := []struct {
+		name    string
+		policy  domain.SchedulePolicy
+		run     int
+		skipped int
+	}{
+		{"all", domain.SchedulePolicy{CatchUp: domain.CatchUpAll}, 10, 0},
+		{"skip", domain.SchedulePolicy{CatchUp: domain.CatchUpSkip, Grace: 15 * time.Minute}, 0, 10},
+		{"skip keeps what is within grace", domain.SchedulePolicy{CatchUp: domain.CatchUpSkip, Grace: 2 * time.Hour}, 1, 9},
+		{"limit", domain.SchedulePolicy{CatchUp: domain.CatchUpLimit, MaxCatchUp: 2, Grace: 15 * time.Minute}, 2, 8},
+		{"limit of none", domain.SchedulePolicy{CatchUp: domain.CatchUpLimit, Grace: 15 * time.Minute}, 0, 10},
+	}
+
+	for _, tt := range tests {
+		db := newMemDB()
+		id := addDueSchedule(t, db, domain.FrequencyDaily, start, domain.NewMoney(1000))
+
+		tu := newScheduleReplica(db, tt.policy)
+		if err := tu.queueScheduledExecutions(context.Background(), now); err != nil {
+			t.Fatal(err)
+		}
+
+		counts := db.executionsByStatus(id)
+		if counts[domain.ExecutionPending] != tt.run || counts[domain.ExecutionSkipped] != tt.skipped {
+			t.Errorf("%s: executions by status %v, want %d to run and %d skipped", tt.name, counts, tt.run, tt.skipped)
+		}
+		if len(db.outbox) != tt.run {
+			t.Errorf("%s: %d runs sent to the workers, want %d", tt.name, len(db.outbox), tt.run)
+		}
+
+		st := db.schedules[id]
+		if st.Occurrences != 10 || !st.NextExecutionAt.After(now) {
+			t.Errorf("%s: schedule at %d occurrences, next %v", tt.name, st.Occurrences, st.NextExecutionAt)
+		}
+	}
+}
+
+func TestConsumeScheduledTransaction(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(0))
+	id := addDueSchedule(t, db, domain.FrequencyOnce, time.Now().Add(-time.Minute), domain.NewMoney(1000))
+
+	tu := newScheduleReplica(db, testSchedulePolicy)
+	ctx := context.Background()
+
+	for _, bad := range []string{"", "1|2|transfer", "x|1|transfer|10.00|1000000001|2000000001|2026-01-01T10:00:00+07:00",
+		"1|1|transfer|10.00|1000000001|2000000001|tomorrow", "transfer|10.00|1000000001|2026-01-01 10:00:00|90.00|2000000001"} {
+		if err := tu.ConsumeScheduledTransaction(ctx, &domain.Message{Value: []byte(bad)}); !domain.IsPermanent(err) {
+			t.Errorf("%q: got %v, want a permanent error", bad, err)
+		}
+	}
+
+	if err := tu.queueScheduledExecutions(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	message := scheduledMessage(db.outbox[0])
+
+	ev, err := codec.DecodeMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, ok := ev.Payload.(*codec.ScheduledExecutionEvent)
+	if !ok || ev.Type != "scheduled.execution" || run.ScheduleId != id || run.Amount != 1000 {
+		t.Fatalf("queued %s %+v, want the run of the schedule", ev.Type, ev.Payload)
+	}
+
+	// a message queued before the envelope, then the same run delivered twice
+	legacy := fmt.Sprintf("%d|%d|transfer|10.00|1000000001|2000000001|%s", run.ExecutionId, run.ScheduleId, run.ScheduledFor.Format(time.RFC3339))
+	for _, m := range []*domain.Message{{Value: []byte(legacy)}, message, message} {
+		if err := tu.ConsumeScheduledTransaction(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if counts := db.transactionsByStatus(); counts[domain.TransactionCompleted] != 1 || len(db.transactions) != 1 {
+		t.Errorf("transactions by status %v, want one completed", counts)
+	}
+}
@@ -0,0 +1,193 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"main/domain"
+)
+
+const statementPageSize = 500
+
+type statementUsecase struct {
+	transactionRepo domain.TransactionRepository
+	accountRepo     domain.AccountRepository
+	unitOfWork      domain.UnitOfWork
+	contextTimeout  time.Duration
+}
+
+// NewStatementUsecase will create new an statementUsecase object representation of domain.StatementUsecase interface
+func NewStatementUsecase(tr domain.TransactionRepository, ar domain.AccountRepository, uow domain.UnitOfWork, timeout time.Duration) domain.StatementUsecase {
+	return &statementUsecase{
+		transactionRepo: tr,
+		accountRepo:     ar,
+		unitOfWork:      uow,
+		contextTimeout:  timeout,
+	}
+}
+
+// GetStatement works the balances at both period boundaries back from the current balance, so
+// the statement always reconciles with the account. The balance and the transactions are read
+// in one unit of work to get a consistent snapshot.
+func (s *statementUsecase) GetStatement(c context.Context, uuid string, account_no string, from time.Time, to time.Time) (res *domain.Statement, err error) {
+	if !from.Before(to) {
+		return nil, domain.ErrBadParamInput
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.contextTimeout)
+	defer cancel()
+
+	var acc *domain.Account
+	var transactions []domain.Transaction
+
+	err = s.unitOfWork.Do(ctx, func(ctx context.Context) (err error) {
+		acc, err = s.accountRepo.GetAccountByAccountNo(ctx, account_no)
+		if err != nil {
+			return err
+		}
+
+		if acc.Uuid != uuid {
+			return domain.ErrNotFound
+		}
+
+		transactions, err = s.getTransactionsSince(ctx, account_no, from)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res = &domain.Statement{
+		AccountNo:   acc.AccountNo,
+		AccountName: acc.Name,
+		Bank:        acc.Bank,
+		Currency:    domain.DefaultCurrency,
+		From:        from,
+		To:          to,
+		GeneratedAt: time.Now(),
+	}
+
+	// transactions come newest first: undo everything booked from `to` onwards to get the
+	// closing balance, then keep going through the period to get the opening balance
+	balance := acc.Balance
+	var lines []domain.StatementLine
+
+	for _, tr := range transactions {
+		if !tr.IsPosted() {
+			continue
+		}
+
+		line := statementLine(account_no, tr)
+
+		if !tr.CreatedAt.Before(to) {
+			if balance, err = balance.Sub(line.Amount); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if lines == nil {
+			res.ClosingBalance = balance
+			lines = make([]domain.StatementLine, 0)
+		}
+
+		line.Balance = balance
+		lines = append(lines, line)
+
+		if balance, err = balance.Sub(line.Amount); err != nil {
+			return nil, err
+		}
+
+		if line.Amount.IsNegative() {
+			res.TotalDebits, err = res.TotalDebits.Add(line.Amount.Abs())
+		} else {
+			res.TotalCredits, err = res.TotalCredits.Add(line.Amount)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if lines == nil {
+		res.ClosingBalance = balance
+		lines = make([]domain.StatementLine, 0)
+	}
+	res.OpeningBalance = balance
+
+	// statements read oldest first
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	res.Lines = lines
+
+	return res, nil
+}
+
+func (s *statementUsecase) getTransactionsSince(ctx context.Context, account_no string, from time.Time) (res []domain.Transaction, err error) {
+	filter := domain.TransactionFilter{
+		AccountNo: account_no,
+		From:      &from,
+		Num:       statementPageSize,
+	}
+
+	for {
+		page, nextCursor, err := s.transactionRepo.GetAllTransaction(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, page...)
+
+		if nextCursor == "" {
+			return res, nil
+		}
+		filter.Cursor = nextCursor
+	}
+}
+
+// statementLine describes a transaction from the point of view of account_no
+func statementLine(account_no string, tr domain.Transaction) domain.StatementLine {
+	line := domain.StatementLine{
+		TransactionId: tr.Id,
+		Type:          tr.Type,
+		BookedAt:      tr.CreatedAt,
+	}
+
+	switch tr.Type {
+	case "deposit":
+		line.Description = "Deposit"
+		line.Amount = tr.Amount
+	case "withdraw":
+		line.Description = "Withdrawal"
+		line.Amount = tr.Amount.Neg()
+		if tr.Fee.IsPositive() {
+			line.Description = fmt.Sprintf("Withdrawal, fee %s", tr.Fee)
+			line.Amount = tr.Total.Neg()
+		}
+	case "transfer":
+		if tr.Account.AccountNo == account_no {
+			line.Description = fmt.Sprintf("Transfer to %s", tr.Receiver.AccountNo)
+			if tr.Fee.IsPositive() {
+				line.Description = fmt.Sprintf("Transfer to %s, fee %s", tr.Receiver.AccountNo, tr.Fee)
+			}
+			line.Counterparty = tr.Receiver.AccountNo
+			line.Amount = tr.Total.Neg()
+		} else {
+			line.Description = fmt.Sprintf("Transfer from %s", tr.Account.AccountNo)
+			line.Counterparty = tr.Account.AccountNo
+			line.Amount = tr.Amount
+		}
+	case "reversal":
+		line.Description = fmt.Sprintf("Reversal of transaction %d", tr.ReferenceId)
+		if tr.Account.AccountNo == account_no {
+			line.Counterparty = tr.Receiver.AccountNo
+			line.Amount = tr.Amount.Neg()
+		} else {
+			line.Counterparty = tr.Account.AccountNo
+			line.Amount = tr.Total
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+func TestStatementPagesThroughEqualTimestamps(t *testing.T) {
+	db := newMemDB()
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	batch := from.Add(12 * time.Hour)
+
+	// more deposits with the same created_at than fit on one page
+	count := statementPageSize + statementPageSize/2
+	for i := 0; i < count; i++ {
+		db.addBooked(domain.Transaction{Type: "deposit", Amount: domain.NewMoney(100), Account: domain.Account{AccountNo: "1000000001"}}, batch)
+	}
+	// booked after the period, only moves the closing balance back
+	db.addBooked(domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(5000), Account: domain.Account{AccountNo: "1000000001"}}, to.Add(time.Hour))
+
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(1000000))
+	su := NewStatementUsecase(memTransactionRepo{db: db}, memAccountRepo{db: db}, memUnitOfWork{db: db}, 5*time.Second)
+
+	st, err := su.GetStatement(context.Background(), "0811111111", "1000000001", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(st.Lines) != count {
+		t.Fatalf("got %d lines, want %d", len(st.Lines), count)
+	}
+
+	seen := make(map[int64]bool)
+	for _, line := range st.Lines {
+		if seen[line.TransactionId] {
+			t.Fatalf("transaction %d is on the statement twice", line.TransactionId)
+		}
+		seen[line.TransactionId] = true
+	}
+
+	closing := int64(1000000 + 5000)
+	opening := closing - int64(count)*100
+	if st.ClosingBalance.Satang != closing || st.OpeningBalance.Satang != opening {
+		t.Errorf("opening %s, closing %s, want %s and %s", st.OpeningBalance, st.ClosingBalance, domain.NewMoney(opening), domain.NewMoney(closing))
+	}
+	if st.TotalCredits.Satang != int64(count)*100 || !st.TotalDebits.IsZero() {
+		t.Errorf("credits %s, debits %s", st.TotalCredits, st.TotalDebits)
+	}
+}
+
+func TestStatementOfAnotherUserIsHidden(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(1000))
+	su := NewStatementUsecase(memTransactionRepo{db: db}, memAccountRepo{db: db}, memUnitOfWork{db: db}, 5*time.Second)
+
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := su.GetStatement(context.Background(), "0899999999", "1000000001", from, from.AddDate(0, 1, 0)); err != domain.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,352 @@
+package usecase
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"main/domain"
+	"main/kafka/codec"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AcceptDeposit locks the cassettes of the terminal like a dispense does, so the deposit is either
+// in a balancing or after it
+func (t *terminalUsecase) AcceptDeposit(c context.Context, tr *domain.Transaction) (err error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	terminal, err := t.terminalRepo.GetTerminal(ctx, tr.TerminalId)
+	if err != nil {
+		return err
+	}
+
+	if terminal.Status != domain.TerminalOnline {
+		return domain.ErrTerminalUnavailable
+	}
+
+	if err = domain.DepositedNotes(tr); err != nil {
+		return err
+	}
+
+	if _, err = t.terminalRepo.GetCassettesForUpdate(ctx, terminal.Id); err != nil {
+		return err
+	}
+
+	movements := make([]domain.CashMovement, 0, len(tr.Notes))
+	for _, n := range tr.Notes {
+		movements = append(movements, domain.CashMovement{TerminalId: terminal.Id, Kind: domain.CashDeposit, Position: domain.DepositBin,
+			Denomination: n.Denomination, Count: n.Count, TransactionId: tr.Id})
+	}
+
+	return t.terminalRepo.CreateCashMovements(ctx, movements)
+}
+
+// ReturnDispense leaves a withdrawal without a dispense alone, it was not paid out at a terminal.
+// Which notes came back of part of a dispense can not be told, so only a reversal of the whole
+// amount puts notes back.
+func (t *terminalUsecase) ReturnDispense(c context.Context, orig *domain.Transaction, reversal *domain.Transaction) (err error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	plan, err := t.terminalRepo.GetDispenseForUpdate(ctx, orig.Id)
+	if err != nil || plan == nil {
+		return err
+	}
+
+	if plan.ReversalId != 0 {
+		return domain.ErrAlreadyReversed
+	}
+
+	if reversal.Amount.Cmp(plan.Amount) != 0 {
+		return domain.ErrInvalidReversal
+	}
+
+	cassettes, err := t.terminalRepo.GetCassettesForUpdate(ctx, plan.TerminalId)
+	if err != nil {
+		return err
+	}
+
+	movements := make([]domain.CashMovement, 0, len(plan.Notes))
+	for _, note := range plan.Notes {
+		// a cassette loaded with other notes since can not take these back
+		cassette := findCassette(cassettes, note.Position)
+		if cassette == nil || cassette.Id != note.CassetteId || cassette.Denomination != note.Denomination {
+			return domain.ErrInvalidReversal
+		}
+
+		cassette.Count += note.Count
+		if err = t.terminalRepo.UpdateCassetteCount(ctx, cassette.Id, cassette.Count); err != nil {
+			return err
+		}
+
+		movements = append(movements, domain.CashMovement{TerminalId: plan.TerminalId, Kind: domain.CashReversal, Position: note.Position,
+			Denomination: note.Denomination, Count: note.Count, TransactionId: reversal.Id})
+	}
+
+	if err = t.terminalRepo.CreateCashMovements(ctx, movements); err != nil {
+		return err
+	}
+
+	return t.terminalRepo.ReverseDispense(ctx, orig.Id, reversal.Id)
+}
+
+// Replenish adds the notes of op to the cassettes they were loaded into
+func (t *terminalUsecase) Replenish(c context.Context, terminalId string, op domain.CashOperation) (*domain.Terminal, error) {
+	if op.DepositBin {
+		return nil, domain.ErrInvalidCashOperation
+	}
+
+	return t.moveCash(c, terminalId, op, domain.CashReplenishment)
+}
+
+// PickUp takes the notes of op out of the cassettes and, with op.DepositBin, everything out of the
+// deposit bin
+func (t *terminalUsecase) PickUp(c context.Context, terminalId string, op domain.CashOperation) (*domain.Terminal, error) {
+	return t.moveCash(c, terminalId, op, domain.CashPickup)
+}
+
+func (t *terminalUsecase) moveCash(c context.Context, terminalId string, op domain.CashOperation, kind string) (*domain.Terminal, error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	if op.Operator == "" || (len(op.Cassettes) == 0 && !op.DepositBin) {
+		return nil, domain.ErrInvalidCashOperation
+	}
+
+	sign := 1
+	if kind == domain.CashPickup {
+		sign = -1
+	}
+
+	var terminal domain.Terminal
+	err := t.unitOfWork.Do(ctx, func(ctx context.Context) (err error) {
+		if terminal, err = t.terminalRepo.GetTerminal(ctx, terminalId); err != nil {
+			return err
+		}
+
+		if terminal.Cassettes, err = t.terminalRepo.GetCassettesForUpdate(ctx, terminalId); err != nil {
+			return err
+		}
+		cash := terminal.Cash()
+
+		movements := make([]domain.CashMovement, 0, len(op.Cassettes))
+		for _, cc := range op.Cassettes {
+			cassette := findCassette(terminal.Cassettes, cc.Position)
+			if cassette == nil || cc.Count <= 0 || cassette.Count+sign*cc.Count < 0 {
+				return domain.ErrInvalidCashOperation
+			}
+
+			cassette.Count += sign * cc.Count
+			if err = t.terminalRepo.UpdateCassetteCount(ctx, cassette.Id, cassette.Count); err != nil {
+				return err
+			}
+
+			movements = append(movements, domain.CashMovement{TerminalId: terminalId, Kind: kind, Position: cc.Position,
+				Denomination: cassette.Denomination, Count: sign * cc.Count, Operator: op.Operator})
+		}
+
+		if op.DepositBin {
+			bin, err := t.terminalRepo.GetDepositBin(ctx, terminalId)
+			if err != nil {
+				return err
+			}
+
+			for _, n := range bin {
+				movements = append(movements, domain.CashMovement{TerminalId: terminalId, Kind: kind, Position: domain.DepositBin,
+					Denomination: n.Denomination, Count: -n.Count, Operator: op.Operator})
+			}
+		}
+
+		if err = t.terminalRepo.CreateCashMovements(ctx, movements); err != nil {
+			return err
+		}
+
+		return t.alertLowCash(ctx, &terminal, cash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &terminal, nil
+}
+
+func findCassette(cassettes []domain.Cassette, position int) *domain.Cassette {
+	for i := range cassettes {
+		if cassettes[i].Position == position {
+			return &cassettes[i]
+		}
+	}
+	return nil
+}
+
+// Balance compares the notes counted in the terminal with what its movements since the last
+// balancing leave in it, then sets the cassettes and the deposit bin to what was counted. The
+// cassettes are locked so no movement slips in between.
+func (t *terminalUsecase) Balance(c context.Context, terminalId string, req domain.BalancingRequest) (*domain.BalancingReport, error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	if req.Operator == "" {
+		return nil, domain.ErrInvalidCashOperation
+	}
+
+	var report *domain.BalancingReport
+	err := t.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		terminal, err := t.terminalRepo.GetTerminal(ctx, terminalId)
+		if err != nil {
+			return err
+		}
+
+		if terminal.Cassettes, err = t.terminalRepo.GetCassettesForUpdate(ctx, terminalId); err != nil {
+			return err
+		}
+		cash := terminal.Cash()
+
+		counted, err := req.Counted(terminal.Cassettes)
+		if err != nil {
+			return err
+		}
+
+		previous, err := t.terminalRepo.GetLastBalancingReport(ctx, terminalId)
+		if err != nil {
+			return err
+		}
+
+		var after int64
+		if previous != nil {
+			after = previous.LastMovementId
+		}
+
+		movements, err := t.terminalRepo.GetCashMovementsAfter(ctx, terminalId, after)
+		if err != nil {
+			return err
+		}
+
+		if report, err = domain.NewBalancingReport(terminalId, previous, movements, counted); err != nil {
+			return err
+		}
+
+		corrections, err := t.correctCash(ctx, &terminal, req)
+		if err != nil {
+			return err
+		}
+
+		// the corrections belong to this balancing, the next shift starts after them
+		for _, mv := range corrections {
+			if mv.Id > report.LastMovementId {
+				report.LastMovementId = mv.Id
+			}
+		}
+
+		report.Operator = req.Operator
+		if err = t.terminalRepo.CreateBalancingReport(ctx, report); err != nil {
+			return err
+		}
+
+		return t.alertLowCash(ctx, &terminal, cash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !report.Balanced {
+		logrus.Warnf("terminal %s balancing %d is off by %s", terminalId, report.Id, report.Discrepancy)
+	}
+
+	return report, nil
+}
+
+// correctCash sets the cassettes of terminal and its deposit bin to the notes counted in req and
+// records each difference as a correction
+func (t *terminalUsecase) correctCash(ctx context.Context, terminal *domain.Terminal, req domain.BalancingRequest) ([]domain.CashMovement, error) {
+	var corrections []domain.CashMovement
+	correct := func(position int, denomination int64, diff int) {
+		if diff != 0 {
+			corrections = append(corrections, domain.CashMovement{TerminalId: terminal.Id, Kind: domain.CashCorrection, Position: position,
+				Denomination: denomination, Count: diff, Operator: req.Operator})
+		}
+	}
+
+	for _, cc := range req.Cassettes {
+		cassette := findCassette(terminal.Cassettes, cc.Position)
+		if cassette.Count == cc.Count {
+			continue
+		}
+
+		correct(cc.Position, cassette.Denomination, cc.Count-cassette.Count)
+		cassette.Count = cc.Count
+		if err := t.terminalRepo.UpdateCassetteCount(ctx, cassette.Id, cassette.Count); err != nil {
+			return nil, err
+		}
+	}
+
+	bin, err := t.terminalRepo.GetDepositBin(ctx, terminal.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make(map[int64]int)
+	for _, n := range req.DepositBin {
+		diffs[n.Denomination] += n.Count
+	}
+	for _, n := range bin {
+		diffs[n.Denomination] -= n.Count
+	}
+
+	denominations := make([]int64, 0, len(diffs))
+	for d := range diffs {
+		denominations = append(denominations, d)
+	}
+	sort.Slice(denominations, func(i, j int) bool { return denominations[i] < denominations[j] })
+	for _, d := range denominations {
+		correct(domain.DepositBin, d, diffs[d])
+	}
+
+	if err = t.terminalRepo.CreateCashMovements(ctx, corrections); err != nil {
+		return nil, err
+	}
+
+	return corrections, nil
+}
+
+func (t *terminalUsecase) GetBalancingReports(c context.Context, terminalId string) ([]domain.BalancingReport, error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	if _, err := t.terminalRepo.GetTerminal(ctx, terminalId); err != nil {
+		return nil, err
+	}
+
+	return t.terminalRepo.GetBalancingReports(ctx, terminalId)
+}
+
+// alertLowCash writes a low cash event to the outbox when the cash of terminal drops under its
+// threshold from before, so an alert goes out once each time the terminal runs low
+func (t *terminalUsecase) alertLowCash(ctx context.Context, terminal *domain.Terminal, before domain.Money) error {
+	cash := terminal.Cash()
+	if !terminal.IsLowOnCash(cash) || terminal.IsLowOnCash(before) {
+		return nil
+	}
+
+	ev := codec.NewEnvelope(codec.TerminalEventType("low_cash"), codec.TerminalVersion, domain.CorrelationID(ctx), &codec.TerminalEvent{
+		TerminalId: terminal.Id,
+		Location:   terminal.Location,
+		Currency:   domain.DefaultCurrency,
+		Cash:       cash.Satang,
+		Threshold:  terminal.LowCashThreshold.Satang,
+		CreatedAt:  time.Now(),
+	})
+
+	payload, err := codec.JSON.Encode(ev)
+	if err != nil {
+		return err
+	}
+
+	return t.outboxRepo.CreateEvent(ctx, &domain.OutboxEvent{
+		Topic:   t.alertTopic,
+		Key:     terminal.Id,
+		Payload: string(payload),
+	})
+}
@@ -0,0 +1,197 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+// newTerminalTest loads the notes of counts into the cassettes of ATM-0001, from position 1
+func newTerminalTest(t *testing.T, threshold *domain.Money, counts ...domain.BanknoteCount) (*memDB, *terminalUsecase) {
+	t.Helper()
+
+	db := newMemDB()
+	db.addTerminal("ATM-0001", threshold)
+	tu := NewTerminalUsecase(memTerminalRepo{db: db}, memOutboxRepo{db: db}, memUnitOfWork{db: db}, "terminal_alerts", 5*time.Second).(*terminalUsecase)
+
+	for i, n := range counts {
+		cassette := &domain.Cassette{Position: i + 1, Denomination: n.Denomination, Count: n.Count}
+		if err := tu.LoadCassette(context.Background(), "ATM-0001", cassette); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, tu
+}
+
+func dispense(tu *terminalUsecase, db *memDB, baht int64) (*domain.Transaction, error) {
+	tr := &domain.Transaction{Id: db.id(), TerminalId: "ATM-0001", Amount: domain.NewMoney(baht * 100)}
+	return tr, tu.Dispense(context.Background(), tr)
+}
+
+// alerts counts the low cash events in the outbox of db
+func (db *memDB) alerts() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n := 0
+	for _, ev := range db.outbox {
+		if ev.Topic == "terminal_alerts" && ev.Key == "ATM-0001" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLowCashAlertsOnceWhenCrossingTheThreshold(t *testing.T) {
+	threshold := domain.NewMoney(500000)
+	db, tu := newTerminalTest(t, &threshold, domain.BanknoteCount{Denomination: 100, Count: 60})
+	ctx := context.Background()
+	op := domain.CashOperation{Operator: "ops", Cassettes: []domain.CassetteCount{{Position: 1, Count: 10}}}
+
+	steps := []struct {
+		name   string
+		run    func() error
+		cash   int64
+		alerts int
+	}{
+		{"above", func() error { _, err := dispense(tu, db, 500); return err }, 5500, 0},
+		// at the threshold is not under it
+		{"at", func() error { _, err := dispense(tu, db, 500); return err }, 5000, 0},
+		{"crossing", func() error { _, err := dispense(tu, db, 100); return err }, 4900, 1},
+		{"still low", func() error { _, err := dispense(tu, db, 400); return err }, 4500, 1},
+		{"replenished", func() error { _, err := tu.Replenish(ctx, "ATM-0001", op); return err }, 5500, 1},
+		{"picked up", func() error { _, err := tu.PickUp(ctx, "ATM-0001", op); return err }, 4500, 2},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		terminal, _ := tu.GetTerminal(ctx, "ATM-0001")
+		if cash := terminal.Cash(); cash.Satang != step.cash*100 {
+			t.Fatalf("%s: cash is %s, want %d baht", step.name, cash, step.cash)
+		}
+		if got := db.alerts(); got != step.alerts {
+			t.Fatalf("%s: %d alerts, want %d", step.name, got, step.alerts)
+		}
+	}
+}
+
+func TestNoLowCashAlertWithoutThreshold(t *testing.T) {
+	db, tu := newTerminalTest(t, nil, domain.BanknoteCount{Denomination: 100, Count: 10})
+
+	if _, err := dispense(tu, db, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.alerts(); got != 0 {
+		t.Errorf("%d alerts for an empty terminal without a threshold", got)
+	}
+}
+
+func TestDispenseRecordsTheNotesPaidOut(t *testing.T) {
+	db, tu := newTerminalTest(t, nil, domain.BanknoteCount{Denomination: 100, Count: 50}, domain.BanknoteCount{Denomination: 500, Count: 10})
+
+	tr, err := dispense(tu, db, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, ok := db.dispenses[tr.Id]
+	if !ok || plan.Amount.Satang != 60000 || len(plan.Notes) != 2 {
+		t.Fatalf("recorded %+v, want 600 baht in two kinds of notes", plan)
+	}
+	for _, note := range plan.Notes {
+		if note.Count != 1 {
+			t.Errorf("paid out %d notes of %d, want 1", note.Count, note.Denomination)
+		}
+	}
+}
+
+func TestBalanceCorrectsTheCassettes(t *testing.T) {
+	db, tu := newTerminalTest(t, nil, domain.BanknoteCount{Denomination: 100, Count: 50}, domain.BanknoteCount{Denomination: 500, Count: 10})
+	ctx := context.Background()
+
+	if _, err := dispense(tu, db, 600); err != nil {
+		t.Fatal(err)
+	}
+	deposit := &domain.Transaction{Id: db.id(), TerminalId: "ATM-0001", Amount: domain.NewMoney(200000),
+		Notes: []domain.BanknoteCount{{Denomination: 1000, Count: 2}}}
+	if err := tu.AcceptDeposit(ctx, deposit); err != nil {
+		t.Fatal(err)
+	}
+
+	// two notes of 100 are missing from the cassette and one of 1000 from the deposit bin
+	req := domain.BalancingRequest{
+		Operator:   "ops",
+		Cassettes:  []domain.CassetteCount{{Position: 1, Count: 47}, {Position: 2, Count: 9}},
+		DepositBin: []domain.BanknoteCount{{Denomination: 1000, Count: 1}},
+	}
+
+	report, err := tu.Balance(ctx, "ATM-0001", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Balanced || report.Discrepancy.Satang != -120000 || report.Operator != "ops" {
+		t.Fatalf("got %+v, want off by -1200 baht", report)
+	}
+
+	terminal, _ := tu.GetTerminal(ctx, "ATM-0001")
+	if counts := []int{terminal.Cassettes[0].Count, terminal.Cassettes[1].Count}; counts[0] != 47 || counts[1] != 9 {
+		t.Errorf("cassettes hold %v notes, want the counted 47 and 9", counts)
+	}
+	if bin, _ := (memTerminalRepo{db: db}).GetDepositBin(ctx, "ATM-0001"); len(bin) != 1 || bin[0].Count != 1 {
+		t.Errorf("deposit bin holds %+v, want the counted note of 1000", bin)
+	}
+
+	var corrections []domain.CashMovement
+	for _, mv := range db.movements {
+		if mv.Kind == domain.CashCorrection {
+			corrections = append(corrections, mv)
+		}
+	}
+	if len(corrections) != 2 || corrections[0].Count != -2 || corrections[1].Count != -1 || corrections[1].Position != domain.DepositBin {
+		t.Fatalf("got corrections %+v, want -2 notes of 100 and -1 of 1000 from the deposit bin", corrections)
+	}
+	for _, mv := range corrections {
+		if mv.Operator != "ops" || mv.Id > report.LastMovementId {
+			t.Errorf("correction %+v is not covered by balancing up to %d", mv, report.LastMovementId)
+		}
+	}
+
+	// the next shift opens with the counted notes, the corrections are not counted again
+	movements := len(db.movements)
+	next, err := tu.Balance(ctx, "ATM-0001", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !next.Balanced || !next.Discrepancy.IsZero() {
+		t.Errorf("got %+v, want the next shift balanced", next)
+	}
+	if len(db.movements) != movements {
+		t.Errorf("a balanced shift added %d corrections", len(db.movements)-movements)
+	}
+}
+
+func TestBalanceRefusesAnIncompleteCount(t *testing.T) {
+	db, tu := newTerminalTest(t, nil, domain.BanknoteCount{Denomination: 100, Count: 50}, domain.BanknoteCount{Denomination: 500, Count: 10})
+	ctx := context.Background()
+
+	tests := []domain.BalancingRequest{
+		{Cassettes: []domain.CassetteCount{{Position: 1, Count: 50}, {Position: 2, Count: 10}}},
+		{Operator: "ops", Cassettes: []domain.CassetteCount{{Position: 1, Count: 50}}},
+		{Operator: "ops", Cassettes: []domain.CassetteCount{{Position: 1, Count: 50}, {Position: 2, Count: 10}},
+			DepositBin: []domain.BanknoteCount{{Denomination: 30, Count: 1}}},
+	}
+
+	for i, req := range tests {
+		if _, err := tu.Balance(ctx, "ATM-0001", req); err != domain.ErrInvalidCashOperation {
+			t.Errorf("request %d: got %v, want ErrInvalidCashOperation", i, err)
+		}
+	}
+	if len(db.balancings) != 0 {
+		t.Errorf("recorded %d balancings", len(db.balancings))
+	}
+}
@@ -0,0 +1,193 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"main/domain"
+)
+
+type terminalUsecase struct {
+	terminalRepo   domain.TerminalRepository
+	outboxRepo     domain.OutboxRepository
+	unitOfWork     domain.UnitOfWork
+	alertTopic     string
+	contextTimeout time.Duration
+}
+
+// NewTerminalUsecase will create new an terminalUsecase object representation of domain.TerminalUsecase interface.
+// Low cash alerts are published to alertTopic.
+func NewTerminalUsecase(tr domain.TerminalRepository, or domain.OutboxRepository, uow domain.UnitOfWork, alertTopic string, timeout time.Duration) domain.TerminalUsecase {
+	return &terminalUsecase{
+		terminalRepo:   tr,
+		outboxRepo:     or,
+		unitOfWork:     uow,
+		alertTopic:     alertTopic,
+		contextTimeout: timeout,
+	}
+}
+
+func (t *terminalUsecase) GetTerminals(c context.Context) ([]domain.Terminal, error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	terminals, err := t.terminalRepo.GetTerminals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range terminals {
+		if terminals[i].Cassettes, err = t.terminalRepo.GetCassettes(ctx, terminals[i].Id); err != nil {
+			return nil, err
+		}
+	}
+
+	return terminals, nil
+}
+
+func (t *terminalUsecase) GetTerminal(c context.Context, id string) (*domain.Terminal, error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	terminal, err := t.terminalRepo.GetTerminal(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if terminal.Cassettes, err = t.terminalRepo.GetCassettes(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return &terminal, nil
+}
+
+// SaveTerminal registers the terminal or changes its settings, its cassettes stay as they are
+func (t *terminalUsecase) SaveTerminal(c context.Context, terminal *domain.Terminal) (err error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	if err = terminal.Validate(); err != nil {
+		return err
+	}
+
+	if err = t.terminalRepo.UpsertTerminal(ctx, terminal); err != nil {
+		return err
+	}
+
+	terminal.Cassettes, err = t.terminalRepo.GetCassettes(ctx, terminal.Id)
+	return err
+}
+
+// LoadCassette locks the cassettes of the terminal, so a refill does not interleave with a dispense.
+// The difference to what the slot held is recorded as an adjustment.
+func (t *terminalUsecase) LoadCassette(c context.Context, terminalId string, cassette *domain.Cassette) (err error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	return t.unitOfWork.Do(ctx, func(ctx context.Context) error {
+		terminal, err := t.terminalRepo.GetTerminal(ctx, terminalId)
+		if err != nil {
+			return err
+		}
+
+		if cassette.Position < 1 || cassette.Count < 0 || !terminal.Supports(cassette.Denomination) {
+			return domain.ErrInvalidTerminal
+		}
+
+		if terminal.Cassettes, err = t.terminalRepo.GetCassettesForUpdate(ctx, terminalId); err != nil {
+			return err
+		}
+		cash := terminal.Cash()
+
+		var movements []domain.CashMovement
+		adjust := func(denomination int64, count int) {
+			if count != 0 {
+				movements = append(movements, domain.CashMovement{TerminalId: terminalId, Kind: domain.CashAdjustment,
+					Position: cassette.Position, Denomination: denomination, Count: count})
+			}
+		}
+
+		loaded := false
+		for i, old := range terminal.Cassettes {
+			if old.Position != cassette.Position {
+				continue
+			}
+
+			if old.Denomination == cassette.Denomination {
+				adjust(old.Denomination, cassette.Count-old.Count)
+			} else {
+				adjust(old.Denomination, -old.Count)
+				adjust(cassette.Denomination, cassette.Count)
+			}
+			terminal.Cassettes[i], loaded = *cassette, true
+		}
+		if !loaded {
+			adjust(cassette.Denomination, cassette.Count)
+			terminal.Cassettes = append(terminal.Cassettes, *cassette)
+		}
+
+		cassette.TerminalId = terminalId
+		if err = t.terminalRepo.UpsertCassette(ctx, cassette); err != nil {
+			return err
+		}
+
+		if err = t.terminalRepo.CreateCashMovements(ctx, movements); err != nil {
+			return err
+		}
+
+		return t.alertLowCash(ctx, &terminal, cash)
+	})
+}
+
+func (t *terminalUsecase) Dispense(c context.Context, tr *domain.Transaction) (err error) {
+	ctx, cancel := context.WithTimeout(c, t.contextTimeout)
+	defer cancel()
+
+	terminal, err := t.terminalRepo.GetTerminal(ctx, tr.TerminalId)
+	if err != nil {
+		return err
+	}
+
+	if terminal.Cassettes, err = t.terminalRepo.GetCassettesForUpdate(ctx, tr.TerminalId); err != nil {
+		return err
+	}
+
+	plan, err := terminal.PlanDispense(tr.Amount)
+	if err != nil {
+		return err
+	}
+	cash := terminal.Cash()
+
+	movements := make([]domain.CashMovement, 0, len(plan.Notes))
+	for _, note := range plan.Notes {
+		for i := range terminal.Cassettes {
+			cassette := &terminal.Cassettes[i]
+			if cassette.Id != note.CassetteId {
+				continue
+			}
+
+			cassette.Count -= note.Count
+			if err = t.terminalRepo.UpdateCassetteCount(ctx, cassette.Id, cassette.Count); err != nil {
+				return err
+			}
+		}
+
+		movements = append(movements, domain.CashMovement{TerminalId: terminal.Id, Kind: domain.CashDispense, Position: note.Position,
+			Denomination: note.Denomination, Count: -note.Count, TransactionId: tr.Id})
+	}
+
+	if err = t.terminalRepo.CreateCashMovements(ctx, movements); err != nil {
+		return err
+	}
+
+	if err = t.terminalRepo.CreateDispense(ctx, tr.Id, plan); err != nil {
+		return err
+	}
+
+	if err = t.alertLowCash(ctx, &terminal, cash); err != nil {
+		return err
+	}
+
+	tr.Dispense = plan
+	return nil
+}
@@ -2,222 +2,508 @@ package usecase
 
 import (
 	"context"
-	"fmt"
-	"strconv"
 	"time"
 
 	"main/domain"
-	producer "main/kafka/producer"
+	"main/kafka/codec"
 
-	"github.com/Shopify/sarama"
-	"github.com/go-redis/redis"
-	"github.com/spf13/viper"
+	"github.com/sirupsen/logrus"
 )
 
 type transactionUsecase struct {
 	transactionRepo domain.TransactionRepository
+	scheduledRepo   domain.ScheduledTransactionRepository
+	outboxRepo      domain.OutboxRepository
+	interbankRepo   domain.InterbankTransferRepository
+	proxyRepo       domain.ProxyRepository
+	cardlessRepo    domain.CardlessWithdrawalRepository
+	accountRepo     domain.AccountRepository
 	accountUsecase  domain.AccountUsecase
+	userUsecase     domain.UserUsecase
+	ledgerUsecase   domain.LedgerUsecase
+	feeUsecase      domain.FeeUsecase
+	limitUsecase    domain.LimitUsecase
+	terminalUsecase domain.TerminalUsecase
+	clearing        domain.ClearingAdapter
+	unitOfWork      domain.UnitOfWork
+	schedulePolicy  domain.SchedulePolicy
+	cardlessPolicy  domain.CardlessPolicy
+	clearingPolicy  domain.ClearingPolicy
 	contextTimeout  time.Duration
-	redis           *redis.Client
-	kafkaClient     sarama.Client
 }
 
 // NewTransactionUsecase will create new an transactionUsecase object representation of domain.TransactionUsecase interface
 func NewTransactionUsecase(tr domain.TransactionRepository,
+	sr domain.ScheduledTransactionRepository,
+	or domain.OutboxRepository,
+	ir domain.InterbankTransferRepository,
+	pr domain.ProxyRepository,
+	cr domain.CardlessWithdrawalRepository,
+	ar domain.AccountRepository,
 	au domain.AccountUsecase,
-	timeout time.Duration,
-	redis *redis.Client,
-	kafka sarama.Client) domain.TransactionUsecase {
+	uu domain.UserUsecase,
+	lu domain.LedgerUsecase,
+	fu domain.FeeUsecase,
+	limu domain.LimitUsecase,
+	tmu domain.TerminalUsecase,
+	ca domain.ClearingAdapter,
+	uow domain.UnitOfWork,
+	sp domain.SchedulePolicy,
+	cp domain.CardlessPolicy,
+	clp domain.ClearingPolicy,
+	timeout time.Duration) domain.TransactionUsecase {
 	return &transactionUsecase{
 		transactionRepo: tr,
+		scheduledRepo:   sr,
+		outboxRepo:      or,
+		interbankRepo:   ir,
+		proxyRepo:       pr,
+		cardlessRepo:    cr,
+		accountRepo:     ar,
 		accountUsecase:  au,
+		userUsecase:     uu,
+		ledgerUsecase:   lu,
+		feeUsecase:      fu,
+		limitUsecase:    limu,
+		terminalUsecase: tmu,
+		clearing:        ca,
+		unitOfWork:      uow,
+		schedulePolicy:  sp,
+		cardlessPolicy:  cp,
+		clearingPolicy:  clp,
 		contextTimeout:  timeout,
-		redis:           redis,
-		kafkaClient:     kafka,
 	}
 }
 
-// func (a *transactionUsecase) GetTransactionByID(c context.Context, id int64) (res domain.Transaction, err error) {
-// 	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
-// 	defer cancel()
+func (a *transactionUsecase) GetAllTransaction(c context.Context, uuid string, filter domain.TransactionFilter) (res []domain.Transaction, nextCursor string, err error) {
+	if filter.Num == 0 {
+		filter.Num = 10
+	}
+
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
 
-// 	res, err = a.transactionRepo.GetTransactionByTID(ctx, id)
-// 	if err != nil {
-// 		return
-// 	}
-// 	return
-// }
+	if err = a.checkAccountOwner(ctx, uuid, filter.AccountNo); err != nil {
+		return nil, "", err
+	}
 
-func (a *transactionUsecase) Withdraw(c context.Context, tr *domain.Transaction) (err error) {
+	return a.transactionRepo.GetAllTransaction(ctx, filter)
+}
+
+func (a *transactionUsecase) GetTransactionByTID(c context.Context, uuid string, account_no string, tid int64) (res *domain.Transaction, err error) {
 	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
 	defer cancel()
 
-	acc, err := a.accountUsecase.GetAccountByAccountNo(ctx, tr.Account.AccountNo)
+	if err = a.checkAccountOwner(ctx, uuid, account_no); err != nil {
+		return nil, err
+	}
+
+	tr, err := a.transactionRepo.GetTransactionByTID(ctx, tid)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if acc.Balance < tr.Amount {
-		return domain.ErrInsufficientBalance
+	if tr.Account.AccountNo != account_no && tr.Receiver.AccountNo != account_no {
+		return nil, domain.ErrTransactionNotFound
 	}
 
-	acc.Balance -= tr.Amount
+	return &tr, nil
+}
 
-	if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+// checkFunds makes sure acc can pay total out of its balance less what cardless withdrawals
+// hold. acc must be locked, so no hold can be placed in between.
+func (a *transactionUsecase) checkFunds(ctx context.Context, acc *domain.Account, total domain.Money) error {
+	held, err := a.cardlessRepo.GetHeldAmount(ctx, acc.AccountNo, time.Now())
+	if err != nil {
 		return err
 	}
 
-	if err = a.createTransaction(ctx, tr); err != nil {
+	available, err := acc.Balance.Sub(held)
+	if err != nil {
 		return err
 	}
 
-	tr.Account = *acc
+	left, err := available.Sub(total)
+	if err != nil {
+		return err
+	}
 
-	go a.addTransactionNotiToQueue(ctx, *tr, acc.Balance)
+	if left.IsNegative() {
+		return domain.ErrInsufficientBalance
+	}
 
 	return nil
 }
 
-func (a *transactionUsecase) Deposit(c context.Context, tr *domain.Transaction) (err error) {
-	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
-	defer cancel()
-
-	acc, err := a.accountUsecase.GetAccountByAccountNo(ctx, tr.Account.AccountNo)
+// checkAccountOwner hides accounts of other users behind ErrNotFound
+func (a *transactionUsecase) checkAccountOwner(ctx context.Context, uuid string, account_no string) error {
+	acc, err := a.accountRepo.GetAccountByAccountNo(ctx, account_no)
 	if err != nil {
 		return err
 	}
 
-	cacheKey := "min_deposit_amount"
-	limitAmount, err := a.redis.Get(cacheKey).Result()
-	if err != nil {
-		return fmt.Errorf("redis key %s is missing", cacheKey)
+	if acc.Uuid != uuid {
+		return domain.ErrNotFound
 	}
 
-	floatLimitAmount, _ := strconv.ParseFloat(limitAmount, 64)
-
-	if floatLimitAmount > tr.Amount {
-		return domain.ErrMinimumDeposit
-	}
+	return nil
+}
 
-	acc.Balance += tr.Amount
+// WithdrawWithPin checks pin against the PIN of the holder of the account before the withdraw. A
+// wrong PIN books no failed transaction.
+func (a *transactionUsecase) WithdrawWithPin(c context.Context, tr *domain.Transaction, pin string) (err error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
 
-	if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+	acc, err := a.accountRepo.GetAccountByAccountNo(ctx, tr.Account.AccountNo)
+	if err != nil {
 		return err
 	}
 
-	if err = a.createTransaction(ctx, tr); err != nil {
-		return err
+	if !a.userUsecase.ValidatePin(ctx, acc.Uuid, pin) {
+		return domain.ErrWrongPin
 	}
 
-	tr.Account = *acc
+	return a.withdraw(ctx, tr, nil, nil)
+}
 
-	go a.addTransactionNotiToQueue(ctx, *tr, acc.Balance)
+// withdraw runs guard and within, when given, in the unit of work that books tr, as transfer does.
+// Cash only leaves through a terminal, which pays out the notes.
+func (a *transactionUsecase) withdraw(c context.Context, tr *domain.Transaction, guard, within func(ctx context.Context) error) (err error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
 
-	return nil
+	if !tr.Amount.IsPositive() {
+		return domain.ErrBadParamInput
+	}
 
+	if tr.TerminalId == "" {
+		return domain.ErrInvalidTerminal
+	}
+
+	return a.execute(ctx, tr, guard, func(ctx context.Context) (err error) {
+		if within != nil {
+			if err = within(ctx); err != nil {
+				return err
+			}
+		}
+
+		acc, err := a.accountRepo.GetAccountByAccountNoForUpdate(ctx, tr.Account.AccountNo)
+		if err != nil {
+			return err
+		}
+
+		if err = a.limitUsecase.CheckLimits(ctx, tr, acc); err != nil {
+			return err
+		}
+
+		if err = a.feeUsecase.ApplyFee(ctx, tr, acc, nil); err != nil {
+			return err
+		}
+
+		newBalance, err := acc.Balance.Sub(tr.Total)
+		if err != nil {
+			return err
+		}
+
+		if err = a.checkFunds(ctx, acc, tr.Total); err != nil {
+			return err
+		}
+
+		// the notes leave the cassettes in the unit of work the money leaves the account in
+		if err = a.terminalUsecase.Dispense(ctx, tr); err != nil {
+			return err
+		}
+
+		acc.Balance = newBalance
+
+		if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+			return err
+		}
+
+		tr.Account = *acc
+		return nil
+	})
 }
 
-func (a *transactionUsecase) Transfer(c context.Context, tr *domain.Transaction) (err error) {
+// Deposit credits cash taken in at the terminal of tr, which counted the notes
+func (a *transactionUsecase) Deposit(c context.Context, tr *domain.Transaction) (err error) {
 	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
 	defer cancel()
 
-	isExceedLimit := a.checkTransactionLimit(ctx, *tr)
-
-	if !isExceedLimit {
-		return fmt.Errorf("exceed limit per day")
+	if !tr.Amount.IsPositive() {
+		return domain.ErrBadParamInput
 	}
 
-	acc, err := a.accountUsecase.GetAccountByAccountNo(ctx, tr.Account.AccountNo)
-	if err != nil {
-		return err
+	if tr.TerminalId == "" {
+		return domain.ErrInvalidTerminal
 	}
 
-	res_acc, err := a.accountUsecase.GetAccountByAccountNo(ctx, tr.Receiver.AccountNo)
-	if err != nil {
-		return err
-	}
+	return a.execute(ctx, tr, nil, func(ctx context.Context) (err error) {
+		acc, err := a.accountRepo.GetAccountByAccountNoForUpdate(ctx, tr.Account.AccountNo)
+		if err != nil {
+			return err
+		}
+
+		if err = a.limitUsecase.CheckLimits(ctx, tr, acc); err != nil {
+			return err
+		}
+
+		// the notes go into the deposit bin in the unit of work the money reaches the account in
+		if err = a.terminalUsecase.AcceptDeposit(ctx, tr); err != nil {
+			return err
+		}
+
+		tr.Total = tr.Amount
+		if acc.Balance, err = acc.Balance.Add(tr.Amount); err != nil {
+			return err
+		}
+
+		if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+			return err
+		}
+
+		tr.Account = *acc
+		return nil
+	})
+}
 
-	if res_acc == nil {
-		return domain.ErrResipientNotFound
-	}
+func (a *transactionUsecase) Transfer(c context.Context, tr *domain.Transaction) (err error) {
+	return a.transfer(c, tr, nil, nil)
+}
 
-	if res_acc.Status == "inactive" {
-		return domain.ErrAccDeleted
-	}
+// transfer runs within, when given, first in the unit of work that books tr, so whatever it
+// writes commits or rolls back together with the money moving. guard is handed to execute.
+func (a *transactionUsecase) transfer(c context.Context, tr *domain.Transaction, guard, within func(ctx context.Context) error) (err error) {
+	ctx, cancel := context.WithTimeout(c, a.contextTimeout)
+	defer cancel()
 
-	if err := a.checkTransferLimit(ctx, acc.AccountNo, tr.Amount); err != nil {
-		return err
+	if !tr.Amount.IsPositive() {
+		return domain.ErrBadParamInput
 	}
 
-	tr.Fee = calculateTransferFee(acc, res_acc)
-	tr.Total = tr.Amount + tr.Fee
-
-	if acc.Balance < tr.Total {
-		return domain.ErrInsufficientBalance
+	if tr.ReceiverProxy != nil {
+		if err = a.resolveReceiverProxy(ctx, tr); err != nil {
+			return err
+		}
 	}
 
-	acc.Balance -= (tr.Total)
-	res_acc.Balance += tr.Amount
+	return a.execute(ctx, tr, guard, func(ctx context.Context) (err error) {
+		if within != nil {
+			if err = within(ctx); err != nil {
+				return err
+			}
+		}
+
+		if receiverBank := a.bankOf(tr.Receiver.AccountNo); receiverBank != a.bankOf(tr.Account.AccountNo) {
+			return a.debitInterbankTransfer(ctx, tr, receiverBank)
+		}
+
+		acc, res_acc, err := a.lockTransferAccounts(ctx, tr.Account.AccountNo, tr.Receiver.AccountNo)
+		if err != nil {
+			return err
+		}
+
+		if res_acc.Status == "inactive" {
+			return domain.ErrAccDeleted
+		}
+
+		if err = a.limitUsecase.CheckLimits(ctx, tr, acc); err != nil {
+			return err
+		}
+
+		if err = a.feeUsecase.ApplyFee(ctx, tr, acc, res_acc); err != nil {
+			return err
+		}
+
+		newBalance, err := acc.Balance.Sub(tr.Total)
+		if err != nil {
+			return err
+		}
+
+		if err = a.checkFunds(ctx, acc, tr.Total); err != nil {
+			return err
+		}
+
+		acc.Balance = newBalance
+		if res_acc.Balance, err = res_acc.Balance.Add(tr.Amount); err != nil {
+			return err
+		}
+
+		if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+			return err
+		}
+
+		if err = a.accountUsecase.UpdateAccount(ctx, res_acc); err != nil {
+			return err
+		}
+
+		tr.Account = *acc
+		tr.Receiver = *res_acc
+		return nil
+	})
+}
 
-	if err = a.accountUsecase.UpdateAccount(ctx, acc); err != nil {
+// resolveReceiverProxy turns the PromptPay proxy of a transfer into the receiving account, the
+// transfer then goes through the same checks as one made to the account number
+func (a *transactionUsecase) resolveReceiverProxy(ctx context.Context, tr *domain.Transaction) error {
+	if err := tr.ReceiverProxy.Normalize(); err != nil {
 		return err
 	}
 
-	if err = a.accountUsecase.UpdateAccount(ctx, res_acc); err != nil {
+	proxy, err := a.proxyRepo.GetProxy(ctx, tr.ReceiverProxy.Type, tr.ReceiverProxy.Value)
+	if err != nil {
 		return err
 	}
 
-	if err = a.createTransaction(ctx, tr); err != nil {
-		return err
+	if proxy.AccountNo == tr.Account.AccountNo {
+		return domain.ErrBadParamInput
 	}
 
-	if err = a.transactionRepo.SetTransferAmountPerDayInRedis(ctx, tr); err != nil {
+	tr.Receiver = domain.Account{AccountNo: proxy.AccountNo}
+	return nil
+}
+
+// execute records tr as pending, then runs book, the ledger posting, the credit transfer of an
+// interbank transfer and the notification event in one unit of work. The transaction ends up
+// completed or clearing, or failed with the reason when anything goes wrong, so declined attempts
+// stay visible after the rollback.
+//
+// guard, when given, decides whether the attempt is made at all. It runs first in the unit of
+// work and tr is only recorded once it passed, so an attempt it turns down leaves no transaction.
+func (a *transactionUsecase) execute(ctx context.Context, tr *domain.Transaction, guard, book func(ctx context.Context) error) (err error) {
+	if err = tr.Transition(domain.TransactionPending); err != nil {
 		return err
 	}
 
-	tr.Account = *acc
-	tr.Receiver = *res_acc
+	if guard == nil {
+		if err = a.createTransaction(ctx, tr); err != nil {
+			return err
+		}
+	}
 
-	go a.addTransactionNotiToQueue(ctx, *tr, acc.Balance)
+	attempted := guard == nil
+	err = a.unitOfWork.Do(ctx, func(ctx context.Context) (err error) {
+		if guard != nil {
+			if err = guard(ctx); err != nil {
+				return err
+			}
+
+			if err = a.createTransaction(ctx, tr); err != nil {
+				return err
+			}
+			attempted = true
+		}
+
+		if err = book(ctx); err != nil {
+			return err
+		}
+
+		// a transfer to another bank is only done once the clearing house settled it
+		status := domain.TransactionCompleted
+		if tr.IsInterbank() {
+			status = domain.TransactionClearing
+		}
+
+		if err = a.settleTransaction(ctx, tr, status); err != nil {
+			return err
+		}
+
+		if err = a.ledgerUsecase.PostTransaction(ctx, tr); err != nil {
+			return err
+		}
+
+		if tr.IsInterbank() {
+			if err = a.submitInterbankTransfer(ctx, tr); err != nil {
+				return err
+			}
+		}
+
+		return a.enqueueTransactionEvent(ctx, *tr, tr.Account.Balance)
+	})
+	if err != nil {
+		if attempted {
+			// a pending row written in the unit of work went with the rollback
+			a.recordFailure(ctx, tr, err, guard != nil)
+		}
+		return err
+	}
 
 	return nil
 }
 
-func (a *transactionUsecase) checkTransactionLimit(ctx context.Context, tr domain.Transaction) bool {
-	dailyLimit, err := a.accountUsecase.GetDailyLimit(ctx, tr.Account.AccountNo)
-	if err != nil {
-		return false
+// recordFailure marks the pending tr failed because of cause, or writes it failed when its pending
+// row was rolled back. It runs after the unit of work rolled back and outside of it on purpose, so
+// the attempt stays on record. The request context may be what ran out, so the write keeps its
+// values but gets a deadline of its own.
+func (a *transactionUsecase) recordFailure(ctx context.Context, tr *domain.Transaction, cause error, rolledBack bool) {
+	// settling may have got as far as completed before the ledger turned the posting down
+	tr.Status = domain.TransactionPending
+	if err := tr.Fail(cause); err != nil {
+		return
 	}
 
-	dailySumTransaction, _ := a.accountUsecase.GetSumDailyTransaction(ctx, tr.Account.AccountNo)
+	failCtx, cancel := context.WithTimeout(detachedContext{ctx}, a.contextTimeout)
+	defer cancel()
 
-	if tr.Amount+dailySumTransaction > dailyLimit {
-		return false
+	var err error
+	if rolledBack {
+		err = a.createTransaction(failCtx, tr)
+	} else {
+		err = a.transactionRepo.UpdateTransactionStatus(failCtx, tr, domain.TransactionPending)
+	}
+	if err != nil {
+		logrus.Error(err)
 	}
+}
 
-	return true
+// detachedContext keeps the values of a context, such as the correlation id, without its
+// deadline and cancellation
+type detachedContext struct {
+	context.Context
 }
 
-func calculateTransferFee(acc, res_acc *domain.Account) float64 {
-	if acc.Bank != res_acc.Bank {
-		return 10.0
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (a *transactionUsecase) settleTransaction(ctx context.Context, tr *domain.Transaction, status string) error {
+	from := tr.Status
+	if err := tr.Transition(status); err != nil {
+		return err
 	}
-	return 0.0
+
+	return a.transactionRepo.UpdateTransactionStatus(ctx, tr, from)
 }
 
-func (a *transactionUsecase) checkTransferLimit(ctx context.Context, AccountNo string, amount float64) error {
-	cacheKey := fmt.Sprintf("limit_per_transaction: %s", AccountNo)
-	limitAmountPerTransaction, err := a.redis.Get(cacheKey).Result()
+// lockTransferAccounts locks sender and receiver in account number order so that
+// two opposite transfers between the same accounts can not deadlock each other
+func (a *transactionUsecase) lockTransferAccounts(ctx context.Context, accountNo, receiverNo string) (acc, res_acc *domain.Account, err error) {
+	lock := func(account_no string) (*domain.Account, error) {
+		locked, err := a.accountRepo.GetAccountByAccountNoForUpdate(ctx, account_no)
+		if err == domain.ErrNotFound && account_no == receiverNo {
+			return nil, domain.ErrResipientNotFound
+		}
+		return locked, err
+	}
 
-	if err == redis.Nil {
-		limitAmountPerTransaction = "0"
+	if accountNo < receiverNo {
+		if acc, err = lock(accountNo); err != nil {
+			return nil, nil, err
+		}
+		if res_acc, err = lock(receiverNo); err != nil {
+			return nil, nil, err
+		}
+		return acc, res_acc, nil
 	}
-	limitAmountPerTransactionFloat64, _ := strconv.ParseFloat(limitAmountPerTransaction, 64)
 
-	if limitAmountPerTransactionFloat64 != 0 && amount > limitAmountPerTransactionFloat64 {
-		return domain.ErrExceedLimitAmountPerTransaction
+	if res_acc, err = lock(receiverNo); err != nil {
+		return nil, nil, err
 	}
-	return nil
+	if acc, err = lock(accountNo); err != nil {
+		return nil, nil, err
+	}
+	return acc, res_acc, nil
 }
 
 func (a *transactionUsecase) createTransaction(ctx context.Context, tr *domain.Transaction) (err error) {
@@ -234,22 +520,37 @@ func (a *transactionUsecase) migrateTransactionHistory(ctx context.Context) (err
 	return nil
 }
 
-func (a *transactionUsecase) addTransactionNotiToQueue(ctx context.Context, tr domain.Transaction, remainingBalance float64) {
-	topic := "sms_transaction"
-	brokerAddress := viper.GetString("kafka.broker_address")
-	if tr.Type == "withdraw" {
-		message := fmt.Sprintf("%s|%.2f|%s|%s|%.2f",
-			tr.Type, tr.Amount, tr.Account.AccountNo, tr.CreatedAt.Format("2006-01-02 15:04:05"), remainingBalance)
-		producer.RunKafkaProducer(brokerAddress, topic, message)
-	} else if tr.Type == "deposit" {
-		message := fmt.Sprintf("%s|%.2f|%s|%s|%.2f",
-			tr.Type, tr.Amount, tr.Account.AccountNo, tr.CreatedAt.Format("2006-01-02 15:04:05"), remainingBalance)
-
-		producer.RunKafkaProducer(brokerAddress, topic, message)
-	} else if tr.Type == "transfer" {
-		message := fmt.Sprintf("%s|%.2f|%s|%s|%.2f|%s",
-			tr.Type, tr.Amount, tr.Account.AccountNo, tr.CreatedAt.Format("2006-01-02 15:04:05"), remainingBalance, tr.Receiver.AccountNo)
+// enqueueTransactionEvent writes the notification event of tr to the outbox, keyed by account so
+// the events of an account keep their order
+func (a *transactionUsecase) enqueueTransactionEvent(ctx context.Context, tr domain.Transaction, remainingBalance domain.Money) error {
+	switch tr.Type {
+	case "withdraw", "deposit", "reversal", "transfer":
+	default:
+		return nil
+	}
 
-		producer.RunKafkaProducer(brokerAddress, topic, message)
+	ev := codec.NewEnvelope(codec.TransactionEventType(tr.Type), codec.TransactionVersion, domain.CorrelationID(ctx), &codec.TransactionEvent{
+		TransactionId: tr.Id,
+		Type:          tr.Type,
+		AccountNo:     tr.Account.AccountNo,
+		ReceiverNo:    tr.Receiver.AccountNo,
+		Currency:      domain.DefaultCurrency,
+		Amount:        tr.Amount.Satang,
+		Total:         tr.Total.Satang,
+		Balance:       remainingBalance.Satang,
+		ReferenceId:   tr.ReferenceId,
+		Status:        tr.Status,
+		CreatedAt:     tr.CreatedAt,
+	})
+
+	payload, err := codec.JSON.Encode(ev)
+	if err != nil {
+		return err
 	}
+
+	return a.outboxRepo.CreateEvent(ctx, &domain.OutboxEvent{
+		Topic:   "sms_transaction",
+		Key:     tr.Account.AccountNo,
+		Payload: string(payload),
+	})
 }
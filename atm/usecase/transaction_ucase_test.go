@@ -0,0 +1,201 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+func TestParallelWithdrawalsNeverOverdraw(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	tu := newTestUsecases(db).transaction
+
+	const n = 25
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tr := &domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(10000), Account: domain.Account{AccountNo: "1000000001"}, TerminalId: "ATM-0001"}
+			errs[i] = tu.withdraw(context.Background(), tr, nil, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, domain.ErrInsufficientBalance):
+			t.Fatalf("withdraw failed with %v, want ErrInsufficientBalance", err)
+		}
+	}
+
+	if succeeded != 10 {
+		t.Errorf("%d withdrawals succeeded, want 10", succeeded)
+	}
+
+	if balance := db.account("1000000001").Balance; !balance.IsZero() {
+		t.Errorf("balance is %s, want 0.00", balance)
+	}
+
+	counts := db.transactionsByStatus()
+	if counts[domain.TransactionCompleted] != 10 || counts[domain.TransactionFailed] != n-10 {
+		t.Errorf("transactions by status %v, want 10 completed and %d failed", counts, n-10)
+	}
+}
+
+func TestOppositeTransfersDoNotDeadlock(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	db.addAccount("2000000001", "0822222222", domain.NewMoney(100000))
+	tu := newTestUsecases(db).transaction
+
+	const n = 20
+	done := make(chan error, 2*n)
+
+	transfer := func(from, to string) {
+		tr := &domain.Transaction{Type: "transfer", Amount: domain.NewMoney(1000), Account: domain.Account{AccountNo: from},
+			Receiver: domain.Account{AccountNo: to}}
+		done <- tu.Transfer(context.Background(), tr)
+	}
+
+	for i := 0; i < n; i++ {
+		go transfer("1000000001", "2000000001")
+		go transfer("2000000001", "1000000001")
+	}
+
+	timeout := time.After(5 * time.Second)
+	for i := 0; i < 2*n; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("transfer failed: %v", err)
+			}
+		case <-timeout:
+			t.Fatal("transfers in opposite directions deadlocked")
+		}
+	}
+
+	for _, accountNo := range []string{"1000000001", "2000000001"} {
+		if balance := db.account(accountNo).Balance; balance.Satang != 100000 {
+			t.Errorf("balance of %s is %s, want 1000.00", accountNo, balance)
+		}
+	}
+}
+
+func TestFailedWithdrawalRollsBack(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(5000))
+	tu := newTestUsecases(db).transaction
+	entries := len(db.ledger)
+
+	tr := &domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(10000), Account: domain.Account{AccountNo: "1000000001"}, TerminalId: "ATM-0001"}
+	if err := tu.withdraw(context.Background(), tr, nil, nil); !errors.Is(err, domain.ErrInsufficientBalance) {
+		t.Fatalf("got %v, want ErrInsufficientBalance", err)
+	}
+
+	if balance := db.account("1000000001").Balance; balance.Satang != 5000 {
+		t.Errorf("balance is %s, want 50.00", balance)
+	}
+
+	if len(db.ledger) != entries || len(db.outbox) != 0 {
+		t.Errorf("a failed withdrawal left %d ledger entries and %d events", len(db.ledger)-entries, len(db.outbox))
+	}
+
+	if tr.Status != domain.TransactionFailed || tr.FailureCode == 0 {
+		t.Errorf("transaction is %s with code %d, want failed with a code", tr.Status, tr.FailureCode)
+	}
+}
+
+func TestFailureIsRecordedAfterTheRequestIsCancelled(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(100000))
+	tu := newTestUsecases(db).transaction
+
+	ctx, cancel := context.WithCancel(domain.WithCorrelationID(context.Background(), "request-1"))
+	tr := &domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(10000), Account: domain.Account{AccountNo: "1000000001"}}
+
+	err := tu.execute(ctx, tr, nil, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	recorded := db.transactions[tr.Id]
+	if recorded.Status != domain.TransactionFailed || recorded.FailureCode == 0 {
+		t.Fatalf("the attempt was recorded as %q with code %d, want failed", recorded.Status, recorded.FailureCode)
+	}
+}
+
+func TestCashOnlyMovesThroughATerminal(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	tu := newTestUsecases(db).transaction
+	tu.userUsecase = testPins{pins: map[string]string{"0811111111": "123456"}}
+	ctx := context.Background()
+
+	withdraw := &domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(10000), Account: domain.Account{AccountNo: "1000000001"}}
+	if err := tu.WithdrawWithPin(ctx, withdraw, "123456"); err != domain.ErrInvalidTerminal {
+		t.Errorf("withdraw: got %v, want ErrInvalidTerminal", err)
+	}
+	deposit := &domain.Transaction{Type: "deposit", Amount: domain.NewMoney(10000), Account: domain.Account{AccountNo: "1000000001"}}
+	if err := tu.Deposit(ctx, deposit); err != domain.ErrInvalidTerminal {
+		t.Errorf("deposit: got %v, want ErrInvalidTerminal", err)
+	}
+
+	if balance := db.account("1000000001").Balance.Satang; balance != 50000 || len(db.transactions) != 0 {
+		t.Errorf("balance is %d satang after %d transactions, want it untouched", balance, len(db.transactions))
+	}
+}
+
+// testPins knows the PIN of each user
+type testPins struct {
+	domain.UserUsecase
+	pins map[string]string
+}
+
+func (p testPins) ValidatePin(ctx context.Context, uuid string, pin string) bool {
+	want, ok := p.pins[uuid]
+	return ok && pin == want
+}
+
+func TestWithdrawWithPin(t *testing.T) {
+	db := newMemDB()
+	db.addAccount("1000000001", "0811111111", domain.NewMoney(50000))
+	tu := newTestUsecases(db).transaction
+	terminals := tu.terminalUsecase.(*testTerminals)
+	tu.userUsecase = testPins{pins: map[string]string{"0811111111": "123456", "0822222222": "654321"}}
+
+	withdraw := func(pin string) error {
+		tr := &domain.Transaction{Type: "withdraw", Amount: domain.NewMoney(10000), Account: domain.Account{AccountNo: "1000000001"}, TerminalId: "ATM-0001"}
+		return tu.WithdrawWithPin(context.Background(), tr, pin)
+	}
+
+	// the PIN of another user is as wrong as any other
+	for _, pin := range []string{"000000", "654321", ""} {
+		if err := withdraw(pin); err != domain.ErrWrongPin {
+			t.Fatalf("pin %q: got %v, want ErrWrongPin", pin, err)
+		}
+	}
+	if len(terminals.dispensed) != 0 || len(db.transactions) != 0 {
+		t.Fatalf("a wrong pin dispensed %v and booked %d transactions", terminals.dispensed, len(db.transactions))
+	}
+
+	if err := withdraw("123456"); err != nil {
+		t.Fatal(err)
+	}
+	if balance := db.account("1000000001").Balance.Satang; balance != 40000 || len(terminals.dispensed) != 1 {
+		t.Errorf("balance is %d satang, dispensed %v", balance, terminals.dispensed)
+	}
+}
@@ -0,0 +1,222 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"main/domain"
+)
+
+var ErrBusClosed = errors.New("event bus is closed")
+
+// memoryPartition holds the messages of a partition not consumed yet
+type memoryPartition struct {
+	mu     sync.Mutex
+	queue  []domain.Message
+	next   int64
+	notify chan struct{}
+}
+
+type memoryBus struct {
+	router     *Router
+	partitions int
+
+	mu     sync.Mutex
+	topics map[string][]*memoryPartition
+	closed bool
+	stop   chan struct{}
+	// delayed are the retries waiting for their delay, by a sequence number
+	delayed   map[int64]*time.Timer
+	nextDelay int64
+}
+
+// NewMemoryBus will create an object that represent the domain.EventBus interface in process,
+// for running without Kafka. Topics have partitions partitions, a key always hashes to the same
+// one, and each partition is consumed by one worker in order. A retried message only joins its
+// partition once its delay is over. Messages not consumed are lost when the bus is closed.
+func NewMemoryBus(partitions int, retryDelays []time.Duration) domain.EventBus {
+	if partitions < 1 {
+		partitions = 1
+	}
+
+	b := &memoryBus{
+		partitions: partitions,
+		topics:     make(map[string][]*memoryPartition),
+		stop:       make(chan struct{}),
+		delayed:    make(map[int64]*time.Timer),
+	}
+	b.router = NewRouter(b, retryDelays)
+
+	return b
+}
+
+func (b *memoryBus) Publish(topic string, key string, headers map[string]string, message []byte) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBusClosed
+	}
+	partitions := b.topic(topic)
+	b.mu.Unlock()
+
+	partition := 0
+	if key != "" {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(key))
+		partition = int(hash.Sum32() % uint32(len(partitions)))
+	}
+	p := partitions[partition]
+
+	msg := domain.Message{
+		Topic:     topic,
+		Partition: int32(partition),
+		Key:       key,
+		Headers:   make(map[string]string, len(headers)),
+		Value:     append([]byte(nil), message...),
+		Timestamp: time.Now(),
+	}
+	for k, v := range headers {
+		msg.Headers[k] = v
+	}
+
+	if wait := time.Until(b.router.DueAt(&msg)); wait > 0 {
+		b.delay(p, msg, wait)
+		return nil
+	}
+
+	b.enqueue(p, msg)
+	return nil
+}
+
+// delay enqueues msg after wait, unless the bus is closed by then
+func (b *memoryBus) delay(p *memoryPartition, msg domain.Message, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextDelay
+	b.nextDelay++
+	b.delayed[id] = time.AfterFunc(wait, func() {
+		b.mu.Lock()
+		delete(b.delayed, id)
+		closed := b.closed
+		b.mu.Unlock()
+
+		if !closed {
+			b.enqueue(p, msg)
+		}
+	})
+}
+
+func (b *memoryBus) enqueue(p *memoryPartition, msg domain.Message) {
+	p.mu.Lock()
+	msg.Offset = p.next
+	p.next++
+	p.queue = append(p.queue, msg)
+	p.mu.Unlock()
+
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (b *memoryBus) Subscribe(topic string, handler domain.MessageHandler) {
+	b.router.Subscribe(topic, handler)
+}
+
+func (b *memoryBus) SubscribeDeadLetters(topic string, handler domain.MessageHandler) {
+	b.router.SubscribeDeadLetters(topic, handler)
+}
+
+// Run delivers until ctx is done or the bus is closed
+func (b *memoryBus) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-b.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for _, topic := range b.router.Topics() {
+		b.mu.Lock()
+		partitions := b.topic(topic)
+		b.mu.Unlock()
+
+		for _, p := range partitions {
+			wg.Add(1)
+			go func(p *memoryPartition) {
+				defer wg.Done()
+				b.consume(ctx, p)
+			}(p)
+		}
+	}
+
+	wg.Wait()
+	return nil
+}
+
+// Close refuses further messages and stops Run. Nothing needs flushing, the messages not
+// consumed yet, retries waiting for their delay included, are dropped.
+func (b *memoryBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.stop)
+
+	for id, timer := range b.delayed {
+		timer.Stop()
+		delete(b.delayed, id)
+	}
+}
+
+// consume hands the messages of p to the router in order. A message leaves the queue only once
+// it was handled, so one interrupted by shutdown is delivered again by the next Run.
+func (b *memoryBus) consume(ctx context.Context, p *memoryPartition) {
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.notify:
+				continue
+			}
+		}
+		msg := p.queue[0]
+		p.mu.Unlock()
+
+		if !b.router.Process(ctx, &msg) {
+			return
+		}
+
+		p.mu.Lock()
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+	}
+}
+
+// topic returns the partitions of topic, creating them on first use. b.mu must be held.
+func (b *memoryBus) topic(topic string) []*memoryPartition {
+	partitions, ok := b.topics[topic]
+	if !ok {
+		partitions = make([]*memoryPartition, b.partitions)
+		for i := range partitions {
+			partitions[i] = &memoryPartition{notify: make(chan struct{}, 1)}
+		}
+		b.topics[topic] = partitions
+	}
+	return partitions
+}
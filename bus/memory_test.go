@@ -0,0 +1,195 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+// runBus runs b until the test ends
+func runBus(t *testing.T, b domain.EventBus) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = b.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		b.Close()
+	})
+}
+
+// await waits for ch to be closed
+func await(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestMemoryBusRetries(t *testing.T) {
+	b := NewMemoryBus(2, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond})
+
+	var mu sync.Mutex
+	var seen []*domain.Message
+	done := make(chan struct{})
+	b.Subscribe("sms", func(ctx context.Context, message *domain.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen = append(seen, message)
+		if len(seen) < 3 {
+			return errors.New("gateway unavailable")
+		}
+		close(done)
+		return nil
+	})
+	runBus(t, b)
+
+	start := time.Now()
+	if err := b.Publish("sms", "0811111111", map[string]string{"content-type": "text/plain"}, []byte("123456")); err != nil {
+		t.Fatal(err)
+	}
+	await(t, done, "the second retry")
+
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("retried after %v, want the delays kept", elapsed)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	last := seen[2]
+	if last.Topic != domain.RetryTopic("sms", 2) || last.Headers[domain.HeaderAttempts] != "2" ||
+		last.Headers[domain.HeaderOriginalTopic] != "sms" || last.Headers["content-type"] != "text/plain" || string(last.Value) != "123456" {
+		t.Errorf("got %s %v %q, want the second retry with the original message", last.Topic, last.Headers, last.Value)
+	}
+}
+
+func TestMemoryBusDeadLetters(t *testing.T) {
+	b := NewMemoryBus(1, []time.Duration{time.Millisecond})
+
+	dead := make(chan *domain.Message, 2)
+	b.Subscribe("sms", func(ctx context.Context, message *domain.Message) error {
+		if string(message.Value) == "bad" {
+			return domain.Permanent(errors.New("unreadable"))
+		}
+		return errors.New("gateway unavailable")
+	})
+	b.SubscribeDeadLetters("sms", func(ctx context.Context, message *domain.Message) error {
+		dead <- message
+		return nil
+	})
+	runBus(t, b)
+
+	_ = b.Publish("sms", "0811111111", nil, []byte("bad"))
+	_ = b.Publish("sms", "0811111111", nil, []byte("retried"))
+
+	want := map[string]string{"bad": "1", "retried": "2"}
+	for i := 0; i < 2; i++ {
+		select {
+		case message := <-dead:
+			if message.Topic != domain.DeadLetterTopic("sms") || message.Headers[domain.HeaderAttempts] != want[string(message.Value)] {
+				t.Errorf("got %q on %s after %s attempts, want %s", message.Value, message.Topic, message.Headers[domain.HeaderAttempts], want[string(message.Value)])
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for the dead letters")
+		}
+	}
+}
+
+func TestMemoryBusKeepsKeyOrder(t *testing.T) {
+	b := NewMemoryBus(4, nil)
+
+	var mu sync.Mutex
+	got := make(map[string][]int)
+	done := make(chan struct{})
+	total := 0
+	b.Subscribe("sms_transaction", func(ctx context.Context, message *domain.Message) error {
+		var n int
+		_, _ = fmt.Sscanf(string(message.Value), "%d", &n)
+
+		mu.Lock()
+		defer mu.Unlock()
+		got[message.Key] = append(got[message.Key], n)
+		if total++; total == 300 {
+			close(done)
+		}
+		return nil
+	})
+	runBus(t, b)
+
+	keys := []string{"1000000001", "2000000001", "3000000001"}
+	for i := 0; i < 100; i++ {
+		for _, key := range keys {
+			_ = b.Publish("sms_transaction", key, nil, []byte(fmt.Sprint(i)))
+		}
+	}
+	await(t, done, "every message")
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		for i, n := range got[key] {
+			if n != i {
+				t.Fatalf("%s: message %d is %d, want them in order", key, i, n)
+			}
+		}
+	}
+}
+
+func TestMemoryBusDelayDoesNotHoldThePartition(t *testing.T) {
+	b := NewMemoryBus(1, []time.Duration{time.Hour})
+
+	handled := make(chan struct{})
+	b.Subscribe("sms", func(ctx context.Context, message *domain.Message) error {
+		if string(message.Value) == "due" {
+			close(handled)
+		}
+		return nil
+	})
+	runBus(t, b)
+
+	// both land on the one partition of the retry topic, the later one is due first
+	later := time.Now().Add(time.Hour).Format(time.RFC3339Nano)
+	_ = b.Publish(domain.RetryTopic("sms", 1), "", map[string]string{domain.HeaderRetryAt: later}, []byte("later"))
+	_ = b.Publish(domain.RetryTopic("sms", 1), "", map[string]string{domain.HeaderRetryAt: time.Now().Format(time.RFC3339Nano)}, []byte("due"))
+
+	await(t, handled, "the message that is due")
+}
+
+func TestMemoryBusCloseStopsRun(t *testing.T) {
+	b := NewMemoryBus(2, []time.Duration{time.Hour})
+	b.Subscribe("sms", func(ctx context.Context, message *domain.Message) error {
+		return errors.New("gateway unavailable")
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = b.Run(context.Background())
+	}()
+
+	// a retry is waiting for its delay
+	_ = b.Publish("sms", "0811111111", nil, []byte("123456"))
+	time.Sleep(10 * time.Millisecond)
+
+	b.Close()
+	await(t, stopped, "Run to return")
+
+	if err := b.Publish("sms", "0811111111", nil, []byte("123456")); err != ErrBusClosed {
+		t.Errorf("got %v, want %v", err, ErrBusClosed)
+	}
+}
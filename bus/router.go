@@ -0,0 +1,150 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"main/domain"
+)
+
+const (
+	retryBackoff    = time.Second
+	maxRetryBackoff = time.Minute
+)
+
+// route is what a subscribed topic is consumed with. stage is 0 for the topic itself, n for its
+// nth retry topic and -1 for a dead letter topic.
+type route struct {
+	topic   string
+	stage   int
+	handler domain.MessageHandler
+}
+
+// Router runs the handlers of an event bus and moves failed messages along the retry topics to
+// the dead letter topic, whatever carries the messages
+type Router struct {
+	publisher   domain.EventPublisher
+	routes      map[string]route
+	retryDelays []time.Duration
+}
+
+// NewRouter retries a failed message once per entry of retryDelays, each after its delay,
+// going through publisher to the retry and dead letter topics
+func NewRouter(publisher domain.EventPublisher, retryDelays []time.Duration) *Router {
+	return &Router{
+		publisher:   publisher,
+		routes:      make(map[string]route),
+		retryDelays: retryDelays,
+	}
+}
+
+// Subscribe registers handler for topic and its retry topics. A retried message no longer
+// keeps its order with the rest of its key.
+func (r *Router) Subscribe(topic string, handler domain.MessageHandler) {
+	r.routes[topic] = route{topic: topic, handler: handler}
+	for i := range r.retryDelays {
+		r.routes[domain.RetryTopic(topic, i+1)] = route{topic: topic, stage: i + 1, handler: handler}
+	}
+}
+
+func (r *Router) SubscribeDeadLetters(topic string, handler domain.MessageHandler) {
+	r.routes[domain.DeadLetterTopic(topic)] = route{topic: topic, stage: -1, handler: handler}
+}
+
+// Topics lists every topic to consume, retry and dead letter topics included
+func (r *Router) Topics() []string {
+	topics := make([]string, 0, len(r.routes))
+	for topic := range r.routes {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// DueAt is when a message may be handled: the end of its retry delay on a retry topic, zero on
+// any other. The transport holds a message back until then, Process does not wait for it.
+func (r *Router) DueAt(message *domain.Message) time.Time {
+	if rt, ok := r.routes[message.Topic]; !ok || rt.stage <= 0 {
+		return time.Time{}
+	}
+
+	retryAt, _ := time.Parse(time.RFC3339Nano, message.Headers[domain.HeaderRetryAt])
+	return retryAt
+}
+
+// Process runs the handler of the message's topic and passes the message on when it fails. Only
+// when that is not possible either, e.g. the broker is down, it is tried again in place. It
+// returns false when ctx ended first, the message then counts as not consumed. The handler gets
+// ctx, and a failure after ctx ended is not passed on either, so a message stopped by shutdown or
+// a rebalance is delivered again instead of being retried.
+func (r *Router) Process(ctx context.Context, message *domain.Message) bool {
+	rt, ok := r.routes[message.Topic]
+	if !ok {
+		fmt.Printf("No handler for topic %s\n", message.Topic)
+		return false
+	}
+
+	backoff := retryBackoff
+	for {
+		err := rt.handler(ctx, message)
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		fmt.Printf("Error handling message %s/%d/%d: %v\n", message.Topic, message.Partition, message.Offset, err)
+
+		if rt.stage >= 0 {
+			if err = r.forward(rt, message, err); err == nil {
+				return true
+			}
+			fmt.Printf("Error forwarding message %s/%d/%d: %v\n", message.Topic, message.Partition, message.Offset, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// forward sends a message that failed with cause to the next retry topic, or to the dead letter
+// topic, with the original headers and what went wrong
+func (r *Router) forward(rt route, message *domain.Message, cause error) error {
+	now := time.Now()
+	attempts, _ := strconv.Atoi(message.Headers[domain.HeaderAttempts])
+
+	headers := make(map[string]string, len(message.Headers)+7)
+	for k, v := range message.Headers {
+		headers[k] = v
+	}
+	delete(headers, domain.HeaderRetryAt)
+
+	if headers[domain.HeaderOriginalTopic] == "" {
+		headers[domain.HeaderOriginalTopic] = message.Topic
+		headers[domain.HeaderOriginalPartition] = strconv.Itoa(int(message.Partition))
+		headers[domain.HeaderOriginalOffset] = strconv.FormatInt(message.Offset, 10)
+	}
+
+	headers[domain.HeaderAttempts] = strconv.Itoa(attempts + 1)
+	headers[domain.HeaderError] = cause.Error()
+	headers[domain.HeaderFailedAt] = now.Format(time.RFC3339Nano)
+
+	next := domain.DeadLetterTopic(rt.topic)
+	if rt.stage < len(r.retryDelays) && !domain.IsPermanent(cause) {
+		next = domain.RetryTopic(rt.topic, rt.stage+1)
+		headers[domain.HeaderRetryAt] = now.Add(r.retryDelays[rt.stage]).Format(time.RFC3339Nano)
+	}
+
+	return r.publisher.Publish(next, message.Key, headers, message.Value)
+}
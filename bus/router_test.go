@@ -0,0 +1,99 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"main/domain"
+)
+
+// testPublisher records the topics a router forwards to
+type testPublisher struct {
+	mu     sync.Mutex
+	topics []string
+}
+
+func (p *testPublisher) Publish(topic string, key string, headers map[string]string, message []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.topics = append(p.topics, topic)
+	return nil
+}
+
+func TestProcessCancelsTheHandler(t *testing.T) {
+	p := &testPublisher{}
+	r := NewRouter(p, []time.Duration{time.Second})
+
+	started := make(chan struct{})
+	r.Subscribe("sms", func(ctx context.Context, message *domain.Message) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() {
+		done <- r.Process(ctx, &domain.Message{Topic: "sms"})
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case consumed := <-done:
+		if consumed {
+			t.Error("a stopped message counts as consumed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the handler was not cancelled")
+	}
+	if len(p.topics) != 0 {
+		t.Errorf("forwarded to %v, want the message delivered again instead", p.topics)
+	}
+}
+
+func TestProcessForwardsAFailure(t *testing.T) {
+	p := &testPublisher{}
+	r := NewRouter(p, []time.Duration{time.Second})
+	r.Subscribe("sms", func(ctx context.Context, message *domain.Message) error {
+		return errors.New("gateway unavailable")
+	})
+
+	if !r.Process(context.Background(), &domain.Message{Topic: "sms"}) {
+		t.Fatal("a forwarded message counts as consumed")
+	}
+	if want := domain.RetryTopic("sms", 1); len(p.topics) != 1 || p.topics[0] != want {
+		t.Errorf("forwarded to %v, want %s", p.topics, want)
+	}
+}
+
+func TestProcessDoesNotWaitForTheRetryDelay(t *testing.T) {
+	r := NewRouter(&testPublisher{}, []time.Duration{time.Hour})
+	handled := false
+	r.Subscribe("sms", func(ctx context.Context, message *domain.Message) error {
+		handled = true
+		return nil
+	})
+
+	retryAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	message := &domain.Message{
+		Topic:   domain.RetryTopic("sms", 1),
+		Headers: map[string]string{domain.HeaderRetryAt: retryAt.Format(time.RFC3339Nano)},
+	}
+
+	if due := r.DueAt(message); !due.Equal(retryAt) {
+		t.Errorf("due at %v, want %v", due, retryAt)
+	}
+	if due := r.DueAt(&domain.Message{Topic: "sms"}); !due.IsZero() {
+		t.Errorf("due at %v, want the topic itself due straight away", due)
+	}
+
+	// the transport holds the message back, Process handles what it is given
+	if !r.Process(context.Background(), message) || !handled {
+		t.Error("the message was not handled")
+	}
+}
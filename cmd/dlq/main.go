@@ -0,0 +1,192 @@
+// Command dlq inspects, edits and replays dead letters through the admin API.
+//
+//	dlq [-addr http://localhost:8081] list [-topic t] [-status pending] [-limit 50]
+//	dlq show <id>
+//	dlq edit <id> [-key k] [-payload text | -payload-file f]
+//	dlq replay <id>
+//	dlq discard <id>
+//	dlq stats
+//
+// The admin key of the operator is read from ADMIN_API_KEY.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const adminKeyHeader = "X-Admin-Key"
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+func main() {
+	addr := flag.String("addr", envOr("DLQ_ADDR", "http://localhost:8081"), "address of the service")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	base := *addr + "/admin/dead-letters"
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+
+	var err error
+	switch cmd {
+	case "list":
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		topic := fs.String("topic", "", "only dead letters of this topic")
+		status := fs.String("status", "pending", "pending, replayed or discarded, empty for all")
+		limit := fs.Int("limit", 50, "at most this many")
+		_ = fs.Parse(args)
+
+		q := url.Values{}
+		q.Set("topic", *topic)
+		q.Set("status", *status)
+		q.Set("limit", strconv.Itoa(*limit))
+		err = call(http.MethodGet, base+"?"+q.Encode(), nil)
+	case "show":
+		err = withID(args, func(id string) error {
+			return call(http.MethodGet, base+"/"+id, nil)
+		})
+	case "edit":
+		err = edit(base, args)
+	case "replay":
+		err = withID(args, func(id string) error {
+			return call(http.MethodPost, base+"/"+id+"/replay", nil)
+		})
+	case "discard":
+		err = withID(args, func(id string) error {
+			return call(http.MethodPost, base+"/"+id+"/discard", nil)
+		})
+	case "stats":
+		err = call(http.MethodGet, base+"/stats", nil)
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func edit(base string, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("edit needs a dead letter id")
+	}
+	id := args[0]
+
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	key := fs.String("key", "", "new message key")
+	payload := fs.String("payload", "", "new payload")
+	payloadFile := fs.String("payload-file", "", "read the new payload from this file")
+	_ = fs.Parse(args[1:])
+
+	body := map[string]interface{}{}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "key":
+			body["key"] = *key
+		case "payload":
+			body["payload"] = []byte(*payload)
+		}
+	})
+
+	if *payloadFile != "" {
+		b, err := os.ReadFile(*payloadFile)
+		if err != nil {
+			return err
+		}
+		body["payload"] = b
+	}
+
+	if len(body) == 0 {
+		return fmt.Errorf("nothing to edit, give -key, -payload or -payload-file")
+	}
+
+	return call(http.MethodPut, base+"/"+id, body)
+}
+
+func withID(args []string, fn func(id string) error) error {
+	if len(args) < 1 {
+		return fmt.Errorf("a dead letter id is needed")
+	}
+	if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+		return fmt.Errorf("invalid dead letter id %q", args[0])
+	}
+	return fn(args[0])
+}
+
+// call sends body as JSON and prints the response indented
+func call(method string, target string, body interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(adminKeyHeader, os.Getenv("ADMIN_API_KEY"))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if json.Indent(&out, b, "", "  ") != nil {
+		out.Reset()
+		out.Write(b)
+	}
+	fmt.Println(out.String())
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", method, target, res.Status)
+	}
+	return nil
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: dlq [-addr url] <command>
+
+commands:
+  list [-topic t] [-status pending] [-limit 50]
+  show <id>
+  edit <id> [-key k] [-payload text | -payload-file f]
+  replay <id>
+  discard <id>
+  stats`)
+}
@@ -0,0 +1,118 @@
+// Command limits copies the limits still kept under the old Redis keys into banking.limits.
+//
+//	limits [-config config.json] [-dry-run] seed
+//
+// Limits already in the table are left alone, so it can be run again at any time. Run it once
+// before the service starts checking limits from the table.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+
+	goredis "github.com/go-redis/redis"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/spf13/viper"
+
+	_limitRepo "main/atm/repository/mysql"
+	_legacyLimitRepo "main/atm/repository/redis"
+	"main/domain"
+)
+
+func main() {
+	configFile := flag.String("config", "config.json", "config file of the service")
+	dryRun := flag.Bool("dry-run", false, "only print what would be seeded")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 || flag.Arg(0) != "seed" {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := seed(*configFile, *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func seed(configFile string, dryRun bool) error {
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+
+	val := url.Values{}
+	val.Add("parseTime", "true")
+	val.Add("loc", "Asia/Bangkok")
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?%s", viper.GetString(`database.user`), viper.GetString(`database.pass`),
+		viper.GetString(`database.host`), viper.GetString(`database.port`), viper.GetString(`database.name`), val.Encode())
+
+	dbConn, err := sql.Open(`mysql`, dsn)
+	if err != nil {
+		return err
+	}
+	defer dbConn.Close()
+
+	redis := goredis.NewClient(&goredis.Options{
+		Addr:     fmt.Sprintf("%s:%s", viper.GetString(`redis.host`), viper.GetString(`redis.port`)),
+		Password: viper.GetString(`redis.pass`),
+		DB:       0,
+	})
+	defer redis.Close()
+
+	legacy, skipped, err := _legacyLimitRepo.LegacyLimits(redis)
+	if err != nil {
+		return err
+	}
+	for _, key := range skipped {
+		fmt.Printf("skipped  %s\n", key)
+	}
+
+	ctx := context.Background()
+	lr := _limitRepo.NewMysqlLimitRepository(dbConn)
+
+	existing, err := lr.GetLimits(ctx, "", "")
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	for _, limit := range existing {
+		set[limitKey(limit)] = true
+	}
+
+	for i := range legacy {
+		limit := &legacy[i]
+		if set[limitKey(*limit)] {
+			fmt.Printf("kept     %s\n", describe(*limit))
+			continue
+		}
+
+		if !dryRun {
+			if err = lr.UpsertLimit(ctx, limit); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("seeded   %s\n", describe(*limit))
+	}
+
+	return nil
+}
+
+func limitKey(l domain.Limit) string {
+	return l.Scope + "/" + l.ScopeRef + "/" + l.TransactionType + "/" + l.Kind
+}
+
+func describe(l domain.Limit) string {
+	return fmt.Sprintf("%s %s", limitKey(l), l.Amount)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: limits [-config config.json] [-dry-run] seed")
+	flag.PrintDefaults()
+}
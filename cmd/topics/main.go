@@ -0,0 +1,91 @@
+// Command topics checks the Kafka topics against kafka.topics of the service config.
+//
+//	topics [-config config.json] validate
+//	topics create
+//	topics alter
+//
+// validate changes nothing, create also creates the missing topics and alter also brings the
+// existing ones in line. It exits with 1 while the cluster still differs from the config.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Shopify/sarama"
+	"github.com/spf13/viper"
+
+	admin "main/kafka/admin"
+)
+
+func main() {
+	configFile := flag.String("config", "config.json", "config file of the service")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	mode, err := admin.ParseMode(flag.Arg(0))
+	if err != nil || mode == admin.Off {
+		usage()
+		os.Exit(2)
+	}
+
+	report, err := run(*configFile, mode)
+
+	for _, topic := range report.Created {
+		fmt.Printf("created  %s\n", topic)
+	}
+	for _, d := range report.Altered {
+		fmt.Printf("altered  %s\n", d)
+	}
+	for _, topic := range report.Missing {
+		fmt.Printf("missing  %s\n", topic)
+	}
+	for _, d := range report.Drift {
+		fmt.Printf("drift    %s\n", d)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if !report.InSync() {
+		os.Exit(1)
+	}
+}
+
+func run(configFile string, mode admin.Mode) (report admin.Report, err error) {
+	viper.SetConfigFile(configFile)
+	if err = viper.ReadInConfig(); err != nil {
+		return report, err
+	}
+
+	var topics admin.TopicsConfig
+	if err = viper.UnmarshalKey("kafka.topics", &topics); err != nil {
+		return report, err
+	}
+
+	config := sarama.NewConfig()
+	config.ClientID = "topics"
+
+	clusterAdmin, err := sarama.NewClusterAdmin([]string{viper.GetString("kafka.broker_address")}, config)
+	if err != nil {
+		return report, err
+	}
+	defer clusterAdmin.Close()
+
+	// a retry topic for each retry delay of the consumers
+	retries := len(viper.GetStringSlice("kafka.consumer.retry_delays"))
+	return admin.Provision(clusterAdmin, topics.Specs(retries), mode)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: topics [-config config.json] validate|create|alter")
+	flag.PrintDefaults()
+}
@@ -12,12 +12,13 @@ type Account struct {
 	Name      string     `json:"name,omitempty"`
 	Email     string     `json:"email,omitempty"`
 	Tel       string     `json:"tel,omitempty"`
-	Balance   float64    `json:"balance"`
+	Balance   Money      `json:"balance"`
 	Bank      string     `json:"bank,omitempty"`
 	Status    string     `json:"status,omitempty"`
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 	IsClosed  int        `json:"is_closed,omitempty"`
+	Segment   string     `json:"segment,omitempty"`
 }
 
 type CountAccount struct {
@@ -36,8 +37,6 @@ type AccountUsecase interface {
 	// CalNewBalance(ctx context.Context, ar *Account, tr *Transaction) error
 	ValidateAccount(ctx context.Context, ar *Account) error
 	GetAllAccountByUuid(c context.Context, uuid string) (res *[]Account, err error)
-	GetDailyLimit(c context.Context, account_no string) (float64, error)
-	GetSumDailyTransaction(c context.Context, account_no string) (float64, error)
 	SelectBank(lastDigit string) (bank string)
 }
 
@@ -46,6 +45,7 @@ type AccountRepository interface {
 	GetAllAccount(ctx context.Context, cursor string, num int64) (res []Account, nextCursor string, err error)
 	GetAccountFromRedisByAccountNo(ctx context.Context, account_no string) (*Account, error)
 	GetAccountByAccountNo(ctx context.Context, account_no string) (*Account, error)
+	GetAccountByAccountNoForUpdate(ctx context.Context, account_no string) (*Account, error)
 	UpdateAccount(ctx context.Context, ar *Account) error
 	RegisterAccount(ctx context.Context, a *Account) error
 	GetCountAccountByStatus(ctx context.Context) (result map[string]int, err error)
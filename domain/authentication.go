@@ -9,9 +9,14 @@ type AuthenticationUsecase interface {
 	GenerateOtp(c context.Context, tel string) (string, error)
 	SendOtp(c context.Context, tel string) error
 	ValidateOtp(c context.Context, userOTP string, secretKey string) bool
+	// ConsumeOtp validates otp and burns it, so it is used only once. The burn is undone with the
+	// unit of work of c.
+	ConsumeOtp(c context.Context, tel string, otp string) error
 }
 
 type AuthenticationRepository interface {
 	SaveOtpSecret(ctx context.Context, uuid string, secretKey string) (err error)
 	GetOtpSecret(ctx context.Context, uuid string) (secretKey string, expiredAt time.Time, err error)
+	// ExpireOtpSecret returns ErrInvalidOtp when the secret already expired or was used
+	ExpireOtpSecret(ctx context.Context, uuid string, secretKey string) error
 }
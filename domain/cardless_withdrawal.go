@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Cardless withdrawal statuses. Only a pending withdrawal that has not expired holds money.
+const (
+	CardlessPending  = "pending"
+	CardlessRedeemed = "redeemed"
+	CardlessExpired  = "expired"
+	// CardlessBlocked is set once the code was entered wrong too often
+	CardlessBlocked = "blocked"
+)
+
+// CardlessWithdrawal is a withdrawal started on the app and collected at an ATM without a card.
+// Until it is redeemed or expires it holds Hold, the amount plus the fee quoted when it was made,
+// so the money can not be spent elsewhere in the meantime.
+type CardlessWithdrawal struct {
+	Id        int64  `json:"id"`
+	Reference string `json:"reference"`
+	AccountNo string `json:"account_no"`
+	Uuid      string `json:"-"`
+	Amount    Money  `json:"amount"`
+	Hold      Money  `json:"hold"`
+	// Code is only known when the withdrawal is made, CodeHash is what is kept of it
+	Code          string     `json:"code,omitempty"`
+	CodeHash      string     `json:"-"`
+	Attempts      int        `json:"-"`
+	Status        string     `json:"status"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	TransactionId int64      `json:"transaction_id,omitempty"`
+	TerminalId    string     `json:"terminal_id,omitempty"`
+	RedeemedAt    *time.Time `json:"redeemed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// IsHolding tells whether w still holds its money at now
+func (w *CardlessWithdrawal) IsHolding(now time.Time) bool {
+	return w.Status == CardlessPending && now.Before(w.ExpiresAt)
+}
+
+// CardlessWithdrawalRequest starts a cardless withdrawal from the account in the path
+type CardlessWithdrawalRequest struct {
+	Amount Money `json:"amount"`
+}
+
+// CardlessRedemption is what a customer keys in at the ATM
+type CardlessRedemption struct {
+	Reference string `json:"reference"`
+	Code      string `json:"code"`
+}
+
+// CardlessPolicy bounds how long a code is good for and how often it may be entered wrong
+type CardlessPolicy struct {
+	TTL         time.Duration
+	MaxAttempts int
+}
+
+type CardlessWithdrawalRepository interface {
+	CreateCardlessWithdrawal(ctx context.Context, w *CardlessWithdrawal) error
+	GetCardlessWithdrawalByReferenceForUpdate(ctx context.Context, reference string) (CardlessWithdrawal, error)
+	UpdateCardlessWithdrawal(ctx context.Context, w *CardlessWithdrawal) error
+	// GetHeldAmount sums the holds of the withdrawals of the account that still hold money at now
+	GetHeldAmount(ctx context.Context, accountNo string, now time.Time) (Money, error)
+	// ExpireCardlessWithdrawals marks the pending withdrawals expired by now, returning how many
+	ExpireCardlessWithdrawals(ctx context.Context, now time.Time) (int64, error)
+}
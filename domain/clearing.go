@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// interbank transfer statuses
+const (
+	InterbankSent     = "sent"
+	InterbankSettled  = "settled"
+	InterbankRejected = "rejected"
+)
+
+// pacs.002 transaction statuses the clearing house reports
+const (
+	PaymentAccepted = "ACSC"
+	PaymentRejected = "RJCT"
+)
+
+// PaymentTimedOut is the ISO 20022 reason a transfer is returned for when the clearing house
+// never reported on it
+const PaymentTimedOut = "AB06"
+
+const (
+	// LedgerClearingAccount holds the money of outgoing interbank transfers until the clearing
+	// house settled or returned them
+	LedgerClearingAccount = "INTERBANK_CLEARING"
+	// LedgerSettlementAccount is the bank's settlement account at the clearing house
+	LedgerSettlementAccount = "INTERBANK_SETTLEMENT"
+)
+
+// InterbankTransfer is the clearing side of an outgoing transfer to another bank. MessageId and
+// EndToEndId are the references of its pacs.008, the status report comes back with them.
+// LastSentAt is when the pacs.008 was last sent, CreditedAt when the receiver was credited if
+// its account is held here.
+type InterbankTransfer struct {
+	Id              int64      `json:"id"`
+	TransactionId   int64      `json:"transaction_id"`
+	MessageId       string     `json:"message_id"`
+	EndToEndId      string     `json:"end_to_end_id"`
+	DebtorAccount   string     `json:"debtor_account"`
+	DebtorBank      string     `json:"debtor_bank"`
+	CreditorAccount string     `json:"creditor_account"`
+	CreditorBank    string     `json:"creditor_bank"`
+	Amount          Money      `json:"amount"`
+	Status          string     `json:"status"`
+	ReasonCode      string     `json:"reason_code,omitempty"`
+	ReasonText      string     `json:"reason_text,omitempty"`
+	SentAt          time.Time  `json:"sent_at"`
+	LastSentAt      time.Time  `json:"last_sent_at"`
+	SettledAt       *time.Time `json:"settled_at,omitempty"`
+	CreditedAt      *time.Time `json:"credited_at,omitempty"`
+}
+
+// ClearingPolicy tells how long to wait for the status report of a transfer. The credit
+// transfer is sent again after ResendAfter without a report, the clearing house answers a
+// duplicate with the report of the original. After ReturnAfter the transfer is given up and the
+// money goes back to the sender. Zero durations turn either off.
+type ClearingPolicy struct {
+	ResendAfter time.Duration
+	ReturnAfter time.Duration
+}
+
+// PaymentStatus is the outcome of one credit transfer as reported by a pacs.002
+type PaymentStatus struct {
+	OriginalMessageId  string
+	OriginalEndToEndId string
+	Status             string
+	// ReasonCode is the ISO 20022 reason of a rejection, e.g. AC01 for a wrong account number
+	ReasonCode string
+	ReasonText string
+}
+
+// ClearingAdapter speaks the message format of the clearing house. Credit transfers go out
+// through the outbox, so they are only sent once the debit that funds them committed.
+type ClearingAdapter interface {
+	// CreditTransfer builds the message asking the clearing house to pay it
+	CreditTransfer(it *InterbankTransfer) (OutboxEvent, error)
+	// StatusTopic is where the clearing house reports back
+	StatusTopic() string
+	// PaymentStatus reads a status report of the clearing house
+	PaymentStatus(message *Message) (PaymentStatus, error)
+}
+
+type InterbankTransferRepository interface {
+	CreateInterbankTransfer(ctx context.Context, it *InterbankTransfer) error
+	GetInterbankTransferByTransactionID(ctx context.Context, tid int64) (InterbankTransfer, error)
+	GetInterbankTransferByEndToEndIDForUpdate(ctx context.Context, endToEndId string) (InterbankTransfer, error)
+	// GetUnreportedInterbankTransfers lists up to limit transfers still waiting for their report
+	// that were last sent before sentBefore, the oldest first
+	GetUnreportedInterbankTransfers(ctx context.Context, sentBefore time.Time, limit int) ([]InterbankTransfer, error)
+	// UpdateInterbankTransfer stores Status, the reason, LastSentAt, SettledAt and CreditedAt of it
+	UpdateInterbankTransfer(ctx context.Context, it *InterbankTransfer) error
+}
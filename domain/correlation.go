@@ -0,0 +1,16 @@
+package domain
+
+import "context"
+
+type correlationKey struct{}
+
+// WithCorrelationID tags ctx with the id that ties together the events of one request or run
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the id set by WithCorrelationID, "" when there is none
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
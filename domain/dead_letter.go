@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// dead letter statuses
+const (
+	DeadLetterPending   = "pending"
+	DeadLetterReplaying = "replaying"
+	DeadLetterReplayed  = "replayed"
+	DeadLetterDiscarded = "discarded"
+)
+
+// DeadLetter is a message that failed every retry, kept from its dead letter topic until it is
+// replayed into Topic or discarded. Partition and Offset locate it in the dead letter topic.
+// Redacted is set when the payload was not kept, e.g. the OTPs of the sms topic.
+type DeadLetter struct {
+	Id                int64             `json:"id"`
+	Topic             string            `json:"topic"`
+	Partition         int32             `json:"partition"`
+	Offset            int64             `json:"offset"`
+	OriginalPartition int32             `json:"original_partition"`
+	OriginalOffset    int64             `json:"original_offset"`
+	Key               string            `json:"key"`
+	Payload           []byte            `json:"payload"`
+	Redacted          bool              `json:"redacted"`
+	Headers           map[string]string `json:"headers"`
+	Error             string            `json:"error"`
+	Attempts          int               `json:"attempts"`
+	Status            string            `json:"status"`
+	FailedAt          time.Time         `json:"failed_at"`
+	ReplayedAt        *time.Time        `json:"replayed_at,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// DeadLetterEdit changes a pending dead letter before it is replayed, nil fields stay as they are
+type DeadLetterEdit struct {
+	Key     *string           `json:"key"`
+	Payload []byte            `json:"payload"`
+	Headers map[string]string `json:"headers"`
+}
+
+type DeadLetterFilter struct {
+	Topic  string
+	Status string
+	Limit  int
+}
+
+// DeadLetterStats is the depth of the dead letters of a topic still waiting for someone, pending
+// or being replayed
+type DeadLetterStats struct {
+	Topic          string     `json:"topic"`
+	Pending        int64      `json:"pending"`
+	OldestFailedAt *time.Time `json:"oldest_failed_at,omitempty"`
+}
+
+type DeadLetterUsecase interface {
+	// StoreDeadLetter is the consumer of the dead letter topics
+	StoreDeadLetter(ctx context.Context, message *Message) error
+	GetDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error)
+	GetDeadLetterByID(ctx context.Context, id int64) (*DeadLetter, error)
+	UpdateDeadLetter(ctx context.Context, id int64, edit DeadLetterEdit) (*DeadLetter, error)
+	ReplayDeadLetter(ctx context.Context, id int64) (*DeadLetter, error)
+	DiscardDeadLetter(ctx context.Context, id int64) (*DeadLetter, error)
+	GetDeadLetterStats(ctx context.Context) ([]DeadLetterStats, error)
+	// WatchDeadLetters publishes the depth of every topic as the dead_letters_pending expvar
+	// gauge every interval until ctx is done
+	WatchDeadLetters(ctx context.Context, interval time.Duration)
+}
+
+type DeadLetterRepository interface {
+	// CreateDeadLetter does nothing for a message it already stored
+	CreateDeadLetter(ctx context.Context, dl *DeadLetter) error
+	GetDeadLetters(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error)
+	GetDeadLetterByID(ctx context.Context, id int64) (DeadLetter, error)
+	GetDeadLetterByIDForUpdate(ctx context.Context, id int64) (DeadLetter, error)
+	UpdateDeadLetter(ctx context.Context, dl *DeadLetter) error
+	GetDeadLetterStats(ctx context.Context) ([]DeadLetterStats, error)
+}
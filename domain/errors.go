@@ -18,9 +18,10 @@ var (
 	// ErrInternalServerError will throw if any the Internal Server Error happen
 	ErrInternalServerError = errors.New("internal Server Error")
 	// ErrNotFound will throw if the requested item is not exists
-	ErrNotFound          = errors.New("Account not found")
-	ErrResipientNotFound = errors.New("Resipient Account not found")
-	ErrAccDeleted        = errors.New("Resipient Account closed")
+	ErrNotFound            = errors.New("Account not found")
+	ErrResipientNotFound   = errors.New("Resipient Account not found")
+	ErrTransactionNotFound = errors.New("Transaction not found")
+	ErrAccDeleted          = errors.New("Resipient Account closed")
 	// ErrConflict will throw if the current action already exists
 	ErrConflict = errors.New("your Item already exist")
 	// ErrBadParamInput will throw if the given request-body or params is not valid
@@ -28,9 +29,113 @@ var (
 	ErrInsufficientBalance             = errors.New("insufficient balance")
 	ErrMinimumDeposit                  = errors.New("minimum for deposit is 100")
 	ErrExceedLimitAmountPerTransaction = errors.New("exceed limit amount per transaction")
+	ErrExceedDailyLimit                = errors.New("exceed limit per day")
 	ErrDuplicateUUID                   = errors.New("User already exists")
 	ErrInvalidPassword                 = errors.New("Invalid password")
 	ErrWrongPassword                   = &Error{Code: 1002, Message: "Wrong password"}
 	ErrUserNotFound                    = &Error{Code: 1001, Message: "User not found"}
 	ErrSetPin                          = errors.New("Can not set pin")
+	ErrUnbalancedJournal               = errors.New("journal debits and credits do not match")
+	ErrLedgerMismatch                  = errors.New("account balance does not match ledger")
+	ErrInvalidMoney                    = errors.New("invalid money amount")
+	ErrMoneyOverflow                   = errors.New("money amount out of range")
+	ErrIdempotencyKeyReused            = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyInProgress           = errors.New("a request with this idempotency key is still in progress")
+	ErrAlreadyReversed                 = errors.New("transaction has already been reversed")
+	ErrInvalidReversal                 = errors.New("transaction can not be reversed by this amount")
+	ErrInvalidStatusTransition         = errors.New("transaction can not move to this status")
+	ErrInvalidFeeRule                  = errors.New("invalid fee rule")
+	ErrFeeRuleNotFound                 = errors.New("Fee rule not found")
+	ErrFeeRuleTransactionType          = errors.New("fee rules only price withdraw and transfer transactions, deposits are free")
+	// ErrLimitExceeded is wrapped by every *LimitError
+	ErrLimitExceeded = errors.New("limit exceeded")
+	ErrInvalidLimit  = errors.New("invalid limit")
+	ErrLimitNotFound = errors.New("Limit not found")
+	// ErrInvalidTimezone will throw if a schedule names an unknown zone or a time offset the zone does not have
+	ErrInvalidTimezone   = errors.New("invalid timezone")
+	ErrInvalidSchedule   = errors.New("invalid schedule")
+	ErrScheduleNotFound  = errors.New("Scheduled transaction not found")
+	ErrScheduleNotActive = errors.New("scheduled transaction is no longer active")
+	// ErrExecutionLeaseLost will throw if another worker took over a scheduled run
+	ErrExecutionLeaseLost = errors.New("scheduled execution lease was lost")
+	ErrDeadLetterNotFound = errors.New("Dead letter not found")
+	// ErrDeadLetterNotPending will throw if a dead letter was already replayed or discarded
+	ErrDeadLetterNotPending = errors.New("dead letter is no longer pending")
+	// ErrDeadLetterRedacted will throw if a dead letter whose payload was not kept is replayed
+	ErrDeadLetterRedacted = errors.New("dead letter payload was redacted, it cannot be replayed")
+	// ErrClearingRejected is recorded on a transfer the clearing house returned
+	ErrClearingRejected          = errors.New("transfer rejected by the receiving bank")
+	ErrInterbankTransferNotFound = errors.New("Interbank transfer not found")
+	ErrInvalidProxy              = errors.New("invalid proxy")
+	ErrProxyNotFound             = errors.New("Proxy not found")
+	// ErrProxyTaken will throw if the proxy is already registered to an account
+	ErrProxyTaken = errors.New("proxy is already registered")
+	// ErrProxyNotVerifiable will throw if a proxy is registered that the bank cannot tie to the user
+	ErrProxyNotVerifiable = errors.New("only phone proxies can be registered")
+	ErrInvalidOtp         = errors.New("Otp is invalid")
+	// ErrInvalidQR will throw if a scanned payload is no Thai QR payment code this bank can pay
+	ErrInvalidQR = errors.New("invalid QR payment code")
+	// ErrQRChecksum will throw if the CRC of a scanned payload does not match, e.g. a misread code
+	ErrQRChecksum = errors.New("QR payment code checksum mismatch")
+	// ErrCardlessNotFound will throw if no cardless withdrawal can be paid out for the reference
+	ErrCardlessNotFound    = errors.New("Cardless withdrawal not found")
+	ErrInvalidCardlessCode = errors.New("invalid cardless withdrawal code")
+	ErrInvalidTerminal     = errors.New("invalid terminal")
+	// ErrWrongPin will throw if the PIN keyed in at a terminal is not the one of the account holder
+	ErrWrongPin            = errors.New("Pin is incorrect")
+	ErrTerminalNotFound    = errors.New("Terminal not found")
+	ErrTerminalUnavailable = errors.New("terminal is not in service")
+	// ErrCannotDispense will throw if the cassettes of the terminal can not make up the amount
+	ErrCannotDispense = errors.New("amount can not be dispensed by this terminal")
+	// ErrInvalidCashOperation will throw if notes counted, loaded, taken out or deposited do not add up
+	ErrInvalidCashOperation = errors.New("invalid cash operation")
 )
+
+// errorCodes are stored with failed transactions, so a code must never be reused for another error.
+// 2011 was the currency mismatch of Money, every amount is in baht.
+var errorCodes = map[error]int{
+	ErrInternalServerError:             1000,
+	ErrNotFound:                        2001,
+	ErrResipientNotFound:               2002,
+	ErrAccDeleted:                      2003,
+	ErrBadParamInput:                   2004,
+	ErrInsufficientBalance:             2005,
+	ErrMinimumDeposit:                  2006,
+	ErrExceedLimitAmountPerTransaction: 2007,
+	ErrExceedDailyLimit:                2008,
+	ErrInvalidMoney:                    2009,
+	ErrMoneyOverflow:                   2010,
+	ErrLimitExceeded:                   2012,
+	ErrUnbalancedJournal:               3001,
+	ErrLedgerMismatch:                  3002,
+	ErrClearingRejected:                4001,
+	ErrTerminalUnavailable:             5001,
+	ErrCannotDispense:                  5002,
+	ErrTerminalNotFound:                5003,
+	ErrInvalidCashOperation:            5004,
+}
+
+// ErrorCode gives the failure code and reason recorded for err. Errors without a code of their
+// own are reported as internal errors so that driver messages do not end up in the record.
+func ErrorCode(err error) (int, string) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code, e.Message
+	}
+
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		if legacy := limitErr.legacyError(); legacy != nil {
+			return errorCodes[legacy], limitErr.Error()
+		}
+		return errorCodes[ErrLimitExceeded], limitErr.Error()
+	}
+
+	for known, code := range errorCodes {
+		if errors.Is(err, known) {
+			return code, known.Error()
+		}
+	}
+
+	return errorCodes[ErrInternalServerError], ErrInternalServerError.Error()
+}
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// headers added to a message that failed, the original ones are kept
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderAttempts          = "x-attempts"
+	HeaderError             = "x-error"
+	HeaderFailedAt          = "x-failed-at"
+	HeaderRetryAt           = "x-retry-at"
+	// HeaderReplayedFrom is set on a dead letter sent back to its topic, with the id it was kept under
+	HeaderReplayedFrom = "x-replayed-from"
+)
+
+// Message is a message delivered by an EventBus. Partition and Offset locate it in its topic.
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       string
+	Headers   map[string]string
+	Value     []byte
+	Timestamp time.Time
+}
+
+// MessageHandler processes one message, see EventBus.Subscribe for what happens when it fails
+type MessageHandler func(ctx context.Context, message *Message) error
+
+// EventBus publishes messages and delivers them to the handlers of the service, as one consumer
+// group: every message is handled once by the group, in order within its partition, and only
+// counts as consumed once its handler succeeded.
+type EventBus interface {
+	EventPublisher
+	// Subscribe handles topic. A message that fails moves through the retry topics of topic and
+	// then to its dead letter topic, straight away when the error is Permanent.
+	Subscribe(topic string, handler MessageHandler)
+	// SubscribeDeadLetters handles the dead letter topic of topic, failures are retried in place
+	SubscribeDeadLetters(topic string, handler MessageHandler)
+	// Run delivers until ctx is done. Handlers get a context that ends with ctx, a message they
+	// did not finish by then is delivered again. All subscriptions must be made before.
+	Run(ctx context.Context) error
+	// Close flushes what was published, once Run returned
+	Close()
+}
+
+// RetryTopic names the topic of the nth retry of topic's messages, counting from 1
+func RetryTopic(topic string, n int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, n)
+}
+
+// DeadLetterTopic names the topic where topic's messages end up once the retries are used up
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as one no retry can fix, the message goes straight to the dead letter topic
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent tells whether err was marked by Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
@@ -1,7 +1,9 @@
 package domain
 
-import "context"
+import (
+	"context"
+)
 
 type ExternalUsecase interface {
-	SendSms(ctx context.Context)
+	SendSms(ctx context.Context, message *Message) error
 }
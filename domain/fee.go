@@ -0,0 +1,212 @@
+package domain
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+const (
+	// FeeFlat charges FlatFee
+	FeeFlat = "flat"
+	// FeePercentage charges RateBps basis points of the amount
+	FeePercentage = "percentage"
+	// FeeCapped charges a percentage kept between MinFee and MaxFee
+	FeeCapped = "capped"
+	// FeeFreeQuota charges nothing for the first FreeQuota transactions of the month, FlatFee after
+	FeeFreeQuota = "free_quota"
+
+	FeeSameBank  = "same"
+	FeeOtherBank = "other"
+
+	// ChannelATM is everything coming in through the /transaction endpoints
+	ChannelATM       = "atm"
+	ChannelScheduled = "scheduled"
+	// ChannelCardless is a withdrawal paid out at an ATM against a cardless withdrawal code
+	ChannelCardless = "cardless"
+	// ChannelClearing is booked on a report of the clearing house
+	ChannelClearing = "clearing"
+
+	SegmentRetail = "retail"
+)
+
+// FeeRule prices one kind of transaction. Rules are never edited: a change is a new Version
+// of the same RuleKey, and the previous version stops being effective when it starts.
+// Empty match fields match anything.
+type FeeRule struct {
+	Id              int64      `json:"id"`
+	RuleKey         string     `json:"rule_key"`
+	Version         int        `json:"version"`
+	TransactionType string     `json:"transaction_type"`
+	Channel         string     `json:"channel,omitempty"`
+	SourceBank      string     `json:"source_bank,omitempty"`
+	DestinationBank string     `json:"destination_bank,omitempty"`
+	BankRelation    string     `json:"bank_relation,omitempty"`
+	Segment         string     `json:"segment,omitempty"`
+	MinAmount       *Money     `json:"min_amount,omitempty"`
+	MaxAmount       *Money     `json:"max_amount,omitempty"`
+	FeeType         string     `json:"fee_type"`
+	FlatFee         Money      `json:"flat_fee"`
+	RateBps         int64      `json:"rate_bps"`
+	MinFee          Money      `json:"min_fee"`
+	MaxFee          Money      `json:"max_fee"`
+	FreeQuota       int64      `json:"free_quota"`
+	Priority        int        `json:"priority"`
+	EffectiveFrom   time.Time  `json:"effective_from"`
+	EffectiveTo     *time.Time `json:"effective_to,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// FeeContext is what a rule is matched against
+type FeeContext struct {
+	TransactionType string
+	Channel         string
+	Amount          Money
+	SourceBank      string
+	DestinationBank string
+	Segment         string
+}
+
+// Validate checks the rule can be applied; it does not look at other versions. Deposits are out
+// of scope: they are never charged, so a deposit rule would never be looked up.
+func (r *FeeRule) Validate() error {
+	if r.RuleKey == "" {
+		return ErrInvalidFeeRule
+	}
+
+	if r.TransactionType != "withdraw" && r.TransactionType != "transfer" {
+		return ErrFeeRuleTransactionType
+	}
+
+	if r.BankRelation != "" && r.BankRelation != FeeSameBank && r.BankRelation != FeeOtherBank {
+		return ErrInvalidFeeRule
+	}
+
+	if r.MinAmount != nil && r.MaxAmount != nil {
+		if r.MinAmount.Cmp(*r.MaxAmount) >= 0 {
+			return ErrInvalidFeeRule
+		}
+	}
+
+	if r.FlatFee.IsNegative() || r.MinFee.IsNegative() || r.MaxFee.IsNegative() || r.RateBps < 0 {
+		return ErrInvalidFeeRule
+	}
+
+	switch r.FeeType {
+	case FeeFlat, FeePercentage:
+	case FeeCapped:
+		if r.MinFee.Cmp(r.MaxFee) > 0 {
+			return ErrInvalidFeeRule
+		}
+	case FeeFreeQuota:
+		if r.FreeQuota <= 0 {
+			return ErrInvalidFeeRule
+		}
+	default:
+		return ErrInvalidFeeRule
+	}
+
+	return nil
+}
+
+// Matches tells whether the rule prices fc. It returns how many criteria were matched so
+// that among rules of the same priority the most specific one wins.
+func (r *FeeRule) Matches(fc FeeContext) (bool, int) {
+	if r.TransactionType != fc.TransactionType {
+		return false, 0
+	}
+
+	specificity := 0
+	for _, c := range [][2]string{
+		{r.Channel, fc.Channel},
+		{r.SourceBank, fc.SourceBank},
+		{r.DestinationBank, fc.DestinationBank},
+		{r.Segment, fc.Segment},
+	} {
+		if c[0] == "" {
+			continue
+		}
+		if c[0] != c[1] {
+			return false, 0
+		}
+		specificity++
+	}
+
+	if r.BankRelation != "" {
+		sameBank := fc.SourceBank == fc.DestinationBank
+		if sameBank != (r.BankRelation == FeeSameBank) {
+			return false, 0
+		}
+		specificity++
+	}
+
+	if r.MinAmount != nil {
+		if fc.Amount.Cmp(*r.MinAmount) < 0 {
+			return false, 0
+		}
+		specificity++
+	}
+
+	if r.MaxAmount != nil {
+		if fc.Amount.Cmp(*r.MaxAmount) >= 0 {
+			return false, 0
+		}
+		specificity++
+	}
+
+	return true, specificity
+}
+
+// Calculate prices amount. used is how many transactions the free quota has already covered
+// this month.
+func (r *FeeRule) Calculate(amount Money, used int64) (Money, error) {
+	switch r.FeeType {
+	case FeeFlat:
+		return r.FlatFee, nil
+	case FeePercentage:
+		return percentageOf(amount, r.RateBps)
+	case FeeCapped:
+		fee, err := percentageOf(amount, r.RateBps)
+		if err != nil {
+			return Money{}, err
+		}
+		if fee.Cmp(r.MinFee) < 0 {
+			return r.MinFee, nil
+		}
+		if fee.Cmp(r.MaxFee) > 0 {
+			return r.MaxFee, nil
+		}
+		return fee, nil
+	case FeeFreeQuota:
+		if used < r.FreeQuota {
+			return Money{}, nil
+		}
+		return r.FlatFee, nil
+	default:
+		return Money{}, ErrInvalidFeeRule
+	}
+}
+
+// percentageOf rounds half up to the satang
+func percentageOf(amount Money, bps int64) (Money, error) {
+	if bps != 0 && amount.Satang > (math.MaxInt64-5000)/bps {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Satang: (amount.Satang*bps + 5000) / 10000}, nil
+}
+
+type FeeUsecase interface {
+	ApplyFee(ctx context.Context, tr *Transaction, acc *Account, receiver *Account) error
+	GetRules(ctx context.Context, at time.Time) ([]FeeRule, error)
+	GetRuleVersions(ctx context.Context, rule_key string) ([]FeeRule, error)
+	CreateRule(ctx context.Context, rule *FeeRule) error
+	ExpireRule(ctx context.Context, rule_key string, at time.Time) error
+}
+
+type FeeRepository interface {
+	GetRulesEffectiveAt(ctx context.Context, transactionType string, at time.Time) ([]FeeRule, error)
+	GetRuleVersions(ctx context.Context, rule_key string) ([]FeeRule, error)
+	GetLatestRuleForUpdate(ctx context.Context, rule_key string) (*FeeRule, error)
+	CreateRule(ctx context.Context, rule *FeeRule) error
+	SetRuleEffectiveTo(ctx context.Context, id int64, to time.Time) error
+}
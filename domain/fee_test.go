@@ -0,0 +1,81 @@
+package domain
+
+import "testing"
+
+func TestFeeRuleValidate(t *testing.T) {
+	valid := FeeRule{RuleKey: "atm-withdraw", TransactionType: "withdraw", FeeType: FeeFlat, FlatFee: NewMoney(1000)}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid rule: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(r *FeeRule)
+		want   error
+	}{
+		{"deposit", func(r *FeeRule) { r.TransactionType = "deposit" }, ErrFeeRuleTransactionType},
+		{"no key", func(r *FeeRule) { r.RuleKey = "" }, ErrInvalidFeeRule},
+		{"unknown fee type", func(r *FeeRule) { r.FeeType = "tiered" }, ErrInvalidFeeRule},
+		{"negative fee", func(r *FeeRule) { r.FlatFee = NewMoney(-1) }, ErrInvalidFeeRule},
+		{"bank relation", func(r *FeeRule) { r.BankRelation = "foreign" }, ErrInvalidFeeRule},
+		{"min over max fee", func(r *FeeRule) { r.FeeType, r.MinFee, r.MaxFee = FeeCapped, NewMoney(500), NewMoney(100) }, ErrInvalidFeeRule},
+		{"empty quota", func(r *FeeRule) { r.FeeType = FeeFreeQuota }, ErrInvalidFeeRule},
+	}
+
+	for _, tt := range tests {
+		rule := valid
+		tt.change(&rule)
+		if err := rule.Validate(); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestFeeRuleCalculate(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   FeeRule
+		amount int64
+		used   int64
+		want   int64
+	}{
+		{"flat", FeeRule{FeeType: FeeFlat, FlatFee: NewMoney(1000)}, 500000, 0, 1000},
+		{"percentage rounds half up", FeeRule{FeeType: FeePercentage, RateBps: 25}, 1000200, 0, 2501},
+		{"capped at the minimum", FeeRule{FeeType: FeeCapped, RateBps: 10, MinFee: NewMoney(500), MaxFee: NewMoney(5000)}, 10000, 0, 500},
+		{"capped at the maximum", FeeRule{FeeType: FeeCapped, RateBps: 10, MinFee: NewMoney(500), MaxFee: NewMoney(5000)}, 100000000, 0, 5000},
+		{"inside the free quota", FeeRule{FeeType: FeeFreeQuota, FreeQuota: 4, FlatFee: NewMoney(1000)}, 10000, 3, 0},
+		{"past the free quota", FeeRule{FeeType: FeeFreeQuota, FreeQuota: 4, FlatFee: NewMoney(1000)}, 10000, 4, 1000},
+	}
+
+	for _, tt := range tests {
+		fee, err := tt.rule.Calculate(NewMoney(tt.amount), tt.used)
+		if err != nil || fee.Satang != tt.want {
+			t.Errorf("%s: got %d, %v, want %d", tt.name, fee.Satang, err, tt.want)
+		}
+	}
+}
+
+func TestFeeRuleMatches(t *testing.T) {
+	fc := FeeContext{TransactionType: "transfer", Channel: ChannelATM, Amount: NewMoney(100000), SourceBank: "KBANK", DestinationBank: "SCB"}
+
+	otherBank := FeeRule{TransactionType: "transfer", BankRelation: FeeOtherBank}
+	if ok, specificity := otherBank.Matches(fc); !ok || specificity != 1 {
+		t.Errorf("other bank rule: %v, %d", ok, specificity)
+	}
+
+	sameBank := FeeRule{TransactionType: "transfer", BankRelation: FeeSameBank}
+	if ok, _ := sameBank.Matches(fc); ok {
+		t.Error("same bank rule matched a transfer to another bank")
+	}
+
+	max := NewMoney(100000)
+	belowMax := FeeRule{TransactionType: "transfer", MaxAmount: &max}
+	if ok, _ := belowMax.Matches(fc); ok {
+		t.Error("MaxAmount is exclusive but matched the amount itself")
+	}
+
+	withdraw := FeeRule{TransactionType: "withdraw"}
+	if ok, _ := withdraw.Matches(fc); ok {
+		t.Error("withdraw rule matched a transfer")
+	}
+}
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an Idempotency-Key
+type IdempotencyRecord struct {
+	Key         string    `json:"key"`
+	Scope       string    `json:"scope"`
+	RequestHash string    `json:"request_hash"`
+	Completed   bool      `json:"completed"`
+	StatusCode  int       `json:"status_code"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type IdempotencyUsecase interface {
+	// Begin reserves the key for this request. It returns the stored record when the
+	// request is a replay of a completed one, and nil when the request should run.
+	Begin(ctx context.Context, scope string, key string, requestHash string) (*IdempotencyRecord, error)
+	Complete(ctx context.Context, scope string, key string, requestHash string, statusCode int, body []byte) error
+	Release(ctx context.Context, scope string, key string) error
+}
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, record *IdempotencyRecord, ttl time.Duration) (reserved bool, err error)
+	Get(ctx context.Context, scope string, key string) (*IdempotencyRecord, error)
+	Save(ctx context.Context, record *IdempotencyRecord, ttl time.Duration) error
+	Delete(ctx context.Context, scope string, key string) error
+}
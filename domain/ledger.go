@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	LedgerDebit  = "debit"
+	LedgerCredit = "credit"
+
+	// LedgerCashAccount is the bank's own cash held in ATMs and branches
+	LedgerCashAccount = "ATM_CASH"
+	// LedgerFeeIncomeAccount collects the fees charged on transactions
+	LedgerFeeIncomeAccount = "FEE_INCOME"
+	// LedgerOpeningAccount is the other side of the entries that open the ledger of an account at
+	// its balance, see migrations/002_ledger_opening_balances.sql
+	LedgerOpeningAccount = "OPENING_BALANCE"
+)
+
+// LedgerEntry is one leg of a balanced journal. Customer accounts are liabilities,
+// so a credit increases their balance and a debit decreases it.
+type LedgerEntry struct {
+	Id            int64     `json:"id"`
+	TransactionId int64     `json:"transaction_id"`
+	AccountNo     string    `json:"account_no"`
+	Direction     string    `json:"direction"`
+	Amount        Money     `json:"amount"`
+	BalanceAfter  *Money    `json:"balance_after,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type LedgerUsecase interface {
+	PostTransaction(ctx context.Context, tr *Transaction) error
+	// PostSettlement moves an interbank transfer the clearing house settled out of the clearing account
+	PostSettlement(ctx context.Context, tr *Transaction) error
+	// PostInterbankCredit pays an interbank transfer from the settlement account to its receiver,
+	// receiver holding the new balance
+	PostInterbankCredit(ctx context.Context, it *InterbankTransfer, receiver *Account) error
+	// GetLedgerByAccountNo lists the entries of an account of the user uuid
+	GetLedgerByAccountNo(ctx context.Context, uuid string, account_no string, cursor string, num int64) ([]LedgerEntry, string, error)
+}
+
+type LedgerRepository interface {
+	CreateEntries(ctx context.Context, entries []LedgerEntry) error
+	GetEntriesByAccountNo(ctx context.Context, account_no string, cursor string, num int64) (res []LedgerEntry, nextCursor string, err error)
+	GetLastEntryByAccountNo(ctx context.Context, account_no string) (*LedgerEntry, error)
+}
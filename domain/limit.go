@@ -0,0 +1,209 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// LimitPerTransaction caps the amount of a single transaction
+	LimitPerTransaction = "per_transaction"
+	// LimitMinAmount is the smallest amount accepted, e.g. the minimum deposit
+	LimitMinAmount = "min_amount"
+	// LimitDaily and LimitMonthly cap the sum of amounts in the current calendar day or month
+	LimitDaily   = "daily"
+	LimitMonthly = "monthly"
+	// LimitHourlyCount and LimitDailyCount cap how many transactions are made in the last hour
+	// or the current calendar day
+	LimitHourlyCount = "hourly_count"
+	LimitDailyCount  = "daily_count"
+
+	LimitScopeDefault = "default"
+	// LimitScopeProduct applies to every account of a segment, see Account.Segment
+	LimitScopeProduct = "product"
+	LimitScopeAccount = "account"
+)
+
+// limitScopeRank orders the levels, a more specific level overrides the ones below it
+var limitScopeRank = map[string]int{
+	LimitScopeDefault: 0,
+	LimitScopeProduct: 1,
+	LimitScopeAccount: 2,
+}
+
+// Limit is one limit of one transaction type at one level. ScopeRef is the segment for product
+// limits, the account number for account limits and empty for defaults.
+type Limit struct {
+	Id              int64     `json:"id"`
+	Scope           string    `json:"scope"`
+	ScopeRef        string    `json:"scope_ref,omitempty"`
+	TransactionType string    `json:"transaction_type"`
+	Kind            string    `json:"kind"`
+	Amount          *Money    `json:"amount,omitempty"`
+	Count           int64     `json:"count,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// LimitError says which limit a transaction hit and how much room was left under it
+type LimitError struct {
+	TransactionType string `json:"transaction_type"`
+	Kind            string `json:"kind"`
+	Scope           string `json:"scope"`
+	Limit           *Money `json:"limit,omitempty"`
+	Used            *Money `json:"used,omitempty"`
+	Remaining       *Money `json:"remaining,omitempty"`
+	LimitCount      int64  `json:"limit_count,omitempty"`
+	UsedCount       int64  `json:"used_count,omitempty"`
+}
+
+func (e *LimitError) Error() string {
+	switch {
+	case e.Kind == LimitMinAmount:
+		return fmt.Sprintf("%s amount is below the minimum of %s", e.TransactionType, e.Limit)
+	case e.Limit == nil:
+		return fmt.Sprintf("%s %s limit exceeded: %d used of %d", e.TransactionType, e.Kind, e.UsedCount, e.LimitCount)
+	case e.Used == nil:
+		return fmt.Sprintf("%s %s limit exceeded: limit %s", e.TransactionType, e.Kind, e.Limit)
+	default:
+		return fmt.Sprintf("%s %s limit exceeded: limit %s, used %s, remaining %s", e.TransactionType, e.Kind, e.Limit, e.Used, e.Remaining)
+	}
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Is matches the error the same limit was reported with before limits were configurable, so
+// callers checking for those keep working
+func (e *LimitError) Is(target error) bool {
+	legacy := e.legacyError()
+	return legacy != nil && target == legacy
+}
+
+func (e *LimitError) legacyError() error {
+	switch {
+	case e.TransactionType == "deposit" && e.Kind == LimitMinAmount:
+		return ErrMinimumDeposit
+	case e.TransactionType == "transfer" && e.Kind == LimitPerTransaction:
+		return ErrExceedLimitAmountPerTransaction
+	case e.TransactionType == "transfer" && e.Kind == LimitDaily:
+		return ErrExceedDailyLimit
+	}
+	return nil
+}
+
+func (l *Limit) isCountLimit() bool {
+	return l.Kind == LimitHourlyCount || l.Kind == LimitDailyCount
+}
+
+// Validate checks the limit on its own
+func (l *Limit) Validate() error {
+	if _, ok := limitScopeRank[l.Scope]; !ok || (l.Scope == LimitScopeDefault) != (l.ScopeRef == "") {
+		return ErrInvalidLimit
+	}
+
+	switch l.TransactionType {
+	case "withdraw", "deposit", "transfer":
+	default:
+		return ErrInvalidLimit
+	}
+
+	switch l.Kind {
+	case LimitPerTransaction, LimitMinAmount, LimitDaily, LimitMonthly:
+		if l.Amount == nil || !l.Amount.IsPositive() || l.Count != 0 {
+			return ErrInvalidLimit
+		}
+	case LimitHourlyCount, LimitDailyCount:
+		if l.Count <= 0 || l.Amount != nil {
+			return ErrInvalidLimit
+		}
+	default:
+		return ErrInvalidLimit
+	}
+
+	return nil
+}
+
+// Overrides tells whether l is more specific than other
+func (l *Limit) Overrides(other Limit) bool {
+	return limitScopeRank[l.Scope] > limitScopeRank[other.Scope]
+}
+
+// Window returns where the usage counted against the limit starts, and false for limits that
+// only look at the transaction itself
+func (l *Limit) Window(now time.Time) (time.Time, bool) {
+	switch l.Kind {
+	case LimitDaily, LimitDailyCount:
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), true
+	case LimitMonthly:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), true
+	case LimitHourlyCount:
+		return now.Add(-time.Hour), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// Check returns a *LimitError when amount does not fit given what was already used in the window
+func (l *Limit) Check(amount Money, used TransactionUsage) error {
+	limitErr := &LimitError{TransactionType: l.TransactionType, Kind: l.Kind, Scope: l.Scope}
+
+	if l.isCountLimit() {
+		if used.Count < l.Count {
+			return nil
+		}
+		limitErr.LimitCount, limitErr.UsedCount = l.Count, used.Count
+		return limitErr
+	}
+
+	limitErr.Limit = l.Amount
+
+	switch l.Kind {
+	case LimitMinAmount:
+		if amount.Cmp(*l.Amount) >= 0 {
+			return nil
+		}
+		return limitErr
+	case LimitPerTransaction:
+		if amount.Cmp(*l.Amount) <= 0 {
+			return nil
+		}
+		return limitErr
+	}
+
+	total, err := used.Amount.Add(amount)
+	if err != nil {
+		return err
+	}
+
+	if total.Cmp(*l.Amount) <= 0 {
+		return nil
+	}
+
+	remaining, err := l.Amount.Sub(used.Amount)
+	if err != nil {
+		return err
+	}
+	if remaining.IsNegative() {
+		remaining = NewMoney(0)
+	}
+
+	limitErr.Used, limitErr.Remaining = &used.Amount, &remaining
+	return limitErr
+}
+
+type LimitUsecase interface {
+	CheckLimits(ctx context.Context, tr *Transaction, acc *Account) error
+	GetEffectiveLimits(ctx context.Context, account_no string) ([]Limit, error)
+	GetLimits(ctx context.Context, scope string, scope_ref string) ([]Limit, error)
+	SaveLimit(ctx context.Context, limit *Limit) error
+	DeleteLimit(ctx context.Context, id int64) error
+}
+
+type LimitRepository interface {
+	GetApplicableLimits(ctx context.Context, transactionType string, segment string, account_no string) ([]Limit, error)
+	GetLimits(ctx context.Context, scope string, scope_ref string) ([]Limit, error)
+	UpsertLimit(ctx context.Context, limit *Limit) error
+	DeleteLimit(ctx context.Context, id int64) error
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLimitErrorKeepsLegacyErrors(t *testing.T) {
+	tests := []struct {
+		transactionType, kind string
+		legacy                error
+		code                  int
+	}{
+		{"deposit", LimitMinAmount, ErrMinimumDeposit, 2006},
+		{"transfer", LimitPerTransaction, ErrExceedLimitAmountPerTransaction, 2007},
+		{"transfer", LimitDaily, ErrExceedDailyLimit, 2008},
+		{"withdraw", LimitDaily, nil, 2012},
+	}
+
+	for _, tt := range tests {
+		var err error = &LimitError{TransactionType: tt.transactionType, Kind: tt.kind}
+
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s %s is not ErrLimitExceeded", tt.transactionType, tt.kind)
+		}
+		if tt.legacy != nil && !errors.Is(err, tt.legacy) {
+			t.Errorf("%s %s is not %v", tt.transactionType, tt.kind, tt.legacy)
+		}
+		if code, _ := ErrorCode(err); code != tt.code {
+			t.Errorf("%s %s has code %d, want %d", tt.transactionType, tt.kind, code, tt.code)
+		}
+	}
+
+	if errors.Is(&LimitError{TransactionType: "withdraw", Kind: LimitDaily}, ErrExceedDailyLimit) {
+		t.Error("a withdraw limit matched the transfer daily limit error")
+	}
+}
+
+func TestLimitCheck(t *testing.T) {
+	amount := func(satang int64) *Money {
+		m := NewMoney(satang)
+		return &m
+	}
+
+	daily := Limit{TransactionType: "transfer", Kind: LimitDaily, Amount: amount(50000)}
+	if err := daily.Check(NewMoney(20000), TransactionUsage{Amount: NewMoney(30000)}); err != nil {
+		t.Errorf("filling the daily limit exactly: %v", err)
+	}
+
+	err := daily.Check(NewMoney(20001), TransactionUsage{Amount: NewMoney(30000)})
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Remaining.Satang != 20000 {
+		t.Errorf("going over the daily limit: %v", err)
+	}
+
+	minimum := Limit{TransactionType: "deposit", Kind: LimitMinAmount, Amount: amount(10000)}
+	if err := minimum.Check(NewMoney(9999), TransactionUsage{}); !errors.Is(err, ErrMinimumDeposit) {
+		t.Errorf("deposit under the minimum: %v", err)
+	}
+
+	hourly := Limit{TransactionType: "withdraw", Kind: LimitHourlyCount, Count: 3}
+	if err := hourly.Check(NewMoney(1), TransactionUsage{Count: 3}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("fourth withdrawal in an hour: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of every amount. Accounts, the ledger and the clearing house
+// only hold baht, amounts in other currencies are refused where they come in, e.g. Thai QR codes.
+const DefaultCurrency = "THB"
+
+// Money is an amount of satang. The zero value is zero baht.
+type Money struct {
+	Satang int64
+}
+
+// NewMoney returns an amount of satang
+func NewMoney(satang int64) Money {
+	return Money{Satang: satang}
+}
+
+// ParseMoney parses a decimal string such as "100", "-12.5" or "1000.25" without going through float64
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Money{}, ErrInvalidMoney
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	if s == "" || s == "." {
+		return Money{}, ErrInvalidMoney
+	}
+
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+
+	// extra decimals are only accepted when they do not carry value, e.g. "1.500"
+	if len(fraction) > 2 {
+		if strings.Trim(fraction[2:], "0") != "" {
+			return Money{}, ErrInvalidMoney
+		}
+		fraction = fraction[:2]
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	if whole == "" {
+		whole = "0"
+	}
+	if !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, ErrInvalidMoney
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	cents, _ := strconv.ParseInt(fraction, 10, 64)
+	if err != nil || units > (math.MaxInt64-cents)/100 {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	satang := units*100 + cents
+	if negative {
+		satang = -satang
+	}
+
+	return NewMoney(satang), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Add returns m + o, failing on overflow
+func (m Money) Add(o Money) (Money, error) {
+	sum := m.Satang + o.Satang
+	if (o.Satang > 0 && sum < m.Satang) || (o.Satang < 0 && sum > m.Satang) {
+		return Money{}, ErrMoneyOverflow
+	}
+
+	return Money{Satang: sum}, nil
+}
+
+// Sub returns m - o, failing on overflow
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Satang == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return m.Add(Money{Satang: -o.Satang})
+}
+
+// Cmp returns -1, 0 or 1 when m is less than, equal to or greater than o
+func (m Money) Cmp(o Money) int {
+	switch {
+	case m.Satang < o.Satang:
+		return -1
+	case m.Satang > o.Satang:
+		return 1
+	}
+	return 0
+}
+
+// Abs returns the amount without its sign
+func (m Money) Abs() Money {
+	if m.Satang < 0 {
+		return Money{Satang: -m.Satang}
+	}
+	return m
+}
+
+// Neg returns the amount with its sign flipped
+func (m Money) Neg() Money {
+	return Money{Satang: -m.Satang}
+}
+
+func (m Money) IsZero() bool {
+	return m.Satang == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Satang > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Satang < 0
+}
+
+// String formats the amount as a decimal string with two places, e.g. "-12.50"
+func (m Money) String() string {
+	sign := ""
+	satang := m.Satang
+	if satang < 0 {
+		sign = "-"
+	}
+
+	units := satang / 100
+	cents := satang % 100
+	if units < 0 {
+		units = -units
+	}
+	if cents < 0 {
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, units, cents)
+}
+
+// MarshalJSON encodes the amount as a decimal string so clients never see a float
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts both decimal strings and JSON numbers
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if text == "null" {
+		*m = Money{}
+		return nil
+	}
+
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL columns. A value with more satang than an int64 holds,
+// which a DECIMAL(20, 2) column can, fails with ErrMoneyOverflow.
+func (m *Money) Scan(value interface{}) (err error) {
+	switch v := value.(type) {
+	case nil:
+		*m = NewMoney(0)
+	case []byte:
+		*m, err = ParseMoney(string(v))
+	case string:
+		*m, err = ParseMoney(v)
+	case float64:
+		satang := math.Round(v * 100)
+		if math.IsNaN(satang) || satang >= math.MaxInt64 || satang < math.MinInt64 {
+			return ErrMoneyOverflow
+		}
+		*m = NewMoney(int64(satang))
+	case int64:
+		if v > math.MaxInt64/100 || v < math.MinInt64/100 {
+			return ErrMoneyOverflow
+		}
+		*m = NewMoney(v * 100)
+	default:
+		return fmt.Errorf("can not scan %T into Money", value)
+	}
+	return err
+}
+
+// Value implements driver.Valuer, storing the amount as a decimal string
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
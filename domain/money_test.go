@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in     string
+		satang int64
+		err    error
+	}{
+		{"100", 10000, nil},
+		{"-12.5", -1250, nil},
+		{"+1000.25", 100025, nil},
+		{" 0.01 ", 1, nil},
+		{".5", 50, nil},
+		{"7.", 700, nil},
+		{"1.500", 150, nil},
+		{"0.1 ", 10, nil},
+		{"92233720368547758.07", math.MaxInt64, nil},
+		{"1.001", 0, ErrInvalidMoney},
+		{"", 0, ErrInvalidMoney},
+		{"-", 0, ErrInvalidMoney},
+		{".", 0, ErrInvalidMoney},
+		{"1e3", 0, ErrInvalidMoney},
+		{"1,000", 0, ErrInvalidMoney},
+		{"--1", 0, ErrInvalidMoney},
+		{"1.-5", 0, ErrInvalidMoney},
+		{"92233720368547758.08", 0, ErrMoneyOverflow},
+		{"92233720368547759", 0, ErrMoneyOverflow},
+		{"99999999999999999999", 0, ErrMoneyOverflow},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseMoney(tt.in)
+		if err != tt.err {
+			t.Errorf("ParseMoney(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && m.Satang != tt.satang {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, m.Satang, tt.satang)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		satang int64
+		want   string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{-1, "-0.01"},
+		{-1250, "-12.50"},
+		{100025, "1000.25"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{-math.MaxInt64, "-92233720368547758.07"},
+	}
+
+	for _, tt := range tests {
+		if got := NewMoney(tt.satang).String(); got != tt.want {
+			t.Errorf("NewMoney(%d).String() = %q, want %q", tt.satang, got, tt.want)
+		}
+
+		back, err := ParseMoney(tt.want)
+		if err != nil || back.Satang != tt.satang {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.want, back.Satang, err, tt.satang)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	max := NewMoney(math.MaxInt64)
+	min := NewMoney(math.MinInt64)
+
+	if _, err := max.Add(NewMoney(1)); err != ErrMoneyOverflow {
+		t.Errorf("MaxInt64 + 1: got %v, want ErrMoneyOverflow", err)
+	}
+	if _, err := min.Add(NewMoney(-1)); err != ErrMoneyOverflow {
+		t.Errorf("MinInt64 - 1: got %v, want ErrMoneyOverflow", err)
+	}
+	if _, err := NewMoney(0).Sub(min); err != ErrMoneyOverflow {
+		t.Errorf("0 - MinInt64: got %v, want ErrMoneyOverflow", err)
+	}
+	if _, err := min.Sub(NewMoney(1)); err != ErrMoneyOverflow {
+		t.Errorf("MinInt64 - 1: got %v, want ErrMoneyOverflow", err)
+	}
+
+	sum, err := NewMoney(150).Add(Money{Satang: 250})
+	if err != nil || sum.Satang != 400 {
+		t.Errorf("1.50 + 2.50 = %+v, %v, want 4.00", sum, err)
+	}
+
+	diff, err := NewMoney(150).Sub(NewMoney(250))
+	if err != nil || diff.Satang != -100 {
+		t.Errorf("1.50 - 2.50 = %+v, %v, want -1.00", diff, err)
+	}
+}
+
+func TestMoneyCmp(t *testing.T) {
+	if c := NewMoney(100).Cmp(NewMoney(250)); c != -1 {
+		t.Errorf("1.00 vs 2.50 = %d, want -1", c)
+	}
+	if c := NewMoney(-100).Cmp(NewMoney(-250)); c != 1 {
+		t.Errorf("-1.00 vs -2.50 = %d, want 1", c)
+	}
+	if c := NewMoney(100).Cmp(Money{Satang: 100}); c != 0 {
+		t.Errorf("1.00 vs 1.00 = %d, want 0", c)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := json.Marshal(struct{ Amount Money }{NewMoney(-1250)})
+	if err != nil || string(b) != `{"Amount":"-12.50"}` {
+		t.Errorf("Marshal = %s, %v", b, err)
+	}
+
+	for in, want := range map[string]int64{`"12.50"`: 1250, `12.5`: 1250, `100`: 10000, `null`: 0} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err != nil || m.Satang != want {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d", in, m.Satang, err, want)
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`"1.001"`), &m); err != ErrInvalidMoney {
+		t.Errorf("Unmarshal(1.001) error = %v, want ErrInvalidMoney", err)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want int64
+	}{
+		{nil, 0},
+		{[]byte("1000.25"), 100025},
+		{"-0.10", -10},
+		{0.1 + 0.2, 30},
+		{int64(7), 700},
+	}
+
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.in); err != nil || m.Satang != tt.want {
+			t.Errorf("Scan(%#v) = %d, %v, want %d", tt.in, m.Satang, err, tt.want)
+		}
+	}
+
+	// DECIMAL(20, 2) holds more than an int64 of satang does
+	for _, in := range []interface{}{[]byte("999999999999999999.99"), "-999999999999999999.99", 1e17, -1e17, int64(math.MaxInt64 / 10)} {
+		var m Money
+		if err := m.Scan(in); err != ErrMoneyOverflow {
+			t.Errorf("Scan(%#v) = %d, %v, want ErrMoneyOverflow", in, m.Satang, err)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Error("Scan(bool) succeeded")
+	}
+
+	if v, _ := NewMoney(-5).Value(); v != "-0.05" {
+		t.Errorf("Value() = %v, want -0.05", v)
+	}
+}
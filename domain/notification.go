@@ -5,5 +5,5 @@ import (
 )
 
 type NotificationUsecase interface {
-	SendTransactionNotification(ctx context.Context)
+	SendTransactionNotification(ctx context.Context, message *Message) error
 }
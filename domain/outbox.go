@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// OutboxEvent is a Kafka message written in the same unit of work as the change it announces,
+// then published by the relay. Payload is the JSON encoded event envelope, the relay encodes it
+// for the wire, unless ContentType is set: then Payload is a document in that format, e.g. the
+// XML for the clearing house, and is sent as it is. Events with the same Key are published in Id order.
+type OutboxEvent struct {
+	Id          int64  `json:"id"`
+	Topic       string `json:"topic"`
+	Key         string `json:"key"`
+	ContentType string `json:"content_type,omitempty"`
+	Payload     string `json:"payload"`
+	// Attempts counts failed publishes, the next one is not tried before NextAttemptAt. A relay
+	// that claimed the event holds it by moving NextAttemptAt to the end of its lease.
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	PublishedAt   *time.Time `json:"published_at,omitempty"`
+	// ParkedAt is set once the event is given up on, it is not published again until it is cleared
+	ParkedAt *time.Time `json:"parked_at,omitempty"`
+}
+
+// OutboxPolicy tells the relay how often to run, how long a claim holds, when to give up on an
+// event and how long published events are kept. A zero Retention keeps them.
+type OutboxPolicy struct {
+	Interval    time.Duration
+	Lease       time.Duration
+	MaxAttempts int
+	Retention   time.Duration
+}
+
+// EventPublisher sends one keyed message with its headers, messages with the same key land on
+// the same partition
+type EventPublisher interface {
+	Publish(topic string, key string, headers map[string]string, message []byte) error
+}
+
+type OutboxUsecase interface {
+	Relay(ctx context.Context)
+}
+
+type OutboxRepository interface {
+	CreateEvent(ctx context.Context, ev *OutboxEvent) error
+	// ClaimEvents takes up to limit events due by now and holds them until until, skipping events
+	// other relays are claiming. Only the oldest unpublished event of a key is taken, so the
+	// events of a key are published in order; parked events do not hold their key back.
+	ClaimEvents(ctx context.Context, now time.Time, until time.Time, limit int) ([]OutboxEvent, error)
+	MarkEventPublished(ctx context.Context, id int64, publishedAt time.Time) error
+	// UpdateEventAttempt stores Attempts, NextAttemptAt, LastError and ParkedAt of ev
+	UpdateEventAttempt(ctx context.Context, ev *OutboxEvent) error
+	// DeletePublishedEvents removes up to limit events published before before
+	DeletePublishedEvents(ctx context.Context, before time.Time, limit int) (int64, error)
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// PromptPay proxy types
+const (
+	ProxyPhone      = "phone"
+	ProxyNationalID = "national_id"
+	ProxyEWallet    = "ewallet"
+)
+
+// Proxy links a phone number, national ID or e-wallet ID to one account, so money can be sent
+// to it instead of the account number. A proxy points to one account at a time. Only phones are
+// registered until there is KYC data to verify the other types against, so a transfer to a
+// national ID or e-wallet ID finds no proxy.
+type Proxy struct {
+	Id        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	AccountNo string    `json:"account_no"`
+	Uuid      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProxyRef names a proxy, e.g. the receiver of a transfer
+type ProxyRef struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ProxyRequest registers, moves or deregisters a proxy. Otp is the one time password sent to the
+// phone of a phone proxy, or to the phone of the user for the other types. Only phone proxies
+// can be registered for now.
+type ProxyRequest struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	AccountNo string `json:"account_no,omitempty"`
+	Otp       string `json:"otp"`
+}
+
+// Normalize brings the value of the proxy to the form it is stored in and checks it: phones
+// become ten digits starting with 0, national IDs must pass their check digit and e-wallet IDs
+// are fifteen digits
+func (p *ProxyRef) Normalize() error {
+	value := strings.NewReplacer(" ", "", "-", "").Replace(p.Value)
+
+	switch p.Type {
+	case ProxyPhone:
+		if strings.HasPrefix(value, "+66") {
+			value = "0" + value[3:]
+		} else if strings.HasPrefix(value, "66") && len(value) == 11 {
+			value = "0" + value[2:]
+		}
+		if len(value) != 10 || value[0] != '0' || !isDigits(value) {
+			return ErrInvalidProxy
+		}
+	case ProxyNationalID:
+		if len(value) != 13 || !isDigits(value) || !validNationalID(value) {
+			return ErrInvalidProxy
+		}
+	case ProxyEWallet:
+		if len(value) != 15 || !isDigits(value) {
+			return ErrInvalidProxy
+		}
+	default:
+		return ErrInvalidProxy
+	}
+
+	p.Value = value
+	return nil
+}
+
+// validNationalID checks the last digit of a Thai national ID against the twelve before it
+func validNationalID(id string) bool {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		sum += int(id[i]-'0') * (13 - i)
+	}
+	return (11-sum%11)%10 == int(id[12]-'0')
+}
+
+type ProxyUsecase interface {
+	GetProxies(ctx context.Context, uuid string) ([]Proxy, error)
+	RegisterProxy(ctx context.Context, uuid string, req ProxyRequest) (*Proxy, error)
+	// ChangeProxy points a proxy of the user to another of their accounts
+	ChangeProxy(ctx context.Context, uuid string, req ProxyRequest) (*Proxy, error)
+	DeregisterProxy(ctx context.Context, uuid string, req ProxyRequest) error
+}
+
+type ProxyRepository interface {
+	GetProxiesByUuid(ctx context.Context, uuid string) ([]Proxy, error)
+	GetProxy(ctx context.Context, proxyType string, value string) (Proxy, error)
+	GetProxyForUpdate(ctx context.Context, proxyType string, value string) (Proxy, error)
+	CreateProxy(ctx context.Context, p *Proxy) error
+	UpdateProxy(ctx context.Context, p *Proxy) error
+	DeleteProxy(ctx context.Context, id int64) error
+}
@@ -0,0 +1,71 @@
+package domain
+
+import "testing"
+
+func TestNormalizeProxy(t *testing.T) {
+	tests := []struct {
+		proxyType string
+		in        string
+		want      string
+		err       error
+	}{
+		{ProxyPhone, "0812345678", "0812345678", nil},
+		{ProxyPhone, "081-234-5678", "0812345678", nil},
+		{ProxyPhone, "+66812345678", "0812345678", nil},
+		{ProxyPhone, "66812345678", "0812345678", nil},
+		{ProxyPhone, "+66 81 234 5678", "0812345678", nil},
+		{ProxyPhone, "812345678", "", ErrInvalidProxy},
+		{ProxyPhone, "08123456789", "", ErrInvalidProxy},
+		{ProxyPhone, "08123456a8", "", ErrInvalidProxy},
+		{ProxyPhone, "1812345678", "", ErrInvalidProxy},
+		{ProxyNationalID, "1101700230716", "1101700230716", nil},
+		{ProxyNationalID, "1-1017-00230-71-6", "1101700230716", nil},
+		{ProxyNationalID, "1101700230717", "", ErrInvalidProxy},
+		{ProxyNationalID, "110170023071", "", ErrInvalidProxy},
+		{ProxyNationalID, "11017002307a6", "", ErrInvalidProxy},
+		{ProxyEWallet, "140000000000001", "140000000000001", nil},
+		{ProxyEWallet, "1400 0000 0000 001", "140000000000001", nil},
+		{ProxyEWallet, "14000000000000", "", ErrInvalidProxy},
+		{ProxyEWallet, "14000000000000x", "", ErrInvalidProxy},
+		{"email", "someone@example.com", "", ErrInvalidProxy},
+		{"", "0812345678", "", ErrInvalidProxy},
+	}
+
+	for _, tt := range tests {
+		ref := ProxyRef{Type: tt.proxyType, Value: tt.in}
+		err := ref.Normalize()
+		if err != tt.err {
+			t.Errorf("%s %q: got %v, want %v", tt.proxyType, tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && ref.Value != tt.want {
+			t.Errorf("%s %q: got %q, want %q", tt.proxyType, tt.in, ref.Value, tt.want)
+		}
+		if err != nil && ref.Value != tt.in {
+			t.Errorf("%s %q: a rejected value was changed to %q", tt.proxyType, tt.in, ref.Value)
+		}
+	}
+}
+
+func TestValidNationalID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"1101700230716", true},
+		{"3101001234565", true},
+		// the sum leaves 1 and 0 modulo 11, the check digits wrap to 0 and 1
+		{"1101700230040", true},
+		{"1101700230091", true},
+		{"1101700230041", false},
+		{"1101700230090", false},
+		{"1101700230715", false},
+		{"0000000000000", false},
+	}
+
+	for _, tt := range tests {
+		if got := validNationalID(tt.id); got != tt.valid {
+			t.Errorf("%s: got %v, want %v", tt.id, got, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package domain
+
+import "context"
+
+// QRPayment is what a Thai QR payment code asks to be paid: the account or PromptPay proxy the
+// money goes to and, for a code with a fixed amount, the amount. A static code leaves Amount nil
+// and the payer enters it.
+type QRPayment struct {
+	AccountNo string    `json:"account_no,omitempty"`
+	Bank      string    `json:"bank,omitempty"`
+	Proxy     *ProxyRef `json:"proxy,omitempty"`
+	Amount    *Money    `json:"amount,omitempty"`
+}
+
+// QRCode is a payment code to show for receiving money, Image is the code as a PNG
+type QRCode struct {
+	Payload string `json:"payload"`
+	Image   []byte `json:"image"`
+}
+
+// QRCodec writes and reads the EMVCo merchant presented payloads of Thai QR payment codes
+type QRCodec interface {
+	Encode(p QRPayment) (string, error)
+	// Decode checks the CRC of payload before it reads the payment
+	Decode(payload string) (QRPayment, error)
+	PNG(payload string) ([]byte, error)
+}
+
+type QRUsecase interface {
+	// GetReceiveQR makes the code to pay into an account of the user, amount is nil for a static code
+	GetReceiveQR(ctx context.Context, uuid string, accountNo string, amount *Money) (*QRCode, error)
+	// TransferByQR sends tr from an account of the user uuid to whom the scanned payload names,
+	// as a normal transfer
+	TransferByQR(ctx context.Context, uuid string, tr *Transaction, payload string) error
+}
@@ -0,0 +1,508 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ScheduleActive    = "active"
+	ScheduleCompleted = "completed"
+	ScheduleCancelled = "cancelled"
+
+	FrequencyOnce    = "once"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	// FrequencyEndOfMonth runs on the last day of every month
+	FrequencyEndOfMonth = "end_of_month"
+	// FrequencyRRule follows RRule, see parseRRule for the supported subset
+	FrequencyRRule = "rrule"
+
+	// DefaultScheduleTimezone is used when a schedule does not name one
+	DefaultScheduleTimezone = "Asia/Bangkok"
+
+	// ExecutionPending runs are waiting for NextAttemptAt, ExecutionProcessing runs are leased
+	// by a worker until LeaseExpiresAt
+	ExecutionPending    = "pending"
+	ExecutionProcessing = "processing"
+	ExecutionCompleted  = "completed"
+	// ExecutionFailed is terminal, the run used up its attempts or can not succeed
+	ExecutionFailed    = "failed"
+	ExecutionCancelled = "cancelled"
+	// ExecutionSkipped runs were missed while nothing was polling and left out by the catch-up policy
+	ExecutionSkipped = "skipped"
+
+	// CatchUpAll runs every occurrence missed while nothing was polling
+	CatchUpAll = "all"
+	// CatchUpSkip leaves the missed occurrences out and moves on to the next one still to come
+	CatchUpSkip = "skip"
+	// CatchUpLimit runs the most recent MaxCatchUp of the missed occurrences
+	CatchUpLimit = "limit"
+
+	// ScheduledTransactionTopic carries the runs queued by the poller to the workers
+	ScheduledTransactionTopic = "scheduled_transactions"
+)
+
+// ScheduledTransaction is a transfer run once or on a recurrence. Every run happens at the
+// wall-clock time of ScheduledExecutionAt in Timezone, so a schedule keeps its hour across DST.
+type ScheduledTransaction struct {
+	Id       int64   `json:"id"`
+	Amount   Money   `json:"amount"`
+	Type     string  `json:"type"`
+	Account  Account `json:"account"`
+	Receiver Account `json:"receiver,omitempty"`
+	Status   string  `json:"status"`
+	// Frequency defaults to FrequencyOnce
+	Frequency string `json:"frequency"`
+	// DayOfMonth is the day monthly schedules run on, the start day when 0. Months without
+	// that day run on their last day.
+	DayOfMonth int    `json:"day_of_month,omitempty"`
+	RRule      string `json:"rrule,omitempty"`
+	Timezone   string `json:"timezone"`
+	// ScheduledExecutionAt is when the schedule starts, the first run is the first occurrence from then on
+	ScheduledExecutionAt time.Time  `json:"scheduled_execution_at"`
+	NextExecutionAt      *time.Time `json:"next_execution_at,omitempty"`
+	// EndAt and MaxOccurrences end the recurrence, whichever comes first. Zero values never end it.
+	EndAt          *time.Time           `json:"end_at,omitempty"`
+	MaxOccurrences int64                `json:"max_occurrences,omitempty"`
+	Occurrences    int64                `json:"occurrences"`
+	SubmittedAt    time.Time            `json:"submitted_at"`
+	CreatedAt      time.Time            `json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+	Executions     []ScheduledExecution `json:"executions,omitempty"`
+}
+
+// ScheduledExecution is one occurrence of a schedule, there is at most one per ScheduledFor.
+// Attempts doubles as the lease fence: a worker may only write the execution while Attempts is
+// still the value its claim set.
+type ScheduledExecution struct {
+	Id           int64     `json:"id"`
+	ScheduleId   int64     `json:"schedule_id"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	// TransactionId is the transfer of the last attempt
+	TransactionId  int64      `json:"transaction_id,omitempty"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	FailureCode    int        `json:"failure_code,omitempty"`
+	FailureReason  string     `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExecutedAt     *time.Time `json:"executed_at,omitempty"`
+}
+
+// SchedulePolicy bounds how long a worker holds a run and how often a failed run is retried.
+// Lease has to outlast a transfer, or runs are taken over while they are still booking.
+type SchedulePolicy struct {
+	Lease       time.Duration
+	MaxAttempts int
+	// Backoff doubles after every failed attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// CatchUp decides what happens to occurrences more than Grace overdue, CatchUpAll when empty
+	CatchUp    string
+	MaxCatchUp int
+	Grace      time.Duration
+}
+
+// Validate checks the catch-up policy and fills in its default
+func (p *SchedulePolicy) Validate() error {
+	switch p.CatchUp {
+	case "":
+		p.CatchUp = CatchUpAll
+	case CatchUpAll, CatchUpSkip:
+	case CatchUpLimit:
+		if p.MaxCatchUp < 0 {
+			return fmt.Errorf("scheduled: max_catch_up must not be negative, got %d", p.MaxCatchUp)
+		}
+	default:
+		return fmt.Errorf("scheduled: unknown catch_up %q", p.CatchUp)
+	}
+	return nil
+}
+
+// Skips tells whether an occurrence due late ago is left out, when newer occurrences of the same
+// schedule are due after it. An occurrence at most Grace late is on time and always runs.
+func (p SchedulePolicy) Skips(late time.Duration, newer int) bool {
+	if late <= p.Grace {
+		return false
+	}
+
+	switch p.CatchUp {
+	case CatchUpSkip:
+		return true
+	case CatchUpLimit:
+		return newer >= p.MaxCatchUp
+	default:
+		return false
+	}
+}
+
+// Lease starts a new attempt held until now plus lease
+func (e *ScheduledExecution) Lease(now time.Time, lease time.Duration) {
+	expires := now.Add(lease)
+	e.Attempts++
+	e.Status, e.LeaseExpiresAt = ExecutionProcessing, &expires
+}
+
+// Complete records the transfer that ran the occurrence
+func (e *ScheduledExecution) Complete(now time.Time, transactionId int64) {
+	e.Status, e.TransactionId, e.ExecutedAt, e.LeaseExpiresAt = ExecutionCompleted, transactionId, &now, nil
+	e.FailureCode, e.FailureReason = 0, ""
+}
+
+// Cancel ends a run whose schedule was cancelled before it got to make the transfer
+func (e *ScheduledExecution) Cancel(now time.Time) {
+	e.Status, e.ExecutedAt, e.LeaseExpiresAt = ExecutionCancelled, &now, nil
+}
+
+// Retry records why the attempt failed and gives the run back, after a backoff while it has
+// attempts left and for good when it has not or retry is false
+func (e *ScheduledExecution) Retry(now time.Time, cause error, retry bool, policy SchedulePolicy) {
+	e.FailureCode, e.FailureReason = ErrorCode(cause)
+	e.ExecutedAt, e.LeaseExpiresAt = &now, nil
+
+	if !retry || e.Attempts >= policy.MaxAttempts {
+		e.Status = ExecutionFailed
+		return
+	}
+
+	backoff := policy.Backoff
+	for i := 1; i < e.Attempts && backoff < policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+
+	e.Status, e.NextAttemptAt = ExecutionPending, now.Add(backoff)
+}
+
+// recurrence is the normalised form of every frequency
+type recurrence struct {
+	freq     string
+	interval int
+	// byDay are the weekdays weekly recurrences run on
+	byDay []time.Weekday
+	// byMonthDay is the day monthly recurrences run on, -1 for the last day
+	byMonthDay int
+}
+
+// Validate checks the schedule on its own and fills in the defaults. COUNT and UNTIL of an
+// RRule are moved to MaxOccurrences and EndAt.
+func (s *ScheduledTransaction) Validate() error {
+	if s.Type != "transfer" || !s.Amount.IsPositive() || s.Account.AccountNo == s.Receiver.AccountNo {
+		return ErrInvalidSchedule
+	}
+
+	if s.Timezone == "" {
+		s.Timezone = DefaultScheduleTimezone
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return ErrInvalidTimezone
+	}
+
+	// the offset given must be the zone's own, otherwise the wall-clock time meant is ambiguous
+	if s.ScheduledExecutionAt.IsZero() {
+		return ErrInvalidSchedule
+	}
+	_, offset := s.ScheduledExecutionAt.Zone()
+	if _, zoneOffset := s.ScheduledExecutionAt.In(loc).Zone(); offset != zoneOffset {
+		return ErrInvalidTimezone
+	}
+
+	if s.Frequency == "" {
+		s.Frequency = FrequencyOnce
+	}
+	if (s.DayOfMonth != 0 && s.Frequency != FrequencyMonthly) || s.DayOfMonth < 0 || s.DayOfMonth > 31 {
+		return ErrInvalidSchedule
+	}
+	if (s.RRule != "") != (s.Frequency == FrequencyRRule) {
+		return ErrInvalidSchedule
+	}
+
+	if s.Frequency == FrequencyRRule {
+		_, count, until, err := parseRRule(s.RRule, loc)
+		if err != nil {
+			return err
+		}
+		if (count != 0 && s.MaxOccurrences != 0) || (until != nil && s.EndAt != nil) {
+			return ErrInvalidSchedule
+		}
+		if count != 0 {
+			s.MaxOccurrences = count
+		}
+		if until != nil {
+			s.EndAt = until
+		}
+	} else if _, err = s.recurrence(); err != nil {
+		return err
+	}
+
+	if s.MaxOccurrences < 0 || (s.EndAt != nil && s.EndAt.Before(s.ScheduledExecutionAt)) {
+		return ErrInvalidSchedule
+	}
+
+	return nil
+}
+
+func (s *ScheduledTransaction) recurrence() (recurrence, error) {
+	switch s.Frequency {
+	case FrequencyOnce:
+		return recurrence{freq: FrequencyOnce}, nil
+	case FrequencyDaily:
+		return recurrence{freq: FrequencyDaily, interval: 1}, nil
+	case FrequencyWeekly:
+		return recurrence{freq: FrequencyWeekly, interval: 1}, nil
+	case FrequencyMonthly:
+		return recurrence{freq: FrequencyMonthly, interval: 1, byMonthDay: s.DayOfMonth}, nil
+	case FrequencyEndOfMonth:
+		return recurrence{freq: FrequencyMonthly, interval: 1, byMonthDay: -1}, nil
+	case FrequencyRRule:
+		loc, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return recurrence{}, ErrInvalidTimezone
+		}
+		r, _, _, err := parseRRule(s.RRule, loc)
+		return r, err
+	default:
+		return recurrence{}, ErrInvalidSchedule
+	}
+}
+
+// Plan sets NextExecutionAt to the first occurrence after now that is still to run, and
+// completes the schedule when there is none
+func (s *ScheduledTransaction) Plan(now time.Time) error {
+	s.NextExecutionAt = nil
+
+	if s.MaxOccurrences == 0 || s.Occurrences < s.MaxOccurrences {
+		next, ok, err := s.Next(now)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.NextExecutionAt = &next
+		}
+	}
+
+	if s.NextExecutionAt == nil {
+		s.Status = ScheduleCompleted
+	}
+	return nil
+}
+
+// Advance counts the occurrence at NextExecutionAt and plans the one after it, which may be
+// overdue too when nothing was polling for a while
+func (s *ScheduledTransaction) Advance() error {
+	occurrence := *s.NextExecutionAt
+	s.Occurrences++
+	return s.Plan(occurrence)
+}
+
+// Next returns the first occurrence strictly after after, and false when the recurrence has
+// ended by then. MaxOccurrences is left to the caller.
+func (s *ScheduledTransaction) Next(after time.Time) (time.Time, bool, error) {
+	r, err := s.recurrence()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, false, ErrInvalidTimezone
+	}
+
+	start := s.ScheduledExecutionAt.In(loc).Truncate(time.Second)
+	if after.Before(start) {
+		after = start.Add(-time.Nanosecond)
+	}
+	a := after.In(loc)
+
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, loc)
+	}
+
+	var next time.Time
+
+	switch r.freq {
+	case FrequencyOnce:
+		next = start
+
+	case FrequencyDaily:
+		for k := floorTo(daysBetween(start, a), r.interval); !next.After(after); k += r.interval {
+			next = at(start.Year(), start.Month(), start.Day()+k)
+		}
+
+	case FrequencyWeekly:
+		days := r.byDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		// weeks start on Monday, as in RRULE
+		monday := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		week := floorTo(daysBetween(monday, a)/7, r.interval)
+
+	weeks:
+		for ; ; week += r.interval {
+			for _, day := range days {
+				candidate := at(monday.Year(), monday.Month(), monday.Day()+week*7+(int(day)+6)%7)
+				if !candidate.Before(start) && candidate.After(after) {
+					next = candidate
+					break weeks
+				}
+			}
+		}
+
+	case FrequencyMonthly:
+		months := floorTo((a.Year()-start.Year())*12+int(a.Month())-int(start.Month()), r.interval)
+
+		for ; ; months += r.interval {
+			first := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, loc)
+			lastDay := first.AddDate(0, 1, -1).Day()
+
+			day := r.byMonthDay
+			if day == 0 {
+				day = start.Day()
+			}
+			if day == -1 || day > lastDay {
+				day = lastDay
+			}
+
+			candidate := at(first.Year(), first.Month(), day)
+			if !candidate.Before(start) && candidate.After(after) {
+				next = candidate
+				break
+			}
+		}
+	}
+
+	if !next.After(after) || (s.EndAt != nil && next.After(*s.EndAt)) {
+		return time.Time{}, false, nil
+	}
+	return next, true, nil
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// parseRRule reads the RRULE subset FREQ=DAILY|WEEKLY|MONTHLY, INTERVAL, BYDAY (weekly only),
+// BYMONTHDAY of 1 to 31 or -1 (monthly only), COUNT and UNTIL. A date-only UNTIL includes the
+// whole day in loc.
+func parseRRule(rule string, loc *time.Location) (r recurrence, count int64, until *time.Time, err error) {
+	r.interval = 1
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(rule), "RRULE:"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" || seen[key] {
+			return r, 0, nil, ErrInvalidSchedule
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY":
+				r.freq = FrequencyDaily
+			case "WEEKLY":
+				r.freq = FrequencyWeekly
+			case "MONTHLY":
+				r.freq = FrequencyMonthly
+			default:
+				return r, 0, nil, ErrInvalidSchedule
+			}
+		case "INTERVAL":
+			if r.interval, err = strconv.Atoi(value); err != nil || r.interval <= 0 {
+				return r, 0, nil, ErrInvalidSchedule
+			}
+		case "BYDAY":
+			for _, name := range strings.Split(value, ",") {
+				day, ok := rruleWeekdays[name]
+				if !ok {
+					return r, 0, nil, ErrInvalidSchedule
+				}
+				r.byDay = append(r.byDay, day)
+			}
+		case "BYMONTHDAY":
+			if r.byMonthDay, err = strconv.Atoi(value); err != nil || r.byMonthDay == 0 || r.byMonthDay < -1 || r.byMonthDay > 31 {
+				return r, 0, nil, ErrInvalidSchedule
+			}
+		case "COUNT":
+			if count, err = strconv.ParseInt(value, 10, 64); err != nil || count <= 0 {
+				return r, 0, nil, ErrInvalidSchedule
+			}
+		case "UNTIL":
+			var t time.Time
+			if t, err = time.Parse("20060102T150405Z", value); err != nil {
+				if t, err = time.ParseInLocation("20060102", value, loc); err != nil {
+					return r, 0, nil, ErrInvalidSchedule
+				}
+				t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			until = &t
+		default:
+			return r, 0, nil, ErrInvalidSchedule
+		}
+	}
+
+	if r.freq == "" || (len(r.byDay) > 0 && r.freq != FrequencyWeekly) || (r.byMonthDay != 0 && r.freq != FrequencyMonthly) {
+		return r, 0, nil, ErrInvalidSchedule
+	}
+
+	// candidates are tried in week order, Monday first
+	sort.Slice(r.byDay, func(i, j int) bool {
+		return (r.byDay[i]+6)%7 < (r.byDay[j]+6)%7
+	})
+
+	return r, count, until, nil
+}
+
+// daysBetween counts calendar days from a to b
+func daysBetween(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+// floorTo rounds n down to a multiple of interval, never below 0
+func floorTo(n, interval int) int {
+	if n <= 0 {
+		return 0
+	}
+	return n / interval * interval
+}
+
+type ScheduledTransactionRepository interface {
+	CreateScheduledTransaction(ctx context.Context, st *ScheduledTransaction) error
+	GetScheduledTransactionByID(ctx context.Context, id int64) (ScheduledTransaction, error)
+	GetScheduledTransactionByIDForUpdate(ctx context.Context, id int64) (ScheduledTransaction, error)
+	GetScheduledTransactionsByUuid(ctx context.Context, uuid string) ([]ScheduledTransaction, error)
+	// GetDueScheduledTransactions locks the active schedules due by now, skipping rows another poller holds
+	GetDueScheduledTransactions(ctx context.Context, now time.Time) ([]ScheduledTransaction, error)
+	UpdateScheduledTransaction(ctx context.Context, st *ScheduledTransaction) error
+	// CreateScheduledExecution leaves an existing execution of the same occurrence as it is
+	CreateScheduledExecution(ctx context.Context, ex *ScheduledExecution) error
+	// ClaimScheduledExecution locks the oldest run that is due or whose lease ran out, skipping
+	// rows another worker holds. It returns nil when there is none.
+	ClaimScheduledExecution(ctx context.Context, now time.Time) (*ScheduledExecution, error)
+	// ClaimScheduledExecutionByID is ClaimScheduledExecution for the run id only
+	ClaimScheduledExecutionByID(ctx context.Context, id int64, now time.Time) (*ScheduledExecution, error)
+	GetScheduledExecutionForUpdate(ctx context.Context, id int64) (ScheduledExecution, error)
+	// UpdateScheduledExecution returns ErrExecutionLeaseLost unless the row still has fence attempts
+	UpdateScheduledExecution(ctx context.Context, ex *ScheduledExecution, fence int) error
+	CancelScheduledExecutions(ctx context.Context, scheduleId int64) error
+	GetScheduledExecutions(ctx context.Context, scheduleId int64) ([]ScheduledExecution, error)
+}
@@ -0,0 +1,260 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// newSchedule is a valid transfer schedule starting at start, the wall-clock time in timezone
+func newSchedule(t *testing.T, frequency string, rrule string, timezone string, start string) ScheduledTransaction {
+	t.Helper()
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, err := time.ParseInLocation("2006-01-02 15:04", start, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ScheduledTransaction{
+		Type:                 "transfer",
+		Amount:               NewMoney(10000),
+		Account:              Account{AccountNo: "1000000001"},
+		Receiver:             Account{AccountNo: "2000000001"},
+		Frequency:            frequency,
+		RRule:                rrule,
+		Timezone:             timezone,
+		ScheduledExecutionAt: at,
+	}
+	if err = s.Validate(); err != nil {
+		t.Fatalf("%s %s: %v", frequency, rrule, err)
+	}
+	return s
+}
+
+// runs lists the first n occurrences of s as wall-clock times with their offset
+func runs(t *testing.T, s ScheduledTransaction, n int) []string {
+	t.Helper()
+
+	var got []string
+	after := s.ScheduledExecutionAt.Add(-time.Nanosecond)
+	for len(got) < n {
+		next, ok, err := s.Next(after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, next.Format("2006-01-02 15:04 -0700"))
+		after = next
+	}
+	return got
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency string
+		rrule     string
+		timezone  string
+		start     string
+		want      []string
+		// ends is set when the recurrence has no occurrence after want
+		ends bool
+	}{
+		{"daily keeps its hour across DST", FrequencyDaily, "", "Europe/Berlin", "2026-03-27 09:00", []string{
+			"2026-03-27 09:00 +0100", "2026-03-28 09:00 +0100", "2026-03-29 09:00 +0200", "2026-03-30 09:00 +0200"}, false},
+		{"daily in the hour DST skips", FrequencyDaily, "", "Europe/Berlin", "2026-03-28 02:30", []string{
+			"2026-03-28 02:30 +0100", "2026-03-29 03:30 +0200", "2026-03-30 02:30 +0200"}, false},
+		{"weekly back from DST", FrequencyWeekly, "", "Europe/Berlin", "2026-10-18 08:00", []string{
+			"2026-10-18 08:00 +0200", "2026-10-25 08:00 +0100", "2026-11-01 08:00 +0100"}, false},
+		{"once", FrequencyOnce, "", "Asia/Bangkok", "2026-05-01 10:00", []string{
+			"2026-05-01 10:00 +0700"}, true},
+		{"end of month", FrequencyEndOfMonth, "", "Asia/Bangkok", "2026-01-15 10:00", []string{
+			"2026-01-31 10:00 +0700", "2026-02-28 10:00 +0700", "2026-03-31 10:00 +0700", "2026-04-30 10:00 +0700"}, false},
+		{"end of month in a leap year", FrequencyEndOfMonth, "", "Asia/Bangkok", "2028-01-31 10:00", []string{
+			"2028-01-31 10:00 +0700", "2028-02-29 10:00 +0700", "2028-03-31 10:00 +0700"}, false},
+		{"monthly on the 31st runs on shorter months' last day", FrequencyMonthly, "", "Asia/Bangkok", "2026-01-31 10:00", []string{
+			"2026-01-31 10:00 +0700", "2026-02-28 10:00 +0700", "2026-03-31 10:00 +0700", "2026-04-30 10:00 +0700"}, false},
+		{"monthly on the 30th returns to it after February", FrequencyMonthly, "", "Asia/Bangkok", "2026-01-30 10:00", []string{
+			"2026-01-30 10:00 +0700", "2026-02-28 10:00 +0700", "2026-03-30 10:00 +0700"}, false},
+		{"daily interval", FrequencyRRule, "FREQ=DAILY;INTERVAL=3", "Asia/Bangkok", "2026-01-01 10:00", []string{
+			"2026-01-01 10:00 +0700", "2026-01-04 10:00 +0700", "2026-01-07 10:00 +0700"}, false},
+		{"weekly interval by day", FrequencyRRule, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "Asia/Bangkok", "2026-01-07 10:00", []string{
+			"2026-01-09 10:00 +0700", "2026-01-19 10:00 +0700", "2026-01-23 10:00 +0700", "2026-02-02 10:00 +0700"}, false},
+		{"by day in week order", FrequencyRRule, "FREQ=WEEKLY;BYDAY=SU,MO", "Asia/Bangkok", "2026-01-03 10:00", []string{
+			"2026-01-04 10:00 +0700", "2026-01-05 10:00 +0700", "2026-01-11 10:00 +0700", "2026-01-12 10:00 +0700"}, false},
+		{"monthly interval on the last day", FrequencyRRule, "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=-1", "Asia/Bangkok", "2026-01-10 10:00", []string{
+			"2026-01-31 10:00 +0700", "2026-03-31 10:00 +0700", "2026-05-31 10:00 +0700"}, false},
+		{"date-only until includes the day", FrequencyRRule, "RRULE:FREQ=DAILY;UNTIL=20260103", "Asia/Bangkok", "2026-01-01 23:00", []string{
+			"2026-01-01 23:00 +0700", "2026-01-02 23:00 +0700", "2026-01-03 23:00 +0700"}, true},
+	}
+
+	for _, tt := range tests {
+		s := newSchedule(t, tt.frequency, tt.rrule, tt.timezone, tt.start)
+		got := runs(t, s, len(tt.want)+1)
+		if !tt.ends && len(got) > len(tt.want) {
+			got = got[:len(tt.want)]
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNextFromTheMiddle(t *testing.T) {
+	s := newSchedule(t, FrequencyRRule, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "Asia/Bangkok", "2026-01-07 10:00")
+
+	// the weeks in between are not in the recurrence
+	after := time.Date(2026, 1, 26, 12, 0, 0, 0, time.UTC)
+	next, ok, err := s.Next(after)
+	if err != nil || !ok {
+		t.Fatalf("got %v %v", ok, err)
+	}
+	if want := "2026-02-02 10:00 +0700"; next.Format("2006-01-02 15:04 -0700") != want {
+		t.Errorf("got %s, want %s", next, want)
+	}
+}
+
+func TestSchedulePlan(t *testing.T) {
+	s := newSchedule(t, FrequencyRRule, "FREQ=DAILY;COUNT=2", "Asia/Bangkok", "2026-01-01 10:00")
+	if s.MaxOccurrences != 2 {
+		t.Fatalf("MaxOccurrences = %d, want the COUNT", s.MaxOccurrences)
+	}
+
+	s.Status = ScheduleActive
+	if err := s.Plan(s.ScheduledExecutionAt.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if s.NextExecutionAt == nil || !s.NextExecutionAt.Equal(s.ScheduledExecutionAt) {
+		t.Fatalf("first run at %v, want the start", s.NextExecutionAt)
+	}
+
+	for i := 0; i < 2; i++ {
+		if s.Status != ScheduleActive {
+			t.Fatalf("completed after %d runs", i)
+		}
+		if err := s.Advance(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Status != ScheduleCompleted || s.NextExecutionAt != nil || s.Occurrences != 2 {
+		t.Errorf("after COUNT runs: status %s, next %v, occurrences %d", s.Status, s.NextExecutionAt, s.Occurrences)
+	}
+
+	end := newSchedule(t, FrequencyDaily, "", "Asia/Bangkok", "2026-01-01 10:00")
+	endAt := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	end.EndAt, end.Status = &endAt, ScheduleActive
+	if err := end.Plan(time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if end.Status != ScheduleCompleted {
+		t.Errorf("a run after EndAt was planned: %v", end.NextExecutionAt)
+	}
+}
+
+func TestScheduleAdvanceCatchesUp(t *testing.T) {
+	s := newSchedule(t, FrequencyDaily, "", "Asia/Bangkok", "2026-01-01 10:00")
+	s.Status = ScheduleActive
+	if err := s.Plan(s.ScheduledExecutionAt.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// every missed day is still its own occurrence
+	now := time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC)
+	var due int
+	for !s.NextExecutionAt.After(now) {
+		due++
+		if err := s.Advance(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if due != 3 || s.Occurrences != 3 {
+		t.Errorf("due %d, occurrences %d, want 3", due, s.Occurrences)
+	}
+}
+
+func TestParseRRule(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Bangkok")
+
+	r, count, until, err := parseRRule("rrule:freq=weekly;interval=2;byday=fr,mo;count=5;until=20260301T000000Z", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := recurrence{freq: FrequencyWeekly, interval: 2, byDay: []time.Weekday{time.Monday, time.Friday}}
+	if !reflect.DeepEqual(r, want) || count != 5 || until == nil || !until.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %+v count %d until %v", r, count, until)
+	}
+
+	invalid := []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;FREQ=DAILY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;INTERVAL=x",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=-2",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;UNTIL=tomorrow",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ=DAILY;INTERVAL",
+	}
+	for _, rule := range invalid {
+		if _, _, _, err := parseRRule(rule, loc); err != ErrInvalidSchedule {
+			t.Errorf("%q: got %v, want %v", rule, err, ErrInvalidSchedule)
+		}
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	s := newSchedule(t, FrequencyDaily, "", "Europe/Berlin", "2026-01-01 10:00")
+
+	tests := []struct {
+		name   string
+		change func(s *ScheduledTransaction)
+		want   error
+	}{
+		{"unknown zone", func(s *ScheduledTransaction) { s.Timezone = "Mars/Olympus" }, ErrInvalidTimezone},
+		{"offset of another zone", func(s *ScheduledTransaction) { s.ScheduledExecutionAt = s.ScheduledExecutionAt.UTC() }, ErrInvalidTimezone},
+		{"day of month on a daily schedule", func(s *ScheduledTransaction) { s.DayOfMonth = 5 }, ErrInvalidSchedule},
+		{"rrule without the frequency", func(s *ScheduledTransaction) { s.RRule = "FREQ=DAILY" }, ErrInvalidSchedule},
+		{"count twice", func(s *ScheduledTransaction) {
+			s.Frequency, s.RRule, s.MaxOccurrences = FrequencyRRule, "FREQ=DAILY;COUNT=2", 3
+		}, ErrInvalidSchedule},
+		{"end before the start", func(s *ScheduledTransaction) {
+			end := s.ScheduledExecutionAt.Add(-time.Hour)
+			s.EndAt = &end
+		}, ErrInvalidSchedule},
+	}
+
+	for _, tt := range tests {
+		schedule := s
+		tt.change(&schedule)
+		if err := schedule.Validate(); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSchedulePolicyValidate(t *testing.T) {
+	var p SchedulePolicy
+	if err := p.Validate(); err != nil || p.CatchUp != CatchUpAll {
+		t.Errorf("empty catch-up: %v, %q", err, p.CatchUp)
+	}
+
+	for _, p := range []SchedulePolicy{{CatchUp: "some"}, {CatchUp: CatchUpLimit, MaxCatchUp: -1}} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v passed", p)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// StatementLine is one booked transaction seen from the statement's account.
+// Amount is signed: credits to the account are positive, debits negative.
+type StatementLine struct {
+	TransactionId int64     `json:"transaction_id"`
+	Type          string    `json:"type"`
+	Description   string    `json:"description"`
+	Counterparty  string    `json:"counterparty,omitempty"`
+	Amount        Money     `json:"amount"`
+	Balance       Money     `json:"balance"`
+	BookedAt      time.Time `json:"booked_at"`
+}
+
+// Statement covers [From, To). OpeningBalance plus the sum of the lines equals ClosingBalance.
+type Statement struct {
+	AccountNo      string          `json:"account_no"`
+	AccountName    string          `json:"account_name"`
+	Bank           string          `json:"bank"`
+	Currency       string          `json:"currency"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance Money           `json:"opening_balance"`
+	ClosingBalance Money           `json:"closing_balance"`
+	TotalCredits   Money           `json:"total_credits"`
+	TotalDebits    Money           `json:"total_debits"`
+	Lines          []StatementLine `json:"lines"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+}
+
+type StatementUsecase interface {
+	GetStatement(ctx context.Context, uuid string, account_no string, from time.Time, to time.Time) (*Statement, error)
+}
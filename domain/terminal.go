@@ -0,0 +1,291 @@
+package domain
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	TerminalOnline = "online"
+	// TerminalOffline and TerminalOutOfService terminals pay nothing out
+	TerminalOffline      = "offline"
+	TerminalOutOfService = "out_of_service"
+
+	// DispenseMinimalNotes pays out as few notes as possible
+	DispenseMinimalNotes = "minimal_notes"
+	// DispensePreserveSmallNotes uses as few of the smallest notes as possible, then of the next
+	// smallest and so on, so small notes last for the amounts that need them
+	DispensePreserveSmallNotes = "preserve_small_notes"
+
+	// MaxDispenseNotes is the most notes a dispenser pays out at once
+	MaxDispenseNotes = 40
+)
+
+// banknotes are the Thai banknotes in baht
+var banknotes = map[int64]bool{20: true, 50: true, 100: true, 500: true, 1000: true}
+
+// Terminal is an ATM. Denominations are the banknotes in baht it pays out, cassettes with other
+// notes are left alone. A low cash alert goes out when its Cash drops under LowCashThreshold.
+type Terminal struct {
+	Id               string     `json:"id"`
+	Location         string     `json:"location"`
+	Status           string     `json:"status"`
+	Denominations    []int64    `json:"denominations"`
+	DispenseStrategy string     `json:"dispense_strategy"`
+	LowCashThreshold *Money     `json:"low_cash_threshold,omitempty"`
+	Cassettes        []Cassette `json:"cassettes,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// Cassette holds Count notes of Denomination baht in the slot Position of a terminal
+type Cassette struct {
+	Id           int64     `json:"id"`
+	TerminalId   string    `json:"-"`
+	Position     int       `json:"position"`
+	Denomination int64     `json:"denomination"`
+	Count        int       `json:"count"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// DispenseNote is how many notes are taken from one cassette
+type DispenseNote struct {
+	CassetteId   int64 `json:"cassette_id"`
+	Position     int   `json:"position"`
+	Denomination int64 `json:"denomination"`
+	Count        int   `json:"count"`
+}
+
+// DispensePlan is what a terminal pays out for a withdrawal. ReversalId is the reversal that put
+// the notes back, 0 while they are paid out.
+type DispensePlan struct {
+	TerminalId string         `json:"terminal_id"`
+	Amount     Money          `json:"amount"`
+	Notes      []DispenseNote `json:"notes"`
+	ReversalId int64          `json:"reversal_id,omitempty"`
+}
+
+// Validate checks the settings of a terminal, an empty strategy becomes DispenseMinimalNotes
+func (t *Terminal) Validate() error {
+	if t.Id == "" || len(t.Denominations) == 0 {
+		return ErrInvalidTerminal
+	}
+
+	switch t.Status {
+	case TerminalOnline, TerminalOffline, TerminalOutOfService:
+	default:
+		return ErrInvalidTerminal
+	}
+
+	switch t.DispenseStrategy {
+	case "":
+		t.DispenseStrategy = DispenseMinimalNotes
+	case DispenseMinimalNotes, DispensePreserveSmallNotes:
+	default:
+		return ErrInvalidTerminal
+	}
+
+	for _, d := range t.Denominations {
+		if !banknotes[d] {
+			return ErrInvalidTerminal
+		}
+	}
+
+	if t.LowCashThreshold != nil && t.LowCashThreshold.IsNegative() {
+		return ErrInvalidTerminal
+	}
+
+	return nil
+}
+
+// Supports tells whether the terminal pays out notes of denomination
+func (t *Terminal) Supports(denomination int64) bool {
+	for _, d := range t.Denominations {
+		if d == denomination {
+			return true
+		}
+	}
+	return false
+}
+
+// PlanDispense works out the notes for amount from the cassettes of the terminal with its
+// strategy. Amounts the cassettes can not make up exactly in MaxDispenseNotes notes are refused.
+func (t *Terminal) PlanDispense(amount Money) (*DispensePlan, error) {
+	if t.Status != TerminalOnline {
+		return nil, ErrTerminalUnavailable
+	}
+
+	if !amount.IsPositive() || amount.Satang%100 != 0 {
+		return nil, ErrCannotDispense
+	}
+
+	available := make(map[int64]int)
+	for _, c := range t.Cassettes {
+		if t.Supports(c.Denomination) && c.Count > 0 {
+			available[c.Denomination] += c.Count
+		}
+	}
+
+	counts, ok := planNotes(amount.Satang/100, available, t.DispenseStrategy)
+	if !ok {
+		return nil, ErrCannotDispense
+	}
+
+	cassettes := append([]Cassette(nil), t.Cassettes...)
+	sort.Slice(cassettes, func(i, j int) bool { return cassettes[i].Position < cassettes[j].Position })
+
+	plan := &DispensePlan{TerminalId: t.Id, Amount: amount}
+	for _, c := range cassettes {
+		if !t.Supports(c.Denomination) || counts[c.Denomination] == 0 || c.Count <= 0 {
+			continue
+		}
+
+		take := counts[c.Denomination]
+		if take > c.Count {
+			take = c.Count
+		}
+		counts[c.Denomination] -= take
+
+		plan.Notes = append(plan.Notes, DispenseNote{CassetteId: c.Id, Position: c.Position, Denomination: c.Denomination, Count: take})
+	}
+
+	return plan, nil
+}
+
+// planNotes finds how many notes of each denomination make up baht out of the available ones.
+// best[a] is the best way to make up a with the denominations taken in so far, nil when there
+// is none. Both strategies compare plans by a fixed order of their counts, so the best plan for
+// an amount is built from the best plan for what is left after the notes of one denomination.
+func planNotes(baht int64, available map[int64]int, strategy string) (map[int64]int, bool) {
+	denominations := make([]int64, 0, len(available))
+	for d := range available {
+		denominations = append(denominations, d)
+	}
+	sort.Slice(denominations, func(i, j int) bool { return denominations[i] < denominations[j] })
+
+	if len(denominations) == 0 || baht > MaxDispenseNotes*denominations[len(denominations)-1] {
+		return nil, false
+	}
+
+	unit := denominations[0]
+	for _, d := range denominations[1:] {
+		unit = gcd(unit, d)
+	}
+	if baht%unit != 0 {
+		return nil, false
+	}
+	units := int(baht / unit)
+
+	best := make([][]int, units+1)
+	best[0] = make([]int, len(denominations))
+
+	for i, d := range denominations {
+		step := int(d / unit)
+		next := make([][]int, units+1)
+
+		for a := 0; a <= units; a++ {
+			for k := 0; k <= available[d] && k <= MaxDispenseNotes && k*step <= a; k++ {
+				prev := best[a-k*step]
+				if prev == nil {
+					continue
+				}
+
+				candidate := append([]int(nil), prev...)
+				candidate[i] = k
+				if next[a] == nil || betterPlan(candidate, next[a], strategy) {
+					next[a] = candidate
+				}
+			}
+		}
+
+		best = next
+	}
+
+	plan := best[units]
+	if plan == nil || noteCount(plan) > MaxDispenseNotes {
+		return nil, false
+	}
+
+	counts := make(map[int64]int)
+	for i, d := range denominations {
+		counts[d] = plan[i]
+	}
+	return counts, true
+}
+
+// betterPlan compares note counts ordered from the smallest denomination up
+func betterPlan(a, b []int, strategy string) bool {
+	if strategy != DispensePreserveSmallNotes {
+		if na, nb := noteCount(a), noteCount(b); na != nb {
+			return na < nb
+		}
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func noteCount(counts []int) (n int) {
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+type TerminalUsecase interface {
+	GetTerminals(ctx context.Context) ([]Terminal, error)
+	GetTerminal(ctx context.Context, id string) (*Terminal, error)
+	SaveTerminal(ctx context.Context, t *Terminal) error
+	// LoadCassette sets the notes in a slot of the terminal, e.g. after a refill
+	LoadCassette(ctx context.Context, terminalId string, c *Cassette) error
+	// Dispense plans the notes for the withdrawal tr at tr.TerminalId and takes them out of the
+	// cassettes. It must run in the unit of work that debits the account.
+	Dispense(ctx context.Context, tr *Transaction) error
+	// AcceptDeposit puts the notes of the deposit tr into the deposit bin of tr.TerminalId. It must
+	// run in the unit of work that credits the account.
+	AcceptDeposit(ctx context.Context, tr *Transaction) error
+	// ReturnDispense puts the notes paid out for the withdrawal orig back into the cassettes when
+	// reversal gives back all of it. It must run in the unit of work that books reversal.
+	ReturnDispense(ctx context.Context, orig *Transaction, reversal *Transaction) error
+	Replenish(ctx context.Context, terminalId string, op CashOperation) (*Terminal, error)
+	PickUp(ctx context.Context, terminalId string, op CashOperation) (*Terminal, error)
+	// Balance closes the shift of the terminal with the notes counted in it
+	Balance(ctx context.Context, terminalId string, req BalancingRequest) (*BalancingReport, error)
+	GetBalancingReports(ctx context.Context, terminalId string) ([]BalancingReport, error)
+}
+
+type TerminalRepository interface {
+	GetTerminals(ctx context.Context) ([]Terminal, error)
+	GetTerminal(ctx context.Context, id string) (Terminal, error)
+	UpsertTerminal(ctx context.Context, t *Terminal) error
+	GetCassettes(ctx context.Context, terminalId string) ([]Cassette, error)
+	GetCassettesForUpdate(ctx context.Context, terminalId string) ([]Cassette, error)
+	UpsertCassette(ctx context.Context, c *Cassette) error
+	UpdateCassetteCount(ctx context.Context, id int64, count int) error
+	// CreateDispense records the notes paid out for a transaction
+	CreateDispense(ctx context.Context, transactionId int64, plan *DispensePlan) error
+	// GetDispenseForUpdate returns nil when no notes were paid out for the transaction
+	GetDispenseForUpdate(ctx context.Context, transactionId int64) (*DispensePlan, error)
+	// ReverseDispense returns ErrAlreadyReversed when the notes were put back before
+	ReverseDispense(ctx context.Context, transactionId int64, reversalId int64) error
+	CreateCashMovements(ctx context.Context, movements []CashMovement) error
+	GetCashMovementsAfter(ctx context.Context, terminalId string, movementId int64) ([]CashMovement, error)
+	// GetDepositBin counts the notes deposited since the deposit bin was last emptied
+	GetDepositBin(ctx context.Context, terminalId string) ([]BanknoteCount, error)
+	// GetLastBalancingReport returns nil when the terminal was never balanced
+	GetLastBalancingReport(ctx context.Context, terminalId string) (*BalancingReport, error)
+	GetBalancingReports(ctx context.Context, terminalId string) ([]BalancingReport, error)
+	CreateBalancingReport(ctx context.Context, r *BalancingReport) error
+}
@@ -0,0 +1,229 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// Kinds of cash movements
+const (
+	CashReplenishment = "replenishment"
+	CashPickup        = "pickup"
+	CashDispense      = "dispense"
+	CashDeposit       = "deposit"
+	// CashAdjustment is a cassette set up or corrected with LoadCassette
+	CashAdjustment = "adjustment"
+	// CashCorrection sets a cassette or the deposit bin to the notes counted at a balancing. It is
+	// covered by that balancing, so it never shows up as a movement of a shift.
+	CashCorrection = "correction"
+	// CashReversal puts the notes of a reversed withdrawal back into the cassettes they came from,
+	// it counts against what was dispensed
+	CashReversal = "reversal"
+
+	// DepositBin is the position deposited notes go to, cassettes start at 1
+	DepositBin = 0
+)
+
+// CashMovement is a change to the notes in a terminal. Count is signed, notes going into the
+// terminal count up.
+type CashMovement struct {
+	Id            int64     `json:"id"`
+	TerminalId    string    `json:"terminal_id"`
+	Kind          string    `json:"kind"`
+	Position      int       `json:"position"`
+	Denomination  int64     `json:"denomination"`
+	Count         int       `json:"count"`
+	TransactionId int64     `json:"transaction_id,omitempty"`
+	Operator      string    `json:"operator,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type BanknoteCount struct {
+	Denomination int64 `json:"denomination"`
+	Count        int   `json:"count"`
+}
+
+// CassetteCount is how many notes go into or come out of the cassette at Position
+type CassetteCount struct {
+	Position int `json:"position"`
+	Count    int `json:"count"`
+}
+
+// CashOperation is a replenishment or a cash pickup by operations staff. A pickup with
+// DepositBin set empties the deposit bin as well. Operator is whoever the admin key belongs to.
+type CashOperation struct {
+	Operator   string          `json:"-"`
+	Cassettes  []CassetteCount `json:"cassettes"`
+	DepositBin bool            `json:"deposit_bin,omitempty"`
+}
+
+// BalancingRequest closes a shift with the notes counted in each cassette and in the deposit bin.
+// Operator is whoever the admin key belongs to.
+type BalancingRequest struct {
+	Operator   string          `json:"-"`
+	Cassettes  []CassetteCount `json:"cassettes"`
+	DepositBin []BanknoteCount `json:"deposit_bin"`
+}
+
+// Counted lists the notes of r by denomination. Every one of cassettes must be counted once.
+func (r *BalancingRequest) Counted(cassettes []Cassette) ([]BanknoteCount, error) {
+	if len(r.Cassettes) != len(cassettes) {
+		return nil, ErrInvalidCashOperation
+	}
+
+	counted := make([]BanknoteCount, 0, len(r.Cassettes)+len(r.DepositBin))
+	seen := make(map[int]bool)
+	for _, cc := range r.Cassettes {
+		var cassette *Cassette
+		for i := range cassettes {
+			if cassettes[i].Position == cc.Position {
+				cassette = &cassettes[i]
+			}
+		}
+
+		if cassette == nil || seen[cc.Position] || cc.Count < 0 {
+			return nil, ErrInvalidCashOperation
+		}
+		seen[cc.Position] = true
+
+		counted = append(counted, BanknoteCount{Denomination: cassette.Denomination, Count: cc.Count})
+	}
+
+	return append(counted, r.DepositBin...), nil
+}
+
+// DenominationBalance is the balancing of one denomination. Expected is Opening plus every
+// movement of the shift, Discrepancy is Counted less Expected.
+type DenominationBalance struct {
+	Denomination int64 `json:"denomination"`
+	Opening      int   `json:"opening"`
+	Replenished  int   `json:"replenished"`
+	PickedUp     int   `json:"picked_up"`
+	Dispensed    int   `json:"dispensed"`
+	Deposited    int   `json:"deposited"`
+	Adjusted     int   `json:"adjusted"`
+	Expected     int   `json:"expected"`
+	Counted      int   `json:"counted"`
+	Discrepancy  int   `json:"discrepancy"`
+}
+
+// BalancingReport is the end of shift balancing of a terminal. It covers the movements after
+// LastMovementId of the previous report and opens with the notes counted then.
+type BalancingReport struct {
+	Id             int64                 `json:"id"`
+	TerminalId     string                `json:"terminal_id"`
+	Operator       string                `json:"operator"`
+	PeriodStart    *time.Time            `json:"period_start,omitempty"`
+	LastMovementId int64                 `json:"last_movement_id"`
+	Denominations  []DenominationBalance `json:"denominations"`
+	Expected       Money                 `json:"expected"`
+	Counted        Money                 `json:"counted"`
+	Discrepancy    Money                 `json:"discrepancy"`
+	// Balanced is false when any denomination has a discrepancy
+	Balanced  bool      `json:"balanced"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewBalancingReport adds movements to the counts of previous, nil for the first shift of the
+// terminal, and compares the outcome with counted
+func NewBalancingReport(terminalId string, previous *BalancingReport, movements []CashMovement, counted []BanknoteCount) (*BalancingReport, error) {
+	report := &BalancingReport{TerminalId: terminalId, Balanced: true, CreatedAt: time.Now()}
+
+	balances := make(map[int64]*DenominationBalance)
+	balance := func(denomination int64) *DenominationBalance {
+		if b, ok := balances[denomination]; ok {
+			return b
+		}
+		b := &DenominationBalance{Denomination: denomination}
+		balances[denomination] = b
+		return b
+	}
+
+	if previous != nil {
+		report.PeriodStart = &previous.CreatedAt
+		report.LastMovementId = previous.LastMovementId
+		for _, d := range previous.Denominations {
+			balance(d.Denomination).Opening = d.Counted
+		}
+	}
+
+	for _, m := range movements {
+		b := balance(m.Denomination)
+		switch m.Kind {
+		case CashReplenishment:
+			b.Replenished += m.Count
+		case CashPickup:
+			b.PickedUp -= m.Count
+		case CashDispense, CashReversal:
+			b.Dispensed -= m.Count
+		case CashDeposit:
+			b.Deposited += m.Count
+		default:
+			b.Adjusted += m.Count
+		}
+
+		if m.Id > report.LastMovementId {
+			report.LastMovementId = m.Id
+		}
+	}
+
+	for _, c := range counted {
+		if c.Count < 0 || !banknotes[c.Denomination] {
+			return nil, ErrInvalidCashOperation
+		}
+		balance(c.Denomination).Counted += c.Count
+	}
+
+	var expected, counts int64
+	for _, b := range balances {
+		b.Expected = b.Opening + b.Replenished - b.PickedUp - b.Dispensed + b.Deposited + b.Adjusted
+		b.Discrepancy = b.Counted - b.Expected
+		if b.Discrepancy != 0 {
+			report.Balanced = false
+		}
+
+		expected += int64(b.Expected) * b.Denomination
+		counts += int64(b.Counted) * b.Denomination
+		report.Denominations = append(report.Denominations, *b)
+	}
+	sort.Slice(report.Denominations, func(i, j int) bool {
+		return report.Denominations[i].Denomination < report.Denominations[j].Denomination
+	})
+
+	report.Expected = NewMoney(expected * 100)
+	report.Counted = NewMoney(counts * 100)
+	report.Discrepancy = NewMoney((counts - expected) * 100)
+	return report, nil
+}
+
+// Cash is what the terminal can pay out from its cassettes
+func (t *Terminal) Cash() Money {
+	var baht int64
+	for _, c := range t.Cassettes {
+		if t.Supports(c.Denomination) && c.Count > 0 {
+			baht += int64(c.Count) * c.Denomination
+		}
+	}
+	return NewMoney(baht * 100)
+}
+
+// IsLowOnCash tells whether cash is under the low cash threshold of the terminal
+func (t *Terminal) IsLowOnCash(cash Money) bool {
+	return t.LowCashThreshold != nil && cash.Satang < t.LowCashThreshold.Satang
+}
+
+// DepositedNotes checks that the notes a terminal took in for a deposit make up its amount
+func DepositedNotes(tr *Transaction) error {
+	var baht int64
+	for _, n := range tr.Notes {
+		if n.Count <= 0 || !banknotes[n.Denomination] {
+			return ErrInvalidCashOperation
+		}
+		baht += int64(n.Count) * n.Denomination
+	}
+
+	if baht*100 != tr.Amount.Satang {
+		return ErrInvalidCashOperation
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewBalancingReport(t *testing.T) {
+	movements := []CashMovement{
+		{Id: 1, Kind: CashAdjustment, Denomination: 100, Count: 50},
+		{Id: 2, Kind: CashReplenishment, Denomination: 100, Count: 20},
+		{Id: 3, Kind: CashDispense, Denomination: 100, Count: -5},
+		{Id: 4, Kind: CashPickup, Denomination: 100, Count: -10},
+		{Id: 6, Kind: CashDeposit, Position: DepositBin, Denomination: 1000, Count: 3},
+		{Id: 5, Kind: CashAdjustment, Denomination: 500, Count: 4},
+	}
+	counted := []BanknoteCount{{Denomination: 100, Count: 50}, {Denomination: 100, Count: 3}, {Denomination: 500, Count: 4}, {Denomination: 1000, Count: 3}}
+
+	first, err := NewBalancingReport("ATM-0001", nil, movements, counted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []DenominationBalance{
+		{Denomination: 100, Replenished: 20, PickedUp: 10, Dispensed: 5, Adjusted: 50, Expected: 55, Counted: 53, Discrepancy: -2},
+		{Denomination: 500, Adjusted: 4, Expected: 4, Counted: 4},
+		{Denomination: 1000, Deposited: 3, Expected: 3, Counted: 3},
+	}
+	if !reflect.DeepEqual(first.Denominations, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", first.Denominations, want)
+	}
+	if first.Balanced || first.PeriodStart != nil || first.LastMovementId != 6 {
+		t.Errorf("got balanced %v from %v up to %d, want unbalanced from the start up to 6", first.Balanced, first.PeriodStart, first.LastMovementId)
+	}
+	if first.Expected.Satang != 1050000 || first.Counted.Satang != 1030000 || first.Discrepancy.Satang != -20000 {
+		t.Errorf("got expected %s, counted %s, off by %s", first.Expected, first.Counted, first.Discrepancy)
+	}
+
+	// the next shift opens with what was counted, not with what was expected
+	first.CreatedAt = time.Date(2026, 10, 1, 18, 0, 0, 0, time.UTC)
+	next, err := NewBalancingReport("ATM-0001", first, []CashMovement{{Id: 7, Kind: CashDispense, Denomination: 1000, Count: -1}},
+		[]BanknoteCount{{Denomination: 100, Count: 53}, {Denomination: 500, Count: 4}, {Denomination: 1000, Count: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !next.Balanced || next.LastMovementId != 7 || next.PeriodStart == nil || !next.PeriodStart.Equal(first.CreatedAt) {
+		t.Errorf("got %+v, want balanced from the first report up to 7", next)
+	}
+	if opening := next.Denominations[0].Opening; opening != 53 {
+		t.Errorf("opened with %d notes of 100, want the 53 counted", opening)
+	}
+
+	// a shift without movements keeps covering up to the previous report
+	quiet, err := NewBalancingReport("ATM-0001", next, nil, []BanknoteCount{{Denomination: 100, Count: 53}, {Denomination: 500, Count: 4}, {Denomination: 1000, Count: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !quiet.Balanced || quiet.LastMovementId != 7 {
+		t.Errorf("got balanced %v up to %d, want balanced up to 7", quiet.Balanced, quiet.LastMovementId)
+	}
+}
+
+func TestNewBalancingReportInvalidCount(t *testing.T) {
+	for _, counted := range [][]BanknoteCount{
+		{{Denomination: 100, Count: -1}},
+		{{Denomination: 30, Count: 1}},
+	} {
+		if _, err := NewBalancingReport("ATM-0001", nil, nil, counted); err != ErrInvalidCashOperation {
+			t.Errorf("%+v: got %v, want ErrInvalidCashOperation", counted, err)
+		}
+	}
+}
+
+func TestBalancingRequestCounted(t *testing.T) {
+	cassettes := []Cassette{{Position: 1, Denomination: 100}, {Position: 2, Denomination: 500}}
+
+	tests := []struct {
+		name      string
+		cassettes []CassetteCount
+		err       error
+	}{
+		{"every cassette", []CassetteCount{{Position: 2, Count: 3}, {Position: 1, Count: 7}}, nil},
+		{"missing", []CassetteCount{{Position: 1, Count: 7}}, ErrInvalidCashOperation},
+		{"twice", []CassetteCount{{Position: 1, Count: 7}, {Position: 1, Count: 7}}, ErrInvalidCashOperation},
+		{"unknown", []CassetteCount{{Position: 1, Count: 7}, {Position: 3, Count: 3}}, ErrInvalidCashOperation},
+		{"negative", []CassetteCount{{Position: 1, Count: 7}, {Position: 2, Count: -1}}, ErrInvalidCashOperation},
+	}
+
+	for _, tt := range tests {
+		req := BalancingRequest{Cassettes: tt.cassettes, DepositBin: []BanknoteCount{{Denomination: 1000, Count: 2}}}
+		counted, err := req.Counted(cassettes)
+		if err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+
+		want := []BanknoteCount{{Denomination: 500, Count: 3}, {Denomination: 100, Count: 7}, {Denomination: 1000, Count: 2}}
+		if err == nil && !reflect.DeepEqual(counted, want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, counted, want)
+		}
+	}
+}
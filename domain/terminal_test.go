@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanNotes(t *testing.T) {
+	tests := []struct {
+		name      string
+		baht      int64
+		available map[int64]int
+		want      map[int64]int
+	}{
+		// a greedy pick of the 50 first leaves 10 that no note makes up
+		{"60 from 20 and 50", 60, map[int64]int{20: 10, 50: 10}, map[int64]int{20: 3, 50: 0}},
+		{"80 from 20 and 50", 80, map[int64]int{20: 10, 50: 10}, map[int64]int{20: 4, 50: 0}},
+		{"110 from 20 and 50", 110, map[int64]int{20: 10, 50: 10}, map[int64]int{20: 3, 50: 1}},
+		{"160 from 20, 50 and 100", 160, map[int64]int{20: 10, 50: 10, 100: 10}, map[int64]int{20: 3, 50: 0, 100: 1}},
+		{"2600 from all notes", 2600, map[int64]int{20: 10, 50: 10, 100: 10, 500: 10, 1000: 10}, map[int64]int{20: 0, 50: 0, 100: 1, 500: 1, 1000: 2}},
+		// depleted cassettes
+		{"100 with one 50 left", 100, map[int64]int{20: 10, 50: 1}, map[int64]int{20: 5, 50: 0}},
+		{"1000 without 1000s", 1000, map[int64]int{100: 10, 500: 1, 1000: 0}, map[int64]int{100: 5, 500: 1, 1000: 0}},
+		{"60 with two 20s left", 60, map[int64]int{20: 2, 50: 10}, nil},
+		{"nothing left", 100, map[int64]int{100: 0}, nil},
+		{"no cassettes", 100, map[int64]int{}, nil},
+		// the cap of MaxDispenseNotes
+		{"40 notes", 40000, map[int64]int{1000: 50}, map[int64]int{1000: 40}},
+		{"41 notes", 41000, map[int64]int{1000: 50}, nil},
+		{"45 notes at least", 2100, map[int64]int{20: 40, 50: 40}, nil},
+		// amounts no notes make up
+		{"10 from 20 and 50", 10, map[int64]int{20: 10, 50: 10}, nil},
+		{"30 from 20 and 50", 30, map[int64]int{20: 10, 50: 10}, nil},
+		{"150 from 100 and 500", 150, map[int64]int{100: 10, 500: 10}, nil},
+	}
+
+	// for Thai banknotes both strategies agree: swapping smaller notes for larger ones of the
+	// same value always takes fewer notes
+	for _, strategy := range []string{DispenseMinimalNotes, DispensePreserveSmallNotes} {
+		for _, tt := range tests {
+			got, ok := planNotes(tt.baht, tt.available, strategy)
+			if ok != (tt.want != nil) || (ok && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("%s, %s: got %v, %v, want %v", strategy, tt.name, got, ok, tt.want)
+			}
+		}
+	}
+}
+
+func TestPlanDispense(t *testing.T) {
+	terminal := Terminal{
+		Id:            "ATM-0001",
+		Status:        TerminalOnline,
+		Denominations: []int64{100, 500},
+		Cassettes: []Cassette{
+			{Id: 3, Position: 3, Denomination: 500, Count: 1},
+			{Id: 1, Position: 1, Denomination: 100, Count: 3},
+			{Id: 2, Position: 2, Denomination: 100, Count: 5},
+			// notes the terminal does not pay out are left alone
+			{Id: 4, Position: 4, Denomination: 1000, Count: 10},
+			{Id: 5, Position: 5, Denomination: 500, Count: 0},
+		},
+	}
+
+	for _, strategy := range []string{DispenseMinimalNotes, DispensePreserveSmallNotes} {
+		terminal.DispenseStrategy = strategy
+
+		plan, err := terminal.PlanDispense(NewMoney(100000))
+		if err != nil {
+			t.Fatalf("%s: %v", strategy, err)
+		}
+		want := []DispenseNote{
+			{CassetteId: 1, Position: 1, Denomination: 100, Count: 3},
+			{CassetteId: 2, Position: 2, Denomination: 100, Count: 2},
+			{CassetteId: 3, Position: 3, Denomination: 500, Count: 1},
+		}
+		if plan.TerminalId != "ATM-0001" || plan.Amount.Satang != 100000 || !reflect.DeepEqual(plan.Notes, want) {
+			t.Errorf("%s: got %+v, want %+v", strategy, plan, want)
+		}
+
+		// 1,400 needs nine 100s, only eight are left
+		if _, err = terminal.PlanDispense(NewMoney(140000)); err != ErrCannotDispense {
+			t.Errorf("%s: got %v, want ErrCannotDispense", strategy, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		amount Money
+		status string
+		err    error
+	}{
+		{"satang", NewMoney(10050), TerminalOnline, ErrCannotDispense},
+		{"zero", NewMoney(0), TerminalOnline, ErrCannotDispense},
+		{"negative", NewMoney(-10000), TerminalOnline, ErrCannotDispense},
+		{"offline", NewMoney(10000), TerminalOffline, ErrTerminalUnavailable},
+		{"out of service", NewMoney(10000), TerminalOutOfService, ErrTerminalUnavailable},
+	}
+
+	for _, tt := range tests {
+		terminal.Status = tt.status
+		if _, err := terminal.PlanDispense(tt.amount); err != tt.err {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
@@ -5,49 +5,167 @@ import (
 	"time"
 )
 
+const (
+	TransactionPending   = "pending"
+	TransactionCompleted = "completed"
+	TransactionFailed    = "failed"
+	TransactionReversed  = "reversed"
+	// TransactionClearing is a transfer to another bank that left the account and waits for the clearing house
+	TransactionClearing = "clearing"
+	// TransactionReturned is a transfer the clearing house rejected, the money went back in a reversal
+	TransactionReturned = "returned"
+)
+
+// transactionTransitions lists the statuses a transaction may move to from each status
+var transactionTransitions = map[string][]string{
+	"":                   {TransactionPending},
+	TransactionPending:   {TransactionCompleted, TransactionFailed, TransactionClearing},
+	TransactionClearing:  {TransactionCompleted, TransactionReturned},
+	TransactionCompleted: {TransactionReversed},
+}
+
 type Transaction struct {
 	Id          int64     `json:"id"`
-	Amount      float64   `json:"amount"`
+	Amount      Money     `json:"amount"`
 	Type        string    `json:"type"`
-	Fee         float64   `json:"fee"`
-	Total       float64   `json:"total"`
+	Fee         Money     `json:"fee"`
+	Total       Money     `json:"total"`
 	SubmittedAt time.Time `json:"submitted_at"`
 	CreatedAt   time.Time `json:"created_at"`
 	Account     Account   `json:"account"`
 	Receiver    Account   `json:"receiver,omitempty"`
+	// ReceiverProxy is resolved to Receiver when a transfer is sent to a PromptPay proxy
+	ReceiverProxy *ProxyRef `json:"receiver_proxy,omitempty"`
+	Channel       string    `json:"channel,omitempty"`
+	// TerminalId is the ATM paying out a withdrawal or taking in a deposit, Dispense the notes it
+	// pays out and Notes the notes it took in
+	TerminalId string          `json:"terminal_id,omitempty"`
+	Dispense   *DispensePlan   `json:"dispense,omitempty"`
+	Notes      []BanknoteCount `json:"notes,omitempty"`
+	// FeeRuleId is the fee rule that priced Fee, 0 when no rule applied
+	FeeRuleId int64 `json:"fee_rule_id,omitempty"`
+	// ReferenceId links a reversal to the transaction it reverses
+	ReferenceId int64      `json:"reference_id,omitempty"`
+	Remark      string     `json:"remark,omitempty"`
+	ReversedAt  *time.Time `json:"reversed_at,omitempty"`
+	// RefundedAmount is how much of Amount partial reversals gave back so far, the transaction is
+	// reversed once it reaches Amount
+	RefundedAmount Money  `json:"refunded_amount"`
+	Status         string `json:"status"`
+	// FailureCode and FailureReason tell why a failed transaction was declined, see ErrorCode
+	FailureCode   int    `json:"failure_code,omitempty"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// Transition moves the transaction to status if the lifecycle allows it
+func (t *Transaction) Transition(status string) error {
+	for _, next := range transactionTransitions[t.Status] {
+		if next == status {
+			t.Status = status
+			return nil
+		}
+	}
+	return ErrInvalidStatusTransition
+}
+
+// Fail moves a pending transaction to failed and records why
+func (t *Transaction) Fail(cause error) error {
+	if err := t.Transition(TransactionFailed); err != nil {
+		return err
+	}
+	t.FailureCode, t.FailureReason = ErrorCode(cause)
+	return nil
+}
+
+// IsPosted tells whether the transaction has moved money, i.e. it belongs on balances and statements
+func (t *Transaction) IsPosted() bool {
+	switch t.Status {
+	case TransactionCompleted, TransactionReversed, TransactionClearing, TransactionReturned:
+		return true
+	}
+	return false
+}
+
+// IsSettled tells whether the transaction has its outcome. Only settled transactions move to the
+// history, a pending or clearing one is settled in the live table.
+func (t *Transaction) IsSettled() bool {
+	return t.Status != TransactionPending && t.Status != TransactionClearing
+}
+
+// IsInterbank tells whether the transfer goes to an account of another bank, which only the
+// clearing house can credit
+func (t *Transaction) IsInterbank() bool {
+	return t.Type == "transfer" && t.Receiver.Bank != "" && t.Receiver.Bank != t.Account.Bank
+}
+
+// ReversalRequest undoes a transaction, possibly in several parts. Amount defaults to what is left
+// of the original; the fee is refunded with the part that completes the reversal.
+type ReversalRequest struct {
+	Amount *Money `json:"amount,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// TransactionFilter narrows down the history of one account. Empty fields are not filtered on.
+type TransactionFilter struct {
+	AccountNo    string
+	From         *time.Time
+	To           *time.Time
+	Type         string
+	Status       string
+	MinAmount    *Money
+	MaxAmount    *Money
+	Counterparty string
+	Cursor       string
+	Num          int64
 }
 
-type ScheduledTransaction struct {
-	Id                   int64     `json:"id"`
-	Amount               float64   `json:"amount"`
-	Type                 string    `json:"type"`
-	Account              Account   `json:"account"`
-	Receiver             Account   `json:"receiver,omitempty"`
-	Status               string    `json:"status"`
-	SubmittedAt          time.Time `json:"submitted_at"`
-	CreatedAt            time.Time `json:"created_at"`
-	ScheduledExecutionAt string    `json:"scheduled_execution_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
+// TransactionUsage sums up the posted transactions of an account
+type TransactionUsage struct {
+	Count  int64
+	Amount Money
 }
 
 type TransactionUsecase interface {
-	// GetAllTransaction(ctx context.Context, cursor string, num int64) ([]Transaction, string, error)
-	// CreateTransaction(context.Context, *Transaction) error
-	Withdraw(context.Context, *Transaction) error
+	GetAllTransaction(ctx context.Context, uuid string, filter TransactionFilter) ([]Transaction, string, error)
+	GetTransactionByTID(ctx context.Context, uuid string, account_no string, tid int64) (*Transaction, error)
+	// WithdrawWithPin is a withdraw at an ATM terminal, pin is what the card holder keyed in
+	WithdrawWithPin(ctx context.Context, tr *Transaction, pin string) error
 	Deposit(context.Context, *Transaction) error
 	Transfer(context.Context, *Transaction) error
+	Reverse(ctx context.Context, tid int64, req ReversalRequest) (*Transaction, error)
 	PollScheduledTransaction(ctx context.Context, time time.Time) (err error)
-	SaveScheduledTransaction(ctx context.Context, transaction *ScheduledTransaction) (err error)
-	ConsumeScheduledTransaction(ctx context.Context) (err error)
+	// ConsumeScheduledTransaction runs the execution a message of ScheduledTransactionTopic names
+	ConsumeScheduledTransaction(ctx context.Context, message *Message) error
+	// SaveScheduledTransaction only schedules transfers from accounts of the user uuid
+	SaveScheduledTransaction(ctx context.Context, uuid string, transaction *ScheduledTransaction) (err error)
+	GetScheduledTransactions(ctx context.Context, uuid string) ([]ScheduledTransaction, error)
+	GetScheduledTransactionByID(ctx context.Context, uuid string, id int64) (*ScheduledTransaction, error)
+	UpdateScheduledTransaction(ctx context.Context, uuid string, st *ScheduledTransaction) error
+	CancelScheduledTransaction(ctx context.Context, uuid string, id int64) error
+	// HandlePaymentStatus is the consumer of the status reports of the clearing house
+	HandlePaymentStatus(ctx context.Context, message *Message) error
+	// ReconcileInterbankTransfers chases the transfers the clearing house has not reported on
+	ReconcileInterbankTransfers(ctx context.Context, now time.Time) error
+	// ReceiveInterbankTransfer credits the receiver of the interbank transfer endToEndId when its
+	// account is held here, as its bank does once the clearing house settled it. It returns
+	// ErrResipientNotFound for an account held elsewhere and ErrClearingRejected for a transfer
+	// already returned to the sender.
+	ReceiveInterbankTransfer(ctx context.Context, endToEndId string) error
+	CreateCardlessWithdrawal(ctx context.Context, uuid string, accountNo string, req CardlessWithdrawalRequest) (*CardlessWithdrawal, error)
+	// RedeemCardlessWithdrawal turns the hold into a withdraw transaction for the terminal paying out the cash
+	RedeemCardlessWithdrawal(ctx context.Context, terminalId string, req CardlessRedemption) (*Transaction, error)
+	ExpireCardlessWithdrawals(ctx context.Context, now time.Time) error
 }
 
 type TransactionRepository interface {
-	// GetAllTransaction(ctx context.Context, cursor string, num int64) (res []Transaction, nextCursor string, err error)
-	// GetTransactionByTID(ctx context.Context, tid int64) (Transaction, error)
+	GetAllTransaction(ctx context.Context, filter TransactionFilter) (res []Transaction, nextCursor string, err error)
+	GetTransactionByTID(ctx context.Context, tid int64) (Transaction, error)
+	GetTransactionByTIDForUpdate(ctx context.Context, tid int64) (Transaction, error)
 	CreateTransaction(ctx context.Context, tr *Transaction) error
-	SetTransferAmountPerDayInRedis(ctx context.Context, tr *Transaction) error
+	UpdateTransactionStatus(ctx context.Context, tr *Transaction, from string) error
+	GetTransactionUsage(ctx context.Context, account_no string, transactionType string, channel string, since time.Time) (TransactionUsage, error)
+	// RecordRefund stores RefundedAmount, Status and ReversedAt of tr, provided its refunded amount is
+	// still refundedBefore
+	RecordRefund(ctx context.Context, tr *Transaction, refundedBefore Money) error
 	MigrateTransactionHistory(ctx context.Context) (err error)
-	CreateScheduledTransaction(ctx context.Context, st *ScheduledTransaction) (err error)
-	GetScheduledTransaction(ctx context.Context, time time.Time) (transaction []ScheduledTransaction, err error)
-	UpdateScheduledTransaction(ctx context.Context, tr ScheduledTransaction) (err error)
 }
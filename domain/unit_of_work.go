@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// UnitOfWork runs a set of repository calls inside a single database transaction.
+// Repositories called with the ctx handed to fn join that transaction, and any
+// error returned by fn rolls the whole unit back.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type commitsKey struct{}
+
+// WithCommitTracking returns a ctx in which units of work note that they tried to commit, so the
+// caller can tell afterwards whether anything may have been written. See MayHaveCommitted.
+func WithCommitTracking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commitsKey{}, new(int32))
+}
+
+// MarkCommitting is called by a UnitOfWork right before it commits, whether the commit then goes
+// through or not
+func MarkCommitting(ctx context.Context) {
+	if commits, ok := ctx.Value(commitsKey{}).(*int32); ok {
+		atomic.AddInt32(commits, 1)
+	}
+}
+
+// MayHaveCommitted reports whether a unit of work run with ctx tried to commit. Without
+// WithCommitTracking nothing is known, and it is true.
+func MayHaveCommitted(ctx context.Context) bool {
+	commits, ok := ctx.Value(commitsKey{}).(*int32)
+	return !ok || atomic.LoadInt32(commits) > 0
+}
@@ -0,0 +1,325 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"main/domain"
+)
+
+var ErrUnknownMode = errors.New("unknown topic provisioning mode, want off, validate, create or alter")
+
+const (
+	retentionConfig     = "retention.ms"
+	cleanupPolicyConfig = "cleanup.policy"
+)
+
+// Mode is how far Provision may go to make the cluster match the config
+type Mode int
+
+const (
+	// Off leaves the topics alone
+	Off Mode = iota
+	// Validate only reports the missing topics and the drift
+	Validate
+	// Create creates the missing topics, existing ones are only reported on
+	Create
+	// Alter also brings existing topics in line where Kafka allows it: partitions can only be
+	// added and the replication factor needs a reassignment, so those may stay drifted
+	Alter
+)
+
+// ParseMode reads the mode of the kafka.provision config
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "", "off":
+		return Off, nil
+	case "validate":
+		return Validate, nil
+	case "create":
+		return Create, nil
+	case "alter":
+		return Alter, nil
+	default:
+		return Off, ErrUnknownMode
+	}
+}
+
+// TopicSpec is how a topic should look on the cluster. Zero values are not managed and left
+// to the broker defaults. A topic with Retries also has its retry topics and its dead letter
+// topic, set up like the topic itself except that the dead letter topic keeps its messages for
+// DeadLetterRetention.
+type TopicSpec struct {
+	Name                string        `mapstructure:"name"`
+	Partitions          int32         `mapstructure:"partitions"`
+	ReplicationFactor   int16         `mapstructure:"replication_factor"`
+	Retention           time.Duration `mapstructure:"retention"`
+	CleanupPolicy       string        `mapstructure:"cleanup_policy"`
+	Retries             bool          `mapstructure:"retries"`
+	DeadLetterRetention time.Duration `mapstructure:"dlq_retention"`
+}
+
+// TopicsConfig is the kafka.topics config section, a topic in List only sets what differs from Defaults
+type TopicsConfig struct {
+	Defaults TopicSpec   `mapstructure:"defaults"`
+	List     []TopicSpec `mapstructure:"list"`
+}
+
+// Specs returns the topics of the config with the defaults filled in, and retries retry topics
+// and a dead letter topic for each topic with Retries, one per entry of kafka.consumer.retry_delays
+func (c TopicsConfig) Specs(retries int) []TopicSpec {
+	specs := make([]TopicSpec, 0, len(c.List))
+	for _, t := range c.List {
+		if t.Partitions == 0 {
+			t.Partitions = c.Defaults.Partitions
+		}
+		if t.ReplicationFactor == 0 {
+			t.ReplicationFactor = c.Defaults.ReplicationFactor
+		}
+		if t.Retention == 0 {
+			t.Retention = c.Defaults.Retention
+		}
+		if t.CleanupPolicy == "" {
+			t.CleanupPolicy = c.Defaults.CleanupPolicy
+		}
+		if t.Retries && t.DeadLetterRetention == 0 {
+			t.DeadLetterRetention = c.Defaults.DeadLetterRetention
+		}
+		specs = append(specs, t)
+
+		if !t.Retries {
+			continue
+		}
+
+		derived := t
+		derived.Retries, derived.DeadLetterRetention = false, 0
+		for i := 1; i <= retries; i++ {
+			derived.Name = domain.RetryTopic(t.Name, i)
+			specs = append(specs, derived)
+		}
+
+		derived.Name = domain.DeadLetterTopic(t.Name)
+		if t.DeadLetterRetention != 0 {
+			derived.Retention = t.DeadLetterRetention
+		}
+		specs = append(specs, derived)
+	}
+	return specs
+}
+
+// configEntries are the managed topic configs of the spec
+func (t TopicSpec) configEntries() map[string]string {
+	entries := map[string]string{}
+	if t.Retention != 0 {
+		entries[retentionConfig] = strconv.FormatInt(t.Retention.Milliseconds(), 10)
+	}
+	if t.CleanupPolicy != "" {
+		entries[cleanupPolicyConfig] = t.CleanupPolicy
+	}
+	return entries
+}
+
+func (t TopicSpec) detail() *sarama.TopicDetail {
+	detail := &sarama.TopicDetail{
+		// -1 takes the broker default
+		NumPartitions:     -1,
+		ReplicationFactor: -1,
+		ConfigEntries:     map[string]*string{},
+	}
+	if t.Partitions != 0 {
+		detail.NumPartitions = t.Partitions
+	}
+	if t.ReplicationFactor != 0 {
+		detail.ReplicationFactor = t.ReplicationFactor
+	}
+	for name, value := range t.configEntries() {
+		value := value
+		detail.ConfigEntries[name] = &value
+	}
+	return detail
+}
+
+// Drift is a setting of a topic that differs between the config and the cluster
+type Drift struct {
+	Topic   string
+	Setting string
+	Want    string
+	Have    string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s is %s, config wants %s", d.Topic, d.Setting, d.Have, d.Want)
+}
+
+// Report is what Provision found and did
+type Report struct {
+	// Missing are the topics that do not exist and were not created
+	Missing []string
+	Created []string
+	Altered []Drift
+	// Drift is what still differs from the config
+	Drift []Drift
+}
+
+// InSync tells whether the cluster matches the config after the run
+func (r Report) InSync() bool {
+	return len(r.Missing) == 0 && len(r.Drift) == 0
+}
+
+// Provision compares the topics on the cluster with specs and, as far as mode allows, changes
+// the cluster to match
+func Provision(admin sarama.ClusterAdmin, specs []TopicSpec, mode Mode) (report Report, err error) {
+	if mode == Off {
+		return report, nil
+	}
+
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return report, err
+	}
+
+	for _, spec := range specs {
+		detail, ok := existing[spec.Name]
+		if !ok {
+			if mode == Validate {
+				report.Missing = append(report.Missing, spec.Name)
+				continue
+			}
+
+			err = admin.CreateTopic(spec.Name, spec.detail(), false)
+			// another replica starting at the same time got there first
+			if errors.Is(err, sarama.ErrTopicAlreadyExists) {
+				continue
+			}
+			if err != nil {
+				return report, fmt.Errorf("create topic %s: %w", spec.Name, err)
+			}
+
+			report.Created = append(report.Created, spec.Name)
+			continue
+		}
+
+		drift, err := topicDrift(admin, spec, detail)
+		if err != nil {
+			return report, err
+		}
+
+		if mode != Alter {
+			report.Drift = append(report.Drift, drift...)
+			continue
+		}
+
+		altered, left, err := alterTopic(admin, spec, drift)
+		report.Altered = append(report.Altered, altered...)
+		report.Drift = append(report.Drift, left...)
+		if err != nil {
+			return report, fmt.Errorf("alter topic %s: %w", spec.Name, err)
+		}
+	}
+
+	return report, nil
+}
+
+func topicDrift(admin sarama.ClusterAdmin, spec TopicSpec, detail sarama.TopicDetail) (drift []Drift, err error) {
+	if spec.Partitions != 0 && detail.NumPartitions != spec.Partitions {
+		drift = append(drift, Drift{
+			Topic:   spec.Name,
+			Setting: "partitions",
+			Want:    strconv.Itoa(int(spec.Partitions)),
+			Have:    strconv.Itoa(int(detail.NumPartitions)),
+		})
+	}
+
+	if spec.ReplicationFactor != 0 && detail.ReplicationFactor != spec.ReplicationFactor {
+		drift = append(drift, Drift{
+			Topic:   spec.Name,
+			Setting: "replication_factor",
+			Want:    strconv.Itoa(int(spec.ReplicationFactor)),
+			Have:    strconv.Itoa(int(detail.ReplicationFactor)),
+		})
+	}
+
+	want := spec.configEntries()
+	if len(want) == 0 {
+		return drift, nil
+	}
+
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+
+	// unlike ListTopics this also returns the values the topic takes from the broker defaults
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{
+		Type:        sarama.TopicResource,
+		Name:        spec.Name,
+		ConfigNames: names,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe topic %s: %w", spec.Name, err)
+	}
+
+	have := map[string]string{}
+	for _, entry := range entries {
+		have[entry.Name] = entry.Value
+	}
+
+	for _, name := range []string{retentionConfig, cleanupPolicyConfig} {
+		if value, ok := want[name]; ok && have[name] != value {
+			drift = append(drift, Drift{
+				Topic:   spec.Name,
+				Setting: name,
+				Want:    value,
+				Have:    have[name],
+			})
+		}
+	}
+
+	return drift, nil
+}
+
+// alterTopic fixes what it can of drift and returns the rest
+func alterTopic(admin sarama.ClusterAdmin, spec TopicSpec, drift []Drift) (altered, left []Drift, err error) {
+	configs := map[string]sarama.IncrementalAlterConfigsEntry{}
+	var configDrift []Drift
+
+	for _, d := range drift {
+		switch d.Setting {
+		case "partitions":
+			have, _ := strconv.Atoi(d.Have)
+			if int32(have) > spec.Partitions {
+				left = append(left, d)
+				continue
+			}
+			// keys move to other partitions, so ordering only holds for new messages
+			if err = admin.CreatePartitions(spec.Name, spec.Partitions, nil, false); err != nil {
+				return altered, append(left, d), err
+			}
+			altered = append(altered, d)
+		case retentionConfig, cleanupPolicyConfig:
+			value := d.Want
+			configs[d.Setting] = sarama.IncrementalAlterConfigsEntry{
+				Operation: sarama.IncrementalAlterConfigsOperationSet,
+				Value:     &value,
+			}
+			configDrift = append(configDrift, d)
+		default:
+			left = append(left, d)
+		}
+	}
+
+	if len(configs) == 0 {
+		return altered, left, nil
+	}
+
+	// only touches the configs named, the other overrides of the topic stay
+	if err = admin.IncrementalAlterConfig(sarama.TopicResource, spec.Name, configs, false); err != nil {
+		return altered, append(left, configDrift...), err
+	}
+
+	return append(altered, configDrift...), left, nil
+}
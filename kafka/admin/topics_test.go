@@ -0,0 +1,234 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// testAdmin is a cluster with topics, it records what Provision changes
+type testAdmin struct {
+	sarama.ClusterAdmin
+	topics  map[string]sarama.TopicDetail
+	configs map[string]map[string]string
+
+	created    []string
+	partitions map[string]int32
+	altered    map[string]map[string]string
+}
+
+func newTestAdmin() *testAdmin {
+	return &testAdmin{
+		topics:     map[string]sarama.TopicDetail{},
+		configs:    map[string]map[string]string{},
+		partitions: map[string]int32{},
+		altered:    map[string]map[string]string{},
+	}
+}
+
+// addTopic puts a topic on the cluster
+func (a *testAdmin) addTopic(name string, partitions int32, replicationFactor int16, retention time.Duration, cleanupPolicy string) {
+	a.topics[name] = sarama.TopicDetail{NumPartitions: partitions, ReplicationFactor: replicationFactor}
+	a.configs[name] = map[string]string{
+		retentionConfig:     formatMillis(retention),
+		cleanupPolicyConfig: cleanupPolicy,
+	}
+}
+
+func formatMillis(d time.Duration) string {
+	return TopicSpec{Retention: d}.configEntries()[retentionConfig]
+}
+
+func (a *testAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return a.topics, nil
+}
+
+func (a *testAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	if _, ok := a.topics[topic]; ok {
+		return sarama.ErrTopicAlreadyExists
+	}
+	a.created = append(a.created, topic)
+	return nil
+}
+
+func (a *testAdmin) DescribeConfig(resource sarama.ConfigResource) ([]sarama.ConfigEntry, error) {
+	var entries []sarama.ConfigEntry
+	for _, name := range resource.ConfigNames {
+		entries = append(entries, sarama.ConfigEntry{Name: name, Value: a.configs[resource.Name][name]})
+	}
+	return entries, nil
+}
+
+func (a *testAdmin) CreatePartitions(topic string, count int32, assignment [][]int32, validateOnly bool) error {
+	a.partitions[topic] = count
+	return nil
+}
+
+func (a *testAdmin) IncrementalAlterConfig(resourceType sarama.ConfigResourceType, name string, entries map[string]sarama.IncrementalAlterConfigsEntry, validateOnly bool) error {
+	a.altered[name] = map[string]string{}
+	for config, entry := range entries {
+		a.altered[name][config] = *entry.Value
+	}
+	return nil
+}
+
+func TestSpecs(t *testing.T) {
+	config := TopicsConfig{
+		Defaults: TopicSpec{
+			Partitions:          6,
+			ReplicationFactor:   3,
+			Retention:           168 * time.Hour,
+			CleanupPolicy:       "delete",
+			DeadLetterRetention: 720 * time.Hour,
+		},
+		List: []TopicSpec{
+			{Name: "sms", Retries: true, DeadLetterRetention: time.Hour},
+			{Name: "sms_transaction", Partitions: 12, Retries: true},
+			{Name: "terminal_alerts", Retention: 24 * time.Hour, CleanupPolicy: "compact"},
+		},
+	}
+
+	spec := func(name string, partitions int32, retention time.Duration, cleanupPolicy string) TopicSpec {
+		return TopicSpec{Name: name, Partitions: partitions, ReplicationFactor: 3, Retention: retention, CleanupPolicy: cleanupPolicy}
+	}
+	sms := spec("sms", 6, 168*time.Hour, "delete")
+	sms.Retries, sms.DeadLetterRetention = true, time.Hour
+	tx := spec("sms_transaction", 12, 168*time.Hour, "delete")
+	tx.Retries, tx.DeadLetterRetention = true, 720*time.Hour
+
+	want := []TopicSpec{
+		sms,
+		spec("sms.retry.1", 6, 168*time.Hour, "delete"),
+		spec("sms.retry.2", 6, 168*time.Hour, "delete"),
+		spec("sms.dlq", 6, time.Hour, "delete"),
+		tx,
+		spec("sms_transaction.retry.1", 12, 168*time.Hour, "delete"),
+		spec("sms_transaction.retry.2", 12, 168*time.Hour, "delete"),
+		spec("sms_transaction.dlq", 12, 720*time.Hour, "delete"),
+		spec("terminal_alerts", 6, 24*time.Hour, "compact"),
+	}
+
+	if got := config.Specs(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", got, want)
+	}
+
+	// without retry delays a failed message goes straight to the dead letter topic
+	if got := config.Specs(0); len(got) != 5 || got[1].Name != "sms.dlq" || got[3].Name != "sms_transaction.dlq" {
+		t.Errorf("got %+v, want only the dead letter topics added", got)
+	}
+}
+
+func TestProvision(t *testing.T) {
+	specs := []TopicSpec{
+		{Name: "sms", Partitions: 6, ReplicationFactor: 3, Retention: 168 * time.Hour, CleanupPolicy: "delete"},
+		{Name: "sms.dlq", Partitions: 6, ReplicationFactor: 3, Retention: time.Hour, CleanupPolicy: "delete"},
+		{Name: "sms_transaction", Partitions: 6, ReplicationFactor: 3, Retention: 168 * time.Hour, CleanupPolicy: "delete"},
+		{Name: "terminal_alerts", Partitions: 6, ReplicationFactor: 3, Retention: 168 * time.Hour, CleanupPolicy: "delete"},
+	}
+
+	// sms matches, sms.dlq is missing, sms_transaction has too few partitions and the wrong
+	// retention, terminal_alerts has too many partitions and the wrong replication factor
+	cluster := func() *testAdmin {
+		a := newTestAdmin()
+		a.addTopic("sms", 6, 3, 168*time.Hour, "delete")
+		a.addTopic("sms_transaction", 3, 3, 24*time.Hour, "delete")
+		a.addTopic("terminal_alerts", 12, 1, 168*time.Hour, "delete")
+		return a
+	}
+
+	partitions := Drift{Topic: "sms_transaction", Setting: "partitions", Want: "6", Have: "3"}
+	retention := Drift{Topic: "sms_transaction", Setting: retentionConfig, Want: formatMillis(168 * time.Hour), Have: formatMillis(24 * time.Hour)}
+	shrink := Drift{Topic: "terminal_alerts", Setting: "partitions", Want: "6", Have: "12"}
+	replication := Drift{Topic: "terminal_alerts", Setting: "replication_factor", Want: "3", Have: "1"}
+
+	tests := []struct {
+		name       string
+		mode       Mode
+		want       Report
+		created    []string
+		partitions map[string]int32
+		altered    map[string]map[string]string
+	}{
+		{
+			name: "off",
+			mode: Off,
+			want: Report{},
+		},
+		{
+			name: "validate",
+			mode: Validate,
+			want: Report{
+				Missing: []string{"sms.dlq"},
+				Drift:   []Drift{partitions, retention, shrink, replication},
+			},
+		},
+		{
+			name:    "create",
+			mode:    Create,
+			want:    Report{Created: []string{"sms.dlq"}, Drift: []Drift{partitions, retention, shrink, replication}},
+			created: []string{"sms.dlq"},
+		},
+		{
+			// a shrink and the replication factor cannot be altered and are left as drift
+			name:       "alter",
+			mode:       Alter,
+			want:       Report{Created: []string{"sms.dlq"}, Altered: []Drift{partitions, retention}, Drift: []Drift{shrink, replication}},
+			created:    []string{"sms.dlq"},
+			partitions: map[string]int32{"sms_transaction": 6},
+			altered:    map[string]map[string]string{"sms_transaction": {retentionConfig: formatMillis(168 * time.Hour)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := cluster()
+			report, err := Provision(a, specs, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(report, tt.want) {
+				t.Errorf("got report %+v, want %+v", report, tt.want)
+			}
+			if !reflect.DeepEqual(a.created, tt.created) {
+				t.Errorf("created %v, want %v", a.created, tt.created)
+			}
+			if len(a.partitions) != len(tt.partitions) || (len(tt.partitions) != 0 && !reflect.DeepEqual(a.partitions, tt.partitions)) {
+				t.Errorf("set partitions %v, want %v", a.partitions, tt.partitions)
+			}
+			if len(a.altered) != len(tt.altered) || (len(tt.altered) != 0 && !reflect.DeepEqual(a.altered, tt.altered)) {
+				t.Errorf("altered %v, want %v", a.altered, tt.altered)
+			}
+			if report.InSync() != (len(tt.want.Missing) == 0 && len(tt.want.Drift) == 0) {
+				t.Errorf("in sync %v for %+v", report.InSync(), report)
+			}
+		})
+	}
+}
+
+func TestProvisionTopicCreatedMeanwhile(t *testing.T) {
+	a := newTestAdmin()
+	// listed as missing, then created by another replica before this one gets to it
+	a.topics["sms"] = sarama.TopicDetail{}
+	listed := map[string]sarama.TopicDetail{}
+
+	report, err := Provision(listedAdmin{a, listed}, []TopicSpec{{Name: "sms"}}, Create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Created) != 0 || len(report.Missing) != 0 {
+		t.Errorf("got %+v, want the topic taken as it is", report)
+	}
+}
+
+// listedAdmin lists topics instead of what is on the cluster
+type listedAdmin struct {
+	*testAdmin
+	topics map[string]sarama.TopicDetail
+}
+
+func (a listedAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return a.topics, nil
+}
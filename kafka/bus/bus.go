@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"main/bus"
+	"main/domain"
+	consumer "main/kafka/consumer"
+	producer "main/kafka/producer"
+
+	"github.com/Shopify/sarama"
+)
+
+type kafkaBus struct {
+	producer *producer.Producer
+	router   *bus.Router
+	group    *consumer.ConsumerGroupHandler
+}
+
+// NewKafkaBus will create an object that represent the domain.EventBus interface on client,
+// whose config went through producer.Configure. It consumes as groupID with concurrency workers
+// per partition, Publish waits up to publishTimeout for a message to be delivered.
+func NewKafkaBus(client sarama.Client, groupID string, concurrency int, retryDelays []time.Duration, publishTimeout time.Duration) (domain.EventBus, error) {
+	p, err := producer.NewProducer(client, publishTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	router := bus.NewRouter(p, retryDelays)
+
+	group, err := consumer.NewConsumerGroupHandler(client, groupID, concurrency, router)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	return &kafkaBus{
+		producer: p,
+		router:   router,
+		group:    group,
+	}, nil
+}
+
+func (k *kafkaBus) Publish(topic string, key string, headers map[string]string, message []byte) error {
+	return k.producer.Publish(topic, key, headers, message)
+}
+
+func (k *kafkaBus) Subscribe(topic string, handler domain.MessageHandler) {
+	k.router.Subscribe(topic, handler)
+}
+
+func (k *kafkaBus) SubscribeDeadLetters(topic string, handler domain.MessageHandler) {
+	k.router.SubscribeDeadLetters(topic, handler)
+}
+
+func (k *kafkaBus) Run(ctx context.Context) error {
+	return k.group.Run(ctx)
+}
+
+func (k *kafkaBus) Close() {
+	k.producer.Close()
+}
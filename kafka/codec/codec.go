@@ -0,0 +1,57 @@
+package codec
+
+import (
+	"main/domain"
+)
+
+// ContentTypeHeader is the Kafka header naming the encoding of a message
+const ContentTypeHeader = "content-type"
+
+// Codec encodes envelopes for the wire. Producers pick one, consumers pick by the header.
+type Codec interface {
+	ContentType() string
+	Encode(ev *Envelope) ([]byte, error)
+	Decode(data []byte) (*Envelope, error)
+}
+
+var (
+	JSON     Codec = jsonCodec{}
+	Protobuf Codec = protobufCodec{}
+)
+
+// ForName returns the codec configured by name, JSON when name is empty
+func ForName(name string) (Codec, error) {
+	switch name {
+	case "", "json":
+		return JSON, nil
+	case "protobuf":
+		return Protobuf, nil
+	}
+
+	return nil, ErrUnknownEncoding
+}
+
+func ForContentType(contentType string) (Codec, error) {
+	switch contentType {
+	case JSON.ContentType():
+		return JSON, nil
+	case Protobuf.ContentType():
+		return Protobuf, nil
+	}
+
+	return nil, ErrUnknownEncoding
+}
+
+// DecodeMessage decodes msg by its content type. A message without one comes from a producer
+// that predates the envelope and is read as the old pipe-delimited format.
+func DecodeMessage(msg *domain.Message) (*Envelope, error) {
+	if contentType, ok := msg.Headers[ContentTypeHeader]; ok {
+		c, err := ForContentType(contentType)
+		if err != nil {
+			return nil, err
+		}
+		return c.Decode(msg.Value)
+	}
+
+	return DecodeLegacy(string(msg.Value))
+}
@@ -0,0 +1,458 @@
+package codec
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"main/domain"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	testOccurredAt = time.Date(2023, 6, 1, 10, 0, 0, 123456789, time.UTC)
+	testCreatedAt  = time.Date(2023, 6, 1, 9, 59, 59, 0, time.UTC)
+)
+
+func testEnvelopes() []*Envelope {
+	return []*Envelope{
+		{
+			ID:            "5f0c1a2b-3c4d-4e5f-8a6b-7c8d9e0f1a2b",
+			Type:          TransactionEventType("transfer"),
+			Version:       TransactionVersion,
+			OccurredAt:    testOccurredAt,
+			CorrelationID: "req-1",
+			Payload: &TransactionEvent{
+				TransactionId: 42,
+				Type:          "transfer",
+				AccountNo:     "1000000001",
+				ReceiverNo:    "2000000001",
+				Currency:      "THB",
+				Amount:        10050,
+				Total:         10550,
+				Balance:       -2500,
+				Status:        "completed",
+				CreatedAt:     testCreatedAt,
+			},
+		},
+		{
+			ID:         "6f0c1a2b-3c4d-4e5f-8a6b-7c8d9e0f1a2b",
+			Type:       TerminalEventType("low_cash"),
+			Version:    TerminalVersion,
+			OccurredAt: testOccurredAt,
+			Payload: &TerminalEvent{
+				TerminalId: "T0001",
+				Location:   "Silom",
+				Currency:   "THB",
+				Cash:       1500000,
+				Threshold:  2000000,
+				CreatedAt:  testCreatedAt,
+			},
+		},
+		{
+			ID:            "7f0c1a2b-3c4d-4e5f-8a6b-7c8d9e0f1a2b",
+			Type:          ScheduledEventType("execution"),
+			Version:       ScheduledVersion,
+			OccurredAt:    testOccurredAt,
+			CorrelationID: "poll-1",
+			Payload: &ScheduledExecutionEvent{
+				ExecutionId:  7,
+				ScheduleId:   3,
+				Type:         "transfer",
+				AccountNo:    "1000000001",
+				ReceiverNo:   "2000000001",
+				Currency:     "THB",
+				Amount:       10050,
+				ScheduledFor: testCreatedAt,
+			},
+		},
+	}
+}
+
+// sameEnvelope compares a and b with their times by instant, protobuf decodes them in Local
+func sameEnvelope(t *testing.T, got *Envelope, want *Envelope) {
+	t.Helper()
+
+	if !got.OccurredAt.Equal(want.OccurredAt) {
+		t.Errorf("occurred at %v, want %v", got.OccurredAt, want.OccurredAt)
+	}
+	g, w := *got, *want
+	g.OccurredAt, w.OccurredAt = time.Time{}, time.Time{}
+	g.Payload, w.Payload = nil, nil
+	if g != w {
+		t.Errorf("got %+v, want %+v", g, w)
+	}
+
+	switch p := got.Payload.(type) {
+	case *TransactionEvent:
+		q := *want.Payload.(*TransactionEvent)
+		if !p.CreatedAt.Equal(q.CreatedAt) {
+			t.Errorf("created at %v, want %v", p.CreatedAt, q.CreatedAt)
+		}
+		gp := *p
+		gp.CreatedAt, q.CreatedAt = time.Time{}, time.Time{}
+		if gp != q {
+			t.Errorf("got %+v, want %+v", gp, q)
+		}
+	case *TerminalEvent:
+		q := *want.Payload.(*TerminalEvent)
+		if !p.CreatedAt.Equal(q.CreatedAt) {
+			t.Errorf("created at %v, want %v", p.CreatedAt, q.CreatedAt)
+		}
+		gp := *p
+		gp.CreatedAt, q.CreatedAt = time.Time{}, time.Time{}
+		if gp != q {
+			t.Errorf("got %+v, want %+v", gp, q)
+		}
+	case *ScheduledExecutionEvent:
+		q := *want.Payload.(*ScheduledExecutionEvent)
+		if !p.ScheduledFor.Equal(q.ScheduledFor) {
+			t.Errorf("scheduled for %v, want %v", p.ScheduledFor, q.ScheduledFor)
+		}
+		gp := *p
+		gp.ScheduledFor, q.ScheduledFor = time.Time{}, time.Time{}
+		if gp != q {
+			t.Errorf("got %+v, want %+v", gp, q)
+		}
+	default:
+		t.Errorf("got payload %T", got.Payload)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range []Codec{JSON, Protobuf} {
+		for _, ev := range testEnvelopes() {
+			b, err := c.Encode(ev)
+			if err != nil {
+				t.Fatalf("%s: %v", c.ContentType(), err)
+			}
+
+			msg := &domain.Message{Value: b, Headers: map[string]string{ContentTypeHeader: c.ContentType()}}
+			got, err := DecodeMessage(msg)
+			if err != nil {
+				t.Fatalf("%s %s: %v", c.ContentType(), ev.Type, err)
+			}
+			sameEnvelope(t, got, ev)
+		}
+	}
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	createdAt := time.Date(2023, 6, 1, 10, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		message string
+		want    TransactionEvent
+		err     error
+	}{
+		{
+			message: "transfer|100.50|1000000001|2023-06-01 10:00:00|899.50|2000000001|completed",
+			want:    TransactionEvent{Type: "transfer", AccountNo: "1000000001", ReceiverNo: "2000000001", Currency: "THB", Amount: 10050, Balance: 89950, Status: "completed", CreatedAt: createdAt},
+		},
+		{
+			message: "withdraw|20.00|1000000001|2023-06-01 10:00:00|80.00|completed",
+			want:    TransactionEvent{Type: "withdraw", AccountNo: "1000000001", Currency: "THB", Amount: 2000, Balance: 8000, Status: "completed", CreatedAt: createdAt},
+		},
+		{
+			message: "reversal|105.50|1000000001|2023-06-01 10:00:00|1005.00|42|completed",
+			want:    TransactionEvent{Type: "reversal", AccountNo: "1000000001", Currency: "THB", Total: 10550, Balance: 100500, ReferenceId: 42, Status: "completed", CreatedAt: createdAt},
+		},
+		// as the baseline producer wrote them, without a status
+		{
+			message: "transfer|100.50|1000000001|2023-06-01 10:00:00|899.50|2000000001",
+			want:    TransactionEvent{Type: "transfer", AccountNo: "1000000001", ReceiverNo: "2000000001", Currency: "THB", Amount: 10050, Balance: 89950, Status: "completed", CreatedAt: createdAt},
+		},
+		{
+			message: "withdraw|20.00|1000000001|2023-06-01 10:00:00|80.00",
+			want:    TransactionEvent{Type: "withdraw", AccountNo: "1000000001", Currency: "THB", Amount: 2000, Balance: 8000, Status: "completed", CreatedAt: createdAt},
+		},
+		{
+			message: "deposit|500.00|1000000001|2023-06-01 10:00:00|580.00",
+			want:    TransactionEvent{Type: "deposit", AccountNo: "1000000001", Currency: "THB", Amount: 50000, Balance: 58000, Status: "completed", CreatedAt: createdAt},
+		},
+		{message: "transfer|100.50|1000000001|2023-06-01 10:00:00|899.50", err: ErrMalformedMessage},
+		{message: "withdraw|20.00|1000000001|2023-06-01 10:00:00", err: ErrMalformedMessage},
+		{message: "withdraw|abc|1000000001|2023-06-01 10:00:00|80.00|completed", err: ErrMalformedMessage},
+		{message: "reversal|105.50|1000000001|2023-06-01 10:00:00|1005.00|x|completed", err: ErrMalformedMessage},
+		{message: "withdraw|20.00|1000000001|yesterday|80.00|completed", err: ErrMalformedMessage},
+		{message: "payment|20.00|1000000001|2023-06-01 10:00:00|80.00|completed", err: ErrUnknownEvent},
+	}
+
+	for _, tt := range tests {
+		// a message without a content type is read as legacy
+		got, err := DecodeMessage(&domain.Message{Value: []byte(tt.message)})
+		if err != tt.err {
+			t.Errorf("%q: got %v, want %v", tt.message, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if got.Type != TransactionEventType(tt.want.Type) || got.Version != TransactionVersion || !got.OccurredAt.Equal(createdAt) {
+			t.Errorf("%q: got %+v", tt.message, got)
+		}
+		if p := got.Payload.(*TransactionEvent); !reflect.DeepEqual(*p, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.message, *p, tt.want)
+		}
+	}
+}
+
+func TestDecodeLegacyScheduled(t *testing.T) {
+	scheduledFor := time.Date(2026, 1, 1, 10, 0, 0, 0, time.FixedZone("ICT", 7*60*60))
+
+	got, err := DecodeMessage(&domain.Message{Value: []byte("7|3|transfer|100.50|1000000001|2000000001|2026-01-01T10:00:00+07:00")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Envelope{
+		Type:       ScheduledEventType("execution"),
+		Version:    ScheduledVersion,
+		OccurredAt: scheduledFor,
+		Payload: &ScheduledExecutionEvent{ExecutionId: 7, ScheduleId: 3, Type: "transfer", AccountNo: "1000000001",
+			ReceiverNo: "2000000001", Currency: "THB", Amount: 10050, ScheduledFor: scheduledFor},
+	}
+	sameEnvelope(t, got, want)
+
+	for _, bad := range []string{
+		"7|3|transfer|100.50|1000000001|2000000001",
+		"7|x|transfer|100.50|1000000001|2000000001|2026-01-01T10:00:00+07:00",
+		"7|3|transfer|lots|1000000001|2000000001|2026-01-01T10:00:00+07:00",
+		"7|3|transfer|100.50|1000000001|2000000001|tomorrow",
+	} {
+		if _, err := DecodeMessage(&domain.Message{Value: []byte(bad)}); err != ErrMalformedMessage {
+			t.Errorf("%q: got %v, want %v", bad, err, ErrMalformedMessage)
+		}
+	}
+}
+
+// TestDecodeNewerBuild decodes events of the same version from a build that added fields, and
+// refuses a version this build does not know
+func TestDecodeNewerBuild(t *testing.T) {
+	ev := testEnvelopes()[0]
+
+	b, _ := JSON.Encode(ev)
+	var raw map[string]interface{}
+	_ = json.Unmarshal(b, &raw)
+	raw["source"] = "branch"
+	raw["payload"].(map[string]interface{})["channel"] = "atm"
+	b, _ = json.Marshal(raw)
+
+	got, err := JSON.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameEnvelope(t, got, ev)
+
+	raw["version"] = TransactionVersion + 1
+	b, _ = json.Marshal(raw)
+	if _, err = JSON.Decode(b); err != ErrUnsupportedVersion {
+		t.Errorf("json: got %v, want %v", err, ErrUnsupportedVersion)
+	}
+
+	payload := ev.Payload.marshalProto()
+	payload = protowire.AppendTag(payload, 12, protowire.BytesType)
+	payload = protowire.AppendString(payload, "atm")
+	b, _ = Protobuf.Encode(&Envelope{ID: ev.ID, Type: ev.Type, Version: ev.Version, OccurredAt: ev.OccurredAt, CorrelationID: ev.CorrelationID})
+	b = protowire.AppendTag(b, 6, protowire.BytesType)
+	b = protowire.AppendBytes(b, payload)
+	b = protowire.AppendTag(b, 7, protowire.VarintType)
+	b = protowire.AppendVarint(b, 1)
+
+	if got, err = Protobuf.Decode(b); err != nil {
+		t.Fatal(err)
+	}
+	sameEnvelope(t, got, ev)
+
+	b, _ = Protobuf.Encode(&Envelope{ID: ev.ID, Type: ev.Type, Version: TransactionVersion + 1, Payload: ev.Payload})
+	if _, err = Protobuf.Decode(b); err != ErrUnsupportedVersion {
+		t.Errorf("protobuf: got %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
+
+// eventProto builds the descriptors of event.proto, the reference the hand-written wire format
+// is checked against
+func eventProto(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(num),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+		if typ == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+			f.TypeName = proto.String(".google.protobuf.Timestamp")
+		}
+		return f
+	}
+	const (
+		str   = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		i64   = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		bytes = descriptorpb.FieldDescriptorProto_TYPE_BYTES
+		ts    = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("event.proto"),
+		Package:    proto.String("banking.events"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Envelope"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, str), field("type", 2, str), field("version", 3, i64),
+					field("occurred_at", 4, ts), field("correlation_id", 5, str), field("payload", 6, bytes),
+				},
+			},
+			{
+				Name: proto.String("TransactionEvent"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("transaction_id", 1, i64), field("type", 2, str), field("account_no", 3, str),
+					field("receiver_no", 4, str), field("currency", 5, str), field("amount", 6, i64),
+					field("total", 7, i64), field("balance", 8, i64), field("reference_id", 9, i64),
+					field("status", 10, str), field("created_at", 11, ts),
+				},
+			},
+			{
+				Name: proto.String("TerminalEvent"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("terminal_id", 1, str), field("location", 2, str), field("currency", 3, str),
+					field("cash", 4, i64), field("threshold", 5, i64), field("created_at", 6, ts),
+				},
+			},
+			{
+				Name: proto.String("ScheduledExecutionEvent"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("execution_id", 1, i64), field("schedule_id", 2, i64), field("type", 3, str),
+					field("account_no", 4, str), field("receiver_no", 5, str), field("currency", 6, str),
+					field("amount", 7, i64), field("scheduled_for", 8, ts),
+				},
+			},
+		},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+// setFields sets the fields of m from values keyed by field name, times as Timestamps
+func setFields(m *dynamicpb.Message, values map[string]interface{}) {
+	fields := m.Descriptor().Fields()
+	for name, v := range values {
+		f := fields.ByName(protoreflect.Name(name))
+		switch v := v.(type) {
+		case time.Time:
+			ts := dynamicpb.NewMessage(f.Message())
+			ts.Set(ts.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(v.Unix()))
+			ts.Set(ts.Descriptor().Fields().ByName("nanos"), protoreflect.ValueOfInt32(int32(v.Nanosecond())))
+			m.Set(f, protoreflect.ValueOfMessage(ts))
+		default:
+			m.Set(f, protoreflect.ValueOf(v))
+		}
+	}
+}
+
+func referenceFields(ev *Envelope) (string, map[string]interface{}) {
+	switch p := ev.Payload.(type) {
+	case *TransactionEvent:
+		return "TransactionEvent", map[string]interface{}{
+			"transaction_id": p.TransactionId, "type": p.Type, "account_no": p.AccountNo,
+			"receiver_no": p.ReceiverNo, "currency": p.Currency, "amount": p.Amount, "total": p.Total,
+			"balance": p.Balance, "status": p.Status, "created_at": p.CreatedAt,
+		}
+	case *TerminalEvent:
+		return "TerminalEvent", map[string]interface{}{
+			"terminal_id": p.TerminalId, "location": p.Location, "currency": p.Currency,
+			"cash": p.Cash, "threshold": p.Threshold, "created_at": p.CreatedAt,
+		}
+	case *ScheduledExecutionEvent:
+		return "ScheduledExecutionEvent", map[string]interface{}{
+			"execution_id": p.ExecutionId, "schedule_id": p.ScheduleId, "type": p.Type,
+			"account_no": p.AccountNo, "receiver_no": p.ReceiverNo, "currency": p.Currency,
+			"amount": p.Amount, "scheduled_for": p.ScheduledFor,
+		}
+	}
+	return "", nil
+}
+
+// reference encodes ev with the protobuf runtime from the descriptors of event.proto
+func reference(t *testing.T, fd protoreflect.FileDescriptor, ev *Envelope) *dynamicpb.Message {
+	t.Helper()
+
+	name, values := referenceFields(ev)
+	payload := dynamicpb.NewMessage(fd.Messages().ByName(protoreflect.Name(name)))
+	setFields(payload, values)
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := dynamicpb.NewMessage(fd.Messages().ByName("Envelope"))
+	setFields(env, map[string]interface{}{
+		"id": ev.ID, "type": ev.Type, "version": int64(ev.Version), "occurred_at": ev.OccurredAt,
+		"correlation_id": ev.CorrelationID, "payload": b,
+	})
+	return env
+}
+
+func TestProtobufMatchesEventProto(t *testing.T) {
+	fd := eventProto(t)
+
+	for _, ev := range testEnvelopes() {
+		want := reference(t, fd, ev)
+
+		// what the codec writes is read by the runtime as the same message
+		b, err := Protobuf.Encode(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := dynamicpb.NewMessage(fd.Messages().ByName("Envelope"))
+		if err = proto.Unmarshal(b, got); err != nil {
+			t.Fatalf("%s: %v", ev.Type, err)
+		}
+
+		// payload bytes are compared as messages, field order within them is not fixed
+		name, _ := referenceFields(ev)
+		payloadField := got.Descriptor().Fields().ByName("payload")
+		gotPayload := dynamicpb.NewMessage(fd.Messages().ByName(protoreflect.Name(name)))
+		wantPayload := dynamicpb.NewMessage(fd.Messages().ByName(protoreflect.Name(name)))
+		if err = proto.Unmarshal(got.Get(payloadField).Bytes(), gotPayload); err != nil {
+			t.Fatalf("%s payload: %v", ev.Type, err)
+		}
+		_ = proto.Unmarshal(want.Get(payloadField).Bytes(), wantPayload)
+		if !proto.Equal(gotPayload, wantPayload) {
+			t.Errorf("%s payload: got %v, want %v", ev.Type, gotPayload, wantPayload)
+		}
+
+		got.Clear(payloadField)
+		want.Clear(payloadField)
+		if !proto.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", ev.Type, got, want)
+		}
+
+		// and what the runtime writes decodes to the event
+		b, err = proto.Marshal(reference(t, fd, ev))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := Protobuf.Decode(b)
+		if err != nil {
+			t.Fatalf("%s: %v", ev.Type, err)
+		}
+		sameEnvelope(t, decoded, ev)
+	}
+}
@@ -0,0 +1,149 @@
+package codec
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TransactionVersion is the schema version of TransactionEvent. Fields are only ever added
+// within a version, never renamed or reused; anything else takes a new version.
+const TransactionVersion = 1
+
+// TerminalVersion is the schema version of TerminalEvent, versioned as TransactionVersion is
+const TerminalVersion = 1
+
+// ScheduledVersion is the schema version of ScheduledExecutionEvent, versioned as TransactionVersion is
+const ScheduledVersion = 1
+
+var (
+	ErrUnknownEvent       = errors.New("unknown event type")
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+	ErrUnknownEncoding    = errors.New("unknown event encoding")
+	ErrMalformedMessage   = errors.New("malformed event message")
+)
+
+// Envelope wraps every event published to Kafka, whatever the encoding
+type Envelope struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// CorrelationID ties together the events caused by one request or scheduled run
+	CorrelationID string  `json:"correlation_id,omitempty"`
+	Payload       Payload `json:"payload"`
+}
+
+// Payload is the body of an event, one type per family of event types
+type Payload interface {
+	marshalProto() []byte
+	unmarshalProto(b []byte) error
+}
+
+// TransactionEvent tells that a transaction on AccountNo was booked. Amounts are in minor
+// units of Currency, e.g. satang.
+type TransactionEvent struct {
+	TransactionId int64  `json:"transaction_id"`
+	Type          string `json:"type"`
+	AccountNo     string `json:"account_no"`
+	ReceiverNo    string `json:"receiver_no,omitempty"`
+	Currency      string `json:"currency"`
+	Amount        int64  `json:"amount"`
+	Total         int64  `json:"total"`
+	// Balance is what is left on AccountNo afterwards
+	Balance     int64     `json:"balance"`
+	ReferenceId int64     `json:"reference_id,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TransactionEventType names the event of a transaction type, e.g. "transaction.transfer"
+func TransactionEventType(transactionType string) string {
+	return "transaction." + transactionType
+}
+
+// TerminalEvent tells that the cash of an ATM terminal ran low. Cash is what the terminal can
+// still pay out, Cash and Threshold are in minor units of Currency.
+type TerminalEvent struct {
+	TerminalId string    `json:"terminal_id"`
+	Location   string    `json:"location,omitempty"`
+	Currency   string    `json:"currency"`
+	Cash       int64     `json:"cash"`
+	Threshold  int64     `json:"threshold"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TerminalEventType names an event of a terminal, e.g. "terminal.low_cash"
+func TerminalEventType(kind string) string {
+	return "terminal." + kind
+}
+
+// ScheduledExecutionEvent tells a worker that run ExecutionId of schedule ScheduleId is due.
+// The transfer itself is taken from the schedule, the rest is there for the logs. Amount is in
+// minor units of Currency.
+type ScheduledExecutionEvent struct {
+	ExecutionId  int64     `json:"execution_id"`
+	ScheduleId   int64     `json:"schedule_id"`
+	Type         string    `json:"type"`
+	AccountNo    string    `json:"account_no"`
+	ReceiverNo   string    `json:"receiver_no,omitempty"`
+	Currency     string    `json:"currency"`
+	Amount       int64     `json:"amount"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+// ScheduledEventType names an event of a scheduled transaction, e.g. "scheduled.execution"
+func ScheduledEventType(kind string) string {
+	return "scheduled." + kind
+}
+
+// NewEnvelope wraps payload in a new event occurring now
+func NewEnvelope(eventType string, version int, correlationID string, payload Payload) *Envelope {
+	return &Envelope{
+		ID:            newEventID(),
+		Type:          eventType,
+		Version:       version,
+		OccurredAt:    time.Now(),
+		CorrelationID: correlationID,
+		Payload:       payload,
+	}
+}
+
+// newPayload returns an empty payload to decode an event into. Events of a newer version than
+// this build knows are refused rather than half read.
+func newPayload(eventType string, version int) (Payload, error) {
+	switch {
+	case strings.HasPrefix(eventType, "transaction."):
+		if version < 1 || version > TransactionVersion {
+			return nil, ErrUnsupportedVersion
+		}
+		return &TransactionEvent{}, nil
+	case strings.HasPrefix(eventType, "terminal."):
+		if version < 1 || version > TerminalVersion {
+			return nil, ErrUnsupportedVersion
+		}
+		return &TerminalEvent{}, nil
+	case strings.HasPrefix(eventType, "scheduled."):
+		if version < 1 || version > ScheduledVersion {
+			return nil, ErrUnsupportedVersion
+		}
+		return &ScheduledExecutionEvent{}, nil
+	}
+
+	return nil, ErrUnknownEvent
+}
+
+// newEventID returns a random (version 4) UUID
+func newEventID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,53 @@
+package codec
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Encode(ev *Envelope) ([]byte, error) {
+	return json.Marshal(ev)
+}
+
+// Decode ignores fields it does not know, so events from a newer build of the same version still decode
+func (jsonCodec) Decode(data []byte) (*Envelope, error) {
+	var raw struct {
+		ID            string          `json:"id"`
+		Type          string          `json:"type"`
+		Version       int             `json:"version"`
+		OccurredAt    time.Time       `json:"occurred_at"`
+		CorrelationID string          `json:"correlation_id"`
+		Payload       json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	payload, err := newPayload(raw.Type, raw.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw.Payload) == 0 {
+		return nil, ErrMalformedMessage
+	}
+
+	if err = json.Unmarshal(raw.Payload, payload); err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		ID:            raw.ID,
+		Type:          raw.Type,
+		Version:       raw.Version,
+		OccurredAt:    raw.OccurredAt,
+		CorrelationID: raw.CorrelationID,
+		Payload:       payload,
+	}, nil
+}
@@ -0,0 +1,116 @@
+package codec
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"main/domain"
+)
+
+// DecodeLegacy reads the pipe-delimited messages of producers from before the envelope, e.g.
+// "transfer|100.00|acc|2006-01-02 15:04:05|balance|receiver|status". The first producers left
+// the status out, they only sent completed transactions. A message starting with a number is
+// a scheduled run, see decodeLegacyScheduled. Short messages are refused with ErrMalformedMessage.
+func DecodeLegacy(message string) (*Envelope, error) {
+	fields := strings.Split(message, "|")
+
+	if _, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+		return decodeLegacyScheduled(fields)
+	}
+
+	e := TransactionEvent{Type: fields[0], Status: domain.TransactionCompleted}
+
+	// the number of fields before the optional status
+	n := 6
+	switch e.Type {
+	case "withdraw", "deposit":
+		n = 5
+	case "reversal", "transfer":
+	default:
+		return nil, ErrUnknownEvent
+	}
+
+	if len(fields) < n {
+		return nil, ErrMalformedMessage
+	}
+	if len(fields) > n {
+		e.Status = fields[n]
+	}
+
+	amount, extra := fields[1], ""
+	if n == 6 {
+		extra = fields[5]
+	}
+
+	e.AccountNo = fields[2]
+
+	money, err := domain.ParseMoney(amount)
+	if err != nil {
+		return nil, ErrMalformedMessage
+	}
+	e.Currency = domain.DefaultCurrency
+
+	// a reversal carries its total, the other types their amount
+	if e.Type == "reversal" {
+		e.Total = money.Satang
+		if e.ReferenceId, err = strconv.ParseInt(extra, 10, 64); err != nil {
+			return nil, ErrMalformedMessage
+		}
+	} else {
+		e.Amount = money.Satang
+		e.ReceiverNo = extra
+	}
+
+	if e.CreatedAt, err = time.ParseInLocation("2006-01-02 15:04:05", fields[3], time.Local); err != nil {
+		return nil, ErrMalformedMessage
+	}
+
+	balance, err := domain.ParseMoney(fields[4])
+	if err != nil {
+		return nil, ErrMalformedMessage
+	}
+	e.Balance = balance.Satang
+
+	return &Envelope{
+		Type:       TransactionEventType(e.Type),
+		Version:    TransactionVersion,
+		OccurredAt: e.CreatedAt,
+		Payload:    &e,
+	}, nil
+}
+
+// decodeLegacyScheduled reads the runs queued before the envelope,
+// "execution id|schedule id|type|amount|account|receiver|scheduled for" with the time in RFC 3339
+func decodeLegacyScheduled(fields []string) (*Envelope, error) {
+	if len(fields) != 7 {
+		return nil, ErrMalformedMessage
+	}
+
+	e := ScheduledExecutionEvent{Type: fields[2], AccountNo: fields[4], ReceiverNo: fields[5], Currency: domain.DefaultCurrency}
+
+	var err error
+	if e.ExecutionId, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return nil, ErrMalformedMessage
+	}
+	if e.ScheduleId, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return nil, ErrMalformedMessage
+	}
+
+	amount, err := domain.ParseMoney(fields[3])
+	if err != nil {
+		return nil, ErrMalformedMessage
+	}
+	e.Amount = amount.Satang
+
+	if e.ScheduledFor, err = time.Parse(time.RFC3339, fields[6]); err != nil {
+		return nil, ErrMalformedMessage
+	}
+
+	return &Envelope{
+		Type:       ScheduledEventType("execution"),
+		Version:    ScheduledVersion,
+		OccurredAt: e.ScheduledFor,
+		Payload:    &e,
+	}, nil
+}
@@ -0,0 +1,277 @@
+package codec
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufCodec writes the messages of event.proto. Fields it does not know are skipped, so
+// events from a newer build of the same version still decode.
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (protobufCodec) Encode(ev *Envelope) ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, ev.ID)
+	b = appendString(b, 2, ev.Type)
+	b = appendInt64(b, 3, int64(ev.Version))
+	b = appendTime(b, 4, ev.OccurredAt)
+	b = appendString(b, 5, ev.CorrelationID)
+	if ev.Payload != nil {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, ev.Payload.marshalProto())
+	}
+	return b, nil
+}
+
+func (protobufCodec) Decode(data []byte) (*Envelope, error) {
+	var ev Envelope
+	var version int64
+	var payload []byte
+
+	err := walk(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeString(b, &ev.ID)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeString(b, &ev.Type)
+		case num == 3 && typ == protowire.VarintType:
+			return consumeInt64(b, &version)
+		case num == 4 && typ == protowire.BytesType:
+			return consumeTime(b, &ev.OccurredAt)
+		case num == 5 && typ == protowire.BytesType:
+			return consumeString(b, &ev.CorrelationID)
+		case num == 6 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			payload = v
+			return n
+		}
+		return 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ev.Version = int(version)
+	if ev.Payload, err = newPayload(ev.Type, ev.Version); err != nil {
+		return nil, err
+	}
+
+	if payload == nil {
+		return nil, ErrMalformedMessage
+	}
+
+	if err = ev.Payload.unmarshalProto(payload); err != nil {
+		return nil, err
+	}
+
+	return &ev, nil
+}
+
+func (e *TransactionEvent) marshalProto() []byte {
+	var b []byte
+	b = appendInt64(b, 1, e.TransactionId)
+	b = appendString(b, 2, e.Type)
+	b = appendString(b, 3, e.AccountNo)
+	b = appendString(b, 4, e.ReceiverNo)
+	b = appendString(b, 5, e.Currency)
+	b = appendInt64(b, 6, e.Amount)
+	b = appendInt64(b, 7, e.Total)
+	b = appendInt64(b, 8, e.Balance)
+	b = appendInt64(b, 9, e.ReferenceId)
+	b = appendString(b, 10, e.Status)
+	b = appendTime(b, 11, e.CreatedAt)
+	return b
+}
+
+func (e *TransactionEvent) unmarshalProto(data []byte) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.TransactionId)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeString(b, &e.Type)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeString(b, &e.AccountNo)
+		case num == 4 && typ == protowire.BytesType:
+			return consumeString(b, &e.ReceiverNo)
+		case num == 5 && typ == protowire.BytesType:
+			return consumeString(b, &e.Currency)
+		case num == 6 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.Amount)
+		case num == 7 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.Total)
+		case num == 8 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.Balance)
+		case num == 9 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.ReferenceId)
+		case num == 10 && typ == protowire.BytesType:
+			return consumeString(b, &e.Status)
+		case num == 11 && typ == protowire.BytesType:
+			return consumeTime(b, &e.CreatedAt)
+		}
+		return 0
+	})
+}
+
+func (e *TerminalEvent) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, e.TerminalId)
+	b = appendString(b, 2, e.Location)
+	b = appendString(b, 3, e.Currency)
+	b = appendInt64(b, 4, e.Cash)
+	b = appendInt64(b, 5, e.Threshold)
+	b = appendTime(b, 6, e.CreatedAt)
+	return b
+}
+
+func (e *TerminalEvent) unmarshalProto(data []byte) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeString(b, &e.TerminalId)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeString(b, &e.Location)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeString(b, &e.Currency)
+		case num == 4 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.Cash)
+		case num == 5 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.Threshold)
+		case num == 6 && typ == protowire.BytesType:
+			return consumeTime(b, &e.CreatedAt)
+		}
+		return 0
+	})
+}
+
+func (e *ScheduledExecutionEvent) marshalProto() []byte {
+	var b []byte
+	b = appendInt64(b, 1, e.ExecutionId)
+	b = appendInt64(b, 2, e.ScheduleId)
+	b = appendString(b, 3, e.Type)
+	b = appendString(b, 4, e.AccountNo)
+	b = appendString(b, 5, e.ReceiverNo)
+	b = appendString(b, 6, e.Currency)
+	b = appendInt64(b, 7, e.Amount)
+	b = appendTime(b, 8, e.ScheduledFor)
+	return b
+}
+
+func (e *ScheduledExecutionEvent) unmarshalProto(data []byte) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.ExecutionId)
+		case num == 2 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.ScheduleId)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeString(b, &e.Type)
+		case num == 4 && typ == protowire.BytesType:
+			return consumeString(b, &e.AccountNo)
+		case num == 5 && typ == protowire.BytesType:
+			return consumeString(b, &e.ReceiverNo)
+		case num == 6 && typ == protowire.BytesType:
+			return consumeString(b, &e.Currency)
+		case num == 7 && typ == protowire.VarintType:
+			return consumeInt64(b, &e.Amount)
+		case num == 8 && typ == protowire.BytesType:
+			return consumeTime(b, &e.ScheduledFor)
+		}
+		return 0
+	})
+}
+
+// walk calls field with the value of every field in b. field returns the length it consumed,
+// 0 to skip a field it does not know, or a negative protowire error code.
+func walk(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n = field(num, typ, b)
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// zero values are left out, as proto3 does
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendTime writes t as a google.protobuf.Timestamp
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+
+	var ts []byte
+	ts = appendInt64(ts, 1, t.Unix())
+	ts = appendInt64(ts, 2, int64(t.Nanosecond()))
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, ts)
+}
+
+func consumeString(b []byte, v *string) int {
+	s, n := protowire.ConsumeString(b)
+	*v = s
+	return n
+}
+
+func consumeInt64(b []byte, v *int64) int {
+	x, n := protowire.ConsumeVarint(b)
+	*v = int64(x)
+	return n
+}
+
+func consumeTime(b []byte, v *time.Time) int {
+	ts, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n
+	}
+
+	var seconds, nanos int64
+	err := walk(ts, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			return consumeInt64(b, &seconds)
+		case num == 2 && typ == protowire.VarintType:
+			return consumeInt64(b, &nanos)
+		}
+		return 0
+	})
+	if err != nil {
+		return -1
+	}
+
+	*v = time.Unix(seconds, nanos)
+	return n
+}
@@ -1,67 +1,257 @@
 package kafka
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"main/bus"
+	"main/domain"
 
 	"github.com/Shopify/sarama"
 )
 
-func CreateConsumer(brokerAddress, topic string) (sarama.Consumer, error) {
-	config := sarama.NewConfig()
-	config.Consumer.Return.Errors = true
+const (
+	rejoinBackoff = time.Second
+	// maxHeldMessages is how many messages of a retry topic partition wait for their delay at once
+	maxHeldMessages = 1000
+)
 
-	return sarama.NewConsumer([]string{brokerAddress}, config)
+// ConsumerGroupHandler consumes the topics of router as a consumer group. An offset is only
+// committed once its message and all before it in the partition were handled.
+type ConsumerGroupHandler struct {
+	group       sarama.ConsumerGroup
+	router      *bus.Router
+	concurrency int
 }
 
-func RunKafkaConsumer(kafkaClient sarama.Client, topic string, partition int32, offset int64) (message string) {
-	consumer, err := sarama.NewConsumerFromClient(kafkaClient)
+// NewConsumerGroupHandler joins groupID on client. concurrency is the number of workers per
+// claimed partition; messages with the same key always go to the same worker, so they stay in order.
+func NewConsumerGroupHandler(client sarama.Client, groupID string, concurrency int, router *bus.Router) (*ConsumerGroupHandler, error) {
+	group, err := sarama.NewConsumerGroupFromClient(groupID, client)
 	if err != nil {
-		fmt.Printf("Error creating consumer: %v\n", err)
-		return
+		return nil, err
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
 	}
+
+	return &ConsumerGroupHandler{
+		group:       group,
+		router:      router,
+		concurrency: concurrency,
+	}, nil
+}
+
+// Run consumes the topics of the router until ctx is done, rejoining the group after every
+// rebalance. The messages finished by then are committed before it returns, the rest are
+// delivered again.
+func (h *ConsumerGroupHandler) Run(ctx context.Context) error {
+	topics := h.router.Topics()
+
+	go func() {
+		for err := range h.group.Errors() {
+			fmt.Printf("Error in consumer group: %v\n", err)
+		}
+	}()
+
+	for ctx.Err() == nil {
+		if err := h.group.Consume(ctx, topics, h); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return nil
+			}
+
+			// e.g. Kafka is down, try to join again in a while
+			fmt.Printf("Error consuming: %v\n", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(rejoinBackoff):
+			}
+		}
+	}
+
+	return h.group.Close()
+}
+
+func (h *ConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	fmt.Printf("Consumer group joined, generation %d, claims %v\n", session.GenerationID(), session.Claims())
+	return nil
+}
+
+// Cleanup commits the offsets marked by the claims before the partitions move on
+func (h *ConsumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	session.Commit()
+	return nil
+}
+
+// ConsumeClaim hands the messages of a partition to its workers until the claim ends on a
+// rebalance or shutdown, then waits for the workers to finish what they were given.
+func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tracker := &offsetTracker{
+		session:   session,
+		topic:     claim.Topic(),
+		partition: claim.Partition(),
+		done:      make(map[int64]bool),
+	}
+
+	var wg sync.WaitGroup
+	workers := make([]chan *sarama.ConsumerMessage, h.concurrency)
+	for i := range workers {
+		workers[i] = make(chan *sarama.ConsumerMessage)
+
+		wg.Add(1)
+		go func(messages <-chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for message := range messages {
+				if h.router.Process(session.Context(), toMessage(message)) {
+					tracker.complete(message.Offset)
+				}
+			}
+		}(workers[i])
+	}
+
 	defer func() {
-		if err := consumer.Close(); err != nil {
-			fmt.Printf("Error closing consumer: %v\n", err)
+		for _, w := range workers {
+			close(w)
 		}
+		wg.Wait()
 	}()
 
-	partitionConsumer, err := consumer.ConsumePartition(topic, partition, offset)
-	if err != nil {
-		fmt.Printf("Error creating partition consumer: %v\n", err)
-		return
+	dispatch := func(message *sarama.ConsumerMessage) bool {
+		select {
+		case workers[h.worker(message)] <- message:
+			return true
+		case <-session.Context().Done():
+			return false
+		}
 	}
+
+	// messages of a retry topic wait here for their delay rather than in a worker, so the claim
+	// keeps answering the end of the session. They all have the same delay, so the oldest is due first.
+	var held []*sarama.ConsumerMessage
+	var armed *sarama.ConsumerMessage
+	var timer *time.Timer
 	defer func() {
-		if err := partitionConsumer.Close(); err != nil {
-			fmt.Printf("Error closing partition consumer: %v\n", err)
+		if timer != nil {
+			timer.Stop()
 		}
 	}()
 
-	for message := range partitionConsumer.Messages() {
-		return string(message.Value)
+	for {
+		for len(held) > 0 && !time.Now().Before(h.dueAt(held[0])) {
+			if !dispatch(held[0]) {
+				return nil
+			}
+			held = held[1:]
+		}
+
+		var due <-chan time.Time
+		if len(held) > 0 {
+			if armed != held[0] {
+				if timer != nil {
+					timer.Stop()
+				}
+				armed, timer = held[0], time.NewTimer(time.Until(h.dueAt(held[0])))
+			}
+			due = timer.C
+		}
+
+		// a full hold stops reading until its oldest message is due
+		messages := claim.Messages()
+		if len(held) >= maxHeldMessages {
+			messages = nil
+		}
+
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			tracker.add(message.Offset)
+			if len(held) > 0 || time.Now().Before(h.dueAt(message)) {
+				held = append(held, message)
+			} else if !dispatch(message) {
+				return nil
+			}
+
+		case <-due:
 
+		case <-session.Context().Done():
+			return nil
+		}
 	}
+}
+
+func (h *ConsumerGroupHandler) dueAt(message *sarama.ConsumerMessage) time.Time {
+	return h.router.DueAt(toMessage(message))
+}
 
-	return
+func (h *ConsumerGroupHandler) worker(message *sarama.ConsumerMessage) int {
+	if len(message.Key) == 0 {
+		return int(message.Offset % int64(h.concurrency))
+	}
 
+	hash := fnv.New32a()
+	_, _ = hash.Write(message.Key)
+	return int(hash.Sum32() % uint32(h.concurrency))
 }
 
-type ConsumerGroupHandler struct{}
+func toMessage(m *sarama.ConsumerMessage) *domain.Message {
+	message := &domain.Message{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       string(m.Key),
+		Headers:   make(map[string]string, len(m.Headers)),
+		Value:     m.Value,
+		Timestamp: m.Timestamp,
+	}
+	for _, h := range m.Headers {
+		if h != nil {
+			message.Headers[string(h.Key)] = string(h.Value)
+		}
+	}
+	return message
+}
 
-func (h *ConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
-	return nil
+// offsetTracker marks the offset of a partition up to the first message still being handled,
+// as workers finish messages out of order
+type offsetTracker struct {
+	mu        sync.Mutex
+	session   sarama.ConsumerGroupSession
+	topic     string
+	partition int32
+	pending   []int64
+	done      map[int64]bool
 }
 
-func (h *ConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
-	return nil
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, offset)
 }
 
-func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		// Process the message
-		fmt.Printf("Received message: %s\n", message.Value)
+func (t *offsetTracker) complete(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
 
-		// Mark the message as processed by committing its offset
-		session.MarkMessage(message, "")
+	n := 0
+	for n < len(t.pending) && t.done[t.pending[n]] {
+		delete(t.done, t.pending[n])
+		n++
+	}
+
+	if n > 0 {
+		// the committed offset is the next message to read
+		t.session.MarkOffset(t.topic, t.partition, t.pending[n-1]+1, "")
+		t.pending = t.pending[n:]
 	}
-	return nil
 }
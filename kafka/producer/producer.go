@@ -1,50 +1,201 @@
 package kafka
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 )
 
-func CreateProducer(brokerAddress string) (sarama.SyncProducer, error) {
-	config := sarama.NewConfig()
+var (
+	ErrProducerClosed = errors.New("kafka producer is closed")
+	ErrPublishTimeout = errors.New("kafka publish timed out")
+)
+
+// Options are the producer settings of the kafka.producer config section
+type Options struct {
+	// Idempotent lets the broker drop the duplicates of a retried send
+	Idempotent bool
+	// Compression is none, gzip, snappy, lz4 or zstd
+	Compression string
+	// a batch is sent after FlushFrequency, or once it holds FlushMessages or FlushBytes
+	FlushFrequency time.Duration
+	FlushMessages  int
+	FlushBytes     int
+}
+
+// Configure applies opts to config, before the client is created from it
+func Configure(config *sarama.Config, opts Options) error {
 	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Retry.Max = 5
 	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.Retry.Max = 5
+
+	if opts.Idempotent {
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+	}
+
+	if opts.Compression != "" {
+		if err := config.Producer.Compression.UnmarshalText([]byte(opts.Compression)); err != nil {
+			return err
+		}
+	}
+
+	config.Producer.Flush.Frequency = opts.FlushFrequency
+	config.Producer.Flush.Messages = opts.FlushMessages
+	config.Producer.Flush.Bytes = opts.FlushBytes
 
-	return sarama.NewSyncProducer([]string{brokerAddress}, config)
+	return config.Validate()
 }
 
-func RunKafkaProducer(brokerAddress string, topic string, message string) {
-	producer, err := CreateProducer(brokerAddress)
+// Callback gets the delivery report of a message, err is nil once the brokers acknowledged it
+type Callback func(err error)
+
+// Producer is the one producer of the service, shared by everything that publishes. Messages
+// are batched by the async producer underneath; Publish waits for the delivery report of its
+// message, PublishAsync hands it to a callback.
+type Producer struct {
+	mu      sync.Mutex
+	closed  bool
+	closing chan struct{}
+	// sending counts the messages being handed to the producer
+	sending  sync.WaitGroup
+	producer sarama.AsyncProducer
+	timeout  time.Duration
+	wg       sync.WaitGroup
+}
+
+// NewProducer creates the producer on client, whose config went through Configure. Publish
+// gives up waiting for a delivery report after timeout, 0 waits as long as it takes.
+func NewProducer(client sarama.Client, timeout time.Duration) (*Producer, error) {
+	producer, err := sarama.NewAsyncProducerFromClient(client)
 	if err != nil {
-		fmt.Printf("Error creating producer: %v\n", err)
-		return
+		return nil, err
 	}
-	defer func() {
-		if err := producer.Close(); err != nil {
-			fmt.Printf("Error closing producer: %v\n", err)
+
+	return newProducer(producer, timeout), nil
+}
+
+func newProducer(producer sarama.AsyncProducer, timeout time.Duration) *Producer {
+	p := &Producer{
+		closing:  make(chan struct{}),
+		producer: producer,
+		timeout:  timeout,
+	}
+
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		for msg := range producer.Successes() {
+			report(msg, nil)
+		}
+	}()
+	go func() {
+		defer p.wg.Done()
+		for err := range producer.Errors() {
+			report(err.Msg, err.Err)
 		}
 	}()
 
-	// fmt.Println("Kafka producer started.")
+	return p
+}
 
-	kafkaMessage := &sarama.ProducerMessage{
-		Topic: topic,
-		Value: sarama.StringEncoder(message),
+func report(msg *sarama.ProducerMessage, err error) {
+	if callback, ok := msg.Metadata.(Callback); ok && callback != nil {
+		callback(err)
 	}
+}
 
-	// partition, offset, err := producer.SendMessage(kafkaMessage)
-	// if err != nil {
-	// 	log.Fatal("Error sending Kafka message:", err)
-	// }
+// Publish sends message keyed by key and waits until it is delivered, or until the timeout ran
+// out with ErrPublishTimeout; a message handed over by then may still be delivered. The hash
+// partitioner keeps a key on one partition.
+func (p *Producer) Publish(topic string, key string, headers map[string]string, message []byte) error {
+	done := make(chan error, 1)
+	msg := newMessage(topic, key, headers, message, func(err error) {
+		done <- err
+	})
 
-	_, _, err = producer.SendMessage(kafkaMessage)
-	if err != nil {
-		log.Fatal("Error sending Kafka message:", err)
+	var expired <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	if !p.send(msg, expired) {
+		return ErrPublishTimeout
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-expired:
+		return ErrPublishTimeout
+	}
+}
+
+// PublishAsync queues message and returns, callback is called from another goroutine once the
+// message is delivered or given up on
+func (p *Producer) PublishAsync(topic string, key string, headers map[string]string, message []byte, callback Callback) {
+	p.send(newMessage(topic, key, headers, message, callback), nil)
+}
+
+func newMessage(topic string, key string, headers map[string]string, message []byte, callback Callback) *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Topic:    topic,
+		Value:    sarama.ByteEncoder(message),
+		Metadata: callback,
+	}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+	for k, v := range headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return msg
+}
+
+// send hands msg to the producer, whose input blocks while its buffer is full. It reports false
+// when expired fires first. Close does not wait for room either, msg is then given up with
+// ErrProducerClosed.
+func (p *Producer) send(msg *sarama.ProducerMessage, expired <-chan time.Time) bool {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		report(msg, ErrProducerClosed)
+		return true
 	}
+	p.sending.Add(1)
+	p.mu.Unlock()
+	defer p.sending.Done()
 
-	// fmt.Printf("Message sent to partition %d at offset %d\n", partition, offset)
+	select {
+	case p.producer.Input() <- msg:
+	case <-p.closing:
+		report(msg, ErrProducerClosed)
+	case <-expired:
+		return false
+	}
+	return true
+}
+
+// Close flushes the messages still buffered and waits for all their delivery reports. Messages
+// still waiting for room in the buffer are given up with ErrProducerClosed.
+func (p *Producer) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.closing)
+	p.mu.Unlock()
 
+	p.sending.Wait()
+	p.producer.AsyncClose()
+	p.wg.Wait()
+	fmt.Println("Kafka producer flushed and closed")
 }
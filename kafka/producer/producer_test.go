@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// stuckProducer stands in for sarama's async producer. Nothing reads its input unless deliver
+// is started, as when its buffer is full and the brokers are down.
+type stuckProducer struct {
+	sarama.AsyncProducer
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+}
+
+func newStuckProducer() *stuckProducer {
+	return &stuckProducer{
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+	}
+}
+
+func (s *stuckProducer) Input() chan<- *sarama.ProducerMessage     { return s.input }
+func (s *stuckProducer) Successes() <-chan *sarama.ProducerMessage { return s.successes }
+func (s *stuckProducer) Errors() <-chan *sarama.ProducerError      { return s.errors }
+
+func (s *stuckProducer) AsyncClose() {
+	close(s.successes)
+	close(s.errors)
+}
+
+// deliver reports every message it reads with err
+func (s *stuckProducer) deliver(err error) {
+	go func() {
+		for msg := range s.input {
+			if err != nil {
+				s.errors <- &sarama.ProducerError{Msg: msg, Err: err}
+			} else {
+				s.successes <- msg
+			}
+		}
+	}()
+}
+
+func TestPublish(t *testing.T) {
+	s := newStuckProducer()
+	s.deliver(nil)
+	p := newProducer(s, time.Second)
+
+	if err := p.Publish("sms", "1000000001", map[string]string{"content-type": "text/plain"}, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := newStuckProducer()
+	failed.deliver(sarama.ErrOutOfBrokers)
+	if err := newProducer(failed, time.Second).Publish("sms", "", nil, []byte("hello")); !errors.Is(err, sarama.ErrOutOfBrokers) {
+		t.Errorf("got %v, want %v", err, sarama.ErrOutOfBrokers)
+	}
+}
+
+func TestPublishTimesOut(t *testing.T) {
+	// the message is never taken
+	p := newProducer(newStuckProducer(), 50*time.Millisecond)
+	if err := p.Publish("sms", "", nil, []byte("hello")); err != ErrPublishTimeout {
+		t.Errorf("got %v, want %v", err, ErrPublishTimeout)
+	}
+
+	// the message is taken, its report never comes
+	s := newStuckProducer()
+	go func() {
+		for range s.input {
+		}
+	}()
+	p = newProducer(s, 50*time.Millisecond)
+	if err := p.Publish("sms", "", nil, []byte("hello")); err != ErrPublishTimeout {
+		t.Errorf("got %v, want %v", err, ErrPublishTimeout)
+	}
+}
+
+func TestCloseGivesUpMessagesWaitingForRoom(t *testing.T) {
+	p := newProducer(newStuckProducer(), 0)
+
+	reported := make(chan error, 1)
+	go p.PublishAsync("sms", "", nil, []byte("hello"), func(err error) {
+		reported <- err
+	})
+
+	// let PublishAsync block on the input
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close waits for the blocked PublishAsync")
+	}
+	if err := <-reported; err != ErrProducerClosed {
+		t.Errorf("got %v, want %v", err, ErrProducerClosed)
+	}
+
+	if err := p.Publish("sms", "", nil, []byte("hello")); err != ErrProducerClosed {
+		t.Errorf("got %v after Close, want %v", err, ErrProducerClosed)
+	}
+}
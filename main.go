@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -28,10 +29,15 @@ import (
 	_userHttpDelivery "main/atm/delivery/http"
 	_httpDeliveryMiddleware "main/atm/delivery/http/middleware"
 
+	// clearing
+	"main/atm/clearing"
+	"main/atm/thaiqr"
+
 	// service
 	_accountUcase "main/atm/usecase"
 	_authenticationUcase "main/atm/usecase"
 	_externalUcase "main/atm/usecase"
+	_idempotencyUcase "main/atm/usecase"
 	_notificationUcase "main/atm/usecase"
 	_pollingUcase "main/atm/usecase"
 	_userUcase "main/atm/usecase"
@@ -41,6 +47,14 @@ import (
 	_authenticationRepo "main/atm/repository/mysql"
 	_transactionRepo "main/atm/repository/mysql"
 	_userRepo "main/atm/repository/mysql"
+	_idempotencyRepo "main/atm/repository/redis"
+
+	"main/bus"
+	"main/domain"
+	_kafkaAdmin "main/kafka/admin"
+	_kafkaBus "main/kafka/bus"
+	"main/kafka/codec"
+	producer "main/kafka/producer"
 
 	// logging
 	"main/logger"
@@ -59,6 +73,9 @@ func init() {
 }
 
 func main() {
+	busMode := flag.String("bus", viper.GetString("bus"), "event bus to run on, kafka or memory")
+	flag.Parse()
+
 	logger.Info("start program...")
 
 	dbHost := viper.GetString(`database.host`)
@@ -116,40 +133,45 @@ func main() {
 	// kafkaHost := viper.GetString(`kafka.host`)
 	// kafkaPort := viper.GetString(`kafka.port`)
 
-	config := sarama.NewConfig()
-	config.ClientID = "my-kafka-client"
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Return.Successes = true
-	config.Consumer.Return.Errors = true
-	config.Consumer.Offsets.AutoCommit.Enable = true
-	config.Consumer.Offsets.AutoCommit.Interval = 1 * time.Second
-	// config.Consumer.Offsets.Initial = sarama.OffsetNewest
-
-	// Replace with your Kafka brokers' addresses
-	brokers := []string{viper.GetString("kafka.broker_address")}
-	kafkaClient, err := sarama.NewClient(brokers, config)
-	if err != nil {
-		log.Fatal(err)
+	var retryDelays []time.Duration
+	for _, delay := range viper.GetStringSlice("kafka.consumer.retry_delays") {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		retryDelays = append(retryDelays, d)
 	}
-	defer kafkaClient.Close()
 
-	// producer, err := producer.CreateProducer("localhost:9092")
-	// if err != nil {
-	// 	log.Fatal("Error creating producer:", err)
-	// }
-	// defer producer.Close()
+	var eventBus domain.EventBus
+	switch *busMode {
+	case "memory":
+		// messages never leave the process, e.g. to run locally without Kafka
+		eventBus = bus.NewMemoryBus(viper.GetInt("kafka.consumer.concurrency"), retryDelays)
+	case "kafka":
+		kafkaClient, err := newKafkaClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer kafkaClient.Close()
 
-	// consumer, err := consumer.CreateConsumer("localhost:9092", "test-topic")
-	// if err != nil {
-	// 	log.Fatal("Error creating consumer:", err)
-	// }
-	// defer consumer.Close()
+		if err = provisionTopics(kafkaClient, len(retryDelays)); err != nil {
+			log.Fatal(err)
+		}
 
-	// fmt.Println("Kafka ping successful")
+		eventBus, err = _kafkaBus.NewKafkaBus(kafkaClient, viper.GetString("kafka.consumer.group_id"), viper.GetInt("kafka.consumer.concurrency"), retryDelays,
+			viper.GetDuration("kafka.producer.publish_timeout"))
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown event bus %q", *busMode)
+	}
 
 	e := echo.New()
 	middL := _httpDeliveryMiddleware.InitMiddleware()
 	e.Use(middL.CORS)
+	e.Use(middleware.RequestID())
+	e.Use(middL.Correlation)
 	e.Use(middL.RateLimitMiddleware)
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"http://localhost:3001", "http://localhost:3000"},
@@ -159,27 +181,119 @@ func main() {
 	ar := _accountRepo.NewMysqlAccountRepository(dbConn, redis)
 	authr := _authenticationRepo.NewMysqlAuthenticationRepository(dbConn, redis)
 	ur := _userRepo.NewMysqlUserRepository(dbConn)
-	tr := _transactionRepo.NewMysqlTransactionRepository(dbConn, redis)
+	tr := _transactionRepo.NewMysqlTransactionRepository(dbConn)
+	sr := _transactionRepo.NewMysqlScheduledTransactionRepository(dbConn)
+	uow := _transactionRepo.NewMysqlUnitOfWork(dbConn)
+	lr := _transactionRepo.NewMysqlLedgerRepository(dbConn)
+	fr := _transactionRepo.NewMysqlFeeRepository(dbConn)
+	limr := _transactionRepo.NewMysqlLimitRepository(dbConn)
+	or := _transactionRepo.NewMysqlOutboxRepository(dbConn)
+	dr := _transactionRepo.NewMysqlDeadLetterRepository(dbConn)
+	ibr := _transactionRepo.NewMysqlInterbankTransferRepository(dbConn)
+	pr := _transactionRepo.NewMysqlProxyRepository(dbConn)
+	cr := _transactionRepo.NewMysqlCardlessWithdrawalRepository(dbConn)
+	tmr := _transactionRepo.NewMysqlTerminalRepository(dbConn)
+	ir := _idempotencyRepo.NewRedisIdempotencyRepository(redis)
 
 	timeoutContext := time.Duration(viper.GetInt("context.timeout")) * time.Second
-	au := _accountUcase.NewAccountUsecase(ar, tr, redis, timeoutContext)
-	auth := _authenticationUcase.NewAuthenticationUsecase(authr, timeoutContext)
+	au := _accountUcase.NewAccountUsecase(ar, tr, timeoutContext)
+	auth := _authenticationUcase.NewAuthenticationUsecase(authr, eventBus, timeoutContext)
 	uu := _userUcase.NewUserUsecase(ur, timeoutContext)
-	tu := _accountUcase.NewTransactionUsecase(tr, au, timeoutContext, redis, kafkaClient)
-	nu := _notificationUcase.NewNotificationUsecase(tu, timeoutContext, kafkaClient)
-	xu := _externalUcase.NewExternalUsecase(timeoutContext, kafkaClient)
+	lu := _accountUcase.NewLedgerUsecase(lr, ar, timeoutContext)
+	fu := _accountUcase.NewFeeUsecase(fr, tr, uow, timeoutContext)
+	limu := _accountUcase.NewLimitUsecase(limr, tr, ar, timeoutContext)
+	tmu := _accountUcase.NewTerminalUsecase(tmr, or, uow, viper.GetString("terminals.alert_topic"), timeoutContext)
+	sp := domain.SchedulePolicy{
+		Lease:       viper.GetDuration("scheduled.lease"),
+		MaxAttempts: viper.GetInt("scheduled.max_attempts"),
+		Backoff:     viper.GetDuration("scheduled.backoff"),
+		MaxBackoff:  viper.GetDuration("scheduled.max_backoff"),
+		CatchUp:     viper.GetString("scheduled.catch_up"),
+		MaxCatchUp:  viper.GetInt("scheduled.max_catch_up"),
+		Grace:       viper.GetDuration("scheduled.grace"),
+	}
+	if err = sp.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	cp := domain.CardlessPolicy{
+		TTL:         viper.GetDuration("cardless.ttl"),
+		MaxAttempts: viper.GetInt("cardless.max_attempts"),
+	}
+	ca := clearing.NewISO20022Adapter(viper.GetString("clearing.request_topic"), viper.GetString("clearing.status_topic"))
+	clp := domain.ClearingPolicy{
+		ResendAfter: viper.GetDuration("clearing.resend_after"),
+		ReturnAfter: viper.GetDuration("clearing.return_after"),
+	}
+	tu := _accountUcase.NewTransactionUsecase(tr, sr, or, ibr, pr, cr, ar, au, uu, lu, fu, limu, tmu, ca, uow, sp, cp, clp, timeoutContext)
+	nu := _notificationUcase.NewNotificationUsecase(tu, timeoutContext)
+	xu := _externalUcase.NewExternalUsecase(timeoutContext)
+	proxyu := _accountUcase.NewProxyUsecase(pr, ar, auth, uow, timeoutContext)
+	qu := _accountUcase.NewQRUsecase(ar, au, tu, thaiqr.NewPromptPayCodec(viper.GetInt("qr.size")), timeoutContext)
+	su := _accountUcase.NewStatementUsecase(tr, ar, uow, timeoutContext)
+	iu := _idempotencyUcase.NewIdempotencyUsecase(ir, viper.GetDuration("idempotency.ttl"), viper.GetDuration("idempotency.lock_timeout"))
+	eventCodec, err := codec.ForName(viper.GetString("kafka.encoding"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	du := _accountUcase.NewDeadLetterUsecase(dr, eventBus, uow, timeoutContext, viper.GetStringSlice("dead_letters.redacted_topics"))
+	ou := _accountUcase.NewOutboxUsecase(or, eventBus, eventCodec, uow, domain.OutboxPolicy{
+		Interval:    viper.GetDuration("outbox.interval"),
+		Lease:       viper.GetDuration("outbox.lease"),
+		MaxAttempts: viper.GetInt("outbox.max_attempts"),
+		Retention:   viper.GetDuration("outbox.retention"),
+	})
+
+	var terminalKeys []_httpDeliveryMiddleware.TerminalKey
+	if err = viper.UnmarshalKey("terminals.keys", &terminalKeys); err != nil {
+		log.Fatal(err)
+	}
+	terminalAuth := _httpDeliveryMiddleware.NewTerminalMiddleware(terminalKeys)
+	var adminKeys []_httpDeliveryMiddleware.AdminKey
+	if err = viper.UnmarshalKey("admin.keys", &adminKeys); err != nil {
+		log.Fatal(err)
+	}
+	adminAuth := _httpDeliveryMiddleware.NewAdminMiddleware(adminKeys)
 
 	_accountHttpDelivery.NewAccountHandler(e, au)
 	_authenticationHttpDelivery.NewAuthenticationHandler(e, auth)
 	_userHttpDelivery.NewUserHandler(e, uu, auth)
-	_transactionHttpDelivery.NewTransactionHandler(e, tu, redis)
+	_transactionHttpDelivery.NewTransactionHandler(e, tu, iu, redis, adminAuth)
+	_accountHttpDelivery.NewLedgerHandler(e, lu)
+	_accountHttpDelivery.NewStatementHandler(e, su)
+	_accountHttpDelivery.NewFeeHandler(e, fu, adminAuth)
+	_accountHttpDelivery.NewLimitHandler(e, limu, adminAuth)
+	_accountHttpDelivery.NewDeadLetterHandler(e, du, adminAuth)
+	_accountHttpDelivery.NewProxyHandler(e, proxyu)
+	_accountHttpDelivery.NewQRHandler(e, qu, iu)
+	_transactionHttpDelivery.NewCardlessWithdrawalHandler(e, tu, iu, terminalAuth)
+	_transactionHttpDelivery.NewTerminalHandler(e, tmu, tu, iu, adminAuth, terminalAuth)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go nu.SendTransactionNotification(ctx)
-	go xu.SendSms(ctx)
-	go tu.ConsumeScheduledTransaction(ctx)
+	eventBus.Subscribe("sms_transaction", nu.SendTransactionNotification)
+	eventBus.Subscribe("sms", xu.SendSms)
+	eventBus.SubscribeDeadLetters("sms_transaction", du.StoreDeadLetter)
+	eventBus.SubscribeDeadLetters("sms", du.StoreDeadLetter)
+	eventBus.Subscribe(domain.ScheduledTransactionTopic, tu.ConsumeScheduledTransaction)
+	eventBus.SubscribeDeadLetters(domain.ScheduledTransactionTopic, du.StoreDeadLetter)
+	eventBus.Subscribe(ca.StatusTopic(), tu.HandlePaymentStatus)
+	eventBus.SubscribeDeadLetters(ca.StatusTopic(), du.StoreDeadLetter)
+
+	// without a real clearing house the service answers its own credit transfers
+	if viper.GetBool("clearing.stand_in.enabled") {
+		maxAmount, err := domain.ParseMoney(viper.GetString("clearing.stand_in.max_amount"))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		house := clearing.NewStandInClearingHouse(eventBus, tu, ca.StatusTopic(), clearing.StandInRules{
+			MaxAmount:      maxAmount,
+			ClosedAccounts: viper.GetStringSlice("clearing.stand_in.closed_accounts"),
+		})
+		eventBus.Subscribe(viper.GetString("clearing.request_topic"), house.Handle)
+		eventBus.SubscribeDeadLetters(viper.GetString("clearing.request_topic"), du.StoreDeadLetter)
+	}
 
 	//polling service init
 	pollingInterval := 15 * time.Second
@@ -191,14 +305,101 @@ func main() {
 	wg.Add(1)
 	go pu.Polling(ctx, &wg, pollingInterval, stopChan)
 
-	log.Fatal(e.Start(viper.GetString("server.address"))) //nolint
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		ou.Relay(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		du.WatchDeadLetters(ctx, viper.GetDuration("dead_letters.watch_interval"))
+	}()
+	go func() {
+		defer wg.Done()
+		if err := eventBus.Run(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	go func() {
+		if err := e.Start(viper.GetString("server.address")); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 
 	sigchan := make(chan os.Signal, 1) // Wait for OS signals (e.g., Ctrl+C) to gracefully stop the consumer
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigchan
-	time.Sleep(1 * time.Minute) // Let the polling routine run for a specified duration
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Println(err)
+	}
 
 	close(stopChan) // Signal the polling routine to stop
+	cancel()        // Stop the consumers, they commit what they finished
+
+	wg.Wait() // Wait for the polling routine and the consumers to finish before exiting
 
-	wg.Wait() // Wait for the polling routine to finish before exiting
+	eventBus.Close() // Flush what the consumers and the relay still sent
+}
+
+func newKafkaClient() (sarama.Client, error) {
+	config := sarama.NewConfig()
+	config.ClientID = "my-kafka-client"
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.AutoCommit.Enable = true
+	config.Consumer.Offsets.AutoCommit.Interval = 1 * time.Second
+	config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategySticky}
+	// a new group starts at the oldest message, nothing published before it first joined is skipped
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	err := producer.Configure(config, producer.Options{
+		Idempotent:     viper.GetBool("kafka.producer.idempotent"),
+		Compression:    viper.GetString("kafka.producer.compression"),
+		FlushFrequency: viper.GetDuration("kafka.producer.flush_frequency"),
+		FlushMessages:  viper.GetInt("kafka.producer.flush_messages"),
+		FlushBytes:     viper.GetInt("kafka.producer.flush_bytes"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace with your Kafka brokers' addresses
+	brokers := []string{viper.GetString("kafka.broker_address")}
+	return sarama.NewClient(brokers, config)
+}
+
+// provisionTopics brings the topics of kafka.topics to the cluster as far as kafka.provision allows
+func provisionTopics(client sarama.Client, retries int) error {
+	mode, err := _kafkaAdmin.ParseMode(viper.GetString("kafka.provision"))
+	if err != nil {
+		return err
+	}
+
+	var topics _kafkaAdmin.TopicsConfig
+	if err = viper.UnmarshalKey("kafka.topics", &topics); err != nil {
+		return err
+	}
+
+	// not closed, that would close the shared client as well
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return err
+	}
+
+	report, err := _kafkaAdmin.Provision(admin, topics.Specs(retries), mode)
+	for _, topic := range report.Created {
+		log.Printf("created topic %s", topic)
+	}
+	for _, d := range report.Altered {
+		log.Printf("altered topic %s", d)
+	}
+	for _, topic := range report.Missing {
+		log.Printf("topic %s does not exist", topic)
+	}
+	for _, d := range report.Drift {
+		log.Printf("topic drift %s", d)
+	}
+	return err
 }
@@ -0,0 +1,14 @@
+-- Double-entry ledger behind account balances. Customer legs carry the balance of the account
+-- after the posting, the bank's own accounts (ATM_CASH, FEE_INCOME, ...) leave it NULL.
+CREATE TABLE IF NOT EXISTS banking.ledger_entries (
+    id             BIGINT         NOT NULL AUTO_INCREMENT,
+    transaction_id BIGINT         NOT NULL DEFAULT 0,
+    account_no     VARCHAR(32)    NOT NULL,
+    direction      ENUM('debit', 'credit') NOT NULL,
+    amount         DECIMAL(20, 2) NOT NULL,
+    balance_after  DECIMAL(20, 2) NULL,
+    created_at     DATETIME(3)    NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_ledger_entries_account (account_no, id),
+    KEY idx_ledger_entries_transaction (transaction_id)
+);
@@ -0,0 +1,25 @@
+-- Opens the ledger of every account at its balance, against OPENING_BALANCE, so the first
+-- posting of an account that had money before the ledger existed checks out. Run it again after
+-- a balance was changed outside the ledger: an account whose balance differs from the
+-- balance_after of its last entry gets an entry for the difference, accounts in step are left
+-- alone.
+CREATE TEMPORARY TABLE ledger_adjustments AS
+SELECT a.account_no,
+       a.balance - COALESCE(l.balance_after, 0) AS difference,
+       a.balance
+FROM banking.accounts a
+LEFT JOIN banking.ledger_entries l ON l.id = (
+    SELECT MAX(e.id) FROM banking.ledger_entries e
+    WHERE e.account_no = a.account_no AND e.balance_after IS NOT NULL
+)
+WHERE a.balance <> COALESCE(l.balance_after, 0);
+
+INSERT INTO banking.ledger_entries (transaction_id, account_no, direction, amount, balance_after, created_at)
+SELECT 0, account_no, IF(difference > 0, 'credit', 'debit'), ABS(difference), balance, NOW(3)
+FROM ledger_adjustments;
+
+INSERT INTO banking.ledger_entries (transaction_id, account_no, direction, amount, balance_after, created_at)
+SELECT 0, 'OPENING_BALANCE', IF(difference > 0, 'debit', 'credit'), ABS(difference), NULL, NOW(3)
+FROM ledger_adjustments;
+
+DROP TEMPORARY TABLE ledger_adjustments;
@@ -0,0 +1,17 @@
+-- Money is stored as a decimal string and scanned back without going through float64, so every
+-- amount column is an exact DECIMAL. Values already in DOUBLE columns are rounded to satang.
+ALTER TABLE banking.accounts
+    MODIFY balance DECIMAL(20, 2) NOT NULL DEFAULT 0;
+
+ALTER TABLE banking.transactions
+    MODIFY amount       DECIMAL(20, 2) NOT NULL,
+    MODIFY fee          DECIMAL(20, 2) NOT NULL DEFAULT 0,
+    MODIFY total_amount DECIMAL(20, 2) NOT NULL;
+
+ALTER TABLE banking.transactions_history
+    MODIFY amount       DECIMAL(20, 2) NOT NULL,
+    MODIFY fee          DECIMAL(20, 2) NOT NULL DEFAULT 0,
+    MODIFY total_amount DECIMAL(20, 2) NOT NULL;
+
+ALTER TABLE banking.scheduled_transactions
+    MODIFY amount DECIMAL(20, 2) NOT NULL;
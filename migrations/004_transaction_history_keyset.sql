@@ -0,0 +1,9 @@
+-- GetAllTransaction pages by (created_at, id) over both sides of a transfer in the live and the
+-- archived table
+ALTER TABLE banking.transactions
+    ADD KEY idx_transactions_account_keyset (account, created_at, id),
+    ADD KEY idx_transactions_receiver_keyset (receiver, created_at, id);
+
+ALTER TABLE banking.transactions_history
+    ADD KEY idx_transactions_history_account_keyset (account, created_at, id),
+    ADD KEY idx_transactions_history_receiver_keyset (receiver, created_at, id);
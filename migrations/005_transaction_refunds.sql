@@ -0,0 +1,15 @@
+-- Reversals give a transaction back in one or more parts. refunded_amount adds them up,
+-- reversed_at is set and the status moves to reversed once it reaches amount.
+ALTER TABLE banking.transactions
+    ADD COLUMN reference_id    BIGINT         NULL,
+    ADD COLUMN remark          VARCHAR(255)   NULL,
+    ADD COLUMN reversed_at     DATETIME(3)    NULL,
+    ADD COLUMN refunded_amount DECIMAL(20, 2) NOT NULL DEFAULT 0,
+    ADD KEY idx_transactions_reference (reference_id);
+
+ALTER TABLE banking.transactions_history
+    ADD COLUMN reference_id    BIGINT         NULL,
+    ADD COLUMN remark          VARCHAR(255)   NULL,
+    ADD COLUMN reversed_at     DATETIME(3)    NULL,
+    ADD COLUMN refunded_amount DECIMAL(20, 2) NOT NULL DEFAULT 0,
+    ADD KEY idx_transactions_history_reference (reference_id);
@@ -0,0 +1,12 @@
+-- Every attempt is recorded as pending before it is booked and settles as completed or failed.
+-- Rows from before the lifecycle were all booked.
+ALTER TABLE banking.transactions
+    ADD COLUMN status         VARCHAR(16)  NOT NULL DEFAULT 'completed',
+    ADD COLUMN failure_code   INT          NULL,
+    ADD COLUMN failure_reason VARCHAR(255) NULL,
+    ADD KEY idx_transactions_status (status);
+
+ALTER TABLE banking.transactions_history
+    ADD COLUMN status         VARCHAR(16)  NOT NULL DEFAULT 'completed',
+    ADD COLUMN failure_code   INT          NULL,
+    ADD COLUMN failure_reason VARCHAR(255) NULL;
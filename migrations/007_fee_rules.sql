@@ -0,0 +1,40 @@
+-- Versioned fee rules. A rule is never updated except for closing its effective_to when the
+-- next version of its rule_key takes over. Only withdraw and transfer are priced.
+CREATE TABLE IF NOT EXISTS banking.fee_rules (
+    id               BIGINT         NOT NULL AUTO_INCREMENT,
+    rule_key         VARCHAR(64)    NOT NULL,
+    version          INT            NOT NULL,
+    transaction_type ENUM('withdraw', 'transfer') NOT NULL,
+    channel          VARCHAR(16)    NOT NULL DEFAULT '',
+    source_bank      VARCHAR(16)    NOT NULL DEFAULT '',
+    destination_bank VARCHAR(16)    NOT NULL DEFAULT '',
+    bank_relation    VARCHAR(8)     NOT NULL DEFAULT '',
+    segment          VARCHAR(16)    NOT NULL DEFAULT '',
+    min_amount       DECIMAL(20, 2) NULL,
+    max_amount       DECIMAL(20, 2) NULL,
+    fee_type         VARCHAR(16)    NOT NULL,
+    flat_fee         DECIMAL(20, 2) NOT NULL DEFAULT 0,
+    rate_bps         BIGINT         NOT NULL DEFAULT 0,
+    min_fee          DECIMAL(20, 2) NOT NULL DEFAULT 0,
+    max_fee          DECIMAL(20, 2) NOT NULL DEFAULT 0,
+    free_quota       BIGINT         NOT NULL DEFAULT 0,
+    priority         INT            NOT NULL DEFAULT 0,
+    effective_from   DATETIME(3)    NOT NULL,
+    effective_to     DATETIME(3)    NULL,
+    created_at       DATETIME(3)    NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_fee_rules_version (rule_key, version),
+    KEY idx_fee_rules_effective (transaction_type, effective_from, effective_to)
+);
+
+ALTER TABLE banking.accounts
+    ADD COLUMN segment VARCHAR(16) NOT NULL DEFAULT 'retail';
+
+-- channel and fee_rule_id say how a transaction was priced, fee and total_amount are from 003
+ALTER TABLE banking.transactions
+    ADD COLUMN channel     VARCHAR(16) NOT NULL DEFAULT 'atm',
+    ADD COLUMN fee_rule_id BIGINT      NULL;
+
+ALTER TABLE banking.transactions_history
+    ADD COLUMN channel     VARCHAR(16) NOT NULL DEFAULT 'atm',
+    ADD COLUMN fee_rule_id BIGINT      NULL;
@@ -0,0 +1,18 @@
+-- Limits at the default, product (segment) and account level. UpsertLimit relies on the unique
+-- key, and the old limits are copied over from Redis with `go run ./cmd/limits seed`.
+CREATE TABLE IF NOT EXISTS banking.limits (
+    id               BIGINT         NOT NULL AUTO_INCREMENT,
+    scope            ENUM('default', 'product', 'account') NOT NULL,
+    scope_ref        VARCHAR(32)    NOT NULL DEFAULT '',
+    transaction_type ENUM('withdraw', 'deposit', 'transfer') NOT NULL,
+    kind             VARCHAR(16)    NOT NULL,
+    amount           DECIMAL(20, 2) NULL,
+    count            BIGINT         NULL,
+    updated_at       DATETIME(3)    NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_limits_level (scope, scope_ref, transaction_type, kind)
+);
+
+-- usage is counted from the transactions of the account in the window
+ALTER TABLE banking.transactions
+    ADD KEY idx_transactions_usage (account, type, created_at);
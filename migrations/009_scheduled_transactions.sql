@@ -0,0 +1,46 @@
+-- Recurring schedules. A schedule is active until its recurrence ends, and every run it makes is an
+-- execution with its own outcome.
+ALTER TABLE banking.scheduled_transactions
+    MODIFY COLUMN status          VARCHAR(16)  NOT NULL DEFAULT 'active',
+    ADD COLUMN frequency          VARCHAR(16)  NOT NULL DEFAULT 'once' AFTER status,
+    ADD COLUMN day_of_month       INT          NOT NULL DEFAULT 0 AFTER frequency,
+    ADD COLUMN rrule              VARCHAR(255) NOT NULL DEFAULT '' AFTER day_of_month,
+    ADD COLUMN timezone           VARCHAR(64)  NOT NULL DEFAULT 'Asia/Bangkok' AFTER rrule,
+    ADD COLUMN next_execution_at  DATETIME     NULL AFTER scheduled_execution_at,
+    ADD COLUMN end_at             DATETIME     NULL AFTER next_execution_at,
+    ADD COLUMN max_occurrences    BIGINT       NOT NULL DEFAULT 0 AFTER end_at,
+    ADD COLUMN occurrences        BIGINT       NOT NULL DEFAULT 0 AFTER max_occurrences,
+    ADD KEY idx_scheduled_transactions_due (status, next_execution_at),
+    ADD KEY idx_scheduled_transactions_account (account);
+
+-- The old poller only picked up a row in the exact 5 minute slot it was due in, so every
+-- 'unprocessed' row it missed was never paid. They become one-off schedules due at their old
+-- time, overdue ones included, and the poller pays them on its next run.
+UPDATE banking.scheduled_transactions
+SET status = 'active', frequency = 'once', next_execution_at = scheduled_execution_at, updated_at = NOW()
+WHERE status = 'unprocessed';
+
+UPDATE banking.scheduled_transactions
+SET status = 'completed', frequency = 'once', occurrences = 1, updated_at = NOW()
+WHERE status = 'processed';
+
+-- A 'processing' row was handed to Kafka and may or may not have been paid. It is not run again,
+-- check the sender's transactions around scheduled_execution_at before paying it by hand.
+UPDATE banking.scheduled_transactions
+SET status = 'cancelled', frequency = 'once', updated_at = NOW()
+WHERE status = 'processing';
+
+CREATE TABLE IF NOT EXISTS banking.scheduled_transaction_executions (
+    id             BIGINT       NOT NULL AUTO_INCREMENT,
+    schedule_id    BIGINT       NOT NULL,
+    scheduled_for  DATETIME     NOT NULL,
+    transaction_id BIGINT       NULL,
+    status         VARCHAR(16)  NOT NULL,
+    failure_code   INT          NULL,
+    failure_reason VARCHAR(255) NULL,
+    created_at     DATETIME     NOT NULL,
+    executed_at    DATETIME     NULL,
+    PRIMARY KEY (id),
+    KEY idx_scheduled_transaction_executions_schedule (schedule_id, scheduled_for),
+    CONSTRAINT fk_scheduled_transaction_executions_schedule FOREIGN KEY (schedule_id) REFERENCES banking.scheduled_transactions (id)
+);
@@ -0,0 +1,23 @@
+-- Executions are leased by one worker at a time and retried with a backoff. There is at most one
+-- execution per occurrence, CreateScheduledExecution relies on the unique key to queue a run once.
+--
+-- Adding the key fails while an occurrence has more than one execution, list them first with
+--   SELECT schedule_id, scheduled_for, COUNT(*) FROM banking.scheduled_transaction_executions
+--   GROUP BY schedule_id, scheduled_for HAVING COUNT(*) > 1;
+ALTER TABLE banking.scheduled_transaction_executions
+    ADD COLUMN attempts         INT      NOT NULL DEFAULT 0 AFTER status,
+    ADD COLUMN next_attempt_at  DATETIME NULL AFTER attempts,
+    ADD COLUMN lease_expires_at DATETIME NULL AFTER next_attempt_at,
+    DROP KEY idx_scheduled_transaction_executions_schedule,
+    ADD UNIQUE KEY uq_scheduled_transaction_executions_occurrence (schedule_id, scheduled_for),
+    ADD KEY idx_scheduled_transaction_executions_due (status, next_attempt_at),
+    ADD KEY idx_scheduled_transaction_executions_lease (status, lease_expires_at);
+
+-- runs queued before the leases are due straight away, their messages on scheduled_transactions
+-- have the same format and are still taken up by the consumer
+UPDATE banking.scheduled_transaction_executions
+SET next_attempt_at = scheduled_for
+WHERE next_attempt_at IS NULL;
+
+ALTER TABLE banking.scheduled_transaction_executions
+    MODIFY COLUMN next_attempt_at DATETIME NOT NULL;
@@ -0,0 +1,20 @@
+-- Kafka messages written in the unit of work of the change they announce and published by the
+-- relay. A relay claims due events by moving next_attempt_at to the end of its lease; an event
+-- that failed max_attempts times or cannot be encoded is parked until someone clears parked_at.
+-- Published events are deleted after the configured retention.
+CREATE TABLE IF NOT EXISTS banking.outbox_events (
+    id              BIGINT       NOT NULL AUTO_INCREMENT,
+    topic           VARCHAR(255) NOT NULL,
+    event_key       VARCHAR(64)  NOT NULL,
+    payload         MEDIUMTEXT   NOT NULL,
+    attempts        INT          NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME(6)  NOT NULL,
+    last_error      TEXT         NOT NULL,
+    created_at      DATETIME(6)  NOT NULL,
+    published_at    DATETIME(6)  NULL,
+    parked_at       DATETIME(6)  NULL,
+    PRIMARY KEY (id),
+    KEY idx_outbox_events_due (published_at, parked_at, next_attempt_at),
+    KEY idx_outbox_events_key (event_key, id),
+    KEY idx_outbox_events_published (published_at)
+);
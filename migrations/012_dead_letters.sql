@@ -0,0 +1,25 @@
+-- Messages that failed every retry, kept from the dead letter topics until an admin replays or
+-- discards them. The unique key keeps a message read again after a rebalance to one row. The
+-- payloads of redacted topics, e.g. the OTPs of sms, are not kept and cannot be replayed.
+CREATE TABLE IF NOT EXISTS banking.dead_letters (
+    id                 BIGINT       NOT NULL AUTO_INCREMENT,
+    topic              VARCHAR(255) NOT NULL,
+    dlq_partition      INT          NOT NULL,
+    dlq_offset         BIGINT       NOT NULL,
+    original_partition INT          NOT NULL DEFAULT 0,
+    original_offset    BIGINT       NOT NULL DEFAULT 0,
+    message_key        VARCHAR(255) NOT NULL DEFAULT '',
+    payload            MEDIUMBLOB   NULL,
+    redacted           BOOLEAN      NOT NULL DEFAULT FALSE,
+    headers            JSON         NOT NULL,
+    error              TEXT         NOT NULL,
+    attempts           INT          NOT NULL DEFAULT 0,
+    status             ENUM('pending', 'replaying', 'replayed', 'discarded') NOT NULL DEFAULT 'pending',
+    failed_at          DATETIME(6)  NOT NULL,
+    replayed_at        DATETIME(6)  NULL,
+    created_at         DATETIME(6)  NOT NULL,
+    updated_at         DATETIME(6)  NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_dead_letters_message (topic, dlq_partition, dlq_offset),
+    KEY idx_dead_letters_status (status, topic, failed_at)
+);
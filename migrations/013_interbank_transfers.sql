@@ -0,0 +1,30 @@
+-- The clearing side of outgoing transfers to other banks, one row per pacs.008. The pacs.002
+-- reports are matched on end_to_end_id; transfers still 'sent' after clearing.resend_after are
+-- sent again and those still 'sent' after clearing.return_after are returned to the sender.
+-- credited_at is set once a receiver held here was paid, so a pacs.008 sent twice pays once.
+CREATE TABLE IF NOT EXISTS banking.interbank_transfers (
+    id               BIGINT         NOT NULL AUTO_INCREMENT,
+    transaction_id   BIGINT         NOT NULL,
+    message_id       VARCHAR(35)    NOT NULL,
+    end_to_end_id    VARCHAR(35)    NOT NULL,
+    debtor_account   VARCHAR(32)    NOT NULL,
+    debtor_bank      VARCHAR(16)    NOT NULL,
+    creditor_account VARCHAR(32)    NOT NULL,
+    creditor_bank    VARCHAR(16)    NOT NULL,
+    amount           DECIMAL(20, 2) NOT NULL,
+    status           ENUM('sent', 'settled', 'rejected') NOT NULL DEFAULT 'sent',
+    reason_code      VARCHAR(4)     NULL,
+    reason_text      VARCHAR(255)   NULL,
+    sent_at          DATETIME(6)    NOT NULL,
+    last_sent_at     DATETIME(6)    NOT NULL,
+    settled_at       DATETIME(6)    NULL,
+    credited_at      DATETIME(6)    NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_interbank_transfers_transaction (transaction_id),
+    UNIQUE KEY uq_interbank_transfers_end_to_end (end_to_end_id),
+    KEY idx_interbank_transfers_unreported (status, last_sent_at)
+);
+
+-- documents for the clearing house are queued with their content type and sent as they are
+ALTER TABLE banking.outbox_events
+    ADD COLUMN content_type VARCHAR(64) NOT NULL DEFAULT '' AFTER event_key;
@@ -0,0 +1,16 @@
+-- PromptPay proxies, each phone, national ID or e-wallet ID points to one account. The unique
+-- key is what turns a second registration of the same proxy into ErrProxyTaken. Only phone
+-- proxies are registered for now; the other types are kept for proxies set up elsewhere.
+CREATE TABLE IF NOT EXISTS banking.proxies (
+    id          BIGINT      NOT NULL AUTO_INCREMENT,
+    proxy_type  ENUM('phone', 'national_id', 'ewallet') NOT NULL,
+    proxy_value VARCHAR(15) NOT NULL,
+    account_no  VARCHAR(32) NOT NULL,
+    uuid        VARCHAR(64) NOT NULL,
+    created_at  DATETIME(3) NOT NULL,
+    updated_at  DATETIME(3) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_proxies_proxy (proxy_type, proxy_value),
+    KEY idx_proxies_uuid (uuid),
+    KEY idx_proxies_account (account_no)
+);
@@ -0,0 +1,24 @@
+-- Cardless withdrawals started on the app and collected at an ATM with reference and code. Only
+-- a bcrypt hash of the code is kept. A 'pending' row holds `hold` on the account until
+-- expires_at, checkFunds sums these holds; the poller marks rows past expires_at 'expired'.
+CREATE TABLE IF NOT EXISTS banking.cardless_withdrawals (
+    id             BIGINT         NOT NULL AUTO_INCREMENT,
+    reference      VARCHAR(10)    NOT NULL,
+    account_no     VARCHAR(32)    NOT NULL,
+    uuid           VARCHAR(64)    NOT NULL,
+    amount         DECIMAL(20, 2) NOT NULL,
+    hold           DECIMAL(20, 2) NOT NULL,
+    code_hash      VARCHAR(72)    NOT NULL,
+    attempts       INT            NOT NULL DEFAULT 0,
+    status         ENUM('pending', 'redeemed', 'expired', 'blocked') NOT NULL DEFAULT 'pending',
+    expires_at     DATETIME(6)    NOT NULL,
+    transaction_id BIGINT         NULL,
+    terminal_id    VARCHAR(32)    NULL,
+    redeemed_at    DATETIME(6)    NULL,
+    created_at     DATETIME(6)    NOT NULL,
+    updated_at     DATETIME(6)    NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_cardless_withdrawals_reference (reference),
+    KEY idx_cardless_withdrawals_held (account_no, status, expires_at),
+    KEY idx_cardless_withdrawals_expiry (status, expires_at)
+);
@@ -0,0 +1,40 @@
+-- The ATM terminal registry. denominations is the comma separated list of banknotes in baht the
+-- terminal pays out; cassettes with other notes are left alone when a dispense is planned.
+CREATE TABLE IF NOT EXISTS banking.terminals (
+    id                VARCHAR(32)  NOT NULL,
+    location          VARCHAR(255) NOT NULL DEFAULT '',
+    status            ENUM('online', 'offline', 'out_of_service') NOT NULL DEFAULT 'offline',
+    denominations     VARCHAR(64)  NOT NULL,
+    dispense_strategy ENUM('minimal_notes', 'preserve_small_notes') NOT NULL DEFAULT 'minimal_notes',
+    created_at        DATETIME(6)  NOT NULL,
+    updated_at        DATETIME(6)  NOT NULL,
+    PRIMARY KEY (id)
+);
+
+-- One row per cassette slot. Dispensing locks the cassettes of a terminal FOR UPDATE in the unit
+-- of work that debits the account, so two withdrawals can not take the same notes.
+CREATE TABLE IF NOT EXISTS banking.terminal_cassettes (
+    id           BIGINT      NOT NULL AUTO_INCREMENT,
+    terminal_id  VARCHAR(32) NOT NULL,
+    position     INT         NOT NULL,
+    denomination INT         NOT NULL,
+    note_count   INT         NOT NULL DEFAULT 0,
+    updated_at   DATETIME(6) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_terminal_cassettes_slot (terminal_id, position),
+    CONSTRAINT fk_terminal_cassettes_terminal FOREIGN KEY (terminal_id) REFERENCES banking.terminals (id),
+    CONSTRAINT chk_terminal_cassettes_count CHECK (note_count >= 0)
+);
+
+-- The notes paid out for each withdrawal, notes is the JSON of the dispense plan
+CREATE TABLE IF NOT EXISTS banking.terminal_dispenses (
+    id             BIGINT         NOT NULL AUTO_INCREMENT,
+    terminal_id    VARCHAR(32)    NOT NULL,
+    transaction_id BIGINT         NOT NULL,
+    amount         DECIMAL(20, 2) NOT NULL,
+    notes          JSON           NOT NULL,
+    created_at     DATETIME(6)    NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_terminal_dispenses_transaction (transaction_id),
+    KEY idx_terminal_dispenses_terminal (terminal_id, created_at)
+);
@@ -0,0 +1,40 @@
+-- A low cash alert goes out when the cash in the cassettes drops under low_cash_threshold, NULL
+-- turns the alert off
+ALTER TABLE banking.terminals
+    ADD COLUMN low_cash_threshold DECIMAL(20, 2) NULL AFTER dispense_strategy;
+
+-- Every change to the notes in a terminal, note_count is signed with notes going in counting up.
+-- position 0 is the deposit bin. A balancing covers the movements up to its last_movement_id.
+CREATE TABLE IF NOT EXISTS banking.terminal_cash_movements (
+    id             BIGINT      NOT NULL AUTO_INCREMENT,
+    terminal_id    VARCHAR(32) NOT NULL,
+    kind           ENUM('replenishment', 'pickup', 'dispense', 'deposit', 'adjustment', 'correction') NOT NULL,
+    position       INT         NOT NULL,
+    denomination   INT         NOT NULL,
+    note_count     INT         NOT NULL,
+    transaction_id BIGINT      NULL,
+    operator       VARCHAR(64) NULL,
+    created_at     DATETIME(6) NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_terminal_cash_movements_terminal (terminal_id, id),
+    KEY idx_terminal_cash_movements_position (terminal_id, position, denomination),
+    CONSTRAINT fk_terminal_cash_movements_terminal FOREIGN KEY (terminal_id) REFERENCES banking.terminals (id)
+);
+
+-- The end of shift balancings, denominations is the JSON of the balance of each denomination
+CREATE TABLE IF NOT EXISTS banking.terminal_balancings (
+    id               BIGINT         NOT NULL AUTO_INCREMENT,
+    terminal_id      VARCHAR(32)    NOT NULL,
+    operator         VARCHAR(64)    NOT NULL,
+    period_start     DATETIME(6)    NULL,
+    last_movement_id BIGINT         NOT NULL,
+    denominations    JSON           NOT NULL,
+    expected         DECIMAL(20, 2) NOT NULL,
+    counted          DECIMAL(20, 2) NOT NULL,
+    discrepancy      DECIMAL(20, 2) NOT NULL,
+    balanced         BOOLEAN        NOT NULL,
+    created_at       DATETIME(6)    NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_terminal_balancings_terminal (terminal_id, id),
+    CONSTRAINT fk_terminal_balancings_terminal FOREIGN KEY (terminal_id) REFERENCES banking.terminals (id)
+);
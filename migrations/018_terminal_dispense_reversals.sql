@@ -0,0 +1,7 @@
+-- A reversed withdrawal puts the notes it paid out back into the cassettes they came from, with a
+-- reversal movement. reversal_id is the reversal that did, NULL while the notes are paid out.
+ALTER TABLE banking.terminal_dispenses
+    ADD COLUMN reversal_id BIGINT NULL AFTER notes;
+
+ALTER TABLE banking.terminal_cash_movements
+    MODIFY COLUMN kind ENUM('replenishment', 'pickup', 'dispense', 'deposit', 'adjustment', 'correction', 'reversal') NOT NULL;